@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// batchResult is how one language's build went, for the summary.
+type batchResult struct {
+	name                       string
+	pages, duplicates, skipped int
+	bytes                      int64
+	took                       time.Duration
+	err                        error
+}
+
+// batch builds each of the languages in the config file into its own output
+// directory in one run. The builds go side by side and share -workers
+// between them, so a small wiki doesn't wait behind a large one.
+func batch(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	configFile := fs.String("config", "", "The JSON config file listing the languages to build.")
+	workers := fs.Int("workers", runtime.NumCPU(), "How many parse scripts run at once, shared by all of the languages.")
+	only := fs.String("only", "", "Only build these languages, e.g. en,simple.")
+	fs.Parse(args)
+
+	if *configFile == "" {
+		log.Fatal("batch requires -config")
+	}
+	if *workers < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+	config, err := xml.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	languages := config.Languages
+	if *only != "" {
+		languages = nil
+		for _, name := range strings.Split(*only, ",") {
+			found := false
+			for _, l := range config.Languages {
+				if l.Name == name {
+					languages = append(languages, l)
+					found = true
+				}
+			}
+			if !found {
+				log.Fatalf("-only: %s isn't in %s", name, *configFile)
+			}
+		}
+	}
+	if len(languages) == 0 {
+		log.Fatalf("no languages in %s", *configFile)
+	}
+	log.Println(buildInfo())
+
+	// Check everything up front, so a bad language doesn't stop the batch
+	// after the others have started
+	workersFor := make([]*xml.Worker, len(languages))
+	for i, l := range languages {
+		w, err := newLanguageWorker(config, l, *workers)
+		if err != nil {
+			log.Fatalf("language %s: %v", l.Name, err)
+		}
+		workersFor[i] = w
+	}
+
+	pool := xml.NewPool(*workers)
+	results := make([]batchResult, len(languages))
+	var wg sync.WaitGroup
+	for i, w := range workersFor {
+		wg.Add(1)
+		go func(i int, w *xml.Worker) {
+			defer wg.Done()
+			name := languages[i].Name
+			log.Printf("language %s: building into %s", name, languages[i].OutDir)
+
+			start := time.Now()
+			w.Pool = pool
+			err := w.Start()
+
+			r := batchResult{name: name, took: time.Since(start).Round(time.Second), err: err}
+			r.pages, r.duplicates, r.skipped = w.Read()
+			if fi, err := os.Stat(w.OutputFile); err == nil {
+				r.bytes = fi.Size()
+			}
+			results[i] = r
+			if err != nil {
+				log.Printf("language %s: failed after %s: %v", name, r.took, err)
+				return
+			}
+			log.Printf("language %s: done in %s", name, r.took)
+		}(i, w)
+	}
+	wg.Wait()
+
+	var total batchResult
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+		log.Printf("%-10s %8d pages %6d duplicates %6d skipped %12d bytes in %s", r.name, r.pages, r.duplicates, r.skipped, r.bytes, r.took)
+		total.pages += r.pages
+		total.duplicates += r.duplicates
+		total.skipped += r.skipped
+		total.bytes += r.bytes
+		if r.took > total.took {
+			total.took = r.took
+		}
+	}
+	log.Printf("%-10s %8d pages %6d duplicates %6d skipped %12d bytes in %s", "all", total.pages, total.duplicates, total.skipped, total.bytes, total.took)
+	if failed > 0 {
+		log.Fatalf("%d of %d languages failed", failed, len(results))
+	}
+}
+
+// newLanguageWorker sets up the build of one language with its settings,
+// writing into its output directory.
+func newLanguageWorker(config *xml.Config, l xml.LanguageConfig, workers int) (*xml.Worker, error) {
+	in := inputList(l.Inputs)
+	inputs, err := in.files()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(l.OutDir, 0755); err != nil {
+		return nil, err
+	}
+
+	script := l.Script
+	if script == "" {
+		script = defaultScript(inputs[0])
+	}
+	out := func(name string) string {
+		return filepath.Join(l.OutDir, name)
+	}
+
+	w := xml.NewWorker(inputs[0], out("pages.xml"), script, workers)
+	w.InputFiles = inputs
+	w.Config = config.Language(l)
+	w.Provenance = xml.NewProvenance(inputs, os.Args[1:], buildInfo())
+	w.DecodeWorkers = 1
+	w.SectionParagraphs = 1
+	if l.Disambig != "" {
+		w.DisambigPolicy = l.Disambig
+	}
+	if w.DisambigPolicy == xml.DisambigSeparate {
+		w.DisambigFile = out("disambig.xml")
+	}
+	if l.Encoding != "" {
+		w.Encoding = l.Encoding
+	}
+	w.MaxArticleBytes = l.MaxArticleBytes
+
+	if l.Index {
+		w.IndexFile = out("pages.idx")
+	}
+	if l.Categories {
+		w.CategoryFile = out("categories.tsv")
+	}
+	if l.Links {
+		w.LinkFile = out("links.tsv")
+	}
+	if l.Stats {
+		s, err := xml.NewStatsSink(out("stats.json"), "", nil)
+		if err != nil {
+			return nil, err
+		}
+		s.Version = buildInfo()
+		s.Provenance = w.Provenance
+		w.Sinks = append(w.Sinks, s)
+	}
+	return w, nil
+}
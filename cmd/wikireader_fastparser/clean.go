@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// clean cleans the wikitext on stdin to stdout as a page's text would be in
+// a run, so it can go in a shell pipeline or be tried on a single article.
+func clean(args []string) {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	cleaner := cleanerFlags(fs)
+	title := fs.String("title", "", "The title of the page the text is from, for the script and service.")
+	ns := fs.String("ns", "0", "The namespace of the page the text is from.")
+	fs.Parse(args)
+
+	text, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cleaned, err := cleaner().CleanText(*title, *ns, string(text))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stdout.WriteString(cleaned); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseWhitespace parses -whitespace, exiting if it's invalid.
+func parseWhitespace(s string) *xml.Whitespace {
+	if s == "" {
+		return nil
+	}
+	ws, err := xml.ParseWhitespace(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ws
+}
+
+// cleanerFlags adds the flags for cleaning text outside of a run to fs. The
+// function returned checks them, once they're parsed, and returns a worker
+// cleaning with them. See Worker.CleanText.
+func cleanerFlags(fs *flag.FlagSet) func() *xml.Worker {
+	script := fs.String("script", path.Join("scripts", "parse_xml"), "The parse script.")
+	var scriptArgs, scriptEnv stringList
+	fs.Var(&scriptArgs, "script-arg", "An argument for the parse script. {title}, {ns}, {id} and {revision} are replaced as in a run. Can be repeated.")
+	fs.Var(&scriptEnv, "script-env", "An environment variable for the parse script as NAME=value. Can be repeated.")
+	scriptPrefix := fs.String("script-prefix", "", "Run the parse script with this command, e.g. \"venv/bin/python\".")
+	scriptRetries := fs.Int("script-retries", 0, "How many times to rerun the script when it fails.")
+	cleanURL := fs.String("clean-url", "", "Clean the text by POSTing it to this local HTTP service instead of running -script.")
+	cleanTimeout := fs.Duration("clean-timeout", 30*time.Second, "How long a request to -clean-url may take.")
+	encoding := fs.String("encoding", xml.EncodingReplace, "How to fix invalid UTF-8, BOMs and control characters: replace, drop or off.")
+	whitespace := fs.String("whitespace", "", "Normalize the whitespace of the cleaned text: crlf, trim-trailing, collapse-blank or all, separated by commas.")
+	maxArticleBytes := fs.Int("max-article-bytes", 0, "Summarize text longer than this many bytes, 0 to keep it whole.")
+	sectionParagraphs := fs.Int("section-paragraphs", 1, "Paragraphs to keep per section when summarizing.")
+
+	return func() *xml.Worker {
+		if err := xml.ValidEncodingMode(*encoding); err != nil {
+			log.Fatal(err)
+		}
+		if *scriptRetries < 0 {
+			log.Fatal("-script-retries can't be negative")
+		}
+		for _, env := range scriptEnv {
+			if !strings.Contains(env, "=") {
+				log.Fatalf("-script-env must be NAME=value: %s", env)
+			}
+		}
+
+		w := xml.NewWorker("", "", *script, 1)
+		w.ScriptPrefix = strings.Fields(*scriptPrefix)
+		w.ScriptArgs = scriptArgs
+		w.ScriptEnv = scriptEnv
+		w.ScriptRetries = *scriptRetries
+		if *cleanURL != "" {
+			var err error
+			w.CleanService, err = xml.NewCleanService(*cleanURL, 1, *cleanTimeout)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		w.Encoding = *encoding
+		w.Whitespace = parseWhitespace(*whitespace)
+		w.MaxArticleBytes = *maxArticleBytes
+		w.SectionParagraphs = *sectionParagraphs
+		return w
+	}
+}
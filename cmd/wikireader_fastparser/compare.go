@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// compare checks that two processed outputs have the same pages with the
+// same text, within a tolerance, e.g. one cleaned by the parse script and
+// one by a -clean-url service before switching to it. It exits 1 if they don't.
+func compare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	oldPath := fs.String("old", "", "The output to compare against, held in memory as hashes.")
+	newPath := fs.String("new", "", "The output being checked.")
+	normalize := fs.Bool("normalize", true, "Collapse runs of whitespace before comparing the text.")
+	maxDistance := fs.Int("max-distance", 0, "How many bits the SimHashes of a page's texts may differ by when they aren't the same. 3 lets through small edits.")
+	show := fs.Int("show", verifyShown, "How many of each kind of difference to list.")
+	fs.Parse(args)
+
+	if *oldPath == "" || *newPath == "" {
+		log.Fatal("compare requires -old and -new")
+	}
+
+	result, err := xml.CompareOutputs(*oldPath, *newPath, xml.CompareOptions{Normalize: *normalize, MaxDistance: *maxDistance})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	showTitles := func(what string, titles []string) {
+		for i, title := range titles {
+			if i == *show {
+				log.Printf("... and %d more", len(titles)-i)
+				break
+			}
+			log.Printf("%s: %s", what, title)
+		}
+	}
+	showTitles("only in -old", result.Missing)
+	showTitles("only in -new", result.Extra)
+	for i, m := range result.Mismatched {
+		if i == *show {
+			log.Printf("... and %d more", len(result.Mismatched)-i)
+			break
+		}
+		log.Printf("differs: %s (%d bits)", m.Title, m.Distance)
+	}
+
+	log.Printf("%d pages in both: %d identical, %d within %d bits, %d differ; %d only in -old, %d only in -new",
+		result.Pages, result.Identical, result.Similar, *maxDistance, len(result.Mismatched), len(result.Missing), len(result.Extra))
+	if !result.Match() {
+		log.Print("compare failed, see diff -unified for the changes")
+		os.Exit(1)
+	}
+}
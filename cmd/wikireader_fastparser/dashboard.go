@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+const (
+	// dashboardRefresh is how often the dashboard is redrawn
+	dashboardRefresh = 500 * time.Millisecond
+	// dashboardProblems is how many of the latest problems are shown
+	dashboardProblems = 5
+	// dashboardRates is how many refreshes the sparkline covers
+	dashboardRates = 40
+	// dashboardWidth is where long lines are cut off
+	dashboardWidth = 100
+)
+
+// sparks are the bars of the throughput sparkline, lowest first.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// isTerminal reports whether f is an interactive terminal that can be
+// drawn on.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// dashboard draws the progress of a run over itself in the terminal in place
+// of the log. The log lines reporting problems are kept in a ticker, and the
+// rest are dropped.
+type dashboard struct {
+	progress *xml.Progress
+	out      *os.File
+	start    time.Time
+
+	mu       sync.Mutex
+	problems []string
+	failures int
+
+	last     xml.ProgressSnapshot
+	lastTime time.Time
+	rates    []float64
+	lines    int
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// startDashboard takes over the log and draws the progress on out until
+// stop is called.
+func startDashboard(progress *xml.Progress, out *os.File) *dashboard {
+	d := &dashboard{
+		progress: progress,
+		out:      out,
+		start:    time.Now(),
+		lastTime: time.Now(),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	log.SetOutput(d)
+	go d.run()
+	return d
+}
+
+// stop draws the final state and hands the log back to the terminal.
+func (d *dashboard) stop() {
+	close(d.done)
+	<-d.stopped
+	log.SetOutput(d.out)
+}
+
+func (d *dashboard) run() {
+	defer close(d.stopped)
+	t := time.NewTicker(dashboardRefresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			d.draw()
+		case <-d.done:
+			d.draw()
+			return
+		}
+	}
+}
+
+// Write implements io.Writer for the log, keeping the lines that report
+// problems.
+func (d *dashboard) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		if !isProblem(line) {
+			continue
+		}
+		d.failures++
+		d.problems = append(d.problems, line)
+		if len(d.problems) > dashboardProblems {
+			d.problems = d.problems[1:]
+		}
+	}
+	return len(b), nil
+}
+
+// isProblem reports whether a log line is about something going wrong
+// rather than the usual progress.
+func isProblem(line string) bool {
+	line = strings.ToLower(line)
+	for _, word := range []string{"error", "skipping", "nonconforming", "stopped"} {
+		if strings.Contains(line, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// draw redraws the dashboard over the last one.
+func (d *dashboard) draw() {
+	s := d.progress.Snapshot()
+	now := time.Now()
+	rate := 0.0
+	if elapsed := now.Sub(d.lastTime).Seconds(); elapsed > 0 {
+		rate = float64(s.Written-d.last.Written) / elapsed
+		d.rates = append(d.rates, rate)
+		if len(d.rates) > dashboardRates {
+			d.rates = d.rates[1:]
+		}
+	}
+	d.last, d.lastTime = s, now
+
+	var lines []string
+	if s.InputBytes > 0 {
+		lines = append(lines, fmt.Sprintf("read     %s  %s of %s", bar(s.BytesRead, s.InputBytes), humanBytes(s.BytesRead), humanBytes(s.InputBytes)))
+	} else {
+		lines = append(lines, fmt.Sprintf("read     %s", humanBytes(s.BytesRead)))
+	}
+	lines = append(lines,
+		fmt.Sprintf("cleaned  %s  %d of %d pages, %d failed", bar(s.Cleaned+s.Failed, s.Sent), s.Cleaned, s.Sent, s.Failed),
+		fmt.Sprintf("written  %s  %d of %d pages, %d dropped", bar(s.Written+s.Dropped, s.Cleaned), s.Written, s.Cleaned, s.Dropped),
+		fmt.Sprintf("rate     %s  %.0f pages/s", sparkline(d.rates), rate),
+		fmt.Sprintf("elapsed  %s", now.Sub(d.start).Round(time.Second)),
+	)
+
+	d.mu.Lock()
+	lines = append(lines, fmt.Sprintf("problems %d", d.failures))
+	for _, problem := range d.problems {
+		lines = append(lines, "  "+problem)
+	}
+	d.mu.Unlock()
+
+	var b strings.Builder
+	if d.lines > 0 {
+		// Back up over the last drawing, which may have been taller
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines)
+	}
+	for _, line := range lines {
+		if r := []rune(line); len(r) > dashboardWidth {
+			line = string(r[:dashboardWidth])
+		}
+		b.WriteString("\x1b[2K" + line + "\n")
+	}
+	for i := len(lines); i < d.lines; i++ {
+		b.WriteString("\x1b[2K\n")
+	}
+	if len(lines) > d.lines {
+		d.lines = len(lines)
+	}
+	d.out.WriteString(b.String())
+}
+
+// bar draws a progress bar of done out of total.
+func bar(done, total int64) string {
+	const width = 30
+	frac := 0.0
+	if total > 0 {
+		frac = float64(done) / float64(total)
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	n := int(frac * width)
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", n), strings.Repeat("-", width-n), 100*frac)
+}
+
+// sparkline draws the rates relative to the highest of them.
+func sparkline(rates []float64) string {
+	max := 0.0
+	for _, r := range rates {
+		if r > max {
+			max = r
+		}
+	}
+	var b strings.Builder
+	for _, r := range rates {
+		i := 0
+		if max > 0 {
+			i = int(r / max * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// humanBytes formats a size in bytes with a binary unit.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
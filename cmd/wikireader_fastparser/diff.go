@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// diff reports the pages added, removed and changed between two dumps or
+// processed outputs.
+func diff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	oldPath := fs.String("old", "", "The earlier dump or processed output.")
+	newPath := fs.String("new", "", "The later dump or processed output.")
+	out := fs.String("out", "", "The report to write (added, removed or changed, title, old id, new id).")
+	unified := fs.String("unified", "", "Also write unified diffs of the changed pages' text to this file. Keeps the whole -old text in memory.")
+	context := fs.Int("context", 3, "Lines of context in -unified diffs.")
+	fs.Parse(args)
+
+	if *oldPath == "" || *newPath == "" || *out == "" {
+		log.Fatal("diff requires -old, -new and -out")
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+
+	var u *bufio.Writer
+	if *unified != "" {
+		uf, err := os.Create(*unified)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer uf.Close()
+		u = bufio.NewWriter(uf)
+	}
+
+	counts := make(map[string]int)
+	err = xml.DiffDumps(*oldPath, *newPath, u != nil, func(d *xml.PageDiff) error {
+		counts[d.Change]++
+		if _, err := fmt.Fprintf(b, "%s\t%s\t%s\t%s\n", d.Change, d.Title, d.OldID, d.NewID); err != nil {
+			return err
+		}
+		if u != nil && d.Change == xml.DiffChanged {
+			_, err := u.WriteString(xml.UnifiedDiff(d.OldText, d.NewText, "a/"+d.Title, "b/"+d.Title, *context))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := b.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if u != nil {
+		if err := u.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%d added, %d removed, %d changed", counts[xml.DiffAdded], counts[xml.DiffRemoved], counts[xml.DiffChanged])
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// extract decodes the dumps once into a page cache. The cache can then be
+// given as -in to any number of runs with different cleaning options,
+// which skip the XML decode.
+//
+// With -index it instead pulls single pages out of a processed output,
+// reading only those pages.
+func extract(args []string) {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	var in inputList
+	fs.Var(&in, "in", "The input file to extract. Can be repeated or a glob.")
+	out := fs.String("out", "", "The page cache to write, or with -index the document of the pages found.")
+	index := fs.String("index", "", "The offset index of the processed -in, written by -index or merge -index.")
+	var titles, ids stringList
+	fs.Var(&titles, "title", "With -index, a title to extract. Can be repeated.")
+	fs.Var(&ids, "id", "With -index, a page ID to extract. Can be repeated.")
+	titleFile := fs.String("titles", "", "With -index, a file of titles to extract, one per line.")
+	configFile := fs.String("config", "", "An optional JSON config file. Namespaces with the skip transform aren't extracted.")
+	encoding := fs.String("encoding", xml.EncodingReplace, "How to fix invalid UTF-8, BOMs and control characters: replace, drop or off.")
+	disambig := fs.String("disambig", xml.DisambigInclude, "What to do with disambiguation pages: include or exclude.")
+	fs.Parse(args)
+
+	if *out == "" {
+		log.Fatal("extract requires -out")
+	}
+	if *index != "" {
+		if *titleFile != "" {
+			more, err := readLines(*titleFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			titles = append(titles, more...)
+		}
+		extractPages(in, *index, *out, titles, ids)
+		return
+	}
+	if err := xml.ValidEncodingMode(*encoding); err != nil {
+		log.Fatal(err)
+	}
+	if *disambig != xml.DisambigInclude && *disambig != xml.DisambigExclude {
+		log.Fatal("extract -disambig must be include or exclude")
+	}
+
+	var config *xml.Config
+	if *configFile != "" {
+		var err error
+		config, err = xml.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	inputs, err := in.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		log.Fatal("no input files")
+	}
+
+	cache, err := xml.NewCacheSink(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := xml.NewWorker(inputs[0], "", "", 1)
+	w.InputFiles = inputs
+	w.Encoding = *encoding
+	w.DisambigPolicy = *disambig
+	w.Config = config
+	w.Extract = true
+	w.Sinks = []xml.Sink{cache}
+	if err := w.Start(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// extractPages looks up pages in a processed output with its offset index.
+func extractPages(in inputList, index, out string, titles, ids []string) {
+	if len(in) != 1 {
+		log.Fatal("extract -index requires a single -in")
+	}
+	if len(titles) == 0 && len(ids) == 0 {
+		log.Fatal("extract -index requires -title, -titles or -id")
+	}
+
+	pages, missing, err := xml.LookupPages(in[0], index, titles, ids)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range missing {
+		log.Printf("not found: %s", m)
+	}
+	if err := xml.WritePages(out, pages); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("extracted %d pages", len(pages))
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// readLines reads the non-blank lines of a file.
+func readLines(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
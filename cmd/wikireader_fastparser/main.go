@@ -0,0 +1,735 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// commands are the subcommands. Without one we process a dump.
+var commands = map[string]func(args []string){
+	"batch":    batch,
+	"clean":    clean,
+	"compare":  compare,
+	"diff":     diff,
+	"extract":  extract,
+	"merge":    merge,
+	"prune":    prune,
+	"ngrams":   ngrams,
+	"rank":     rank,
+	"repair":   repair,
+	"selftest": selftest,
+	"synonyms": synonyms,
+	"validate": validate,
+	"verify":   verify,
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	showVersion := flag.Bool("version", false, "Print the version of this build and exit.")
+	showDashboard := flag.Bool("dashboard", false, "Show the progress of each stage, the latest problems and the throughput in the terminal instead of the log. Falls back to the log when stderr isn't a terminal.")
+	preset := flag.String("preset", "", "Start from the flags of a preset build: "+strings.Join(presetNames(), ", ")+". Flags given as well override it.")
+	var in inputList
+	flag.Var(&in, "in", "The input file to process. Can be repeated or a glob to process several files as one run. May be an s3:// or gs:// URL and .bz2 or .gz compressed, or a page cache written by extract.")
+	out := flag.String("out", "", "The output file. May be an s3:// or gs:// URL.")
+	format := flag.String("format", "xml", "The output format: xml, parquet, avro (schema in schema/page.avsc) chunks (JSONL for embedding), sql (MySQL for a MediaWiki 1.41+ wiki), tsv (a row of metadata per page) or blob (articles compressed one by one, with -index giving their offsets).")
+	sqlPrefix := flag.String("sql-prefix", "", "The wiki's table prefix ($wgDBprefix) for -format sql.")
+	parquetRowGroup := flag.Int("parquet-row-group", 10000, "Rows per parquet row group.")
+	parquetCompression := flag.String("parquet-compression", xml.ParquetGzip, "Parquet compression: none or gzip.")
+	avroCodec := flag.String("avro-codec", xml.AvroDeflate, "Avro codec: null or deflate.")
+	blobCodec := flag.String("blob-codec", xml.BlobLZ4, "How each article is compressed with -format blob: none, lz4 or deflate.")
+	chunkTokens := flag.Int("chunk-tokens", 256, "Tokens (words) per chunk with -format chunks.")
+	chunkOverlap := flag.Int("chunk-overlap", 32, "Tokens shared by consecutive chunks.")
+	script := flag.String("script", "", "The parse script. Defaults to ../scripts/parse_xml relative to the input.")
+	var alsoOutputs stringList
+	flag.Var(&alsoOutputs, "also", "Also write the pages to this output as format=path, e.g. sql=pages.sql, so one run makes every artifact. Any -format but xml and blob, or tsv for a row of metadata per page. Options after the path, separated by semicolons, pick and cut the pages for that output alone: ns=0,14, title=regexp, no-redirects, lead, max-bytes=N and html=b,i (the HTML tags to keep, see -sanitize-html), as in chunks=abstracts.jsonl;ns=0;lead. Can be repeated.")
+	var scriptArgs, scriptEnv stringList
+	flag.Var(&scriptArgs, "script-arg", "An argument for the parse script, e.g. --lang=en. {title}, {ns}, {id} and {revision} are replaced by the page's. Can be repeated.")
+	flag.Var(&scriptEnv, "script-env", "An environment variable for the parse script as NAME=value, with the same replacements as -script-arg. Can be repeated.")
+	scriptPrefix := flag.String("script-prefix", "", "Run the parse script with this command, e.g. \"venv/bin/python\" or \"conda run -n wiki\".")
+	cleanURL := flag.String("clean-url", "", "Clean pages by POSTing their text to this local HTTP service instead of running -script, e.g. http://localhost:8080/clean. The title, ns and id are added as query parameters, and the response body is the cleaned text.")
+	cleanConcurrency := flag.Int("clean-concurrency", 8, "The most requests made to -clean-url at once.")
+	cleanTimeout := flag.Duration("clean-timeout", 30*time.Second, "How long a single request to -clean-url may take.")
+	slowThreshold := flag.Duration("slow-threshold", 0, "Move pages still being cleaned after this long to a slow lane, so they don't hold up the workers. 0 to disable.")
+	slowSlots := flag.Int("slow-slots", 1, "How many slow pages may be waited for at once.")
+	stallTimeout := flag.Duration("stall-timeout", 0, "Treat going this long without reading anything or finishing a page as a stall, instead of hanging. 0 to disable.")
+	stallPolicy := flag.String("stall-policy", xml.StallAbort, "What to do about a stall: abort (after logging the running scripts and every goroutine's stack) or kill (the scripts running for longer than -stall-timeout, failing their pages, and abort if there are none).")
+	slowPages := flag.String("slow-pages", "", "List the pages that went through the slow lane (id, title, seconds) as TSV in this file.")
+	lint := flag.String("lint", "", "List pages with unbalanced templates or links, unclosed refs or malformed tables (id, title, problems) as TSV in this file.")
+	diagnostics := flag.String("script-diagnostics", "", "List the pages the script wrote to stderr for (id, title, warning or failed, stderr) as TSV in this file.")
+	galleries := flag.String("galleries", xml.GalleryKeep, "What to do with <gallery> and <imagemap> blocks before the script sees them: keep, drop, or captions (replace each with a list of its captions).")
+	imageManifest := flag.String("image-manifest", "", "List the files in galleries and image maps (id, title, file, caption) as TSV in this file.")
+	extensionTags := flag.String("extension-tags", "", "What to do with extension tags like <hiero>, <score>, <timeline> and <mapframe> before the script sees them, separated by commas: tag=keep, strip (with their content) or placeholder (e.g. [score]). default is hiero and score as placeholders and timeline, mapframe and graph stripped, e.g. default,score=strip. Overrides extension_tags in -config.")
+	lintScript := flag.String("lint-script", "", "Clean pages with those syntax problems with this more conservative script instead of -script.")
+	readAhead := flag.Int("read-ahead", 4, "How many 1 MiB blocks of a compressed input to decompress ahead of the parser, 0 to decompress as it goes.")
+	mmap := flag.Bool("mmap", false, "Map local uncompressed inputs into memory instead of reading them, which saves copying and makes the extra passes of -follow-redirects and -title-collisions cheap. Scans the mapping in place with -encoding off.")
+	cleanCache := flag.String("clean-cache", "", "Keep the parse script output for each revision in this directory and reuse it on later runs.")
+	workers := flag.String("workers", "1", "How many worker tasks, or auto to start with one per CPU and adjust to the load.")
+	decodeWorkers := flag.Int("decode-workers", 1, "How many goroutines decode the input XML. More than one splits the input into pages first.")
+	reorderMemory := flag.Int64("reorder-memory", xml.DefaultReorderMemory, "About how many bytes of pages -decode-workers may hold while they wait for a slower one, before spilling them to -spill-dir.")
+	writeWorkers := flag.Int("write-workers", 0, "How many goroutines marshal the output, 0 to do it in the -workers.")
+	maxWorkers := flag.Int("max-workers", 0, "The most workers -workers auto may start. Defaults to four per CPU.")
+	collisions := flag.String("title-collisions", xml.CollisionFirst, "Which page to keep when titles repeat: first, latest (revision), largest (text) or report (none).")
+	collisionReport := flag.String("collision-report", "", "List every page with a repeated title (title, id, revision id, timestamp, bytes, kept or dropped) as TSV in this file.")
+	disambig := flag.String("disambig", xml.DisambigInclude, "What to do with disambiguation pages: include, exclude or separate.")
+	disambigOut := flag.String("disambig-out", "", "The output file for disambiguation pages when using -disambig separate.")
+	configFile := flag.String("config", "", "An optional JSON config file, with the transforms of each namespace, the redactions applied to the cleaned pages and the extension_tags policies.")
+	titleMatch := flag.String("title-match", "", "Only keep pages whose titles match this regular expression. Checked before the pages are decoded, which makes small subsets fast.")
+	skipRedirects := flag.Bool("skip-redirects", false, "Drop redirect pages without decoding them.")
+	idRange := flag.String("id-range", "", "Only keep the pages with IDs in this range, as min-max with either end optional, e.g. 1000000-2000000, checked before pages are decoded. Splits a dump between machines without a separate step.")
+	skipList := flag.String("skip-list", "", "Keep the pages that failed to clean (id, revision sha1, error) in this file, and skip them in later runs until their revision changes.")
+	retrySkipList := flag.Bool("retry-skip-list", false, "Clean the pages on -skip-list again, keeping only those that fail again.")
+	logSkips := flag.Bool("log-skips", false, "Log each page skipped by the filters or as a duplicate, instead of how many were skipped for each reason every minute.")
+	models := flag.String("non-wikitext", xml.ModelPassthrough, "What to do with pages whose content model isn't wikitext, like Lua modules and JSON: passthrough (keep their text uncleaned) or skip.")
+	project := flag.String("project", "", "Adjust the namespaces and cleaning to the project the dump is from: "+strings.Join(xml.ProjectNames(), ", ")+", or auto to tell from the dump.")
+	dictionary := flag.String("dictionary", "", "With -project wiktionary, write each word's pronunciations and definitions by part of speech as JSON lines to this file.")
+	section := flag.String("section", "", "Keep only the level 2 section of each article with this heading, e.g. a language on Wiktionary (English by default with -project wiktionary, all to keep every language).")
+	encoding := flag.String("encoding", xml.EncodingReplace, "How to fix invalid UTF-8, BOMs and control characters: replace, drop or off.")
+	sanitizeHTML := flag.String("sanitize-html", "", "Strip the HTML tags from the cleaned text but these, separated by commas (e.g. b,i,sub,sup), keeping what's inside them. Style, script, gallery and timeline elements go with their content. none strips every tag. Sinks can have their own with the html option of -also.")
+	whitespace := flag.String("whitespace", "", "Normalize the whitespace of the cleaned text: crlf, trim-trailing, collapse-blank or all, separated by commas.")
+	strict := flag.Bool("strict", false, "Check every output page and file against the parts of the export-0.10 schema an import relies on (the page and revision elements, their order and the types of the ids and timestamps) and stop on the first that doesn't conform. Metadata like short descriptions and coordinates, which the schema has no place for, is left out of the xml output.")
+	deadLetter := flag.String("dead-letter", "", "Write the pages the script still fails on after -script-retries to this file as they were read, and with -strict the nonconforming pages instead of stopping.")
+	scriptRetries := flag.Int("script-retries", 2, "How many times to rerun the script on a page when it crashes or fails, before the page is skipped or goes to -dead-letter.")
+	categories := flag.String("categories", "", "Write the category graph (id, title, category) as TSV to this file.")
+	links := flag.String("links", "", "Write the link graph (id, title, target) as TSV to this file.")
+	linkAnchors := flag.Bool("link-anchors", false, "Include the anchor text as a fourth column of -links.")
+	idMap := flag.String("id-map", "", "Give the pages compact sequential IDs, keeping the mapping from MediaWiki IDs in this TSV file so they stay the same in later runs.")
+	raw := flag.Bool("raw", false, "Copy the pages that pass the filters, deduplication and sharding to the xml output byte for byte, without decoding or cleaning them. Much faster, and lossless, for taking a subset of a dump.")
+	deterministic := flag.Bool("deterministic", false, "Make runs over the same inputs with the same flags write byte-identical outputs, so they can be checked by hash: pages are written in input order and the times and random markers in the outputs are fixed. The provenance leaves out the arguments, so the runs can write to different paths.")
+	dedupFile := flag.String("dedup-file", "", "Keep the titles deduplicated against in this TSV file, so later runs over more pieces of a dump skip the titles already written. Inputs read again are dropped from it first.")
+	expectedPages := flag.Int("expected-pages", 0, "Size the dedup set for about this many pages up front, which saves growing it on large dumps.")
+	journal := flag.String("journal", "", "Keep a write-ahead journal of the pages durably written to -out in this file.")
+	resume := flag.Bool("resume", false, "Carry on an interrupted run from its -journal, dropping any torn writes.")
+	index := flag.String("index", "", "Write the offset table of -out (id, title, offset, length) as TSV to this file, for extract -index. With -format blob, the offsets of the articles.")
+	sortedIndex := flag.String("sorted-index", "", "Also write -index sorted by title (ignoring case) to this file, for binary search on the device.")
+	searchKeys := flag.String("search-keys", "", "Sort -sorted-index by search keys made with these transliterations, comma separated, and add the keys as a fifth column, so titles are found by what's typed on the device keyboard: latin (accents and ligatures), greek, cyrillic, or file:path for a TSV of letters and what to type for them.")
+	sortByTitle := flag.Bool("sort-by-title", false, "Write the xml output sorted by title, ignoring case or by -search-keys, instead of in dump order. It's written to -out.unsorted first and sorted at the end with an external sort like -sorted-index.")
+	sortMemory := flag.Int64("sort-memory", xml.DefaultSortMemory, "About how many bytes -sorted-index and -sort-by-title may hold in memory before spilling sorted runs to -spill-dir.")
+	spillDir := flag.String("spill-dir", "", "The directory for the compressed runs -sorted-index, -sort-by-title and the -decode-workers reorder buffer spill, e.g. on fast scratch disk. Defaults to the system's temporary directory.")
+	flag.StringVar(spillDir, "sort-temp", "", "The same as -spill-dir.")
+	checksums := flag.String("checksums", "", "Write SHA-256 checksums of the output to this file.")
+	phoneticIndex := flag.String("phonetic-index", "", "Write the Soundex and Double Metaphone keys of the titles (scheme, key, id, title) as TSV sorted by key to this file, for \"did you mean\" suggestions.")
+	geoIndex := flag.String("geo-index", "", "Write the pages with {{coord}} coordinates (geohash, lat, lon, id, title) as TSV sorted by geohash to this file.")
+	partition := flag.String("partition", "", "Divide pages between shards by title, each with its own -index: letter (a-z, 0-9 and other) or hash:N for N buckets.")
+	split := flag.String("split", "", "Divide pages between output sets by ID, e.g. train=0.95,val=0.05.")
+	filterWords := flag.String("filter-words", "", "Flag pages containing any word from this list, one per line.")
+	filterCmd := flag.String("filter-cmd", "", "Flag pages with an external classifier that prints offending terms.")
+	filterAction := flag.String("filter-action", xml.FilterTag, "What to do with flagged pages: tag, skip or redact.")
+	filterTags := flag.String("filter-tags", "", "Write flagged pages (id, title, terms) as TSV to this file.")
+	maxArticleBytes := flag.Int("max-article-bytes", 0, "Summarize articles longer than this many bytes, 0 to keep them whole.")
+	sectionParagraphs := flag.Int("section-paragraphs", 1, "Paragraphs to keep per section when summarizing.")
+	nearDupDistance := flag.Int("near-dup-distance", 0, "Find near-duplicate pages whose SimHash differs by at most this many bits (up to 7), 0 to disable.")
+	nearDups := flag.String("near-dups", "", "Write near-duplicates (id, title, duplicate of id, title, distance) as TSV to this file.")
+	dropNearDups := flag.Bool("drop-near-dups", false, "Drop all but the first page of each near-duplicate cluster.")
+	traceURL := flag.String("trace", "", "Export a trace of each page's stages to this OTLP/HTTP endpoint, e.g. http://localhost:4318/v1/traces for Jaeger.")
+	traceMin := flag.Duration("trace-min", 0, "Only export traces of pages that took at least this long.")
+	natsURL := flag.String("nats", "", "Publish each page as JSON to this NATS server, e.g. nats://localhost:4222.")
+	natsSubject := flag.String("nats-subject", "wiki.pages", "The NATS subject to publish pages to.")
+	esURL := flag.String("es", "", "Index pages into this Elasticsearch/OpenSearch cluster, e.g. http://localhost:9200.")
+	esIndex := flag.String("es-index", "wiki", "The index to write pages to.")
+	esMapping := flag.String("es-mapping", "", "A JSON file with settings and mappings to create the index with.")
+	esBatch := flag.Int("es-batch", 500, "Pages per bulk request.")
+	pgConn := flag.String("pg", "", "Copy pages into PostgreSQL with psql, e.g. postgres://user@localhost/wiki. Pages already in the table, by id, are replaced.")
+	pgTable := flag.String("pg-table", "pages", "The table to copy pages into, created if needed.")
+	pgTSConfig := flag.String("pg-tsvector", "", "Add a generated tsvector column using this text search config, e.g. english.")
+	pgBatch := flag.Int("pg-batch", 1000, "Rows per COPY statement.")
+	pgTx := flag.Int("pg-tx", 10, "COPY statements per transaction.")
+	stats := flag.String("stats", "", "Write token counts, vocabulary size and a length histogram as JSON to this file.")
+	statsPages := flag.String("stats-pages", "", "Write per page token counts (id, title, tokens, bpe tokens) as TSV to this file.")
+	bpeMerges := flag.String("bpe-merges", "", "Also count BPE tokens using this GPT-2 style merges.txt.")
+	stripContributors := flag.String("strip-contributors", "", "Remove the usernames, user IDs and IPs of contributors (remove), or replace them with stable pseudonyms (hash).")
+	contributorKey := flag.String("contributor-key", "", "The secret key the -strip-contributors hash pseudonyms are made with. The same key gives the same pseudonyms.")
+	fieldList := flag.String("fields", "", "Only write these page fields, e.g. title,id,text,timestamp. Any of id, title, ns, redirect, revision_id, parentid, timestamp, contributor, comment, model, format, text, sha1, categories, short_description, coordinates and biography.")
+	provenance := flag.Bool("provenance", true, "Record the inputs, dump date, tool version, flags and time of the run in the xml output and -stats. Turn off for outputs that are identical between runs.")
+	runReport := flag.String("run-report", "", "Write the resources the run used (CPU time, peak RSS, bytes read and written, script runs, GC) as JSON to this file when it's done. They're logged either way.")
+	originalText := flag.Bool("original-text", false, "Keep the text of each page as it was read next to the cleaned text: original_text in the JSON, parquet and avro outputs and <originaltext> in the xml output.")
+	pageProvenance := flag.Bool("page-provenance", false, "Keep how each page was processed with it in the outputs: the transforms applied, how long it took and the fallbacks it went through, like the slow lane.")
+	indent := flag.Int("indent", 2, "Indent each level of the xml output by this many spaces, 0 to write each page on one line.")
+	templates := flag.String("templates", "", "Keep the Template: and Module: pages in this page cache for template expansion, even if they aren't in the output.")
+	followRedirects := flag.Bool("follow-redirects", false, "Point links in the cleaned text straight at the article instead of at redirects. Reads the inputs an extra time to collect the redirects.")
+	watch := flag.String("watch", "", "Watch this directory and process dump chunks as they finish downloading, instead of -in.")
+	watchPattern := flag.String("watch-pattern", "*.xml", "The file pattern to watch for.")
+	watchInterval := flag.Duration("watch-interval", 10*time.Second, "How often to check the watched directory.")
+	watchIdle := flag.Duration("watch-idle", 30*time.Minute, "Stop watching when nothing new arrives for this long, 0 to never stop.")
+	watchDone := flag.String("watch-done", "", "Stop watching once a file with this name appears in the directory.")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildInfo())
+		return
+	}
+	log.Println(buildInfo())
+
+	if *preset != "" {
+		if err := applyPreset(*preset); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var splits []xml.Split
+	if *split != "" {
+		var err error
+		splits, err = xml.ParseSplit(*split)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var partitions *xml.Partition
+	if *partition != "" {
+		var err error
+		partitions, err = xml.ParsePartition(*partition)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *split != "" || *out == "" || *format != "xml" {
+			log.Fatal("-partition requires -out with -format xml, and no -split")
+		}
+	}
+
+	if err := xml.ValidFilterAction(*filterAction); err != nil {
+		log.Fatal(err)
+	}
+
+	var filter xml.ContentFilter
+	switch {
+	case *filterWords != "" && *filterCmd != "":
+		log.Fatal("only one of -filter-words and -filter-cmd can be used")
+	case *filterWords != "":
+		var err error
+		filter, err = xml.NewKeywordFilter(*filterWords)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case *filterCmd != "":
+		filter = &xml.CommandFilter{Command: *filterCmd}
+	}
+
+	if *nearDupDistance < 0 || *nearDupDistance > 7 {
+		log.Fatal("-near-dup-distance must be between 0 and 7")
+	}
+	if (*nearDups != "" || *dropNearDups) && *nearDupDistance == 0 {
+		log.Fatal("-near-dups and -drop-near-dups require -near-dup-distance")
+	}
+
+	// formatSink creates the sink writing path in one of the formats other
+	// than xml and blob, for -format or -also
+	formatSink := func(format, path string) (xml.Sink, error) {
+		switch format {
+		case "parquet":
+			return xml.NewParquetSink(path, *parquetCompression, *parquetRowGroup)
+		case "avro":
+			return xml.NewAvroSink(path, *avroCodec, *deterministic)
+		case "chunks":
+			if *chunkTokens < 1 || *chunkOverlap < 0 || *chunkOverlap >= *chunkTokens {
+				return nil, errors.New("-chunk-overlap must be smaller than -chunk-tokens")
+			}
+			return xml.NewChunkSink(path, *chunkTokens, *chunkOverlap)
+		case "sql":
+			s, err := xml.NewSQLSink(path, *sqlPrefix)
+			if err != nil {
+				return nil, err
+			}
+			if *deterministic {
+				s.SetTime(time.Unix(0, 0))
+			}
+			return s, nil
+		case "tsv":
+			return xml.NewMetadataSink(path)
+		}
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+
+	var sinks []xml.Sink
+	switch *format {
+	case "xml":
+	case "blob":
+		if *out == "" || *index == "" {
+			log.Fatal("-format blob requires -out and -index")
+		}
+		s, err := xml.NewBlobSink(*out, *index, *blobCodec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+		// The blob sink writes its own index
+		*out = ""
+		*index = ""
+	default:
+		if *out == "" {
+			log.Fatalf("-format %s requires -out", *format)
+		}
+		s, err := formatSink(*format, *out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+		// The sink replaces the xml output
+		*out = ""
+	}
+	for _, also := range alsoOutputs {
+		output, options := also, ""
+		if i := strings.Index(also, ";"); i >= 0 {
+			output, options = also[:i], also[i+1:]
+		}
+		i := strings.Index(output, "=")
+		if i < 0 {
+			log.Fatalf("-also %s: expected format=path", also)
+		}
+		s, err := formatSink(output[:i], output[i+1:])
+		if err != nil {
+			log.Fatalf("-also %s: %v", also, err)
+		}
+		if options != "" {
+			filter, err := xml.ParseSinkFilter(options)
+			if err != nil {
+				log.Fatalf("-also %s: %v", also, err)
+			}
+			s = &xml.FilteredSink{Sink: s, Filter: filter}
+		}
+		sinks = append(sinks, s)
+	}
+	if *natsURL != "" {
+		s, err := xml.NewNATSSink(*natsURL, *natsSubject)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+	}
+	if *esURL != "" {
+		s, err := xml.NewElasticSink(*esURL, *esIndex, *esMapping, *esBatch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+	}
+	if *pgConn != "" {
+		s, err := xml.NewPostgresSink(*pgConn, *pgTable, *pgTSConfig, *pgBatch, *pgTx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+	}
+	var statsSink *xml.StatsSink
+	if *stats != "" {
+		var err error
+		var bpe *xml.BPE
+		if *bpeMerges != "" {
+			bpe, err = xml.NewBPE(*bpeMerges)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		statsSink, err = xml.NewStatsSink(*stats, *statsPages, bpe)
+		if err != nil {
+			log.Fatal(err)
+		}
+		statsSink.Version = buildInfo()
+		sinks = append(sinks, statsSink)
+	}
+	if *out == "" && len(sinks) == 0 {
+		log.Fatal("no output, use -out or a sink")
+	}
+
+	var config *xml.Config
+	if *configFile != "" {
+		var err error
+		config, err = xml.LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	workerCount := 0
+	if *workers != "auto" {
+		var err error
+		workerCount, err = strconv.Atoi(*workers)
+		if err != nil || workerCount < 1 {
+			log.Fatalf("-workers must be a positive number or auto: %s", *workers)
+		}
+	}
+	if *decodeWorkers < 1 || *writeWorkers < 0 {
+		log.Fatal("-decode-workers must be at least 1 and -write-workers at least 0")
+	}
+	if *reorderMemory < 1 {
+		log.Fatal("-reorder-memory must be at least 1")
+	}
+	if *maxWorkers == 0 {
+		*maxWorkers = 4 * runtime.NumCPU()
+	}
+
+	if err := xml.ValidEncodingMode(*encoding); err != nil {
+		log.Fatal(err)
+	}
+
+	if *strict && *format != "xml" {
+		log.Fatal("-strict only applies to -format xml")
+	}
+	if *scriptRetries < 0 {
+		log.Fatal("-script-retries can't be negative")
+	}
+
+	if *journal != "" && (*out == "" || xml.IsRemote(*out) || *format != "xml" || *split != "" || *partition != "") {
+		log.Fatal("-journal requires a local -out with -format xml and no -split or -partition")
+	}
+	if *retrySkipList && *skipList == "" {
+		log.Fatal("-retry-skip-list requires -skip-list")
+	}
+	if *resume && *journal == "" {
+		log.Fatal("-resume requires -journal")
+	}
+	if *index != "" && (*out == "" || *format != "xml" || *split != "" || *resume) {
+		log.Fatal("-index requires -out with -format xml, and no -split or -resume")
+	}
+	if *sortedIndex != "" && (*index == "" || *partition != "") {
+		log.Fatal("-sorted-index requires -index, and no -partition")
+	}
+	var keys *xml.Transliterator
+	if *searchKeys != "" {
+		if *sortedIndex == "" && !*sortByTitle {
+			log.Fatal("-search-keys requires -sorted-index or -sort-by-title")
+		}
+		var err error
+		keys, err = xml.ParseTransliteration(*searchKeys)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *resume && *checksums != "" {
+		log.Fatal("-checksums can't be used with -resume, they would only cover the resumed part")
+	}
+	if *sortByTitle && (*out == "" || xml.IsRemote(*out) || *format != "xml" || *split != "" || *partition != "" || *journal != "" || *checksums != "" || *watch != "") {
+		log.Fatal("-sort-by-title requires a local -out with -format xml, and no -split, -partition, -journal, -checksums or -watch")
+	}
+
+	if err := xml.ValidCollisionPolicy(*collisions); err != nil {
+		log.Fatal(err)
+	}
+	if err := xml.ValidContributorMode(*stripContributors); err != nil {
+		log.Fatal(err)
+	}
+	if *stripContributors == xml.ContributorHash && *contributorKey == "" {
+		log.Fatal("-strip-contributors hash requires -contributor-key, or the pseudonyms could be reversed by hashing known usernames")
+	}
+
+	var fields xml.Fields
+	if *fieldList != "" {
+		var err error
+		fields, err = xml.ParseFields(*fieldList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *strict {
+			log.Fatal("-strict can't be used with -fields, the pages wouldn't conform")
+		}
+		if (*journal != "" || *index != "") && !(fields["id"] && fields["title"]) {
+			log.Fatal("-journal and -index need the id and title in -fields")
+		}
+	}
+
+	if *collisions == xml.CollisionReport && *collisionReport == "" {
+		log.Fatal("-title-collisions report requires -collision-report")
+	}
+	if (*collisions != xml.CollisionFirst || *collisionReport != "") && *watch != "" {
+		log.Fatal("-title-collisions and -collision-report need all of the inputs up front and can't be used with -watch")
+	}
+	if err := xml.ValidStallPolicy(*stallPolicy); err != nil {
+		log.Fatal(err)
+	}
+	if err := xml.ValidGalleryPolicy(*galleries); err != nil {
+		log.Fatal(err)
+	}
+	var extensionPolicies map[string]string
+	if *extensionTags != "" {
+		var err error
+		extensionPolicies, err = xml.ParseExtensionTags(*extensionTags)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *stallTimeout > 0 && *watch != "" {
+		log.Fatal("-stall-timeout can't tell waiting for chunks from a stall with -watch")
+	}
+	if *deterministic && *slowThreshold > 0 {
+		log.Fatal("-deterministic writes pages in input order, so slow pages can't be moved aside with -slow-threshold")
+	}
+	if *dedupFile != "" && *collisions != xml.CollisionFirst {
+		log.Fatal("-dedup-file only works with -title-collisions first")
+	}
+	if *expectedPages < 0 {
+		log.Fatal("-expected-pages can't be negative")
+	}
+	if *followRedirects && *watch != "" {
+		log.Fatal("-follow-redirects needs all of the inputs up front and can't be used with -watch")
+	}
+
+	if err := xml.ValidDisambigPolicy(*disambig); err != nil {
+		log.Fatal(err)
+	}
+	if err := xml.ValidModelPolicy(*models); err != nil {
+		log.Fatal(err)
+	}
+	if *disambig == xml.DisambigSeparate && *disambigOut == "" {
+		log.Fatal("-disambig separate requires -disambig-out")
+	}
+
+	inputs, err := in.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *watch != "" {
+		// The watched directory stands in for the input when locating the
+		// parse script
+		inputs = []string{filepath.Join(*watch, *watchPattern)}
+	}
+	if len(inputs) == 0 {
+		log.Fatal("no input files")
+	}
+
+	parseXMLScript := *script
+	if parseXMLScript == "" {
+		parseXMLScript = defaultScript(inputs[0])
+	}
+
+	for _, env := range scriptEnv {
+		if !strings.Contains(env, "=") {
+			log.Fatalf("-script-env must be NAME=value: %s", env)
+		}
+	}
+
+	var profile *xml.Project
+	switch {
+	case *project == "auto":
+		profile, err = xml.DetectProject(inputs[0])
+	case *project != "":
+		profile, err = xml.ProjectProfile(*project)
+	case *section != "":
+		profile, err = xml.ProjectProfile("wikipedia")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dictionary != "" {
+		if profile == nil || !profile.Dictionary {
+			log.Fatal("-dictionary requires -project wiktionary")
+		}
+		s, err := xml.NewDictionarySink(*dictionary)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+	}
+	if profile != nil {
+		switch *section {
+		case "":
+		case "all":
+			profile.Section = ""
+		default:
+			profile.Section = *section
+		}
+		config = profile.Config(config)
+		log.Printf("project: %s", profile.Name)
+	}
+
+	w := xml.NewWorker(inputs[0], *out, parseXMLScript, workerCount)
+	w.Project = profile
+	w.ScriptPrefix = strings.Fields(*scriptPrefix)
+	w.ScriptArgs = scriptArgs
+	w.ScriptEnv = scriptEnv
+	if *cleanURL != "" {
+		w.CleanService, err = xml.NewCleanService(*cleanURL, *cleanConcurrency, *cleanTimeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *provenance {
+		w.Provenance = xml.NewProvenance(inputs, os.Args[1:], buildInfo())
+		if *deterministic {
+			// The arguments name the outputs, which may differ between runs
+			w.Provenance.Processed = time.Time{}
+			w.Provenance.Args = nil
+		}
+		if statsSink != nil {
+			statsSink.Provenance = w.Provenance
+		}
+	}
+	w.PageProvenance = *pageProvenance
+	w.KeepOriginalText = *originalText
+	w.ReportFile = *runReport
+	w.AutoWorkers = *workers == "auto"
+	w.MaxWorkers = *maxWorkers
+	if *traceURL != "" {
+		w.Tracer = xml.NewTracer(*traceURL, "wikireader_fastparser", *traceMin)
+	}
+	w.DecodeWorkers = *decodeWorkers
+	w.ReorderMemory = *reorderMemory
+	w.WriteWorkers = *writeWorkers
+	w.InputFiles = inputs
+	w.WatchDir = *watch
+	w.WatchPattern = *watchPattern
+	w.WatchInterval = *watchInterval
+	w.WatchIdle = *watchIdle
+	w.WatchDone = *watchDone
+	w.DisambigPolicy = *disambig
+	w.ModelPolicy = *models
+	w.CollisionPolicy = *collisions
+	w.FollowRedirects = *followRedirects
+	w.TemplateFile = *templates
+	w.Indent = *indent
+	w.Fields = fields
+	w.StripContributors = *stripContributors
+	w.ContributorKey = []byte(*contributorKey)
+	w.CollisionFile = *collisionReport
+	w.Encoding = *encoding
+	w.Whitespace = parseWhitespace(*whitespace)
+	if *sanitizeHTML != "" {
+		var err error
+		w.HTMLSanitizer, err = xml.ParseHTMLAllowlist(*sanitizeHTML)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	w.JournalFile = *journal
+	w.Resume = *resume
+	w.IDMapFile = *idMap
+	w.DedupFile = *dedupFile
+	w.Deterministic = *deterministic
+	w.SkipRedirects = *skipRedirects
+	if *idRange != "" {
+		w.IDRange, err = xml.ParseIDRange(*idRange)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	w.LogSkips = *logSkips
+	w.SkipListFile = *skipList
+	w.RetrySkipList = *retrySkipList
+	if *titleMatch != "" {
+		re, err := regexp.Compile(*titleMatch)
+		if err != nil {
+			log.Fatalf("-title-match: %v", err)
+		}
+		w.TitleFilter = re
+	}
+	w.ExpectedPages = *expectedPages
+	w.CleanCacheDir = *cleanCache
+	w.Mmap = *mmap
+	w.ReadAhead = *readAhead
+	w.SlowThreshold = *slowThreshold
+	w.StallTimeout = *stallTimeout
+	w.StallPolicy = *stallPolicy
+	w.SlowLaneSlots = *slowSlots
+	w.SlowFile = *slowPages
+	w.LintFile = *lint
+	w.LintScript = *lintScript
+	w.DiagnosticsFile = *diagnostics
+	w.GalleryPolicy = *galleries
+	w.ImageManifestFile = *imageManifest
+	w.ExtensionTags = extensionPolicies
+	w.Strict = *strict
+	w.DeadLetterFile = *deadLetter
+	w.ScriptRetries = *scriptRetries
+	w.DisambigFile = *disambigOut
+	w.Config = config
+	w.CategoryFile = *categories
+	w.LinkFile = *links
+	w.LinkAnchors = *linkAnchors
+	w.IndexFile = *index
+	w.ChecksumFile = *checksums
+	w.SortedIndexFile = *sortedIndex
+	w.SearchKeys = keys
+	w.SortByTitle = *sortByTitle
+	w.SortOptions = xml.SortOptions{Memory: *sortMemory, TempDir: *spillDir, Parallel: runtime.NumCPU()}
+	w.GeoIndexFile = *geoIndex
+	w.PhoneticIndexFile = *phoneticIndex
+	w.Split = splits
+	w.Partition = partitions
+	w.ContentFilter = filter
+	w.FilterAction = *filterAction
+	w.FilterTagFile = *filterTags
+	w.MaxArticleBytes = *maxArticleBytes
+	w.SectionParagraphs = *sectionParagraphs
+	w.NearDupDistance = *nearDupDistance
+	w.NearDupFile = *nearDups
+	w.DropNearDups = *dropNearDups
+	w.Sinks = sinks
+	w.Raw = *raw
+	if *raw && (len(sinks) > 0 || *out == "" || *categories != "" || *links != "" || *idMap != "" || *fieldList != "" || *journal != "") {
+		log.Fatal("-raw only writes the xml -out, and can't be used with other outputs, -categories, -links, -id-map, -fields or -journal")
+	}
+	if *showDashboard {
+		if isTerminal(os.Stderr) {
+			w.Progress = &xml.Progress{}
+			d := startDashboard(w.Progress, os.Stderr)
+			err := w.Start()
+			d.stop()
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		log.Println("stderr isn't a terminal, logging instead of -dashboard")
+	}
+	if err := w.Start(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// defaultScript returns the parse script for an input. We make some
+// assumptions about the directory structure. Mostly that you have your dumps
+// in the build/ subdirectory of the repo
+func defaultScript(input string) string {
+	dir := filepath.Dir(input)
+	if xml.IsRemote(input) {
+		dir = "build"
+	}
+	return path.Join(dir, "../scripts", "parse_xml")
+}
+
+// inputList is a repeatable -in flag. Each value may be a glob.
+type inputList []string
+
+func (l *inputList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *inputList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// files expands the globs, keeping the order they were given in.
+func (l inputList) files() ([]string, error) {
+	var files []string
+	for _, pattern := range l {
+		if xml.IsRemote(pattern) {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input files match %s", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
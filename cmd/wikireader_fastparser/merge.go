@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// merge combines processed shards into one output, dropping pages whose
+// title was already in an earlier shard.
+func merge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	var in inputList
+	fs.Var(&in, "in", "A processed shard. Can be repeated or a glob, merged in order.")
+	out := fs.String("out", "", "The merged output. May be an s3:// or gs:// URL.")
+	format := fs.String("format", xml.MergeXML, "The merged format: xml or jsonl.")
+	index := fs.String("index", "", "Write the offset table of the merged output (id, title, offset, length) as TSV to this file.")
+	fs.Parse(args)
+
+	inputs, err := in.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(inputs) == 0 || *out == "" {
+		log.Fatal("merge requires -in and -out")
+	}
+
+	stats, err := xml.MergeShards(inputs, *out, *format, *index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("merged %d pages from %d shards, %d duplicates", stats.Pages, len(inputs), stats.Duplicates)
+}
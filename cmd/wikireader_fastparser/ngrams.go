@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// ngrams writes the most frequent n-grams of a processed output.
+func ngrams(args []string) {
+	fs := flag.NewFlagSet("ngrams", flag.ExitOnError)
+	in := fs.String("in", "", "The processed output to count.")
+	out := fs.String("out", "", "The n-gram file to write (n, n-gram, count).")
+	maxN := fs.Int("n", 3, "Count n-grams up to this length.")
+	k := fs.Int("k", 10000, "How many of the most frequent n-grams of each length to keep.")
+	width := fs.Int("width", 1<<22, "Counters per count-min sketch row. Memory use is 4 * width * depth bytes.")
+	depth := fs.Int("depth", 4, "Count-min sketch rows.")
+	fs.Parse(args)
+
+	if *in == "" || *out == "" {
+		log.Fatal("ngrams requires -in and -out")
+	}
+
+	c := xml.NewNGramCounter(*maxN, *k, *width, *depth)
+	pages := 0
+	err := xml.ReadPages(*in, func(p *xml.Page) error {
+		if !xml.IsRedirect(p) {
+			c.Add(xml.NewRecord(p).Text)
+			pages++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("counted %d pages", pages)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	b := bufio.NewWriter(f)
+	for _, g := range c.Top() {
+		fmt.Fprintf(b, "%d\t%s\t%d\n", g.N, g.Text, g.Count)
+	}
+	if err := b.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
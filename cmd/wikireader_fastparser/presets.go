@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// presets bundle the flags for common builds, so a working one doesn't need
+// all of them learned first. Flags given on the command line win over the
+// preset's.
+var presets = map[string]map[string]string{
+	// simplewiki suits the Simple English Wikipedia, small enough to keep
+	// whole on the device
+	"simplewiki": {
+		"disambig":          "exclude",
+		"title-collisions":  "latest",
+		"follow-redirects":  "true",
+		"near-dup-distance": "3",
+		"drop-near-dups":    "true",
+		"workers":           "auto",
+	},
+	// enwiki-minimal cuts the English Wikipedia down to fit a small card,
+	// keeping the lead and first paragraph of each section
+	"enwiki-minimal": {
+		"disambig":           "exclude",
+		"title-collisions":   "latest",
+		"follow-redirects":   "true",
+		"max-article-bytes":  "16384",
+		"section-paragraphs": "1",
+		"near-dup-distance":  "3",
+		"drop-near-dups":     "true",
+		"workers":            "auto",
+	},
+	// full keeps everything, only cleaning the text
+	"full": {
+		"disambig":         "include",
+		"title-collisions": "latest",
+		"follow-redirects": "true",
+		"workers":          "auto",
+	},
+}
+
+// presetNames returns the names of the presets in order.
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset sets the flags of the named preset that weren't given on the
+// command line.
+func applyPreset(name string) error {
+	preset, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %s, use one of: %s", name, strings.Join(presetNames(), ", "))
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var flags []string
+	for flagName := range preset {
+		flags = append(flags, flagName)
+	}
+	sort.Strings(flags)
+	for _, flagName := range flags {
+		if given[flagName] {
+			continue
+		}
+		if err := flag.Set(flagName, preset[flagName]); err != nil {
+			return fmt.Errorf("preset %s: -%s: %v", name, flagName, err)
+		}
+		log.Printf("preset %s: -%s=%s", name, flagName, preset[flagName])
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// prune drops the links to pages that didn't make it into the output, so the
+// device never shows a dead link. It reads the processed output twice, so run
+// it on the final set, e.g. after merge.
+func prune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	var in inputList
+	fs.Var(&in, "in", "A processed output. Can be repeated or a glob, copied in order.")
+	out := fs.String("out", "", "The pruned output. May be an s3:// or gs:// URL.")
+	mode := fs.String("mode", xml.PruneDelink, "What to do with dead links: delink (keep the text) or remove.")
+	fs.Parse(args)
+
+	inputs, err := in.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(inputs) == 0 || *out == "" {
+		log.Fatal("prune requires -in and -out")
+	}
+
+	stats, err := xml.PruneLinks(inputs, *out, *mode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("pruned %d of %d links in %d pages", stats.Pruned, stats.Links, stats.Pages)
+}
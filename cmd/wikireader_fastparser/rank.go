@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// rank scores articles from a -links graph file.
+func rank(args []string) {
+	fs := flag.NewFlagSet("rank", flag.ExitOnError)
+	links := fs.String("links", "", "The link graph TSV written with -links.")
+	index := fs.String("index", "", "The offset index written with -index in the same run, so the pages without links are scored too. Without it only the pages that link somewhere are.")
+	out := fs.String("out", "", "The score file to write (id, title, score).")
+	method := fs.String("method", "pagerank", "How to score pages: pagerank or indegree.")
+	iterations := fs.Int("iterations", 20, "PageRank iterations.")
+	damping := fs.Float64("damping", 0.85, "PageRank damping factor.")
+	fs.Parse(args)
+
+	if *links == "" || *out == "" {
+		log.Fatal("rank requires -links and -out")
+	}
+
+	g, err := xml.ReadLinkGraph(*links)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *index != "" {
+		if err := g.AddPages(*index); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("loaded %d titles", len(g.Titles))
+
+	var scores []xml.Score
+	switch *method {
+	case "pagerank":
+		scores = xml.PageRank(g, *iterations, *damping)
+	case "indegree":
+		scores = xml.InDegree(g)
+	default:
+		log.Fatalf("unknown rank method: %s", *method)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	b := bufio.NewWriter(f)
+	for _, s := range scores {
+		fmt.Fprintf(b, "%s\t%s\t%g\n", s.ID, s.Title, s.Score)
+	}
+	if err := b.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
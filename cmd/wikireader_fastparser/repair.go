@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// repair finds the pages of a processed output whose text was
+// double-escaped or truncated by earlier versions, and writes a patched
+// output with them cleaned again from the dump it was made from.
+func repair(args []string) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	in := fs.String("in", "", "The processed output to repair.")
+	out := fs.String("out", "", "The patched output to write. Without it the damaged pages are only reported.")
+	dump := fs.String("dump", "", "The uncompressed local dump -in was made from.")
+	dumpIndex := fs.String("dump-index", "", "The offset index of -dump. Written by scanning -dump if the file doesn't exist yet.")
+	report := fs.String("report", "", "Write the damaged pages to this file (id, title, damage, what was done) instead of the log.")
+	extracted := fs.Bool("extracted", false, "-in was extracted, so the pages are patched with their text from -dump as it is.")
+	cleaner := cleanerFlags(fs)
+	fs.Parse(args)
+
+	if *in == "" || *dump == "" || *dumpIndex == "" {
+		log.Fatal("repair requires -in, -dump and -dump-index")
+	}
+
+	opts := xml.RepairOptions{Dump: *dump, DumpIndex: *dumpIndex}
+	if !*extracted {
+		w := cleaner()
+		opts.Clean = func(p *xml.Page) (string, error) {
+			return w.CleanText(p.Title, p.Ns, p.Revision.Text.Text)
+		}
+	}
+
+	if _, err := os.Stat(*dumpIndex); os.IsNotExist(err) {
+		log.Printf("indexing %s", *dump)
+		if err := xml.IndexDump(*dump, *dumpIndex); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var b *bufio.Writer
+	if *report != "" {
+		f, err := os.Create(*report)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		b = bufio.NewWriter(f)
+	}
+	counts := make(map[string]int)
+	err := xml.RepairOutput(*in, *out, opts, func(r xml.Repair) error {
+		counts[r.Action]++
+		if b != nil {
+			_, err := fmt.Fprintf(b, "%s\t%s\t%s\t%s\n", r.ID, r.Title, r.Damage, r.Action)
+			return err
+		}
+		log.Printf("%s (%s): %s, %s", r.Title, r.ID, r.Damage, r.Action)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if b != nil {
+		if err := b.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%d patched, %d unconfirmed, %d not in the dump, %d failed to clean",
+		counts[xml.RepairPatched], counts[xml.RepairUnconfirmed], counts[xml.RepairNotFound], counts[xml.RepairFailed])
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// selftest runs the whole pipeline over a miniature dump built into the
+// binary, so an installation (the script, its permissions, the locale) can
+// be checked in seconds before a run that takes all night. It exits 1 if
+// any check fails.
+func selftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	cleaner := cleanerFlags(fs)
+	verbose := fs.Bool("v", false, "Log the runs as they go, not only the results.")
+	keep := fs.Bool("keep", false, "Keep the sample and outputs in the temporary directory, and print where it is.")
+	fs.Parse(args)
+	w := cleaner()
+
+	dir, err := ioutil.TempDir("", "selftest-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *keep {
+		fmt.Println("selftest files are in", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	sample := filepath.Join(dir, "sample.xml")
+	if err := ioutil.WriteFile(sample, []byte(selftestDump), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if !*verbose {
+		defer log.SetOutput(log.Writer())
+		log.SetOutput(ioutil.Discard)
+	}
+
+	t := &selftestRun{sample: sample, dir: dir}
+	t.check("locale", checkLocale)
+	t.check("script", func() error { return checkScript(w) })
+	t.check("pipeline", t.checkPipeline)
+	t.check("clean", func() error { return t.checkClean(w) })
+	t.check("deterministic", func() error { return t.checkDeterministic(w) })
+	if t.failed > 0 {
+		fmt.Printf("selftest failed %d checks\n", t.failed)
+		if !*keep {
+			os.RemoveAll(dir)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("selftest passed")
+}
+
+// selftestRun is the state of the checks.
+type selftestRun struct {
+	sample, dir string
+	// cleaned is the hash of the first cleaned output, once there is one
+	cleaned []byte
+	failed  int
+}
+
+// selftestWarning is a check that didn't fail, but might not be right.
+type selftestWarning string
+
+func (w selftestWarning) Error() string { return string(w) }
+
+// check runs a check and prints how it went.
+func (t *selftestRun) check(name string, fn func() error) {
+	err := fn()
+	if warning, ok := err.(selftestWarning); ok {
+		fmt.Printf("warn %s: %v\n", name, warning)
+		return
+	}
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n", name, err)
+		t.failed++
+		return
+	}
+	fmt.Printf("ok   %s\n", name)
+}
+
+// checkLocale checks the locale the script inherits is UTF-8, which
+// scripts reading stdin as text need to read the articles. The C locale is
+// only a warning, as some languages read UTF-8 in it anyway.
+func checkLocale() error {
+	for _, env := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		if value == "C" || value == "POSIX" {
+			return selftestWarning(fmt.Sprintf("%s is %s, set it to a UTF-8 locale such as C.UTF-8 if the clean check fails", env, value))
+		}
+		normalized := strings.ToLower(strings.Replace(value, "-", "", -1))
+		if !strings.Contains(normalized, "utf8") {
+			return fmt.Errorf("%s is %s, not a UTF-8 locale", env, value)
+		}
+		return nil
+	}
+	return selftestWarning("no locale is set, set LANG to a UTF-8 locale such as C.UTF-8 if the clean check fails")
+}
+
+// checkScript checks the parse script can be run, unless the text goes to
+// a clean service instead.
+func checkScript(w *xml.Worker) error {
+	if w.CleanService != nil {
+		return nil
+	}
+	info, err := os.Stat(w.ParseScript)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", w.ParseScript)
+	}
+	// With a prefix it's an argument, say to python
+	if len(w.ScriptPrefix) > 0 {
+		return nil
+	}
+	_, err = xml.ScriptInterpreter(w.ParseScript)
+	return err
+}
+
+// checkPipeline passes the sample through unchanged and checks each page
+// still has the text its revision's sha1 is of.
+func (t *selftestRun) checkPipeline() error {
+	out := filepath.Join(t.dir, "extracted.xml")
+	w := xml.NewWorker(t.sample, out, "", 1)
+	w.Extract = true
+	if err := runSelftest(w); err != nil {
+		return err
+	}
+	if err := validateSelftest(out); err != nil {
+		return err
+	}
+
+	pages := 0
+	err := xml.ReadPages(out, func(p *xml.Page) error {
+		pages++
+		// The text is kept as it's escaped in the XML
+		if sha1 := xml.Sha1Base36(html.UnescapeString(p.Revision.Text.Text)); sha1 != p.Revision.Sha1 {
+			return fmt.Errorf("page %s (%s) has sha1 %s, not %s", p.ID, p.Title, sha1, p.Revision.Sha1)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if pages != selftestPages {
+		return fmt.Errorf("wrote %d pages, not %d", pages, selftestPages)
+	}
+	return nil
+}
+
+// checkClean cleans the sample as a run would, checking no page fails and
+// the text is still UTF-8 with its letters intact.
+func (t *selftestRun) checkClean(cleaner *xml.Worker) error {
+	out := filepath.Join(t.dir, "cleaned.xml")
+	sum, err := t.clean(cleaner, out, 1)
+	if err != nil {
+		return err
+	}
+	t.cleaned = sum
+
+	pages := 0
+	err = xml.ReadPages(out, func(p *xml.Page) error {
+		pages++
+		if !utf8.ValidString(p.Revision.Text.Text) {
+			return fmt.Errorf("the text of %s isn't valid UTF-8", p.Title)
+		}
+		if p.Title == "Zürich" && !strings.Contains(p.Revision.Text.Text, "Zürich") {
+			return fmt.Errorf("the text of Zürich lost its umlaut, is the script reading UTF-8?")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if pages != selftestPages {
+		return fmt.Errorf("wrote %d pages, not %d", pages, selftestPages)
+	}
+	return nil
+}
+
+// checkDeterministic cleans the sample again with more workers and checks
+// the output is byte for byte the same.
+func (t *selftestRun) checkDeterministic(cleaner *xml.Worker) error {
+	if t.cleaned == nil {
+		return errors.New("skipped, clean failed")
+	}
+	sum, err := t.clean(cleaner, filepath.Join(t.dir, "cleaned-again.xml"), 4)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, t.cleaned) {
+		return fmt.Errorf("the output hashes differ: %x and %x", t.cleaned, sum)
+	}
+	return nil
+}
+
+// clean cleans the sample to out with the cleaner's settings and as many
+// workers, returning the output's hash.
+func (t *selftestRun) clean(cleaner *xml.Worker, out string, workers int) ([]byte, error) {
+	w := xml.NewWorker(t.sample, out, cleaner.ParseScript, workers)
+	w.ScriptPrefix = cleaner.ScriptPrefix
+	w.ScriptArgs = cleaner.ScriptArgs
+	w.ScriptEnv = cleaner.ScriptEnv
+	w.ScriptRetries = cleaner.ScriptRetries
+	w.CleanService = cleaner.CleanService
+	w.Encoding = cleaner.Encoding
+	w.Whitespace = cleaner.Whitespace
+	w.MaxArticleBytes = cleaner.MaxArticleBytes
+	w.SectionParagraphs = cleaner.SectionParagraphs
+	w.Deterministic = true
+
+	var mu sync.Mutex
+	var failures []error
+	w.OnPageFailed = func(err error) {
+		mu.Lock()
+		failures = append(failures, err)
+		mu.Unlock()
+	}
+	if err := runSelftest(w); err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		var pe *xml.ProcessError
+		if errors.As(failures[0], &pe) && pe.Stderr != "" {
+			return nil, fmt.Errorf("%d pages failed, the first: %v: %s", len(failures), pe, strings.TrimSpace(pe.Stderr))
+		}
+		return nil, fmt.Errorf("%d pages failed, the first: %v", len(failures), failures[0])
+	}
+	if err := validateSelftest(out); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// runSelftest runs the worker, returning its error or what it panicked with.
+func runSelftest(w *xml.Worker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	return w.Start()
+}
+
+// validateSelftest checks an output of the sample is well-formed.
+func validateSelftest(out string) error {
+	result, err := xml.ValidateFile(out, xml.ValidateOptions{Workers: 1})
+	if err != nil {
+		return err
+	}
+	if len(result.Problems) > 0 {
+		return fmt.Errorf("%s: %s", filepath.Base(out), result.Problems[0])
+	}
+	return nil
+}
+
+// selftestPages is how many pages are in selftestDump.
+const selftestPages = 4
+
+// selftestDump is the miniature dump selftest runs over: an article with
+// templates, refs and sections, a redirect, an article in several scripts
+// and a talk page. The sha1 of each revision is of its text, as in a real
+// dump.
+const selftestDump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="en">
+  <siteinfo>
+    <sitename>Wikipedia</sitename>
+    <dbname>enwiki</dbname>
+  </siteinfo>
+  <page>
+    <title>Aardvark</title>
+    <ns>0</ns>
+    <id>1001</id>
+    <revision>
+      <id>2001</id>
+      <timestamp>2024-01-01T00:00:00Z</timestamp>
+      <contributor><username>Example</username><id>1</id></contributor>
+      <model>wikitext</model>
+      <format>text/x-wiki</format>
+      <text bytes="421" xml:space="preserve">{{Short description|Mammal native to Africa}}
+{{Infobox mammal
+| name = Aardvark
+| status = LC
+}}
+The '''aardvark''' (''Orycteropus afer'') is a medium-sized, burrowing, [[Nocturnality|nocturnal]] [[mammal]] native to [[Africa]].&lt;ref&gt;{{cite book |title=Mammals of Africa |year=2013}}&lt;/ref&gt;
+
+== Diet ==
+It feeds almost exclusively on [[ant]]s and [[termite]]s.
+
+== References ==
+{{Reflist}}
+
+[[Category:Mammals of Africa]]</text>
+      <sha1>31redl39arf7y9jtvoscykgj2rtuunz</sha1>
+    </revision>
+  </page>
+  <page>
+    <title>Antbear</title>
+    <ns>0</ns>
+    <id>1002</id>
+    <redirect title="Aardvark" />
+    <revision>
+      <id>2002</id>
+      <timestamp>2024-01-01T00:00:00Z</timestamp>
+      <contributor><username>Example</username><id>1</id></contributor>
+      <model>wikitext</model>
+      <format>text/x-wiki</format>
+      <text bytes="22" xml:space="preserve">#REDIRECT [[Aardvark]]</text>
+      <sha1>84kxctz50sf0bq21lnquzizwynheoc9</sha1>
+    </revision>
+  </page>
+  <page>
+    <title>Zürich</title>
+    <ns>0</ns>
+    <id>1003</id>
+    <revision>
+      <id>2003</id>
+      <timestamp>2024-01-01T00:00:00Z</timestamp>
+      <contributor><username>Example</username><id>1</id></contributor>
+      <model>wikitext</model>
+      <format>text/x-wiki</format>
+      <text bytes="320" xml:space="preserve">'''Zürich''' is the largest city in [[Switzerland]], on the shore of [[Lake Zurich]]. Its name is ''Zürich'' in German, ''Zurigo'' in Italian and ''Turitg'' in Romansh.
+
+== Name ==
+The city was known as ''Turicum'' in Latin. Other spellings: Zúrich, Цюрих, チューリッヒ.
+
+[[Category:Cities in Switzerland]]</text>
+      <sha1>dpk28vbn6e04n99dwjd6o1dstrle5wk</sha1>
+    </revision>
+  </page>
+  <page>
+    <title>Talk:Aardvark</title>
+    <ns>1</ns>
+    <id>1004</id>
+    <revision>
+      <id>2004</id>
+      <timestamp>2024-01-01T00:00:00Z</timestamp>
+      <contributor><username>Example</username><id>1</id></contributor>
+      <model>wikitext</model>
+      <format>text/x-wiki</format>
+      <text bytes="67" xml:space="preserve">== Sources ==
+Are there better sources for the diet section? --~~~~</text>
+      <sha1>ssyzp7xvjf712g4mqb0rdxr10tu3ise</sha1>
+    </revision>
+  </page>
+</mediawiki>
+`
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// synonyms writes the anchor texts used for each title from a -links graph
+// file, for use as search synonyms.
+func synonyms(args []string) {
+	fs := flag.NewFlagSet("synonyms", flag.ExitOnError)
+	links := fs.String("links", "", "The link graph TSV written with -links and -link-anchors.")
+	out := fs.String("out", "", "The synonyms file to write (anchor, title, count).")
+	minCount := fs.Int("min-count", 2, "Drop anchors used fewer times than this.")
+	fs.Parse(args)
+
+	if *links == "" || *out == "" {
+		log.Fatal("synonyms requires -links and -out")
+	}
+
+	syns, err := xml.ReadSynonyms(*links, *minCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	b := bufio.NewWriter(f)
+	for _, s := range syns {
+		fmt.Fprintf(b, "%s\t%s\t%d\n", s.Anchor, s.Title, s.Count)
+	}
+	if err := b.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d synonyms", len(syns))
+}
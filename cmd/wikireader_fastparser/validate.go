@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// validate checks existing xml outputs for well-formedness and against the
+// export schema, in parallel chunks, logging the byte offset of each
+// problem.
+func validate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var in inputList
+	fs.Var(&in, "in", "An xml output to check. Can be repeated or a glob.")
+	workers := fs.Int("workers", runtime.NumCPU(), "How many chunks to check at once.")
+	chunk := fs.Int64("chunk", xml.DefaultValidateChunk, "The size of each chunk in bytes.")
+	schema := fs.Bool("schema", true, "Check the pages against the export-0.10 schema as well as for well-formedness.")
+	fs.Parse(args)
+
+	inputs, err := in.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		log.Fatal("validate requires -in")
+	}
+	for _, path := range inputs {
+		if xml.IsRemote(path) || strings.HasSuffix(path, ".bz2") || strings.HasSuffix(path, ".gz") {
+			log.Fatalf("%s: validate only reads local uncompressed files", path)
+		}
+	}
+
+	opts := xml.ValidateOptions{Workers: *workers, Chunk: *chunk, Schema: *schema}
+	failed := 0
+	for _, path := range inputs {
+		result, err := xml.ValidateFile(path, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for j, problem := range result.Problems {
+			if j == verifyShown {
+				log.Printf("... and %d more", len(result.Problems)-j)
+				break
+			}
+			log.Printf("%s: %s", path, problem)
+		}
+		log.Printf("%s: %d pages, %d problems", path, result.Pages, len(result.Problems))
+		failed += len(result.Problems)
+	}
+	if failed > 0 {
+		log.Printf("validate failed with %d problems", failed)
+		os.Exit(1)
+	}
+}
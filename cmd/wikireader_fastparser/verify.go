@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/stephen-mw/wikireader_fastparser/xml"
+)
+
+// verifyShown is how many problems are logged before they're only counted.
+const verifyShown = 20
+
+// verify checks the files that go on the device against their indexes
+// before they're flashed: an xml output or the shards of -partition with
+// their -index, or a -format blob file with its index.
+func verify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var in, index inputList
+	fs.Var(&in, "in", "An xml output, shard or blob file. Can be repeated or a glob.")
+	fs.Var(&index, "index", "The index of each -in, in the same order. Can be repeated or a glob.")
+	samples := fs.Int("samples", 100, "How many random articles of each file to read end to end.")
+	seed := fs.Int64("seed", 0, "The seed picking the samples. Defaults to the time, and is logged so a run can be repeated.")
+	fs.Parse(args)
+
+	inputs, err := in.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	indexes, err := index.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(inputs) == 0 || len(inputs) != len(indexes) {
+		log.Fatal("verify requires -in and an -index for each")
+	}
+	for _, path := range inputs {
+		if xml.IsRemote(path) {
+			log.Fatalf("%s: verify only reads local files", path)
+		}
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	log.Printf("sampling with -seed %d", *seed)
+	rng := rand.New(rand.NewSource(*seed))
+
+	failed := 0
+	for i, path := range inputs {
+		result, err := xml.VerifyArtifact(path, indexes[i], *samples, rng)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for j, problem := range result.Problems {
+			if j == verifyShown {
+				log.Printf("... and %d more", len(result.Problems)-j)
+				break
+			}
+			log.Println(problem)
+		}
+		log.Printf("%s: %d entries, %d sampled, %d problems", path, result.Entries, result.Sampled, len(result.Problems))
+		failed += len(result.Problems)
+	}
+	if failed > 0 {
+		log.Printf("verify failed with %d problems", failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the version of the tool, set when building with
+// -ldflags "-X main.version=...". Without it the module version from the
+// build info is used, if there is one.
+var version = "dev"
+
+// toolVersion returns the version of this build.
+func toolVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// buildInfo describes the build: the tool, its version and the Go release
+// and platform it was built for.
+func buildInfo() string {
+	return fmt.Sprintf("wikireader_fastparser %s (%s %s/%s)", toolVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
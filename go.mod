@@ -1,3 +1,3 @@
-module github.com/stephen-mw/wikireader_fastparse
+module github.com/stephen-mw/wikireader_fastparser
 
 go 1.14
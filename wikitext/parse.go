@@ -0,0 +1,362 @@
+package wikitext
+
+import (
+	"strings"
+)
+
+// Parse parses wikitext into nodes. Everything that isn't a link,
+// template, argument, comment, heading or table is returned as Text, so
+// joining the Raw of the nodes gives back the text.
+func Parse(text string) []*Node {
+	p := &parser{s: text, end: len(text)}
+	return p.nodes(nil)
+}
+
+type parser struct {
+	s string
+	i int
+
+	// end is where parsing stops: the end of the text, or of the heading
+	// being parsed. Headings are inline, they can't hold tables or other
+	// headings.
+	end    int
+	inline bool
+
+	// failed remembers where markup wasn't closed, so it isn't tried again
+	// from every enclosing node
+	failed map[int]bool
+}
+
+// at reports whether the text at p.i starts with prefix.
+func (p *parser) at(prefix string) bool {
+	return strings.HasPrefix(p.s[p.i:p.end], prefix)
+}
+
+// atLineStart reports whether p.i is the first character of a line.
+func (p *parser) atLineStart() bool {
+	return p.i == 0 || p.s[p.i-1] == '\n'
+}
+
+// lineEnd returns where the line at p.i ends.
+func (p *parser) lineEnd() int {
+	if j := strings.IndexByte(p.s[p.i:p.end], '\n'); j >= 0 {
+		return p.i + j
+	}
+	return p.end
+}
+
+// indent returns where the spaces and tabs from i end.
+func (p *parser) indent(i int) int {
+	for i < p.end && (p.s[i] == ' ' || p.s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// nodes parses until stop returns true or the text ends.
+func (p *parser) nodes(stop func() bool) []*Node {
+	var out []*Node
+	text := p.i
+	for p.i < p.end {
+		if stop != nil && stop() {
+			break
+		}
+		start := p.i
+		n := p.node()
+		if n == nil {
+			p.i++
+			continue
+		}
+		if start > text {
+			out = append(out, &Node{Kind: Text, Pos: text, Raw: p.s[text:start]})
+		}
+		out = append(out, n)
+		text = p.i
+	}
+	if p.i > text {
+		out = append(out, &Node{Kind: Text, Pos: text, Raw: p.s[text:p.i]})
+	}
+	return out
+}
+
+// node parses the markup at p.i, if there is any.
+func (p *parser) node() *Node {
+	switch c := p.s[p.i]; {
+	case c == '[' && p.at("[["):
+		return p.try(Link, p.link)
+	case c == '{' && p.at("{{{"):
+		if n := p.try(Argument, p.argument); n != nil {
+			return n
+		}
+		return p.try(Template, p.template)
+	case c == '{' && p.at("{{"):
+		return p.try(Template, p.template)
+	case c == '<' && p.at("<!--"):
+		return p.try(Comment, p.comment)
+	case p.inline || !p.atLineStart():
+		return nil
+	case c == '=':
+		return p.try(Heading, p.heading)
+	case strings.HasPrefix(p.s[p.indent(p.i):p.end], "{|"):
+		return p.try(Table, p.table)
+	}
+	return nil
+}
+
+// try runs parse at p.i, going back to where it started if parse fails.
+func (p *parser) try(kind Kind, parse func() *Node) *Node {
+	key := p.i*int(Cell+1) + int(kind)
+	if p.failed[key] {
+		return nil
+	}
+
+	start := p.i
+	n := parse()
+	if n == nil {
+		if p.failed == nil {
+			p.failed = make(map[int]bool)
+		}
+		p.failed[key] = true
+		p.i = start
+		return nil
+	}
+	n.Pos = start
+	n.Raw = p.s[start:p.i]
+	return n
+}
+
+// comment parses <!-- ... -->. An unclosed comment runs to the end.
+func (p *parser) comment() *Node {
+	if j := strings.Index(p.s[p.i:p.end], "-->"); j >= 0 {
+		p.i += j + len("-->")
+	} else {
+		p.i = p.end
+	}
+	return &Node{Kind: Comment}
+}
+
+// link parses [[Target|label]]. The target can't span lines or hold other
+// markup.
+func (p *parser) link() *Node {
+	p.i += 2
+	start := p.i
+	for p.i < p.end && p.s[p.i] != '|' && !p.at("]]") {
+		switch p.s[p.i] {
+		case '\n', '[', ']', '{', '}':
+			return nil
+		}
+		p.i++
+	}
+
+	n := &Node{Kind: Link, Target: p.s[start:p.i]}
+	if p.at("|") {
+		p.i++
+		n.Children = p.nodes(func() bool { return p.at("]]") })
+	}
+	if !p.at("]]") {
+		return nil
+	}
+	p.i += 2
+	return n
+}
+
+// template parses {{Name|params}}.
+func (p *parser) template() *Node {
+	p.i += 2
+	stop := func() bool { return p.at("|") || p.at("}}") }
+
+	start := p.i
+	p.nodes(stop)
+	n := &Node{Kind: Template, Name: strings.TrimSpace(p.s[start:p.i])}
+	for p.at("|") {
+		p.i++
+		n.Params = append(n.Params, p.param(stop))
+	}
+	if !p.at("}}") {
+		return nil
+	}
+	p.i += 2
+	return n
+}
+
+// param parses a template parameter. It's named if there's an = before any
+// other markup.
+func (p *parser) param(stop func() bool) Param {
+	value := p.nodes(stop)
+	if len(value) == 0 || value[0].Kind != Text {
+		return Param{Value: value}
+	}
+	first := value[0]
+	i := strings.IndexByte(first.Raw, '=')
+	if i < 0 {
+		return Param{Value: value}
+	}
+
+	value = value[1:]
+	if i+1 < len(first.Raw) {
+		rest := &Node{Kind: Text, Pos: first.Pos + i + 1, Raw: first.Raw[i+1:]}
+		value = append([]*Node{rest}, value...)
+	}
+	return Param{Name: strings.TrimSpace(first.Raw[:i]), Value: value}
+}
+
+// argument parses {{{Name|default}}}.
+func (p *parser) argument() *Node {
+	p.i += 3
+
+	start := p.i
+	p.nodes(func() bool { return p.at("|") || p.at("}}}") })
+	n := &Node{Kind: Argument, Name: strings.TrimSpace(p.s[start:p.i])}
+	if p.at("|") {
+		p.i++
+		n.Params = []Param{{Value: p.nodes(func() bool { return p.at("}}}") })}}
+	}
+	if !p.at("}}}") {
+		return nil
+	}
+	p.i += 3
+	return n
+}
+
+// heading parses a line like == text ==. The level is the smaller of the
+// number of ='s on each side.
+func (p *parser) heading() *Node {
+	start := p.i
+	line := strings.TrimRight(p.s[start:p.lineEnd()], " \t")
+
+	open := len(line) - len(strings.TrimLeft(line, "="))
+	close := len(line) - len(strings.TrimRight(line, "="))
+	level := open
+	if close < level {
+		level = close
+	}
+	if level > 6 {
+		level = 6
+	}
+	if level == 0 || len(line) <= 2*level {
+		return nil
+	}
+
+	n := &Node{Kind: Heading, Level: level}
+	end, inline := p.end, p.inline
+	p.i = start + level
+	p.end = start + len(line) - level
+	p.inline = true
+	n.Children = p.nodes(nil)
+	p.end, p.inline = end, inline
+
+	p.i = start + len(line)
+	return n
+}
+
+// table parses a {| ... |} table, one line at a time. A table that isn't
+// closed runs to the end of the text.
+func (p *parser) table() *Node {
+	end := p.lineEnd()
+	n := &Node{Kind: Table, Attrs: strings.TrimSpace(p.s[p.indent(p.i)+2 : end])}
+	p.i = end
+
+	var row, cell *Node
+	grow := func() {
+		if cell != nil {
+			cell.Raw = p.s[cell.Pos:p.i]
+		}
+		if row != nil {
+			row.Raw = p.s[row.Pos:p.i]
+		}
+	}
+	addCell := func(c *Node) {
+		if row == nil {
+			// Rows can start without a |-
+			row = &Node{Kind: Row, Pos: c.Pos}
+			n.Children = append(n.Children, row)
+		}
+		row.Children = append(row.Children, c)
+		cell = c
+		grow()
+	}
+
+	for p.i < p.end {
+		// Skip the newline
+		p.i++
+		line := p.i
+		k := p.indent(line)
+		rest := p.s[k:p.end]
+
+		switch {
+		case strings.HasPrefix(rest, "|}"):
+			p.i = k + 2
+			return n
+
+		case strings.HasPrefix(rest, "|-"):
+			p.i = p.lineEnd()
+			row = &Node{Kind: Row, Pos: line, Raw: p.s[line:p.i], Attrs: strings.TrimSpace(p.s[k+2 : p.i])}
+			n.Children = append(n.Children, row)
+			cell = nil
+
+		case strings.HasPrefix(rest, "|+"):
+			p.i = k + 2
+			c := &Node{Kind: Caption, Pos: line}
+			c.Children = p.nodes(func() bool { return p.at("\n") })
+			c.Raw = p.s[line:p.i]
+			n.Children = append(n.Children, c)
+
+		case strings.HasPrefix(rest, "{|"):
+			// A nested table, in the last cell
+			p.i = line
+			t := p.try(Table, p.table)
+			if cell == nil {
+				addCell(&Node{Kind: Cell, Pos: line})
+			}
+			cell.Children = append(cell.Children, t)
+			p.i = p.lineEnd()
+			grow()
+
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, "!"):
+			header := rest[0] == '!'
+			p.i = k + 1
+			for {
+				addCell(p.cell(header))
+				if !p.at("||") && !(header && p.at("!!")) {
+					break
+				}
+				p.i += 2
+			}
+
+		default:
+			// The content of the last cell carries on, from the newline
+			p.i = line - 1
+			nodes := p.nodes(func() bool { return p.at("\n") && p.tableLine() })
+			if cell != nil {
+				cell.Children = append(cell.Children, nodes...)
+				grow()
+			}
+		}
+	}
+	return n
+}
+
+// cell parses a table cell up to the next cell or the end of the line. If
+// it has a single | the part before it is attributes.
+func (p *parser) cell(header bool) *Node {
+	c := &Node{Kind: Cell, Header: header, Pos: p.i}
+	next := func() bool {
+		return p.at("\n") || p.at("||") || header && p.at("!!")
+	}
+
+	c.Children = p.nodes(func() bool { return next() || p.at("|") })
+	if p.at("|") && !p.at("||") {
+		c.Attrs = strings.TrimSpace(p.s[c.Pos:p.i])
+		p.i++
+		c.Children = p.nodes(next)
+	}
+	c.Raw = p.s[c.Pos:p.i]
+	return c
+}
+
+// tableLine reports whether the line after the newline at p.i is table
+// markup rather than more of a cell.
+func (p *parser) tableLine() bool {
+	k := p.indent(p.i + 1)
+	return k < p.end && (p.s[k] == '|' || p.s[k] == '!')
+}
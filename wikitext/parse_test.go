@@ -0,0 +1,97 @@
+package wikitext
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tree writes the nodes compactly, with the fields of each kind, for
+// comparing parses.
+func tree(nodes []*Node) string {
+	var parts []string
+	for _, n := range nodes {
+		var s string
+		switch n.Kind {
+		case Text, Comment:
+			s = fmt.Sprintf("%s%q", n.Kind, n.Raw)
+		case Link:
+			s = fmt.Sprintf("link(%s)", n.Target)
+		case Template, Argument:
+			s = fmt.Sprintf("%s(%s)", n.Kind, n.Name)
+			for _, p := range n.Params {
+				s += "|"
+				if p.Name != "" {
+					s += p.Name + "="
+				}
+				s += "[" + tree(p.Value) + "]"
+			}
+		case Heading:
+			s = fmt.Sprintf("heading%d", n.Level)
+		case Cell:
+			s = "cell"
+			if n.Header {
+				s = "header"
+			}
+		default:
+			s = n.Kind.String()
+		}
+		if n.Attrs != "" {
+			s += fmt.Sprintf("{%s}", n.Attrs)
+		}
+		if len(n.Children) > 0 {
+			s += "[" + tree(n.Children) + "]"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name, text, want string
+	}{
+		{"text", "just text", `text"just text"`},
+		{"link", "a [[Foo]] b", `text"a " link(Foo) text" b"`},
+		{"link label", "[[Foo bar|the [[Baz]] label]]", `link(Foo bar)[text"the " link(Baz) text" label"]`},
+		{"link across lines", "[[Foo\nbar]]", `text"[[Foo\nbar]]"`},
+		{"template", "{{Cite|title=T|2|x = y}}", `template(Cite)|title=[text"T"]|[text"2"]|x=[text" y"]`},
+		{"nested template", "{{A|{{B|c}}|d=[[E|f]]}}", `template(A)|[template(B)|[text"c"]]|d=[link(E)[text"f"]]`},
+		{"template with link in name", "{{#if:x|[[A|b]]}}", `template(#if:x)|[link(A)[text"b"]]`},
+		{"argument", "{{{1|default}}}", `argument(1)|[text"default"]`},
+		{"argument without default", "x{{{name}}}", `text"x" argument(name)`},
+		{"comment", "a<!-- c -->b", `text"a" comment"<!-- c -->" text"b"`},
+		{"unclosed comment", "a<!-- c", `text"a" comment"<!-- c"`},
+		{"heading", "== Intro ==\ntext", `heading2[text" Intro "] text"\ntext"`},
+		{"heading levels", "=== A ==\n", `heading2[text"= A "] text"\n"`},
+		{"heading with link", "==[[A]] b==", `heading2[link(A) text" b"]`},
+		{"heading mid-line", "x == A ==", `text"x == A =="`},
+		{"table", "{| class=w\n|+ Cap\n|-\n! H1 !! H2\n|-\n| a || b\n|}", `table{class=w}[caption[text" Cap"] row[header[text" H1 "] header[text" H2"]] row[cell[text" a "] cell[text" b"]]]`},
+		{"cell attributes", "{|\n| style=x | a\n|}", `table[row[cell{style=x}[text" a"]]]`},
+		{"nested table", "{|\n| a\n{|\n| b\n|}\n| c\n|}", `table[row[cell[text" a" table[row[cell[text" b"]]]] cell[text" c"]]]`},
+		{"multi-line cell", "{|\n| a\nmore\n|}", `table[row[cell[text" a" text"\nmore"]]]`},
+		{"unclosed link", "a [[Foo b", `text"a [[Foo b"`},
+		{"unclosed template", "{{Foo|[[A]]", `text"{{Foo|" link(A)`},
+		{"unclosed argument", "{{{1|x", `text"{{{1|x"`},
+		{"unclosed table", "{|\n| a", `table[row[cell[text" a"]]]`},
+		{"stray closers", "]] }} |}", `text"]] }} |}"`},
+	} {
+		nodes := Parse(tt.text)
+		if got := tree(nodes); got != tt.want {
+			t.Errorf("%s: Parse(%q) = %s, want %s", tt.name, tt.text, got, tt.want)
+		}
+		var raw strings.Builder
+		for _, n := range nodes {
+			raw.WriteString(n.Raw)
+		}
+		if raw.String() != tt.text {
+			t.Errorf("%s: the nodes' Raw joins to %q, want %q", tt.name, raw.String(), tt.text)
+		}
+		Walk(nodes, func(n *Node) bool {
+			if n.Pos < 0 || n.Pos+len(n.Raw) > len(tt.text) || tt.text[n.Pos:n.Pos+len(n.Raw)] != n.Raw {
+				t.Errorf("%s: %s node at %d doesn't hold %q", tt.name, n.Kind, n.Pos, n.Raw)
+			}
+			return true
+		})
+	}
+}
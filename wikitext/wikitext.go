@@ -0,0 +1,166 @@
+// Package wikitext parses MediaWiki markup into a simple tree of templates,
+// links, headings, tables and the text between them. It doesn't expand
+// anything and never fails: markup that isn't closed is kept as text.
+package wikitext
+
+import (
+	"strings"
+)
+
+// Kind is what a Node is.
+type Kind int
+
+// The kinds of Node.
+const (
+	// Text is plain text, or markup the parser doesn't know
+	Text Kind = iota
+	// Comment is an HTML comment
+	Comment
+	// Link is an internal link, [[Target|label]]
+	Link
+	// Template is a template or parser function, {{Name|params}}
+	Template
+	// Argument is a template parameter, {{{Name|default}}}
+	Argument
+	// Heading is a section heading, == text ==
+	Heading
+	// Table is a {| ... |} table. Its children are a Caption and Rows.
+	Table
+	// Caption is the |+ caption of a table
+	Caption
+	// Row is a table row, started with |- or implied by the first cell
+	Row
+	// Cell is a table cell, | or ! for a header cell
+	Cell
+)
+
+var kindNames = []string{"text", "comment", "link", "template", "argument", "heading", "table", "caption", "row", "cell"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// Node is a piece of parsed markup.
+type Node struct {
+	Kind Kind
+
+	// Pos is where the node starts in the parsed text and Raw is the markup
+	// it was parsed from
+	Pos int
+	Raw string
+
+	// Target is the page a link points to, as written. Name is the name of
+	// a template or argument.
+	Target string
+	Name   string
+
+	// Level is the heading level, from 1 to 6
+	Level int
+
+	// Header marks a table header cell. Attrs are the HTML attributes of a
+	// table, row or cell.
+	Header bool
+	Attrs  string
+
+	// Params are the parameters of a template, or the default of an
+	// argument
+	Params []Param
+
+	// Children are the label of a link, the text of a heading or caption,
+	// the rows of a table, the cells of a row or the content of a cell
+	Children []*Node
+}
+
+// Param is a template parameter. Positional parameters have no name.
+type Param struct {
+	Name  string
+	Value []*Node
+}
+
+// Inner returns the markup inside the brackets of a link, template or
+// argument, e.g. "Target|label" for [[Target|label]].
+func (n *Node) Inner() string {
+	switch n.Kind {
+	case Link, Template:
+		return n.Raw[2 : len(n.Raw)-2]
+	case Argument:
+		return n.Raw[3 : len(n.Raw)-3]
+	}
+	return n.Raw
+}
+
+// Walk calls fn for each node in document order, descending into the
+// children and parameters of those it returns true for.
+func Walk(nodes []*Node, fn func(n *Node) bool) {
+	for _, n := range nodes {
+		if !fn(n) {
+			continue
+		}
+		Walk(n.Children, fn)
+		for _, p := range n.Params {
+			Walk(p.Value, fn)
+		}
+	}
+}
+
+// Replace parses text and replaces the nodes fn returns true for with the
+// returned string. Nodes fn returns false for are left as they are, but
+// their children may still be replaced.
+func Replace(text string, fn func(n *Node) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	Walk(Parse(text), func(n *Node) bool {
+		s, ok := fn(n)
+		if !ok {
+			return true
+		}
+		b.WriteString(text[last:n.Pos])
+		b.WriteString(s)
+		last = n.Pos + len(n.Raw)
+		return false
+	})
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Plain renders the nodes as the text a reader would see: links become
+// their label, templates, arguments and comments disappear and table cells
+// are separated by tabs.
+func Plain(nodes []*Node) string {
+	var b strings.Builder
+	plain(&b, nodes)
+	return b.String()
+}
+
+func plain(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case Text:
+			b.WriteString(n.Raw)
+		case Link:
+			if len(n.Children) > 0 {
+				plain(b, n.Children)
+			} else {
+				b.WriteString(strings.TrimPrefix(strings.TrimSpace(n.Target), ":"))
+			}
+		case Heading, Caption:
+			plain(b, n.Children)
+			b.WriteString("\n")
+		case Table:
+			for _, c := range n.Children {
+				plain(b, []*Node{c})
+			}
+		case Row:
+			for i, c := range n.Children {
+				if i > 0 {
+					b.WriteString("\t")
+				}
+				b.WriteString(strings.TrimSpace(Plain(c.Children)))
+			}
+			b.WriteString("\n")
+		}
+	}
+}
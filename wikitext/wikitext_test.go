@@ -0,0 +1,32 @@
+package wikitext
+
+import "testing"
+
+func TestPlain(t *testing.T) {
+	for _, tt := range []struct{ text, want string }{
+		{"a [[Foo|bar]] [[:Category:X]] b", "a bar Category:X b"},
+		{"x{{Cite|y}}<!-- z -->{{{1}}}", "x"},
+		{"== Head ==\nbody", " Head \n\nbody"},
+		{"{|\n|+ Cap\n|-\n| a || [[B|b]]\n|}", " Cap\na\tb\n"},
+	} {
+		if got := Plain(Parse(tt.text)); got != tt.want {
+			t.Errorf("Plain(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	text := "a {{T|[[L]]}} [[M|{{U}}]] b"
+	got := Replace(text, func(n *Node) (string, bool) {
+		if n.Kind == Template && n.Name == "U" {
+			return "u", true
+		}
+		if n.Kind == Template {
+			return "<" + n.Inner() + ">", true
+		}
+		return "", false
+	})
+	if want := "a <T|[[L]]> [[M|u]] b"; got != want {
+		t.Errorf("Replace = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package xml
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Synonym is an anchor text used to link to a title.
+type Synonym struct {
+	Anchor string
+	Title  string
+	Count  int
+}
+
+// ReadSynonyms collects the anchor texts from a link graph TSV written with
+// -links and -link-anchors. Anchors that only differ from the title by case
+// are dropped, as are those used fewer than minCount times.
+func ReadSynonyms(path string, minCount int) ([]Synonym, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type key struct{ anchor, title string }
+	counts := make(map[key]int)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			continue
+		}
+		title := fields[2]
+		anchor := strings.Join(strings.Fields(fields[3]), " ")
+		if anchor == "" || strings.EqualFold(anchor, title) {
+			continue
+		}
+		counts[key{anchor, title}]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var synonyms []Synonym
+	for k, count := range counts {
+		if count < minCount {
+			continue
+		}
+		synonyms = append(synonyms, Synonym{Anchor: k.anchor, Title: k.title, Count: count})
+	}
+
+	sort.Slice(synonyms, func(i, j int) bool {
+		if synonyms[i].Title != synonyms[j].Title {
+			return synonyms[i].Title < synonyms[j].Title
+		}
+		if synonyms[i].Count != synonyms[j].Count {
+			return synonyms[i].Count > synonyms[j].Count
+		}
+		return synonyms[i].Anchor < synonyms[j].Anchor
+	})
+	return synonyms, nil
+}
@@ -0,0 +1,243 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Avro codecs we can write.
+const (
+	AvroNull    = "null"
+	AvroDeflate = "deflate"
+)
+
+// avroBlockSize is the number of records per container block.
+const avroBlockSize = 1000
+
+// avroSchema is the record schema, the same as schema/page.avsc which is the
+// published copy. Keep them in sync.
+const avroSchema = `{"type":"record","name":"Page","namespace":"org.wikireader","fields":[` +
+	`{"name":"id","type":"long"},` +
+	`{"name":"title","type":"string"},` +
+	`{"name":"ns","type":"int"},` +
+	`{"name":"revision_id","type":"long"},` +
+	`{"name":"timestamp","type":["null",{"type":"long","logicalType":"timestamp-millis"}],"default":null},` +
+	`{"name":"redirect","type":["null","string"],"default":null},` +
+	`{"name":"text","type":"string"},` +
+	`{"name":"categories","type":{"type":"array","items":"string"}},` +
+	`{"name":"short_description","type":["null","string"],"default":null},` +
+	`{"name":"coordinates","type":["null",{"type":"record","name":"Coordinates","fields":[` +
+	`{"name":"lat","type":"double"},{"name":"lon","type":"double"}]}],"default":null},` +
+	`{"name":"biography","type":["null",{"type":"record","name":"Biography","fields":[` +
+	`{"name":"birth_date","type":["null","string"],"default":null},` +
+	`{"name":"death_date","type":["null","string"],"default":null},` +
+	`{"name":"occupation","type":["null","string"],"default":null}]}],"default":null},` +
+	`{"name":"processing","type":["null",{"type":"record","name":"Processing","fields":[` +
+	`{"name":"transforms","type":{"type":"array","items":"string"}},` +
+	`{"name":"millis","type":["null","long"],"default":null},` +
+	`{"name":"fallbacks","type":{"type":"array","items":"string"}}]}],"default":null},` +
+	`{"name":"original_text","type":["null","string"],"default":null}]}`
+
+// AvroSink writes pages to an Avro object container file, which is typed,
+// compact and splittable on its sync markers.
+type AvroSink struct {
+	f     io.WriteCloser
+	w     *bufio.Writer
+	codec string
+	sync  [16]byte
+	block bytes.Buffer
+	count int
+}
+
+// NewAvroSink creates the container file at path using the codec. The sync
+// marker is random unless deterministic is set, when it's taken from the
+// schema so the same pages always make the same file.
+func NewAvroSink(path, codec string, deterministic bool) (*AvroSink, error) {
+	if codec != AvroNull && codec != AvroDeflate {
+		return nil, fmt.Errorf("unknown avro codec: %s", codec)
+	}
+
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &AvroSink{f: f, w: bufio.NewWriter(f), codec: codec}
+	if deterministic {
+		sum := sha256.Sum256([]byte(avroSchema))
+		copy(s.sync[:], sum[:])
+	} else if _, err := rand.Read(s.sync[:]); err != nil {
+		return nil, err
+	}
+
+	// The header is the magic, a map of metadata and the sync marker
+	var h bytes.Buffer
+	h.WriteString("Obj\x01")
+	avroLong(&h, 2)
+	avroString(&h, "avro.schema")
+	avroString(&h, avroSchema)
+	avroString(&h, "avro.codec")
+	avroString(&h, codec)
+	avroLong(&h, 0)
+	h.Write(s.sync[:])
+	if _, err := s.w.Write(h.Bytes()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WritePage implements Sink.
+func (s *AvroSink) WritePage(p *Page) error {
+	r := NewRecord(p)
+	id, _ := strconv.ParseInt(r.ID, 10, 64)
+	ns, _ := strconv.ParseInt(r.Ns, 10, 32)
+	revID, _ := strconv.ParseInt(r.RevisionID, 10, 64)
+
+	b := &s.block
+	avroLong(b, id)
+	avroString(b, r.Title)
+	avroLong(b, ns)
+	avroLong(b, revID)
+	if ts, err := time.Parse(time.RFC3339, r.Timestamp); err == nil {
+		avroLong(b, 1)
+		avroLong(b, ts.UnixNano()/int64(time.Millisecond))
+	} else {
+		avroLong(b, 0)
+	}
+	if r.Redirect != "" {
+		avroLong(b, 1)
+		avroString(b, r.Redirect)
+	} else {
+		avroLong(b, 0)
+	}
+	avroString(b, r.Text)
+	avroStrings(b, r.Categories)
+	if r.ShortDescription != "" {
+		avroLong(b, 1)
+		avroString(b, r.ShortDescription)
+	} else {
+		avroLong(b, 0)
+	}
+	if r.Coordinates != nil {
+		avroLong(b, 1)
+		avroDouble(b, r.Coordinates.Lat)
+		avroDouble(b, r.Coordinates.Lon)
+	} else {
+		avroLong(b, 0)
+	}
+	if r.Biography != nil {
+		avroLong(b, 1)
+		avroOptionalString(b, r.Biography.BirthDate)
+		avroOptionalString(b, r.Biography.DeathDate)
+		avroOptionalString(b, r.Biography.Occupation)
+	} else {
+		avroLong(b, 0)
+	}
+	if r.Processing != nil {
+		avroLong(b, 1)
+		avroStrings(b, r.Processing.Transforms)
+		if r.Processing.Millis > 0 {
+			avroLong(b, 1)
+			avroLong(b, r.Processing.Millis)
+		} else {
+			avroLong(b, 0)
+		}
+		avroStrings(b, r.Processing.Fallbacks)
+	} else {
+		avroLong(b, 0)
+	}
+	avroOptionalString(b, r.OriginalText)
+
+	s.count++
+	if s.count >= avroBlockSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered records as a block.
+func (s *AvroSink) flush() error {
+	if s.count == 0 {
+		return nil
+	}
+
+	data := s.block.Bytes()
+	if s.codec == AvroDeflate {
+		var z bytes.Buffer
+		fw, _ := flate.NewWriter(&z, flate.DefaultCompression)
+		fw.Write(data)
+		if err := fw.Close(); err != nil {
+			return err
+		}
+		data = z.Bytes()
+	}
+
+	var h bytes.Buffer
+	avroLong(&h, int64(s.count))
+	avroLong(&h, int64(len(data)))
+	s.w.Write(h.Bytes())
+	s.w.Write(data)
+	_, err := s.w.Write(s.sync[:])
+
+	s.block.Reset()
+	s.count = 0
+	return err
+}
+
+// Close implements Sink.
+func (s *AvroSink) Close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
+
+// avroLong writes a zigzag varint, which is also how Avro writes ints.
+func avroLong(b *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	b.Write(buf[:n])
+}
+
+func avroString(b *bytes.Buffer, v string) {
+	avroLong(b, int64(len(v)))
+	b.WriteString(v)
+}
+
+// avroOptionalString writes a ["null","string"] union, null if v is empty.
+func avroOptionalString(b *bytes.Buffer, v string) {
+	if v == "" {
+		avroLong(b, 0)
+		return
+	}
+	avroLong(b, 1)
+	avroString(b, v)
+}
+
+// avroStrings writes an array of strings as a single block.
+func avroStrings(b *bytes.Buffer, v []string) {
+	if len(v) > 0 {
+		avroLong(b, int64(len(v)))
+		for _, s := range v {
+			avroString(b, s)
+		}
+	}
+	avroLong(b, 0)
+}
+
+func avroDouble(b *bytes.Buffer, v float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	b.Write(buf[:])
+}
@@ -0,0 +1,147 @@
+package xml
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// Biography is what the infobox of a page about a person says about them.
+// Dates from the {{birth date}} family of templates are YYYY-MM-DD, or
+// shorter if only the year or month is known. Others are left as written.
+type Biography struct {
+	BirthDate  string `xml:"birthdate,omitempty" json:"birth_date,omitempty"`
+	DeathDate  string `xml:"deathdate,omitempty" json:"death_date,omitempty"`
+	Occupation string `xml:"occupation,omitempty" json:"occupation,omitempty"`
+}
+
+// dateTemplates are the templates giving a date in an infobox, lowercase.
+// Their first parameters are the year, month and day.
+var dateTemplates = map[string]bool{
+	"birth date": true, "birth date and age": true, "birth year and age": true, "bda": true,
+	"death date": true, "death date and age": true, "death year and age": true, "dda": true,
+	"birth-date": true, "birth-date and age": true, "death-date": true, "death-date and age": true,
+	"start date": true, "end date": true,
+}
+
+// listTemplates are the templates making a list of their parameters,
+// lowercase.
+var listTemplates = map[string]bool{
+	"hlist": true, "flatlist": true, "plainlist": true, "unbulleted list": true,
+	"ubl": true, "ubil": true, "cslist": true, "bulleted list": true,
+}
+
+// infoboxMarkup is the HTML left in infobox values: references, comments
+// and tags like <br />.
+var infoboxMarkup = regexp.MustCompile(`(?is)<ref\b[^>]*/>|<ref\b[^>]*>.*?</ref\s*>|<!--.*?-->|<[^>]+>`)
+
+// PageBiography returns the birth date, death date and occupation from the
+// first infobox on the page that has any of them. It's nil if there's none.
+func PageBiography(text string) *Biography {
+	var b *Biography
+	wikitext.Walk(wikitext.Parse(html.UnescapeString(text)), func(n *wikitext.Node) bool {
+		if b != nil {
+			return false
+		}
+		if n.Kind != wikitext.Template || !strings.HasPrefix(strings.ToLower(n.Name), "infobox") {
+			return true
+		}
+
+		var found Biography
+		for _, p := range n.Params {
+			switch strings.ToLower(strings.ReplaceAll(p.Name, " ", "_")) {
+			case "birth_date":
+				found.BirthDate = infoboxDate(p.Value)
+			case "death_date":
+				found.DeathDate = infoboxDate(p.Value)
+			case "occupation":
+				found.Occupation = infoboxText(p.Value)
+			}
+		}
+		if found != (Biography{}) {
+			b = &found
+		}
+		// Infoboxes can be nested in others
+		return true
+	})
+	return b
+}
+
+// infoboxDate returns the date an infobox value gives, as YYYY-MM-DD if it
+// comes from a date template.
+func infoboxDate(value []*wikitext.Node) string {
+	for _, n := range value {
+		if n.Kind != wikitext.Template || !dateTemplates[strings.ToLower(strings.ReplaceAll(n.Name, "_", " "))] {
+			continue
+		}
+		var parts []int
+		for _, p := range n.Params {
+			if p.Name != "" {
+				continue
+			}
+			s := strings.TrimSpace(wikitext.Plain(p.Value))
+			v, err := strconv.Atoi(s)
+			if err != nil {
+				if len(parts) == 0 && s != "" {
+					// A date written out, as in {{birth-date|14 March 1879}}
+					return cleanInfobox(s)
+				}
+				break
+			}
+			parts = append(parts, v)
+			if len(parts) == 3 {
+				break
+			}
+		}
+		switch {
+		case len(parts) == 3:
+			return fmt.Sprintf("%04d-%02d-%02d", parts[0], parts[1], parts[2])
+		case len(parts) == 2:
+			return fmt.Sprintf("%04d-%02d", parts[0], parts[1])
+		case len(parts) == 1:
+			return fmt.Sprintf("%04d", parts[0])
+		}
+	}
+	return infoboxText(value)
+}
+
+// infoboxText returns an infobox value as plain text, with lists separated
+// by commas.
+func infoboxText(value []*wikitext.Node) string {
+	var b strings.Builder
+	for _, n := range value {
+		switch {
+		case n.Kind == wikitext.Template && listTemplates[strings.ToLower(n.Name)]:
+			var items []string
+			for _, p := range n.Params {
+				if p.Name == "" {
+					items = append(items, wikitext.Plain(p.Value))
+				}
+			}
+			b.WriteString(strings.Join(items, "\n"))
+		default:
+			b.WriteString(wikitext.Plain([]*wikitext.Node{n}))
+		}
+	}
+	return cleanInfobox(b.String())
+}
+
+// cleanInfobox removes the markup left in an infobox value and puts the
+// items of a list on one line, separated by commas.
+func cleanInfobox(s string) string {
+	s = infoboxMarkup.ReplaceAllString(s, "\n")
+	var items []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.ReplaceAll(line, "''", "")
+		line = strings.Join(strings.Fields(strings.TrimLeft(strings.TrimSpace(line), "*#")), " ")
+		line = strings.Trim(line, ", ")
+		if line != "" {
+			items = append(items, line)
+		}
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,165 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// Blob codecs we can write. zstd would need a dependency, so LZ4 is the
+// fast one and deflate the small one.
+const (
+	BlobNone    = "none"
+	BlobLZ4     = "lz4"
+	BlobDeflate = "deflate"
+)
+
+// blobCodecs are the codec names in the order of their number in the file.
+var blobCodecs = []string{BlobNone, BlobLZ4, BlobDeflate}
+
+// blobMagic starts a blob file. It's followed by the number of the codec
+// and three bytes of padding.
+var blobMagic = []byte("WRBLOB01")
+
+// blobHeaderSize is the size of the file header. Each article then has a
+// header of its compressed and uncompressed sizes as little endian uint32s.
+const blobHeaderSize = 12
+
+// BlobSink packs the text of each page into a blob file, compressed on its
+// own so a single article can be read from its offset without touching the
+// others. See ReadBlobArticle. The offsets are written to an index with the same columns as the
+// xml output's, where the length covers the article's header.
+type BlobSink struct {
+	codec  byte
+	f      io.WriteCloser
+	w      *bufio.Writer
+	index  *tsvFile
+	offset int64
+}
+
+// NewBlobSink creates the blob file at path and its index at indexPath.
+func NewBlobSink(path, indexPath, codec string) (*BlobSink, error) {
+	n := -1
+	for i, name := range blobCodecs {
+		if name == codec {
+			n = i
+		}
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("unknown blob codec: %s", codec)
+	}
+
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := createTSV(indexPath)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := &BlobSink{codec: byte(n), f: f, w: bufio.NewWriter(f), index: index}
+
+	header := make([]byte, blobHeaderSize-len(blobMagic))
+	header[0] = s.codec
+	if err := s.write(append(append([]byte{}, blobMagic...), header...)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *BlobSink) write(b []byte) error {
+	n, err := s.w.Write(b)
+	s.offset += int64(n)
+	return err
+}
+
+// WritePage implements Sink.
+func (s *BlobSink) WritePage(p *Page) error {
+	r := NewRecord(p)
+	text := []byte(r.Text)
+	data, err := blobCompress(text, blobCodecs[s.codec])
+	if err != nil {
+		return err
+	}
+
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(text)))
+
+	offset := s.offset
+	if err := s.write(header[:]); err != nil {
+		return err
+	}
+	if err := s.write(data); err != nil {
+		return err
+	}
+	return s.index.Write(r.ID, r.Title, strconv.FormatInt(offset, 10), strconv.FormatInt(s.offset-offset, 10))
+}
+
+// Close implements Sink.
+func (s *BlobSink) Close() error {
+	if err := s.index.Close(); err != nil {
+		s.f.Close()
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+func blobCompress(text []byte, codec string) ([]byte, error) {
+	switch codec {
+	case BlobLZ4:
+		return lz4Compress(text), nil
+	case BlobDeflate:
+		var b bytes.Buffer
+		fw, _ := flate.NewWriter(&b, flate.BestCompression)
+		fw.Write(text)
+		if err := fw.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	return text, nil
+}
+
+// ReadBlobArticle reads the text of the article at offset in a blob file,
+// as listed in its index.
+func ReadBlobArticle(r io.ReaderAt, offset int64) (string, error) {
+	var header [blobHeaderSize]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return "", err
+	}
+	if !bytes.Equal(header[:len(blobMagic)], blobMagic) || int(header[len(blobMagic)]) >= len(blobCodecs) {
+		return "", fmt.Errorf("not a blob file")
+	}
+	codec := blobCodecs[header[len(blobMagic)]]
+
+	var sizes [8]byte
+	if _, err := r.ReadAt(sizes[:], offset); err != nil {
+		return "", err
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(sizes[:4]))
+	size := int(binary.LittleEndian.Uint32(sizes[4:]))
+	if _, err := r.ReadAt(data, offset+int64(len(sizes))); err != nil {
+		return "", err
+	}
+
+	switch codec {
+	case BlobLZ4:
+		text, err := lz4Decompress(data, size)
+		return string(text), err
+	case BlobDeflate:
+		text, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+		return string(text), err
+	}
+	return string(data), nil
+}
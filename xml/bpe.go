@@ -0,0 +1,105 @@
+package xml
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// BPE counts tokens with a GPT-2 style byte-level BPE tokenizer, loaded from
+// its merges.txt. Only the merges are needed to count tokens.
+type BPE struct {
+	ranks map[[2]string]int
+	bytes [256]string
+	cache map[string]int
+}
+
+// bpeSplit approximates the GPT-2 pre-tokenizer. Go regexps don't support
+// the lookahead it uses for whitespace, so runs of whitespace are kept
+// whole.
+var bpeSplit = regexp.MustCompile(`'s|'t|'re|'ve|'m|'ll|'d| ?\pL+| ?\pN+| ?[^\s\pL\pN]+|\s+`)
+
+// NewBPE reads a merges file, one "a b" pair per line in rank order.
+func NewBPE(path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := &BPE{ranks: make(map[[2]string]int), cache: make(map[string]int)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#version") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		b.ranks[[2]string{parts[0], parts[1]}] = len(b.ranks)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// GPT-2 maps every byte to a printable rune so merges can be written as
+	// text
+	n := 0
+	for i := 0; i < 256; i++ {
+		if (i >= '!' && i <= '~') || (i >= 0xa1 && i <= 0xac) || (i >= 0xae && i <= 0xff) {
+			b.bytes[i] = string(rune(i))
+		} else {
+			b.bytes[i] = string(rune(256 + n))
+			n++
+		}
+	}
+	return b, nil
+}
+
+// Count returns the number of BPE tokens in the text. It isn't safe for
+// concurrent use.
+func (b *BPE) Count(text string) int {
+	total := 0
+	for _, word := range bpeSplit.FindAllString(text, -1) {
+		total += b.countWord(word)
+	}
+	return total
+}
+
+// countWord applies the merges to a single pre-token.
+func (b *BPE) countWord(word string) int {
+	if n, ok := b.cache[word]; ok {
+		return n
+	}
+
+	symbols := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		symbols[i] = b.bytes[word[i]]
+	}
+
+	for len(symbols) > 1 {
+		best := -1
+		bestRank := 0
+		for i := 0; i < len(symbols)-1; i++ {
+			rank, ok := b.ranks[[2]string{symbols[i], symbols[i+1]}]
+			if ok && (best < 0 || rank < bestRank) {
+				best = i
+				bestRank = rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	// Keep the cache from growing without bound on huge corpora
+	if len(b.cache) < 1000000 {
+		b.cache[word] = len(symbols)
+	}
+	return len(symbols)
+}
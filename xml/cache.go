@@ -0,0 +1,96 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+)
+
+// cacheMagic starts every page cache, so it can be given as an input in
+// place of the dump it was extracted from.
+var cacheMagic = []byte("wikireader pages 1\n")
+
+// CacheSink writes decoded pages to the intermediate page cache: the magic
+// line followed by a gzipped gob stream. Reading it back skips the XML
+// decode, which is most of the cost of a run.
+type CacheSink struct {
+	f   io.WriteCloser
+	w   *bufio.Writer
+	z   *gzip.Writer
+	enc *gob.Encoder
+}
+
+// NewCacheSink creates the page cache at path.
+func NewCacheSink(path string) (*CacheSink, error) {
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	if _, err := w.Write(cacheMagic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	z, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	return &CacheSink{f: f, w: w, z: z, enc: gob.NewEncoder(z)}, nil
+}
+
+// WritePage implements Sink.
+func (s *CacheSink) WritePage(p *Page) error {
+	return s.enc.Encode(p)
+}
+
+// Close implements Sink.
+func (s *CacheSink) Close() error {
+	if err := s.z.Close(); err != nil {
+		s.f.Close()
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// isCache reports whether the input is a page cache rather than a dump.
+func isCache(r *bufio.Reader) bool {
+	b, _ := r.Peek(len(cacheMagic))
+	return bytes.Equal(b, cacheMagic)
+}
+
+// readCache calls fn for every page in a page cache.
+func readCache(r *bufio.Reader, fn func(p *Page)) error {
+	return readCacheUntil(r, func(p *Page) error {
+		fn(p)
+		return nil
+	})
+}
+
+// readCacheUntil calls fn for the pages in a page cache until it returns
+// an error.
+func readCacheUntil(r *bufio.Reader, fn func(p *Page) error) error {
+	if _, err := r.Discard(len(cacheMagic)); err != nil {
+		return err
+	}
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	dec := gob.NewDecoder(z)
+	for {
+		var p Page
+		if err := dec.Decode(&p); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package xml
+
+import (
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// categoryPrefixes are the (lowercase) link prefixes for the category
+// namespace.
+var categoryPrefixes = []string{"category:", "kategorie:", "catégorie:", "categoría:"}
+
+// Categories returns the names of all categories the text links to, without
+// the namespace prefix or sort key.
+func Categories(text string) []string {
+	var cats []string
+	for _, link := range links(text) {
+		lower := strings.ToLower(link)
+		for _, prefix := range categoryPrefixes {
+			if !strings.HasPrefix(lower, prefix) {
+				continue
+			}
+			name := link[len(prefix):]
+			if i := strings.Index(name, "|"); i >= 0 {
+				name = name[:i]
+			}
+			name = strings.TrimSpace(name)
+			if name != "" {
+				cats = append(cats, name)
+			}
+			break
+		}
+	}
+	return cats
+}
+
+// links returns the raw contents of every [[...]] link in the text,
+// including those in the labels of other links.
+func links(text string) []string {
+	var found []string
+	wikitext.Walk(wikitext.Parse(text), func(n *wikitext.Node) bool {
+		if n.Kind == wikitext.Link {
+			found = append(found, strings.TrimSpace(n.Inner()))
+		}
+		return true
+	})
+	return found
+}
@@ -0,0 +1,65 @@
+package xml
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// checksums collects the SHA-256 of each output file and an order
+// independent hash of all pages, which is the sum of the page hashes modulo
+// 2^256.
+type checksums struct {
+	mu      sync.Mutex
+	paths   []string
+	files   map[string][]byte
+	content [sha256.Size]byte
+	pages   int
+}
+
+func newChecksums() *checksums {
+	return &checksums{files: make(map[string][]byte)}
+}
+
+// addPage adds a single page to the content hash.
+func (c *checksums) addPage(page []byte) {
+	sum := sha256.Sum256(page)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	carry := 0
+	for i := len(sum) - 1; i >= 0; i-- {
+		v := int(c.content[i]) + int(sum[i]) + carry
+		c.content[i] = byte(v)
+		carry = v >> 8
+	}
+	c.pages++
+}
+
+// addFile records the hash of a complete output file.
+func (c *checksums) addFile(path string, sum []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paths = append(c.paths, path)
+	c.files[path] = sum
+}
+
+// write saves the checksums in the format used by sha256sum, so the files can
+// be checked with `sha256sum -c`. The content hash is written as a comment.
+func (c *checksums) write(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range c.paths {
+		fmt.Fprintf(f, "%x  %s\n", c.files[p], p)
+	}
+	fmt.Fprintf(f, "# content %x pages %d\n", c.content, c.pages)
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package xml
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Chunk is a piece of an article's text sized for embedding.
+type Chunk struct {
+	ID      string `json:"id"`
+	PageID  string `json:"page_id"`
+	Title   string `json:"title"`
+	Section string `json:"section"`
+	// ShortDescription is the page's, repeated in each chunk for context
+	ShortDescription string `json:"short_description,omitempty"`
+	Index            int    `json:"chunk"`
+	Text             string `json:"text"`
+}
+
+// ChunkText splits text into chunks of about size whitespace separated
+// tokens, each repeating the last overlap tokens of the one before. Chunks
+// never span sections, so each can carry its section heading.
+func ChunkText(text string, size, overlap int) []Chunk {
+	if overlap >= size {
+		overlap = size - 1
+	}
+
+	var chunks []Chunk
+	section := ""
+	var words []string
+
+	flush := func() {
+		for start := 0; start < len(words); start += size - overlap {
+			end := start + size
+			if end > len(words) {
+				end = len(words)
+			}
+			chunks = append(chunks, Chunk{
+				Section: section,
+				Index:   len(chunks),
+				Text:    strings.Join(words[start:end], " "),
+			})
+			if end == len(words) {
+				break
+			}
+		}
+		words = words[:0]
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if heading, ok := parseHeading(line); ok {
+			flush()
+			section = heading
+			continue
+		}
+		words = append(words, strings.Fields(line)...)
+	}
+	flush()
+	return chunks
+}
+
+// parseHeading returns the text of a "== Heading ==" line.
+func parseHeading(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if len(line) < 4 || !strings.HasPrefix(line, "==") || !strings.HasSuffix(line, "==") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.Trim(line, "=")), true
+}
+
+// ChunkSink writes the chunks of each page as JSON lines.
+type ChunkSink struct {
+	Size    int
+	Overlap int
+
+	f   io.WriteCloser
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewChunkSink creates the JSONL file at path.
+func NewChunkSink(path string, size, overlap int) (*ChunkSink, error) {
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &ChunkSink{Size: size, Overlap: overlap, f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// WritePage implements Sink. Redirects have nothing worth embedding.
+func (s *ChunkSink) WritePage(p *Page) error {
+	if IsRedirect(p) {
+		return nil
+	}
+
+	r := NewRecord(p)
+	for _, c := range ChunkText(r.Text, s.Size, s.Overlap) {
+		c.ID = p.ID + "-" + strconv.Itoa(c.Index)
+		c.PageID = p.ID
+		c.Title = p.Title
+		c.ShortDescription = r.ShortDescription
+		if err := s.enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *ChunkSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
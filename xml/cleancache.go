@@ -0,0 +1,104 @@
+package xml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// cleanCache keeps the output of the parse script on disk, one file per
+// revision named by its SHA-1, so unchanged revisions are never cleaned
+// twice. Each version of the script and the way it's invoked gets its own
+// directory, since its output is only good for the script that made it.
+type cleanCache struct {
+	dir    string
+	hits   int64
+	misses int64
+}
+
+// newCleanCache opens (or creates) the cache under dir for the script run
+// with the given prefix, arguments and environment. Without a script the
+// invocation alone, such as a clean service's URL, keys the cache.
+func newCleanCache(dir, script string, invocation []string) (*cleanCache, error) {
+	h := sha256.New()
+	if script != "" {
+		f, err := os.Open(script)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Without an invocation the directory stays the same as before there
+	// could be one
+	for _, s := range invocation {
+		h.Write([]byte("\x00" + s))
+	}
+
+	dir = filepath.Join(dir, hex.EncodeToString(h.Sum(nil))[:16])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &cleanCache{dir: dir}, nil
+}
+
+// cleanKey is the cache key for a page: the SHA-1 from the dump, or of the
+// text if the dump doesn't have a usable one.
+func cleanKey(p *Page) string {
+	sha := p.Revision.Sha1
+	if sha == "" || strings.TrimLeft(sha, "0123456789abcdefghijklmnopqrstuvwxyz") != "" {
+		return Sha1Base36(p.Revision.Text.Text)
+	}
+	return sha
+}
+
+// path spreads the entries over subdirectories so none get too large.
+func (c *cleanCache) path(key string) string {
+	if len(key) < 3 {
+		return filepath.Join(c.dir, key)
+	}
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// get returns the cleaned text for the key, if it's been cached.
+func (c *cleanCache) get(key string) (string, bool) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		atomic.AddInt64(&c.misses, 1)
+		return "", false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return string(b), true
+}
+
+// put stores the cleaned text for the key. It's written to a temporary
+// file first, so a crash or another worker never sees a partial entry.
+func (c *cleanCache) put(key, text string) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,113 @@
+package xml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// cleanServiceRetries is how often a page is retried when the service fails
+// or pushes back.
+const cleanServiceRetries = 5
+
+// CleanService cleans pages by POSTing their text to a local HTTP service
+// instead of running the parse script, for cleaning code that's too slow to
+// start for every page. The body of a 200 response is the cleaned text.
+// Connection errors, 429 and 5xx responses are retried with backoff, and
+// at most Concurrency requests are made at once over pooled connections.
+type CleanService struct {
+	URL         string
+	Concurrency int
+
+	client *http.Client
+	slots  *Pool
+}
+
+// NewCleanService returns a service at rawurl taking up to concurrency
+// requests at once, each of which may take up to timeout.
+func NewCleanService(rawurl string, concurrency int, timeout time.Duration) (*CleanService, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("clean service: not an http URL: %s", rawurl)
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("clean service: concurrency must be at least 1")
+	}
+	return &CleanService{
+		URL:         rawurl,
+		Concurrency: concurrency,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				MaxConnsPerHost:     concurrency,
+				MaxIdleConnsPerHost: concurrency,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		slots: NewPool(concurrency),
+	}, nil
+}
+
+// clean sends the text of p to the service, with its title, namespace and
+// ID as query parameters, and returns the cleaned text.
+func (s *CleanService) clean(p *Page, text string) (string, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("title", p.Title)
+	q.Set("ns", p.Ns)
+	q.Set("id", p.ID)
+	u.RawQuery = q.Encode()
+
+	s.slots.acquire()
+	defer s.slots.release()
+
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		cleaned, retry, err := s.post(u.String(), text)
+		if err == nil || !retry {
+			return cleaned, err
+		}
+		if attempt == cleanServiceRetries {
+			return "", fmt.Errorf("clean service: giving up on %s after %d retries: %v", p.Title, cleanServiceRetries, err)
+		}
+		log.Printf("clean service: retrying %s in %s: %v", p.Title, backoff, err)
+	}
+}
+
+// post makes a single request. retry is set when it's worth trying again.
+func (s *CleanService) post(u, text string) (cleaned string, retry bool, err error) {
+	resp, err := s.client.Post(u, "text/plain; charset=utf-8", strings.NewReader(text))
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", true, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return "", true, fmt.Errorf("%s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Anything else won't get better by retrying
+		return "", false, fmt.Errorf("clean service: %s: %s", resp.Status, body)
+	}
+	return string(body), false, nil
+}
@@ -0,0 +1,199 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+)
+
+// Policies for pages with the same title.
+const (
+	// CollisionFirst keeps the first page read
+	CollisionFirst = "first"
+	// CollisionLatest keeps the page with the newest revision
+	CollisionLatest = "latest"
+	// CollisionLargest keeps the page with the most text
+	CollisionLargest = "largest"
+	// CollisionReport keeps none of them, they're only listed in the
+	// collision report for someone to sort out
+	CollisionReport = "report"
+)
+
+// ValidCollisionPolicy returns an error if the policy isn't one we know.
+func ValidCollisionPolicy(policy string) error {
+	switch policy {
+	case CollisionFirst, CollisionLatest, CollisionLargest, CollisionReport:
+		return nil
+	}
+	return fmt.Errorf("unknown title collision policy: %s", policy)
+}
+
+// pageVersion is what the policies compare between pages with the same
+// title.
+type pageVersion struct {
+	timestamp string
+	revision  int64
+	size      int
+}
+
+// newer reports whether v is a later revision than o.
+func (v pageVersion) newer(o pageVersion) bool {
+	if v.timestamp != o.timestamp {
+		return v.timestamp > o.timestamp
+	}
+	return v.revision > o.revision
+}
+
+// versionOf returns the version of a decoded page.
+func versionOf(p *Page) pageVersion {
+	rev, _ := strconv.ParseInt(p.Revision.ID, 10, 64)
+	return pageVersion{timestamp: p.Revision.Timestamp, revision: rev, size: len(p.Revision.Text.Text)}
+}
+
+// collisionWinners reads through the inputs once, without decoding them, to
+// find the titles that appear more than once. It returns which occurrence
+// of each of them to keep, counting from 0, or -1 to keep none.
+func (w *Worker) collisionWinners() map[string]int {
+	type best struct {
+		count   int
+		winner  int
+		version pageVersion
+	}
+	titles := make(map[string]*best)
+
+	add := func(title string, v pageVersion) {
+		b, ok := titles[title]
+		if !ok {
+			titles[title] = &best{count: 1, version: v}
+			return
+		}
+
+		better := false
+		switch w.CollisionPolicy {
+		case CollisionLatest:
+			better = v.newer(b.version)
+		case CollisionLargest:
+			better = v.size > b.version.size
+		}
+		if better {
+			b.winner = b.count
+			b.version = v
+		}
+		b.count++
+	}
+
+	for input := range w.inputs() {
+		log.Println("finding title collisions:", input)
+		if err := w.scanVersions(input, add); err != nil {
+			panic(err)
+		}
+	}
+
+	winners := make(map[string]int)
+	for title, b := range titles {
+		if b.count < 2 {
+			continue
+		}
+		if w.CollisionPolicy == CollisionReport {
+			winners[title] = -1
+		} else {
+			winners[title] = b.winner
+		}
+	}
+	log.Printf("%d titles appear more than once", len(winners))
+	return winners
+}
+
+// scanVersions calls fn with the title and version of every page in the
+// input. Dumps are only scanned for the few elements needed.
+func (w *Worker) scanVersions(input string, fn func(title string, v pageVersion)) error {
+	f, err := w.open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if isCache(r) {
+		return readCache(r, func(p *Page) {
+			if w.keepDecoded(p) {
+				fn(p.Title, versionOf(p))
+			}
+		})
+	}
+
+	s := w.newScanner(f, r)
+	for s.Scan() {
+		page := s.Bytes()
+		if !w.keepRaw(page) {
+			// Never reaches deduplication
+			continue
+		}
+		var v pageVersion
+		if i := bytes.Index(page, []byte("<revision")); i >= 0 {
+			rev := page[i:]
+			v.revision, _ = strconv.ParseInt(string(elementText(rev, "id")), 10, 64)
+			v.timestamp = string(elementText(rev, "timestamp"))
+			v.size = len(elementText(rev, "text"))
+		}
+		// The decoder unescapes the title
+		fn(html.UnescapeString(string(elementText(page, "title"))), v)
+	}
+	return s.Err()
+}
+
+// elementText returns the raw content of the first element with the name.
+func elementText(b []byte, name string) []byte {
+	start := bytes.Index(b, []byte("<"+name))
+	for start >= 0 {
+		rest := b[start+1+len(name):]
+		if len(rest) > 0 && (rest[0] == '>' || rest[0] == ' ') {
+			break
+		}
+		next := bytes.Index(rest, []byte("<"+name))
+		if next < 0 {
+			return nil
+		}
+		start += 1 + len(name) + next
+	}
+	if start < 0 {
+		return nil
+	}
+
+	b = b[start:]
+	open := bytes.IndexByte(b, '>')
+	if open < 0 || b[open-1] == '/' {
+		return nil
+	}
+	b = b[open+1:]
+	end := bytes.Index(b, []byte("</"+name+">"))
+	if end < 0 {
+		return nil
+	}
+	return b[:end]
+}
+
+// keepTitle decides whether the nth page read with the title is kept, and
+// lists it in the collision report if the title is shared.
+func (w *Worker) keepTitle(p *Page, n int, report *tsvFile) bool {
+	winner, collided := w.winners[p.Title]
+	if !collided {
+		return n == 0
+	}
+
+	keep := winner == n
+	if report != nil {
+		v := versionOf(p)
+		action := "dropped"
+		if keep {
+			action = "kept"
+		}
+		if err := report.Write(p.Title, p.ID, p.Revision.ID, v.timestamp, strconv.Itoa(v.size), action); err != nil {
+			w.fatal(&WriteError{Output: w.CollisionFile, Title: p.Title, Err: err})
+		}
+	}
+	return keep
+}
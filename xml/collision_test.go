@@ -0,0 +1,98 @@
+package xml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const collisionDump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="en">
+  <page>
+    <title>Dup</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision>
+      <id>10</id>
+      <timestamp>2001-01-01T00:00:00Z</timestamp>
+      <text xml:space="preserve">Oldest.</text>
+    </revision>
+  </page>
+  <page>
+    <title>Dup</title>
+    <ns>0</ns>
+    <id>2</id>
+    <revision>
+      <id>11</id>
+      <timestamp>2003-01-01T00:00:00Z</timestamp>
+      <text xml:space="preserve">Newest.</text>
+    </revision>
+  </page>
+  <page>
+    <title>Dup</title>
+    <ns>0</ns>
+    <id>3</id>
+    <revision>
+      <id>12</id>
+      <timestamp>2002-01-01T00:00:00Z</timestamp>
+      <text xml:space="preserve">The middle one, the longest.</text>
+    </revision>
+  </page>
+</mediawiki>
+`
+
+func TestCollisionWithDecodedHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := filepath.Join(dir, "dump.xml")
+	if err := ioutil.WriteFile(dump, []byte(collisionDump), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		policy string
+		report bool
+		drop   string
+		want   []string
+	}{
+		{name: "default", want: []string{"1"}},
+		// The first page is the first the hook keeps
+		{name: "default, first dropped", drop: "1", want: []string{"2"}},
+		{name: "first with report, first dropped", policy: CollisionFirst, report: true, drop: "1", want: []string{"2"}},
+		// Dropping a page mustn't shift which occurrence wins
+		{name: "latest, first dropped", policy: CollisionLatest, drop: "1", want: []string{"2"}},
+		{name: "latest, winner dropped", policy: CollisionLatest, drop: "2", want: nil},
+		{name: "largest, first dropped", policy: CollisionLargest, drop: "1", want: []string{"3"}},
+	} {
+		w := NewWorker(dump, filepath.Join(dir, "out.xml"), "", 1)
+		w.Extract = true
+		if tt.policy != "" {
+			w.CollisionPolicy = tt.policy
+		}
+		if tt.report {
+			w.CollisionFile = filepath.Join(dir, "collisions.tsv")
+		}
+		drop := tt.drop
+		w.OnPageDecoded = func(p *Page) bool { return p.ID != drop }
+		var mu sync.Mutex
+		var written []string
+		w.OnPageWritten = func(p *Page) {
+			mu.Lock()
+			written = append(written, p.ID)
+			mu.Unlock()
+		}
+		if err := w.Start(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(written, tt.want) {
+			t.Errorf("%s: written pages = %v, want %v", tt.name, written, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package xml
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// CompareOptions says how close two outputs have to be for their pages to
+// match in CompareOutputs.
+type CompareOptions struct {
+	// Normalize collapses runs of whitespace before the texts are compared
+	Normalize bool
+	// MaxDistance is how many bits the SimHashes of two texts that aren't
+	// the same may differ by for the page to still match
+	MaxDistance int
+}
+
+// PageMismatch is a page in both outputs whose texts are too far apart.
+type PageMismatch struct {
+	Title string
+	// Distance is between the SimHashes of the texts
+	Distance int
+}
+
+// CompareResult is what CompareOutputs found. Titles are sorted, and the
+// mismatches are the furthest apart first.
+type CompareResult struct {
+	// Pages is how many pages are in both outputs
+	Pages int
+	// Identical pages have the same text, Similar ones are within
+	// MaxDistance
+	Identical  int
+	Similar    int
+	Mismatched []PageMismatch
+	// Missing pages are only in the first output, Extra only in the second
+	Missing []string
+	Extra   []string
+}
+
+// Match reports whether the outputs have the same pages, all matching.
+func (r *CompareResult) Match() bool {
+	return len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// comparedPage is what's remembered of a page of the first output.
+type comparedPage struct {
+	sum  [sha256.Size]byte
+	hash uint64
+	seen bool
+}
+
+// CompareOutputs compares the pages of two processed outputs by title,
+// e.g. to check a new cleaner against the one it replaces. The first is
+// held in memory as hashes.
+func CompareOutputs(a, b string, opts CompareOptions) (*CompareResult, error) {
+	first := make(map[string]*comparedPage)
+	err := ReadPages(a, func(p *Page) error {
+		text := CompareText(p, opts)
+		first[p.Title] = &comparedPage{sum: sha256.Sum256([]byte(text)), hash: SimHash(text)}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &CompareResult{}
+	err = ReadPages(b, func(p *Page) error {
+		cp, ok := first[p.Title]
+		if !ok {
+			r.Extra = append(r.Extra, p.Title)
+			return nil
+		}
+		cp.seen = true
+		r.Pages++
+
+		text := CompareText(p, opts)
+		if cp.sum == sha256.Sum256([]byte(text)) {
+			r.Identical++
+			return nil
+		}
+		d := bits.OnesCount64(cp.hash ^ SimHash(text))
+		if d <= opts.MaxDistance {
+			r.Similar++
+			return nil
+		}
+		r.Mismatched = append(r.Mismatched, PageMismatch{Title: p.Title, Distance: d})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for title, cp := range first {
+		if !cp.seen {
+			r.Missing = append(r.Missing, title)
+		}
+	}
+	sort.Strings(r.Missing)
+	sort.Strings(r.Extra)
+	sort.Slice(r.Mismatched, func(i, j int) bool {
+		if r.Mismatched[i].Distance != r.Mismatched[j].Distance {
+			return r.Mismatched[i].Distance > r.Mismatched[j].Distance
+		}
+		return r.Mismatched[i].Title < r.Mismatched[j].Title
+	})
+	return r, nil
+}
+
+// CompareText returns the text of a page as CompareOutputs compares it.
+func CompareText(p *Page, opts CompareOptions) string {
+	text := NewRecord(p).Text
+	if opts.Normalize {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	return text
+}
@@ -0,0 +1,250 @@
+package xml
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Transforms that can be applied to the pages of a namespace.
+const (
+	// TransformClean runs the page through the parse script.
+	TransformClean = "clean"
+	// TransformRaw keeps the page text as-is.
+	TransformRaw = "raw"
+	// TransformCategories keeps only the title and category links.
+	TransformCategories = "categories"
+	// TransformSkip drops the page entirely.
+	TransformSkip = "skip"
+)
+
+// Config is the optional JSON config file.
+type Config struct {
+	// Namespaces maps a namespace number (e.g. "14") to its settings.
+	// The key "default" applies to any namespace not listed.
+	Namespaces map[string]NamespaceConfig `json:"namespaces"`
+
+	// Languages, if set, are the wikis built together by the batch command,
+	// each into its own output directory
+	Languages []LanguageConfig `json:"languages"`
+
+	// Redactions are applied in order to each page once it's cleaned, to
+	// take out the boilerplate the script leaves behind
+	Redactions []Redaction `json:"redactions"`
+
+	// ExtensionTags are the policies for extension tags like hiero and
+	// score, e.g. {"score": "placeholder"}. See Worker.ExtensionTags.
+	ExtensionTags map[string]string `json:"extension_tags"`
+}
+
+// Fields a Redaction applies to.
+const (
+	RedactText  = "text"
+	RedactTitle = "title"
+)
+
+// Redaction replaces what Pattern matches in a field of the page, the text
+// unless Field is RedactTitle. The text is matched as it's escaped in the
+// XML, so a < in it is &lt;, and Replace is escaped to match. Replace can
+// refer to the groups of Pattern as in regexp.Expand, e.g. $1.
+type Redaction struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+	Field   string `json:"field"`
+
+	re *regexp.Regexp
+}
+
+// LanguageConfig is the build of one wiki in a batch. Anything left out
+// uses the same default as the command line.
+type LanguageConfig struct {
+	// Name identifies the build in the logs and summary, e.g. "en"
+	Name string `json:"name"`
+	// Inputs are the dump files, each of which may be a glob
+	Inputs []string `json:"inputs"`
+	// OutDir receives pages.xml and the other outputs asked for
+	OutDir string `json:"out_dir"`
+	Script string `json:"script"`
+
+	Disambig        string `json:"disambig"`
+	Encoding        string `json:"encoding"`
+	MaxArticleBytes int    `json:"max_article_bytes"`
+
+	// Index, Categories, Links and Stats add pages.idx, categories.tsv,
+	// links.tsv and stats.json to OutDir
+	Index      bool `json:"index"`
+	Categories bool `json:"categories"`
+	Links      bool `json:"links"`
+	Stats      bool `json:"stats"`
+
+	// Namespaces override the top level namespace settings for this wiki
+	Namespaces map[string]NamespaceConfig `json:"namespaces"`
+
+	// Redactions are applied after the top level ones for this wiki
+	Redactions []Redaction `json:"redactions"`
+
+	// ExtensionTags override the top level policies for this wiki
+	ExtensionTags map[string]string `json:"extension_tags"`
+}
+
+// NamespaceConfig is the processing for a single namespace.
+type NamespaceConfig struct {
+	Transform string `json:"transform"`
+}
+
+// LoadConfig reads and checks the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Config
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+
+	if err := checkNamespaces(c.Namespaces); err != nil {
+		return nil, err
+	}
+	if err := compileRedactions(c.Redactions); err != nil {
+		return nil, err
+	}
+	if err := checkExtensionTags(c.ExtensionTags); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, l := range c.Languages {
+		if l.Name == "" || len(l.Inputs) == 0 || l.OutDir == "" {
+			return nil, fmt.Errorf("reading config %s: each language needs a name, inputs and out_dir", path)
+		}
+		if names[l.Name] {
+			return nil, fmt.Errorf("language %s is listed twice", l.Name)
+		}
+		if dirs[filepath.Clean(l.OutDir)] {
+			return nil, fmt.Errorf("language %s: out_dir %s is shared with another language", l.Name, l.OutDir)
+		}
+		names[l.Name] = true
+		dirs[filepath.Clean(l.OutDir)] = true
+
+		if l.Disambig != "" {
+			if err := ValidDisambigPolicy(l.Disambig); err != nil {
+				return nil, fmt.Errorf("language %s: %v", l.Name, err)
+			}
+		}
+		if l.Encoding != "" {
+			if err := ValidEncodingMode(l.Encoding); err != nil {
+				return nil, fmt.Errorf("language %s: %v", l.Name, err)
+			}
+		}
+		if err := checkNamespaces(l.Namespaces); err != nil {
+			return nil, fmt.Errorf("language %s: %v", l.Name, err)
+		}
+		if err := compileRedactions(l.Redactions); err != nil {
+			return nil, fmt.Errorf("language %s: %v", l.Name, err)
+		}
+		if err := checkExtensionTags(l.ExtensionTags); err != nil {
+			return nil, fmt.Errorf("language %s: %v", l.Name, err)
+		}
+	}
+	return &c, nil
+}
+
+// compileRedactions checks the redactions and compiles their patterns.
+func compileRedactions(redactions []Redaction) error {
+	for i := range redactions {
+		r := &redactions[i]
+		switch r.Field {
+		case "":
+			r.Field = RedactText
+		case RedactText, RedactTitle:
+		default:
+			return fmt.Errorf("redaction %q: unknown field: %s", r.Pattern, r.Field)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("redaction %q: %v", r.Pattern, err)
+		}
+		r.re = re
+		if r.Field == RedactText {
+			r.Replace = escapeText(r.Replace)
+		}
+	}
+	return nil
+}
+
+// escapeText escapes s as text in the XML.
+func escapeText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// checkNamespaces checks the transforms are all known.
+func checkNamespaces(namespaces map[string]NamespaceConfig) error {
+	for ns, nc := range namespaces {
+		switch nc.Transform {
+		case "", TransformClean, TransformRaw, TransformCategories, TransformSkip:
+		default:
+			return fmt.Errorf("namespace %s: unknown transform: %s", ns, nc.Transform)
+		}
+	}
+	return nil
+}
+
+// Language returns the config for building the given language: its own
+// namespace settings and extension tag policies over the top level ones.
+func (c *Config) Language(l LanguageConfig) *Config {
+	lc := &Config{
+		Namespaces:    make(map[string]NamespaceConfig),
+		ExtensionTags: make(map[string]string),
+	}
+	for ns, nc := range c.Namespaces {
+		lc.Namespaces[ns] = nc
+	}
+	for ns, nc := range l.Namespaces {
+		lc.Namespaces[ns] = nc
+	}
+	lc.Redactions = append(append([]Redaction(nil), c.Redactions...), l.Redactions...)
+	for tag, policy := range c.ExtensionTags {
+		lc.ExtensionTags[tag] = policy
+	}
+	for tag, policy := range l.ExtensionTags {
+		lc.ExtensionTags[tag] = policy
+	}
+	return lc
+}
+
+// Redact applies the redactions for the field to s.
+func (c *Config) Redact(field, s string) string {
+	if c == nil {
+		return s
+	}
+	for _, r := range c.Redactions {
+		if r.Field == field {
+			s = r.re.ReplaceAllString(s, r.Replace)
+		}
+	}
+	return s
+}
+
+// Transform returns the transform to use for the given namespace.
+func (c *Config) Transform(ns string) string {
+	if c == nil {
+		return TransformClean
+	}
+	if nc, ok := c.Namespaces[ns]; ok && nc.Transform != "" {
+		return nc.Transform
+	}
+	if nc, ok := c.Namespaces["default"]; ok && nc.Transform != "" {
+		return nc.Transform
+	}
+	return TransformClean
+}
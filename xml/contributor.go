@@ -0,0 +1,60 @@
+package xml
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Ways of stripping contributors from the output.
+const (
+	// ContributorRemove leaves the contributor empty
+	ContributorRemove = "remove"
+	// ContributorHash replaces the contributor with a pseudonym, the same
+	// for all of their revisions
+	ContributorHash = "hash"
+)
+
+// ValidContributorMode returns an error if the mode isn't one we know. An
+// empty mode keeps the contributors.
+func ValidContributorMode(mode string) error {
+	switch mode {
+	case "", ContributorRemove, ContributorHash:
+		return nil
+	}
+	return fmt.Errorf("unknown contributor mode: %s", mode)
+}
+
+// stripContributor removes the username, user ID and IP of the page's
+// contributor, or replaces them with a pseudonym.
+func (w *Worker) stripContributor(p *Page) {
+	c := &p.Revision.Contributor
+	switch w.StripContributors {
+	case ContributorRemove:
+		*c = Contributor{}
+	case ContributorHash:
+		// Users are known by their ID, which survives renames
+		var who string
+		switch {
+		case c.ID != "":
+			who = "id:" + c.ID
+		case c.Username != "":
+			who = "user:" + c.Username
+		case c.IP != "":
+			who = "ip:" + c.IP
+		default:
+			// Deleted contributors stay empty
+			return
+		}
+		*c = Contributor{Username: pseudonym(w.ContributorKey, who)}
+	}
+}
+
+// pseudonym is a keyed hash of a contributor. Without the key it can't be
+// traced back by hashing known usernames or IPs.
+func pseudonym(key []byte, who string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(who))
+	return "anon-" + hex.EncodeToString(m.Sum(nil)[:8])
+}
@@ -0,0 +1,242 @@
+package xml
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// Coordinates are a point on Earth in decimal degrees.
+type Coordinates struct {
+	Lat float64 `xml:"lat,attr" json:"lat"`
+	Lon float64 `xml:"lon,attr" json:"lon"`
+}
+
+// coordTemplate is the template giving a page's coordinates.
+const coordTemplate = "Template:Coord"
+
+// PageCoordinates returns the coordinates of what the page is about, from
+// the {{coord}} shown by its title or else its first {{coord}}. It's nil if
+// there's none that can be read, or they're on another globe.
+func PageCoordinates(text string) *Coordinates {
+	var first, title *Coordinates
+	wikitext.Walk(wikitext.Parse(html.UnescapeString(text)), func(n *wikitext.Node) bool {
+		if title != nil {
+			return false
+		}
+		if n.Kind != wikitext.Template || !strings.EqualFold(templateTitle(n.Name), coordTemplate) {
+			return true
+		}
+		c, display := parseCoord(n.Params)
+		if c == nil {
+			return false
+		}
+		if first == nil {
+			first = c
+		}
+		if shownByTitle(display) {
+			title = c
+		}
+		return false
+	})
+	if title != nil {
+		return title
+	}
+	return first
+}
+
+// shownByTitle reports whether a {{coord}} display parameter puts the
+// coordinates by the page title, as in display=inline,title or display=it.
+func shownByTitle(display string) bool {
+	for _, part := range strings.Split(display, ",") {
+		switch part {
+		case "title", "t", "it", "ti":
+			return true
+		}
+	}
+	return false
+}
+
+// parseCoord reads the parameters of a {{coord}}, which are decimal degrees
+// (lat|lon) or degrees, minutes and seconds with hemispheres
+// (d|m|s|N|d|m|s|E, with the minutes and seconds optional). It also returns
+// the display parameter.
+func parseCoord(params []wikitext.Param) (*Coordinates, string) {
+	var values []string
+	display := ""
+	for _, p := range params {
+		value := strings.TrimSpace(wikitext.Plain(p.Value))
+		switch {
+		case strings.EqualFold(p.Name, "display"):
+			display = strings.ToLower(strings.ReplaceAll(value, " ", ""))
+		case strings.EqualFold(p.Name, "globe"):
+			if value != "" && !strings.EqualFold(value, "earth") {
+				return nil, ""
+			}
+		case p.Name != "":
+		case strings.Contains(value, ":"):
+			// Coordinate parameters like type:city or globe:moon
+			for _, part := range strings.Split(value, "_") {
+				if g := strings.ToLower(part); strings.HasPrefix(g, "globe:") && g != "globe:earth" {
+					return nil, ""
+				}
+			}
+		default:
+			values = append(values, value)
+		}
+	}
+
+	ns := -1
+	for i, v := range values {
+		if v == "N" || v == "S" {
+			ns = i
+			break
+		}
+	}
+	if ns < 0 {
+		if len(values) != 2 {
+			return nil, ""
+		}
+		return checkCoordinates(degrees(values[:1], ""), degrees(values[1:], ""), display)
+	}
+
+	ew := -1
+	for i := ns + 1; i < len(values); i++ {
+		if values[i] == "E" || values[i] == "W" {
+			ew = i
+			break
+		}
+	}
+	if ew < 0 {
+		return nil, ""
+	}
+	return checkCoordinates(degrees(values[:ns], values[ns]), degrees(values[ns+1:ew], values[ew]), display)
+}
+
+// degrees converts degrees and optional minutes and seconds to decimal
+// degrees, negative in the S and W hemispheres. It returns NaN if they
+// can't be read.
+func degrees(parts []string, hemisphere string) float64 {
+	if len(parts) == 0 || len(parts) > 3 {
+		return math.NaN()
+	}
+	v := 0.0
+	scale := 1.0
+	for _, part := range parts {
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil || (scale < 1 && (f < 0 || f >= 60)) {
+			return math.NaN()
+		}
+		v += f / scale
+		scale *= 60
+	}
+	if hemisphere == "S" || hemisphere == "W" {
+		v = -v
+	}
+	return v
+}
+
+// checkCoordinates returns the coordinates if they're on the globe.
+func checkCoordinates(lat, lon float64, display string) (*Coordinates, string) {
+	if math.IsNaN(lat) || math.IsNaN(lon) || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return nil, ""
+	}
+	return &Coordinates{Lat: lat, Lon: lon}, display
+}
+
+// geohashBase32 is the alphabet of geohashes.
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashLength is the number of characters in the geo index, a cell of
+// about 5 meters.
+const geohashLength = 9
+
+// Geohash returns the geohash of the coordinates with the given number of
+// characters. Nearby points share a prefix, so sorting by it groups them.
+func (c Coordinates) Geohash(length int) string {
+	lat := [2]float64{-90, 90}
+	lon := [2]float64{-180, 180}
+	hash := make([]byte, 0, length)
+	bit, ch := 0, 0
+	even := true
+	for len(hash) < length {
+		// Bits alternate between longitude and latitude, longitude first
+		r, v := &lat, c.Lat
+		if even {
+			r, v = &lon, c.Lon
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		bit++
+		if bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// geoIndex collects the coordinates of the pages written, for the geo
+// index file.
+type geoIndex struct {
+	mu      sync.Mutex
+	entries []geoEntry
+}
+
+type geoEntry struct {
+	hash      string
+	id, title string
+	coords    Coordinates
+}
+
+// add adds a page with coordinates to the index.
+func (g *geoIndex) add(p *Page) {
+	e := geoEntry{hash: p.Coordinates.Geohash(geohashLength), id: p.ID, title: p.Title, coords: *p.Coordinates}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.entries = append(g.entries, e)
+}
+
+// write saves the index as TSV rows of geohash, latitude, longitude, page id
+// and title, sorted by geohash so a reader can find the pages near a point
+// with a binary search on its geohash prefix.
+func (g *geoIndex) write(path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sort.Slice(g.entries, func(i, j int) bool {
+		a, b := g.entries[i], g.entries[j]
+		if a.hash != b.hash {
+			return a.hash < b.hash
+		}
+		return a.title < b.title
+	})
+
+	t, err := createTSV(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range g.entries {
+		lat := strconv.FormatFloat(e.coords.Lat, 'f', 6, 64)
+		lon := strconv.FormatFloat(e.coords.Lon, 'f', 6, 64)
+		if err := t.Write(e.hash, lat, lon, e.id, e.title); err != nil {
+			t.Close()
+			return err
+		}
+	}
+	return t.Close()
+}
@@ -0,0 +1,25 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package xml
+
+import (
+	"time"
+)
+
+// cpuTime isn't available here, so workers are only tuned by how long the
+// reader and workers wait for each other.
+func cpuTime() (time.Duration, bool) {
+	return 0, false
+}
+
+// usage is the resources used by the process and its finished children.
+type usage struct {
+	cpu, childCPU       time.Duration
+	maxRSS, childMaxRSS int64
+}
+
+// resourceUsage isn't available here either.
+func resourceUsage() (usage, bool) {
+	return usage{}, false
+}
@@ -0,0 +1,54 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package xml
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the CPU time used so far by the process and its finished
+// children, which includes the parse script runs.
+func cpuTime() (time.Duration, bool) {
+	var total time.Duration
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var ru syscall.Rusage
+		if err := syscall.Getrusage(who, &ru); err != nil {
+			return 0, false
+		}
+		total += time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+	}
+	return total, true
+}
+
+// usage is the resources used by the process and, separately, its finished
+// children.
+type usage struct {
+	cpu, childCPU       time.Duration
+	maxRSS, childMaxRSS int64
+}
+
+// resourceUsage returns the resources used so far. The peak RSS of the
+// children is of the largest one.
+func resourceUsage() (usage, bool) {
+	var self, children syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &self); err != nil {
+		return usage{}, false
+	}
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children); err != nil {
+		return usage{}, false
+	}
+	// It's in bytes on macOS and KiB elsewhere
+	unit := int64(1024)
+	if runtime.GOOS == "darwin" {
+		unit = 1
+	}
+	return usage{
+		cpu:         time.Duration(self.Utime.Nano() + self.Stime.Nano()),
+		childCPU:    time.Duration(children.Utime.Nano() + children.Stime.Nano()),
+		maxRSS:      int64(self.Maxrss) * unit,
+		childMaxRSS: int64(children.Maxrss) * unit,
+	}, true
+}
@@ -0,0 +1,130 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dedupEntryOverhead is roughly what each title costs in the dedup set
+// besides its bytes: its slot in the map, the string header and the count.
+const dedupEntryOverhead = 48
+
+// dedupFile keeps the titles deduplicated against in a TSV file of title
+// and the input it was first read from, so later runs over more pieces of a
+// dump skip the titles the earlier ones already wrote. The titles of each
+// input are appended once it's been read, so an interrupted run only loses
+// the input it was reading, which is read again by the next.
+type dedupFile struct {
+	f       *os.File
+	w       *bufio.Writer
+	pending []string
+	loaded  int
+}
+
+// openDedupFile adds the titles saved at path to seen, leaving out those of
+// inputs, which are about to be read again. The file is rewritten without
+// them, ready for their titles to be appended.
+func openDedupFile(path string, inputs []string, seen map[string]int) (*dedupFile, error) {
+	rereading := make(map[string]bool)
+	for _, input := range inputs {
+		rereading[input] = true
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".dedup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+
+	d := &dedupFile{}
+	if f, err := os.Open(path); err == nil {
+		s := bufio.NewScanner(f)
+		s.Buffer(make([]byte, 64<<10), 1<<20)
+		for n := 1; s.Scan(); n++ {
+			line := s.Text()
+			i := strings.LastIndexByte(line, '\t')
+			if i < 0 {
+				// A line cut short by an interrupted run
+				log.Printf("dedup file %s: dropping line %d: %q", path, n, line)
+				continue
+			}
+			if rereading[line[i+1:]] {
+				continue
+			}
+			if seen[line[:i]] == 0 {
+				d.loaded++
+			}
+			seen[line[:i]]++
+			w.WriteString(line + "\n")
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			tmp.Close()
+			return nil, fmt.Errorf("dedup file %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	d.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.w = bufio.NewWriter(d.f)
+	return d, nil
+}
+
+// add notes a title first read from the input being read.
+func (d *dedupFile) add(title string) {
+	d.pending = append(d.pending, title)
+}
+
+// inputDone saves the titles first read from input, now that all of it
+// has been read.
+func (d *dedupFile) inputDone(input string) error {
+	for _, title := range d.pending {
+		if _, err := d.w.WriteString(title + "\t" + input + "\n"); err != nil {
+			return err
+		}
+	}
+	d.pending = d.pending[:0]
+	if err := d.w.Flush(); err != nil {
+		return err
+	}
+	return d.f.Sync()
+}
+
+func (d *dedupFile) Close() error {
+	if err := d.w.Flush(); err != nil {
+		d.f.Close()
+		return err
+	}
+	return d.f.Close()
+}
+
+// dedupFootprint estimates the memory used by the dedup set.
+func dedupFootprint(seen map[string]int) int64 {
+	size := int64(len(seen)) * dedupEntryOverhead
+	for title := range seen {
+		size += int64(len(title))
+	}
+	return size
+}
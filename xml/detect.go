@@ -0,0 +1,87 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+)
+
+// detectPeek is how much of an input is looked at to tell what it is.
+const detectPeek = 512
+
+// checkDump returns an error saying what the input looks like if it doesn't
+// start like a MediaWiki export: a <mediawiki> document, or bare <page>
+// elements.
+func checkDump(input string, r *bufio.Reader) error {
+	head, _ := r.Peek(detectPeek)
+	root := rootElement(head)
+	if root == "mediawiki" || root == "page" {
+		return nil
+	}
+
+	seen := head
+	if len(seen) > 64 {
+		seen = seen[:64]
+	}
+	return fmt.Errorf("input %s is not a MediaWiki XML export, it looks like %s. It starts with %q", input, describeInput(head, root), seen)
+}
+
+// rootElement returns the name of the first element, skipping the XML
+// declaration, comments and doctype. It's empty if the input doesn't start
+// with markup.
+func rootElement(head []byte) string {
+	s := bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	for {
+		s = bytes.TrimLeft(s, " \t\r\n")
+		var end []byte
+		switch {
+		case bytes.HasPrefix(s, []byte("<?")):
+			end = []byte("?>")
+		case bytes.HasPrefix(s, []byte("<!--")):
+			end = []byte("-->")
+		case bytes.HasPrefix(s, []byte("<!")):
+			end = []byte(">")
+		case bytes.HasPrefix(s, []byte("<")):
+			s = s[1:]
+			n := 0
+			for n < len(s) && !bytes.ContainsRune([]byte(" \t\r\n/>"), rune(s[n])) {
+				n++
+			}
+			return string(s[:n])
+		default:
+			return ""
+		}
+		i := bytes.Index(s, end)
+		if i < 0 {
+			return ""
+		}
+		s = s[i+len(end):]
+	}
+}
+
+// describeInput guesses what an input that isn't a dump is, from its first
+// bytes.
+func describeInput(head []byte, root string) string {
+	lower := bytes.ToLower(head)
+	switch {
+	case len(head) == 0:
+		return "an empty file"
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return "gzip compressed data (name it .gz to decompress it)"
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "bzip2 compressed data (name it .bz2 to decompress it)"
+	case bytes.HasPrefix(head, []byte("7z\xbc\xaf\x27\x1c")):
+		return "a 7z archive (extract it first)"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return "a zip archive (extract it first)"
+	case bytes.Contains(lower, []byte("<html")) || bytes.Contains(lower, []byte("<!doctype html")):
+		return "an HTML page, maybe an error page saved instead of the dump"
+	case bytes.HasPrefix(head, []byte("-- MySQL dump")) || bytes.Contains(head, []byte("CREATE TABLE")) || bytes.Contains(head, []byte("INSERT INTO")):
+		return "an SQL dump (use the pages-articles XML dump instead)"
+	case root != "":
+		return fmt.Sprintf("XML with a <%s> root element", root)
+	case head[0] == '{' || head[0] == '[':
+		return "JSON"
+	}
+	return "something else"
+}
@@ -0,0 +1,147 @@
+package xml
+
+import (
+	"bufio"
+	"encoding/json"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// DictionaryEntry is what a Wiktionary page says about a word in one
+// language.
+type DictionaryEntry struct {
+	Word     string `json:"word"`
+	Language string `json:"language"`
+	// IPA are the pronunciations, e.g. /tʃæt/
+	IPA           []string       `json:"ipa,omitempty"`
+	PartsOfSpeech []PartOfSpeech `json:"parts_of_speech,omitempty"`
+}
+
+// PartOfSpeech is one of the part of speech sections of an entry, with its
+// numbered definitions.
+type PartOfSpeech struct {
+	Name        string   `json:"pos"`
+	Definitions []string `json:"definitions"`
+}
+
+// partsOfSpeech are the section headings Wiktionary uses for them.
+var partsOfSpeech = map[string]bool{
+	"noun": true, "proper noun": true, "verb": true, "adjective": true,
+	"adverb": true, "pronoun": true, "preposition": true, "postposition": true,
+	"conjunction": true, "interjection": true, "article": true,
+	"determiner": true, "numeral": true, "particle": true, "prefix": true,
+	"suffix": true, "infix": true, "phrase": true, "prepositional phrase": true,
+	"proverb": true, "idiom": true, "abbreviation": true, "initialism": true,
+	"acronym": true, "contraction": true, "symbol": true, "letter": true,
+}
+
+// DictionaryEntries returns an entry for each language section of a
+// Wiktionary page: the {{IPA}} pronunciations and the definitions under
+// each part of speech. Languages with neither are left out.
+func DictionaryEntries(title, text string) []DictionaryEntry {
+	var entries []DictionaryEntry
+	var entry *DictionaryEntry
+	var pos *PartOfSpeech
+
+	for _, line := range strings.Split(html.UnescapeString(text), "\n") {
+		if level, heading := headingLine(line); level > 0 {
+			switch {
+			case level <= 2:
+				entries = append(entries, DictionaryEntry{Word: title, Language: heading})
+				entry = &entries[len(entries)-1]
+				pos = nil
+			case entry == nil:
+			case partsOfSpeech[strings.ToLower(heading)]:
+				entry.PartsOfSpeech = append(entry.PartsOfSpeech, PartOfSpeech{Name: heading})
+				pos = &entry.PartsOfSpeech[len(entry.PartsOfSpeech)-1]
+			case level <= 4:
+				// Etymology, Pronunciation, Synonyms, ... end the
+				// definitions, but not the deeper headings within them
+				pos = nil
+			}
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+
+		entry.IPA = append(entry.IPA, ipa(line)...)
+		if pos != nil && strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#:") && !strings.HasPrefix(line, "#*") && !strings.HasPrefix(line, "##") {
+			def := strings.Join(strings.Fields(wikitext.Plain(wikitext.Parse(strings.TrimPrefix(line, "#")))), " ")
+			if def != "" {
+				pos.Definitions = append(pos.Definitions, def)
+			}
+		}
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		if len(e.IPA) > 0 || len(e.PartsOfSpeech) > 0 {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// ipa returns the pronunciations given with {{IPA}} on a line: the
+// positional parameters that are phonemic /.../ or phonetic [...].
+func ipa(line string) []string {
+	if !strings.Contains(line, "IPA") {
+		return nil
+	}
+	var prons []string
+	wikitext.Walk(wikitext.Parse(line), func(n *wikitext.Node) bool {
+		if n.Kind != wikitext.Template || !strings.EqualFold(strings.TrimSpace(n.Name), "IPA") {
+			return true
+		}
+		for _, param := range n.Params {
+			value := strings.TrimSpace(wikitext.Plain(param.Value))
+			if param.Name == "" && (strings.HasPrefix(value, "/") || strings.HasPrefix(value, "[")) {
+				prons = append(prons, value)
+			}
+		}
+		return false
+	})
+	return prons
+}
+
+// DictionarySink writes the dictionary entries of each page as JSON lines,
+// for building a dictionary from a Wiktionary dump. See DictionaryEntries.
+type DictionarySink struct {
+	f   io.WriteCloser
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewDictionarySink creates the JSONL file at path.
+func NewDictionarySink(path string) (*DictionarySink, error) {
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &DictionarySink{f: f, w: w, enc: enc}, nil
+}
+
+// WritePage implements Sink.
+func (s *DictionarySink) WritePage(p *Page) error {
+	for _, e := range p.Dictionary {
+		if err := s.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *DictionarySink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,293 @@
+package xml
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Changes between two dumps.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// PageDiff is a page that differs between two dumps.
+type PageDiff struct {
+	Change string
+	Title  string
+	// OldID and NewID are empty for added and removed pages respectively
+	OldID string
+	NewID string
+	// OldText and NewText are only set for changed pages when the texts
+	// were kept
+	OldText string
+	NewText string
+}
+
+// diffPage is what's remembered of a page of the old dump.
+type diffPage struct {
+	id   string
+	sum  [sha256.Size]byte
+	text string
+	seen bool
+}
+
+// DiffDumps compares the pages of two dumps or processed outputs by title,
+// calling fn for each added, removed or changed page. Changed pages come
+// in the order of the new dump, then removed pages by title. The old dump
+// is held in memory as hashes, or whole if keepText is set so fn gets the
+// texts of changed pages.
+func DiffDumps(oldPath, newPath string, keepText bool, fn func(d *PageDiff) error) error {
+	old := make(map[string]*diffPage)
+	err := ReadPages(oldPath, func(p *Page) error {
+		text := NewRecord(p).Text
+		dp := &diffPage{id: p.ID, sum: sha256.Sum256([]byte(text))}
+		if keepText {
+			dp.text = text
+		}
+		old[p.Title] = dp
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ReadPages(newPath, func(p *Page) error {
+		text := NewRecord(p).Text
+		dp, ok := old[p.Title]
+		if !ok {
+			return fn(&PageDiff{Change: DiffAdded, Title: p.Title, NewID: p.ID})
+		}
+		dp.seen = true
+		if dp.sum == sha256.Sum256([]byte(text)) {
+			return nil
+		}
+
+		d := &PageDiff{Change: DiffChanged, Title: p.Title, OldID: dp.id, NewID: p.ID}
+		if keepText {
+			d.OldText = dp.text
+			d.NewText = text
+		}
+		return fn(d)
+	})
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for title, dp := range old {
+		if !dp.seen {
+			removed = append(removed, title)
+		}
+	}
+	sort.Strings(removed)
+	for _, title := range removed {
+		if err := fn(&PageDiff{Change: DiffRemoved, Title: title, OldID: old[title].id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnifiedDiff returns the line diff of two texts in unified format, with
+// context lines around each change. It's empty if the texts are the same.
+func UnifiedDiff(a, b, aName, bName string, context int) string {
+	al := splitLines(a)
+	bl := splitLines(b)
+	edits := diffLines(al, bl)
+
+	var out strings.Builder
+	for _, h := range hunks(edits, context) {
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(h.aStart, h.aLen), hunkRange(h.bStart, h.bLen))
+		for _, e := range edits[h.from:h.to] {
+			switch e.op {
+			case ' ':
+				out.WriteString(" " + al[e.a] + "\n")
+			case '-':
+				out.WriteString("-" + al[e.a] + "\n")
+			case '+':
+				out.WriteString("+" + bl[e.b] + "\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// edit is one line of the diff: kept (' '), removed ('-') or added ('+').
+// a and b are the line numbers in each text.
+type edit struct {
+	op   byte
+	a, b int
+}
+
+// maxDiffEdits bounds the work done by diffLines, since the saved states
+// grow with the number of edits times the length of the texts.
+const maxDiffEdits = 2000
+
+// diffLines finds the shortest edit script between two texts with Myers'
+// algorithm. Texts too different for that are replaced wholesale.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+	offset := max + 1
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset, d)
+			}
+		}
+	}
+
+	var edits []edit
+	for i := range a {
+		edits = append(edits, edit{op: '-', a: i, b: 0})
+	}
+	for j := range b {
+		edits = append(edits, edit{op: '+', a: n, b: j})
+	}
+	return edits
+}
+
+// backtrack walks the saved states of diffLines back from the end.
+func backtrack(trace [][]int, a, b []string, offset, d int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+	for ; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{op: ' ', a: x, b: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, edit{op: '+', a: x, b: y})
+			} else {
+				x--
+				edits = append(edits, edit{op: '-', a: x, b: y})
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// hunk is a range of edits to print together.
+type hunk struct {
+	from, to     int
+	aStart, aLen int
+	bStart, bLen int
+}
+
+// hunks groups the changes with up to context unchanged lines around them.
+func hunks(edits []edit, context int) []hunk {
+	var out []hunk
+	i := 0
+	for i < len(edits) {
+		// Find the next change
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		from := i - context
+		if from < 0 {
+			from = 0
+		}
+		// Extend while the gap to the next change is small enough to share
+		// context
+		to := i
+		for to < len(edits) {
+			if edits[to].op != ' ' {
+				to++
+				continue
+			}
+			gap := to
+			for gap < len(edits) && edits[gap].op == ' ' {
+				gap++
+			}
+			if gap == len(edits) || gap-to > 2*context {
+				to += context
+				if to > len(edits) {
+					to = len(edits)
+				}
+				break
+			}
+			to = gap
+		}
+
+		h := hunk{from: from, to: to}
+		h.aStart, h.bStart = edits[from].a, edits[from].b
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				h.aLen++
+			}
+			if e.op != '-' {
+				h.bLen++
+			}
+		}
+		out = append(out, h)
+		i = to
+	}
+	return out
+}
+
+// hunkRange formats a line range the way diff -u does.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,75 @@
+package xml
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// Policies for handling disambiguation pages.
+const (
+	DisambigInclude  = "include"
+	DisambigExclude  = "exclude"
+	DisambigSeparate = "separate"
+)
+
+// disambigTemplates are the template names (lowercase) that mark a page as a
+// disambiguation page. Any template ending in " disambiguation" also counts.
+var disambigTemplates = map[string]bool{
+	"disambiguation":  true,
+	"disambig":        true,
+	"disamb":          true,
+	"dab":             true,
+	"dis":             true,
+	"hndis":           true,
+	"geodis":          true,
+	"numberdis":       true,
+	"begriffsklärung": true,
+	"homonymie":       true,
+	"desambiguación":  true,
+	"неоднозначность": true,
+}
+
+// ValidDisambigPolicy returns an error if the policy isn't one we know.
+func ValidDisambigPolicy(policy string) error {
+	switch policy {
+	case DisambigInclude, DisambigExclude, DisambigSeparate:
+		return nil
+	}
+	return fmt.Errorf("unknown disambiguation policy: %s", policy)
+}
+
+// IsDisambiguation reports whether the page is a disambiguation page, either
+// by the __DISAMBIG__ magic word or one of the disambiguation templates.
+func IsDisambiguation(p *Page) bool {
+	text := p.Revision.Text.Text
+	if strings.Contains(text, "__DISAMBIG__") {
+		return true
+	}
+
+	for _, name := range templateNames(text) {
+		if disambigTemplates[name] || strings.HasSuffix(name, " disambiguation") {
+			return true
+		}
+	}
+	return false
+}
+
+// templateNames returns the normalized (lowercase, spaces for underscores)
+// names of all templates used in the text.
+func templateNames(text string) []string {
+	var names []string
+	wikitext.Walk(wikitext.Parse(text), func(n *wikitext.Node) bool {
+		if n.Kind != wikitext.Template {
+			return true
+		}
+		name := strings.ReplaceAll(n.Name, "_", " ")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			names = append(names, name)
+		}
+		return true
+	})
+	return names
+}
@@ -0,0 +1,139 @@
+package xml
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// How invalid UTF-8 is handled.
+const (
+	// EncodingOff leaves the bytes alone.
+	EncodingOff = "off"
+	// EncodingReplace replaces invalid sequences with U+FFFD.
+	EncodingReplace = "replace"
+	// EncodingDrop removes invalid sequences.
+	EncodingDrop = "drop"
+)
+
+// ValidEncodingMode returns an error if the mode isn't one we know.
+func ValidEncodingMode(mode string) error {
+	switch mode {
+	case EncodingOff, EncodingReplace, EncodingDrop:
+		return nil
+	}
+	return fmt.Errorf("unknown encoding mode: %s", mode)
+}
+
+// fixEncoding makes b valid UTF-8 that is also allowed in XML: invalid
+// sequences are replaced or dropped, and byte order marks and control
+// characters other than tab and newlines are removed.
+func fixEncoding(b []byte, mode string) []byte {
+	if mode == EncodingOff || (utf8.Valid(b) && cleanRunes(b)) {
+		return b
+	}
+
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			if mode == EncodingReplace {
+				out = append(out, "�"...)
+			}
+		case !xmlRune(r):
+		default:
+			out = append(out, b[:size]...)
+		}
+		b = b[size:]
+	}
+	return out
+}
+
+// FixEncoding is fixEncoding for strings.
+func FixEncoding(s, mode string) string {
+	return string(fixEncoding([]byte(s), mode))
+}
+
+// cleanRunes reports whether valid UTF-8 has nothing to remove.
+func cleanRunes(b []byte) bool {
+	for _, c := range b {
+		// Only ASCII controls and the first bytes of U+FEFF, U+FFFE and
+		// U+FFFF need a closer look
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c == 0xef {
+			for _, r := range string(b) {
+				if !xmlRune(r) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return true
+}
+
+// xmlRune reports whether the rune may appear in XML output. Byte order marks
+// are removed too, they only ever show up as garbage within the text.
+func xmlRune(r rune) bool {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return true
+	case r < 0x20:
+		return false
+	case r == 0xfeff || r == 0xfffe || r == 0xffff:
+		return false
+	}
+	return true
+}
+
+// encodingReader fixes the encoding of a stream before it reaches the XML
+// decoder, which gives up on the first bad byte.
+type encodingReader struct {
+	r    io.Reader
+	mode string
+	in   []byte
+	out  []byte
+	err  error
+}
+
+func newEncodingReader(r io.Reader, mode string) io.Reader {
+	if mode == EncodingOff {
+		return r
+	}
+	return &encodingReader{r: r, mode: mode}
+}
+
+func (e *encodingReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			if len(e.in) > 0 {
+				e.out = fixEncoding(e.in, e.mode)
+				e.in = nil
+				continue
+			}
+			return 0, e.err
+		}
+
+		buf := make([]byte, 64*1024)
+		n, err := e.r.Read(buf)
+		e.in = append(e.in, buf[:n]...)
+		e.err = err
+
+		// Hold back a rune that's split between reads
+		end := len(e.in)
+		for i := 1; i < utf8.UTFMax && i <= len(e.in); i++ {
+			if utf8.RuneStart(e.in[len(e.in)-i]) {
+				if !utf8.FullRune(e.in[len(e.in)-i:]) {
+					end = len(e.in) - i
+				}
+				break
+			}
+		}
+		e.out = fixEncoding(e.in[:end], e.mode)
+		e.in = append([]byte(nil), e.in[end:]...)
+	}
+
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
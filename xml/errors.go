@@ -0,0 +1,127 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// The classes of failure, for errors.Is. Each is matched by the error type
+// of the same class, which says more about what failed.
+var (
+	// ErrDecode is an input that couldn't be read as XML. See DecodeError.
+	ErrDecode = errors.New("decode failed")
+	// ErrProcess is a page the parse script or clean service couldn't
+	// clean. See ProcessError.
+	ErrProcess = errors.New("processing failed")
+	// ErrWrite is an output or sink that couldn't be written. See
+	// WriteError.
+	ErrWrite = errors.New("write failed")
+)
+
+// DecodeError is a page, or the document around it, that couldn't be
+// decoded.
+type DecodeError struct {
+	// Input is the file being read, if it's known
+	Input string
+	// Offset is the byte offset of the page, or where the decoder stopped,
+	// in the uncompressed input
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Input == "" {
+		return fmt.Sprintf("decoding at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("input %s: decoding at offset %d: %v", e.Input, e.Offset, e.Err)
+}
+
+// Unwrap returns the decoder's error.
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Is matches ErrDecode.
+func (e *DecodeError) Is(target error) bool { return target == ErrDecode }
+
+// ProcessError is a page that couldn't be cleaned.
+type ProcessError struct {
+	Title string
+	// Script is the script that failed, or empty for the clean service
+	Script string
+	// Stderr is what the script wrote to stderr, which is usually why
+	Stderr string
+	Err    error
+}
+
+func (e *ProcessError) Error() string {
+	if e.Script == "" {
+		return fmt.Sprintf("cleaning %s: %v", e.Title, e.Err)
+	}
+	return fmt.Sprintf("cleaning %s with %s: %v", e.Title, e.Script, e.Err)
+}
+
+// Unwrap returns the script's or clean service's error.
+func (e *ProcessError) Unwrap() error { return e.Err }
+
+// Is matches ErrProcess.
+func (e *ProcessError) Is(target error) bool { return target == ErrProcess }
+
+// WriteError is an output file or sink that couldn't be written.
+type WriteError struct {
+	// Output is the file being written, or empty for a sink
+	Output string
+	// Title is the page being written, if it was one
+	Title string
+	Err   error
+}
+
+func (e *WriteError) Error() string {
+	what := e.Output
+	if what == "" {
+		what = "sink"
+	}
+	if e.Title == "" {
+		return fmt.Sprintf("writing %s: %v", what, e.Err)
+	}
+	return fmt.Sprintf("writing %s to %s: %v", e.Title, what, e.Err)
+}
+
+// Unwrap returns the writer's error.
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// Is matches ErrWrite.
+func (e *WriteError) Is(target error) bool { return target == ErrWrite }
+
+// fatal records an error that stops the run, from the reader, a writer or
+// a sink. The first one is returned by Start. The reader stops reading,
+// and the writers and sinks drain what's still coming to them, so the rest
+// of the pipeline can wind down.
+func (w *Worker) fatal(err error) {
+	w.fatalMu.Lock()
+	if w.fatalErr == nil {
+		w.fatalErr = err
+		log.Printf("stopping: %v", err)
+	}
+	w.fatalMu.Unlock()
+	atomic.StoreInt32(&w.stopping, 1)
+}
+
+// stopped reports whether the run has hit a fatal error.
+func (w *Worker) stopped() bool {
+	return atomic.LoadInt32(&w.stopping) == 1
+}
+
+// fatalError returns the first fatal error, if there was one.
+func (w *Worker) fatalError() error {
+	w.fatalMu.Lock()
+	defer w.fatalMu.Unlock()
+	return w.fatalErr
+}
+
+// failed passes the error for a page that's skipped to OnPageFailed.
+func (w *Worker) failed(err error) {
+	if w.OnPageFailed != nil {
+		w.OnPageFailed(err)
+	}
+}
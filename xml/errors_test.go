@@ -0,0 +1,90 @@
+package xml
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="en">
+  <page>
+    <title>One</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision>
+      <id>10</id>
+      <text xml:space="preserve">First page.</text>
+    </revision>
+  </page>
+  <page>
+    <title>Two</title>
+    <ns>0</ns>
+    <id>2</id>
+    <revision>
+      <id>11</id>
+      <text xml:space="preserve">Second page.</text>
+    </revision>
+  </page>
+</mediawiki>
+`
+
+// failingSink fails to write any page.
+type failingSink struct{}
+
+func (failingSink) WritePage(p *Page) error { return errors.New("sink is full") }
+func (failingSink) Close() error            { return nil }
+
+func TestStartReturnsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := filepath.Join(dir, "dump.xml")
+	if err := ioutil.WriteFile(dump, []byte(testDump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(dir, "garbage.xml")
+	if err := ioutil.WriteFile(garbage, []byte("not a dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWorker(dump, filepath.Join(dir, "out.xml"), "", 1)
+	w.Extract = true
+	w.Sinks = []Sink{failingSink{}}
+	err = w.Start()
+	var we *WriteError
+	if !errors.Is(err, ErrWrite) || !errors.As(err, &we) || we.Title != "One" {
+		t.Errorf("failing sink: got %v, want a WriteError for One", err)
+	}
+
+	w = NewWorker(garbage, filepath.Join(dir, "out2.xml"), "", 1)
+	w.Extract = true
+	if err := w.Start(); !errors.Is(err, ErrDecode) {
+		t.Errorf("garbage input: got %v, want ErrDecode", err)
+	}
+
+	// The test dump has no timestamps, so it doesn't conform
+	w = NewWorker(dump, filepath.Join(dir, "out4.xml"), "", 1)
+	w.Extract = true
+	w.Strict = true
+	if err := w.Start(); !errors.Is(err, ErrWrite) || !errors.As(err, &we) || we.Title != "One" {
+		t.Errorf("strict: got %v, want a WriteError for One", err)
+	}
+
+	w = NewWorker(dump, filepath.Join(dir, "out5.xml"), "", 1)
+	w.Extract = true
+	w.IndexFile = filepath.Join(dir, "missing", "out5.idx")
+	if err := w.Start(); !errors.Is(err, ErrWrite) || !errors.As(err, &we) || we.Output != w.IndexFile {
+		t.Errorf("unwritable index: got %v, want a WriteError for the index", err)
+	}
+
+	w = NewWorker(dump, filepath.Join(dir, "out3.xml"), "", 1)
+	w.Extract = true
+	if err := w.Start(); err != nil {
+		t.Errorf("good input: %v", err)
+	}
+}
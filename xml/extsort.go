@@ -0,0 +1,305 @@
+package xml
+
+import (
+	"bufio"
+	"compress/flate"
+	"container/heap"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sortEntryOverhead is roughly what an entry of a run costs besides its
+// strings.
+const sortEntryOverhead = 48
+
+// DefaultSortMemory is the memory of an external sort if none is given.
+const DefaultSortMemory = 256 << 20
+
+// SortOptions bound an external sort.
+type SortOptions struct {
+	// Memory is about how many bytes of lines are held at once, or
+	// DefaultSortMemory if it's 0. Runs of lines that fill their share of it
+	// are sorted and spilled to TempDir.
+	Memory int64
+	// TempDir holds the spilled runs, the system's temporary directory if
+	// it's empty. They're compressed, since a full dump's can be several
+	// times the memory.
+	TempDir string
+	// Parallel is how many runs are sorted at once
+	Parallel int
+}
+
+// sortEntry is a line and the key it sorts by.
+type sortEntry struct {
+	key, line string
+}
+
+func (a sortEntry) less(b sortEntry) bool {
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.line < b.line
+}
+
+// externalSort sorts more lines than fit in memory: it collects them into
+// runs, sorts and spills the runs as they fill in parallel, and merges the
+// runs at the end.
+type externalSort struct {
+	opts SortOptions
+	run  []sortEntry
+	size int64
+
+	// spilled counts the runs handed to spill, some of which may still be
+	// being sorted and not in runs yet
+	spilled int
+
+	slots chan struct{}
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	runs  []string
+	err   error
+}
+
+func newExternalSort(opts SortOptions) *externalSort {
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	if opts.Memory <= 0 {
+		opts.Memory = DefaultSortMemory
+	}
+	return &externalSort{opts: opts, slots: make(chan struct{}, opts.Parallel)}
+}
+
+// runLimit is the size of each run, so the runs being sorted and the one
+// being filled fit in Memory together.
+func (s *externalSort) runLimit() int64 {
+	return s.opts.Memory / int64(s.opts.Parallel+1)
+}
+
+// add adds a line, which mustn't contain a newline, sorting by key.
+func (s *externalSort) add(key, line string) error {
+	s.run = append(s.run, sortEntry{key: key, line: line})
+	s.size += int64(len(key) + len(line) + sortEntryOverhead)
+	if s.size >= s.runLimit() {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill sorts and writes out the current run on a goroutine of its own,
+// waiting if Parallel runs are already being sorted.
+func (s *externalSort) spill() error {
+	run := s.run
+	s.run, s.size = nil, 0
+
+	s.slots <- struct{}{}
+	if err := s.failed(); err != nil {
+		<-s.slots
+		return err
+	}
+	s.spilled++
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.slots }()
+
+		path, err := writeRun(s.opts.TempDir, run)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+		if path != "" {
+			s.runs = append(s.runs, path)
+		}
+	}()
+	return nil
+}
+
+func (s *externalSort) failed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// writeRun sorts a run and writes it to a temporary file as key and line
+// separated by a tab, compressed with DEFLATE at its fastest.
+func writeRun(dir string, run []sortEntry) (string, error) {
+	sort.Slice(run, func(i, j int) bool {
+		return run[i].less(run[j])
+	})
+
+	f, err := ioutil.TempFile(dir, "wikireader-sort-")
+	if err != nil {
+		return "", err
+	}
+	z, _ := flate.NewWriter(f, flate.BestSpeed)
+	w := bufio.NewWriter(z)
+	for _, e := range run {
+		w.WriteString(e.key)
+		w.WriteByte('\t')
+		w.WriteString(e.line)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if err == nil {
+		err = z.Close()
+	}
+	if err != nil {
+		f.Close()
+		return f.Name(), err
+	}
+	return f.Name(), f.Close()
+}
+
+// each calls fn with every line in order, then removes the spilled runs.
+func (s *externalSort) each(fn func(line string) error) error {
+	defer func() {
+		for _, path := range s.runs {
+			os.Remove(path)
+		}
+	}()
+
+	// The runs still being sorted have to be in runs before they're merged,
+	// and the ones that failed count as spilled
+	s.wg.Wait()
+	if s.spilled == 0 {
+		// It all fit in memory
+		sort.Slice(s.run, func(i, j int) bool {
+			return s.run[i].less(s.run[j])
+		})
+		for _, e := range s.run {
+			if err := fn(e.line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(s.run) > 0 {
+		if err := s.spill(); err != nil {
+			s.wg.Wait()
+			return err
+		}
+	}
+	s.wg.Wait()
+	if s.err != nil {
+		return s.err
+	}
+	return mergeRuns(s.runs, fn)
+}
+
+// mergeRuns merges the sorted runs, calling fn with each line.
+func mergeRuns(paths []string, fn func(line string) error) error {
+	var h runHeap
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		z := flate.NewReader(bufio.NewReader(f))
+		defer z.Close()
+
+		r := &runReader{s: bufio.NewScanner(z)}
+		r.s.Buffer(make([]byte, 64<<10), 16<<20)
+		if r.next() {
+			h = append(h, r)
+		} else if err := r.s.Err(); err != nil {
+			return err
+		}
+	}
+	heap.Init(&h)
+
+	for len(h) > 0 {
+		r := h[0]
+		if err := fn(r.cur.line); err != nil {
+			return err
+		}
+		if r.next() {
+			heap.Fix(&h, 0)
+			continue
+		}
+		if err := r.s.Err(); err != nil {
+			return err
+		}
+		heap.Pop(&h)
+	}
+	return nil
+}
+
+// runReader reads a spilled run.
+type runReader struct {
+	s   *bufio.Scanner
+	cur sortEntry
+}
+
+func (r *runReader) next() bool {
+	if !r.s.Scan() {
+		return false
+	}
+	text := r.s.Text()
+	i := strings.IndexByte(text, '\t')
+	r.cur = sortEntry{key: text[:i], line: text[i+1:]}
+	return true
+}
+
+// runHeap orders the runs by their current line.
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].cur.less(h[j].cur) }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// SortIndex writes the offset index at in sorted by title to out, for
+// looking pages up by title with a binary search. Titles are compared
+// after NormalizeTitle and without case. With keys they're compared by
+// their search keys instead, which are added to each line as a fifth
+// field. It holds only about opts.Memory of the index in memory at once.
+func SortIndex(in, out string, keys *Transliterator, opts SortOptions) error {
+	s := newExternalSort(opts)
+	err := ReadIndex(in, func(e IndexEntry) error {
+		fields := []string{e.ID, e.Title, strconv.FormatInt(e.Offset, 10), strconv.FormatInt(e.Length, 10)}
+		key := keys.Key(e.Title)
+		if keys != nil {
+			fields = append(fields, key)
+		}
+		return s.add(key, strings.Join(fields, "\t"))
+	})
+	if err != nil {
+		s.wg.Wait()
+		for _, path := range s.runs {
+			os.Remove(path)
+		}
+		return err
+	}
+
+	f, err := createOutput(out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = s.each(func(line string) error {
+		_, err := w.WriteString(line + "\n")
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package xml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestExternalSortSpills(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extsort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const lines = 3000
+	for i := 0; i < 50; i++ {
+		s := newExternalSort(SortOptions{Memory: 200000, Parallel: 2, TempDir: dir})
+		var want []string
+		for _, n := range rand.Perm(lines) {
+			line := fmt.Sprintf("%04d", n)
+			want = append(want, line)
+			if err := s.add(line, line); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s.spilled < 2 {
+			t.Fatalf("spilled %d runs, want several", s.spilled)
+		}
+		sort.Strings(want)
+
+		var got []string
+		if err := s.each(func(line string) error {
+			got = append(got, line)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != lines {
+			t.Fatalf("got %d lines, want %d", len(got), lines)
+		}
+		for j := range got {
+			if got[j] != want[j] {
+				t.Fatalf("line %d is %q, want %q", j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestExternalSortInMemory(t *testing.T) {
+	s := newExternalSort(SortOptions{})
+	for _, line := range []string{"c", "a", "b"} {
+		if err := s.add(line, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	if err := s.each(func(line string) error {
+		got = append(got, line)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[a b c]" {
+		t.Errorf("got %v, want [a b c]", got)
+	}
+}
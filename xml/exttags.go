@@ -0,0 +1,147 @@
+package xml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Policies for an extension tag, like <hiero> or <score>, in the text of
+// pages that are cleaned.
+const (
+	// ExtensionKeep leaves the tag for the parse script
+	ExtensionKeep = "keep"
+	// ExtensionStrip takes the tag out of the text with its content
+	ExtensionStrip = "strip"
+	// ExtensionPlaceholder replaces the tag and its content with its name
+	// in brackets, e.g. [score], so the text still reads as having
+	// something there
+	ExtensionPlaceholder = "placeholder"
+)
+
+// DefaultExtensionTags are the policies for the extension tags whose
+// content is markup for another renderer, which only makes a blob of noise
+// in the cleaned text.
+var DefaultExtensionTags = map[string]string{
+	"hiero":    ExtensionPlaceholder,
+	"score":    ExtensionPlaceholder,
+	"timeline": ExtensionStrip,
+	"mapframe": ExtensionStrip,
+	"graph":    ExtensionStrip,
+}
+
+// ValidExtensionPolicy returns an error if the policy isn't one we know.
+func ValidExtensionPolicy(policy string) error {
+	switch policy {
+	case ExtensionKeep, ExtensionStrip, ExtensionPlaceholder:
+		return nil
+	}
+	return fmt.Errorf("unknown extension tag policy: %s", policy)
+}
+
+// ParseExtensionTags parses the policies of extension tags separated by
+// commas, as in hiero=placeholder,score=strip. default stands for
+// DefaultExtensionTags, which the tags after it override.
+func ParseExtensionTags(s string) (map[string]string, error) {
+	policies := make(map[string]string)
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "default" {
+			for tag, policy := range DefaultExtensionTags {
+				policies[tag] = policy
+			}
+			continue
+		}
+		eq := strings.Index(opt, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("extension tag %q has no policy (expected tag=keep, strip or placeholder)", opt)
+		}
+		policies[strings.ToLower(opt[:eq])] = opt[eq+1:]
+	}
+	if err := checkExtensionTags(policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// checkExtensionTags checks the tag names and their policies.
+func checkExtensionTags(policies map[string]string) error {
+	for tag, policy := range policies {
+		if !htmlTagName.MatchString(tag) {
+			return fmt.Errorf("invalid extension tag: %q", tag)
+		}
+		if err := ValidExtensionPolicy(policy); err != nil {
+			return fmt.Errorf("extension tag %s: %v", tag, err)
+		}
+	}
+	return nil
+}
+
+// extensionTags applies the policies of the extension tags to a page's
+// text, which is escaped the way it's kept in the page.
+type extensionTags struct {
+	policies map[string]string
+	// open matches the opening tag of any that aren't kept, and whether it
+	// closes itself
+	open *regexp.Regexp
+	// close matches the closing tag of each
+	close map[string]*regexp.Regexp
+}
+
+// compileExtensionTags compiles the policies, returning nil if every tag is
+// kept.
+func compileExtensionTags(policies map[string]string) (*extensionTags, error) {
+	if err := checkExtensionTags(policies); err != nil {
+		return nil, err
+	}
+	e := &extensionTags{policies: policies, close: make(map[string]*regexp.Regexp)}
+	var tags []string
+	for tag, policy := range policies {
+		if policy == ExtensionKeep {
+			continue
+		}
+		tags = append(tags, tag)
+		e.close[tag] = regexp.MustCompile(`(?i)&lt;/` + tag + `\s*&gt;`)
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	sort.Strings(tags)
+	e.open = regexp.MustCompile(`(?is)&lt;(` + strings.Join(tags, "|") + `)\b.*?(/?)&gt;`)
+	return e, nil
+}
+
+// apply returns the text with the tags that aren't kept replaced as their
+// policy says. A tag that's never closed is left as it is. A nil
+// extensionTags leaves the text as it is.
+func (e *extensionTags) apply(text string) string {
+	if e == nil {
+		return text
+	}
+	var b strings.Builder
+	for {
+		loc := e.open.FindStringSubmatchIndex(text)
+		if loc == nil {
+			break
+		}
+		tag := strings.ToLower(text[loc[2]:loc[3]])
+		end := loc[1]
+		if loc[4] == loc[5] {
+			close := e.close[tag].FindStringIndex(text[end:])
+			if close == nil {
+				b.WriteString(text[:end])
+				text = text[end:]
+				continue
+			}
+			end += close[1]
+		}
+		b.WriteString(text[:loc[0]])
+		if e.policies[tag] == ExtensionPlaceholder {
+			b.WriteString("[" + tag + "]")
+		}
+		text = text[end:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// fieldNames are the page fields that can be selected for the output.
+var fieldNames = []string{
+	"id", "title", "ns", "redirect", "revision_id", "parentid", "timestamp",
+	"contributor", "comment", "model", "format", "text", "sha1", "categories",
+	"short_description", "coordinates", "biography", "processing",
+	"original_text",
+}
+
+// Fields is a selection of page fields. The outputs only have the selected
+// ones: the xml output leaves the others out, the JSON outputs drop their
+// keys and the other formats get them empty.
+type Fields map[string]bool
+
+// ParseFields parses a comma separated list of field names.
+func ParseFields(list string) (Fields, error) {
+	known := make(map[string]bool)
+	for _, name := range fieldNames {
+		known[name] = true
+	}
+
+	f := make(Fields)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown field: %s (known: %s)", name, strings.Join(fieldNames, ","))
+		}
+		f[name] = true
+	}
+	if len(f) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+	return f, nil
+}
+
+// apply returns a copy of the page with only the selected fields set.
+func (f Fields) apply(p *Page) *Page {
+	q := *p
+	q.fields = f
+
+	clear := func(name string, field *string) {
+		if !f[name] {
+			*field = ""
+		}
+	}
+	clear("id", &q.ID)
+	clear("title", &q.Title)
+	clear("ns", &q.Ns)
+	clear("redirect", &q.Redirect.Title)
+	clear("revision_id", &q.Revision.ID)
+	clear("parentid", &q.Revision.Parentid)
+	clear("timestamp", &q.Revision.Timestamp)
+	clear("comment", &q.Revision.Comment)
+	clear("model", &q.Revision.Model)
+	clear("format", &q.Revision.Format)
+	clear("sha1", &q.Revision.Sha1)
+	if !f["contributor"] {
+		q.Revision.Contributor = Contributor{}
+	}
+	if !f["text"] {
+		q.Revision.Text = Text{}
+	}
+	if !f["categories"] {
+		q.Categories = nil
+	}
+	clear("short_description", &q.ShortDescription)
+	if !f["coordinates"] {
+		q.Coordinates = nil
+	}
+	if !f["biography"] {
+		q.Biography = nil
+	}
+	if !f["processing"] {
+		q.Processing = nil
+	}
+	if !f["original_text"] {
+		q.OriginalText = nil
+	}
+	return &q
+}
+
+// selectedPage is a page with only the selected fields, for marshaling.
+type selectedPage struct {
+	XMLName          xml.Name          `xml:"page"`
+	Title            string            `xml:"title,omitempty"`
+	Ns               string            `xml:"ns,omitempty"`
+	ID               string            `xml:"id,omitempty"`
+	Redirect         *Redirect         `xml:"redirect"`
+	Revision         *selectedRevision `xml:"revision"`
+	ShortDescription string            `xml:"shortdescription,omitempty"`
+	Coordinates      *Coordinates      `xml:"coordinates,omitempty"`
+	Biography        *Biography        `xml:"biography,omitempty"`
+	Processing       *Processing       `xml:"processing,omitempty"`
+	OriginalText     *Text             `xml:"originaltext,omitempty"`
+}
+
+type selectedRevision struct {
+	ID          string       `xml:"id,omitempty"`
+	Parentid    string       `xml:"parentid,omitempty"`
+	Timestamp   string       `xml:"timestamp,omitempty"`
+	Contributor *Contributor `xml:"contributor"`
+	Comment     string       `xml:"comment,omitempty"`
+	Model       string       `xml:"model,omitempty"`
+	Format      string       `xml:"format,omitempty"`
+	Text        *Text        `xml:"text"`
+	Sha1        string       `xml:"sha1,omitempty"`
+}
+
+// marshaled returns what to marshal for a page with the selected fields.
+func (f Fields) marshaled(p *Page) *selectedPage {
+	s := &selectedPage{Title: p.Title, Ns: p.Ns, ID: p.ID, ShortDescription: p.ShortDescription, Coordinates: p.Coordinates, Biography: p.Biography, Processing: p.Processing, OriginalText: p.OriginalText}
+	if f["redirect"] {
+		s.Redirect = &p.Redirect
+	}
+
+	r := &selectedRevision{
+		ID:        p.Revision.ID,
+		Parentid:  p.Revision.Parentid,
+		Timestamp: p.Revision.Timestamp,
+		Comment:   p.Revision.Comment,
+		Model:     p.Revision.Model,
+		Format:    p.Revision.Format,
+		Sha1:      p.Revision.Sha1,
+	}
+	if f["contributor"] {
+		r.Contributor = &p.Revision.Contributor
+	}
+	if f["text"] {
+		r.Text = &p.Revision.Text
+	}
+	if *r != (selectedRevision{}) {
+		s.Revision = r
+	}
+	return s
+}
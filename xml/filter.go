@@ -0,0 +1,272 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Actions for pages matched by a ContentFilter.
+const (
+	// FilterTag keeps the page and records it in the tag file.
+	FilterTag = "tag"
+	// FilterSkip drops the page.
+	FilterSkip = "skip"
+	// FilterRedact replaces the matched terms in the text.
+	FilterRedact = "redact"
+)
+
+// redacted replaces terms removed with FilterRedact.
+const redacted = "[redacted]"
+
+// ContentFilter flags unsuitable page content.
+type ContentFilter interface {
+	// Match returns the offending terms found in the page, if any.
+	Match(p *Page) ([]string, error)
+}
+
+// ValidFilterAction returns an error if the action isn't one we know.
+func ValidFilterAction(action string) error {
+	switch action {
+	case FilterTag, FilterSkip, FilterRedact:
+		return nil
+	}
+	return fmt.Errorf("unknown content filter action: %s", action)
+}
+
+// KeywordFilter matches whole words from a list, ignoring case.
+type KeywordFilter struct {
+	words *wordMatcher
+}
+
+// NewKeywordFilter reads a word list with one term per line. Blank lines and
+// lines starting with # are ignored.
+func NewKeywordFilter(path string) (*KeywordFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var terms []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("no terms in %s", path)
+	}
+
+	words, err := newWordMatcher(terms)
+	if err != nil {
+		return nil, err
+	}
+	return &KeywordFilter{words: words}, nil
+}
+
+// Match implements ContentFilter.
+func (k *KeywordFilter) Match(p *Page) ([]string, error) {
+	var terms []string
+	for _, loc := range k.words.matches(p.Revision.Text.Text) {
+		terms = append(terms, p.Revision.Text.Text[loc[0]:loc[1]])
+	}
+	return terms, nil
+}
+
+// wordMatcher finds the terms of a list in a text as whole words, ignoring
+// case. Words are made of letters, digits and underscores in any script,
+// which \b only knows in ASCII.
+type wordMatcher struct {
+	// longest matches the longest of the terms at the leftmost place it can
+	longest *regexp.Regexp
+	// whole matches a string that's exactly one of the terms
+	whole *regexp.Regexp
+}
+
+// newWordMatcher compiles the terms, which are plain text.
+func newWordMatcher(terms []string) (*wordMatcher, error) {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	alternatives := strings.Join(quoted, "|")
+
+	longest, err := regexp.Compile(`(?i)` + alternatives)
+	if err != nil {
+		return nil, err
+	}
+	longest.Longest()
+	whole, err := regexp.Compile(`(?i)^(?:` + alternatives + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	return &wordMatcher{longest: longest, whole: whole}, nil
+}
+
+// matches returns where the terms are found in the text as whole words.
+func (m *wordMatcher) matches(text string) [][]int {
+	var matches [][]int
+	for i := 0; i < len(text); {
+		loc := m.longest.FindStringIndex(text[i:])
+		if loc == nil {
+			break
+		}
+		start := i + loc[0]
+		if end := m.wordEnd(text, start, i+loc[1]); end > start {
+			matches = append(matches, []int{start, end})
+			i = end
+			continue
+		}
+		// Try again from the next rune
+		_, size := utf8.DecodeRuneInString(text[start:])
+		i = start + size
+	}
+	return matches
+}
+
+// wordEnd returns the end of the longest term that's a whole word starting
+// at start, up to the longest term that matched there, or start if there
+// isn't one. A shorter term can be a word where the longest isn't, like
+// "new" in "new yorker" when the list has "new york".
+func (m *wordMatcher) wordEnd(text string, start, end int) int {
+	if wordRuneBefore(text, start) {
+		return start
+	}
+	for ; end > start; end-- {
+		if end == len(text) || utf8.RuneStart(text[end]) {
+			if !wordRuneAt(text, end) && m.whole.MatchString(text[start:end]) {
+				return end
+			}
+		}
+	}
+	return start
+}
+
+// redact replaces the terms found in the text.
+func (m *wordMatcher) redact(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range m.matches(text) {
+		b.WriteString(text[last:loc[0]])
+		b.WriteString(redacted)
+		last = loc[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsNumber(r)
+}
+
+// wordRuneBefore reports whether the rune before i is part of a word.
+func wordRuneBefore(text string, i int) bool {
+	r, size := utf8.DecodeLastRuneInString(text[:i])
+	return size > 0 && isWordRune(r)
+}
+
+// wordRuneAt reports whether the rune at i is part of a word.
+func wordRuneAt(text string, i int) bool {
+	r, size := utf8.DecodeRuneInString(text[i:])
+	return size > 0 && isWordRune(r)
+}
+
+// CommandFilter runs an external classifier per page. The page text is
+// written to its stdin and it prints the offending terms (or a label), one
+// per line. No output means the page is fine.
+type CommandFilter struct {
+	Command string
+}
+
+// Match implements ContentFilter.
+func (c *CommandFilter) Match(p *Page) ([]string, error) {
+	cmd := exec.Command(c.Command)
+	cmd.Stdin = strings.NewReader(p.Revision.Text.Text)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if term := strings.TrimSpace(string(line)); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms, nil
+}
+
+// redact replaces each term in the text, ignoring case. The terms of a
+// KeywordFilter are compiled when it's made, the ones other filters find
+// are compiled for the page.
+func (w *Worker) redact(text string, terms []string) string {
+	if k, ok := w.ContentFilter.(*KeywordFilter); ok {
+		return k.words.redact(text)
+	}
+	words, err := newWordMatcher(terms)
+	if err != nil {
+		panic(err)
+	}
+	return words.redact(text)
+}
+
+// filterContent applies the content filter to a page. It returns false if
+// the page should be dropped.
+func (w *Worker) filterContent(p *Page) bool {
+	terms, err := w.ContentFilter.Match(p)
+	if err != nil {
+		// Err on the side of caution, these builds are meant to be safe
+		log.Printf("error filtering title %s: %v. Skipping", p.Title, err)
+		return false
+	}
+	if len(terms) == 0 {
+		return true
+	}
+	terms = uniqueFold(terms)
+
+	switch w.FilterAction {
+	case FilterSkip:
+		w.skips.skip(p.Title, skipFiltered)
+		return false
+	case FilterRedact:
+		p.Revision.Text.Text = w.redact(p.Revision.Text.Text, terms)
+	}
+
+	if w.filterTags != nil {
+		if err := w.filterTags.Write(p.ID, p.Title, strings.Join(terms, ",")); err != nil {
+			panic(err)
+		}
+	}
+	return true
+}
+
+// uniqueFold removes repeated terms, ignoring case.
+func uniqueFold(terms []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		key := strings.ToLower(term)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, term)
+	}
+	return unique
+}
@@ -0,0 +1,66 @@
+package xml
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestKeywordFilter(t *testing.T) {
+	f, err := ioutil.TempFile("", "words")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# terms\nZürich\ncafé\nart\nartist\nÉcole\nnew\nnew york\n")
+	f.Close()
+
+	k, err := NewKeywordFilter(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		text string
+		want []string
+	}{
+		{"Zürich, café, art.", []string{"Zürich", "café", "art"}},
+		{"ZÜRICH and CAFÉ", []string{"ZÜRICH", "CAFÉ"}},
+		{"école normale", []string{"école"}},
+		{"cafés and party and Zürichsee", nil},
+		{"café café", []string{"café", "café"}},
+		{"Kunst_art art_x art1 (art)", []string{"art"}},
+		{"écafé", nil},
+		// A shorter term earlier in the list doesn't hide a longer one
+		{"the artist paints", []string{"artist"}},
+		{"artists and art", []string{"art"}},
+		// and a longer one that isn't a word doesn't hide a shorter one
+		{"New York and new yorkers", []string{"New York", "new"}},
+	} {
+		p := &Page{}
+		p.Revision.Text.Text = tt.text
+		got, err := k.Match(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Match(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		text, want string
+	}{
+		{"Zürich's café, cafés", "[redacted]'s [redacted], cafés"},
+		{"an artist in New York", "an [redacted] in [redacted]"},
+	} {
+		if got := k.words.redact(tt.text); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	w := &Worker{ContentFilter: &CommandFilter{Command: "true"}}
+	if got, want := w.redact("art and artists, artist", []string{"artist", "art"}), "[redacted] and artists, [redacted]"; got != want {
+		t.Errorf("redact with found terms = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// maxRedirectHops is how many redirects in a row are followed. MediaWiki
+// itself only follows one, but double redirects are common in dumps.
+const maxRedirectHops = 5
+
+// LinkResolver decides where the links in the cleaned text point.
+type LinkResolver interface {
+	// Resolve returns the title a link to title should point to instead,
+	// or false to leave the link alone.
+	Resolve(title string) (string, bool)
+}
+
+// RedirectMap is a LinkResolver that follows redirects, so links go
+// straight to the article instead of through a redirect stub. It maps the
+// title of each redirect page to its target.
+type RedirectMap map[string]string
+
+// Resolve implements LinkResolver. Redirect loops are left alone.
+func (m RedirectMap) Resolve(title string) (string, bool) {
+	target, ok := m[title]
+	if !ok {
+		return "", false
+	}
+	for i := 1; i < maxRedirectHops; i++ {
+		next, ok := m[target]
+		if !ok {
+			break
+		}
+		if next == title {
+			return "", false
+		}
+		target = next
+	}
+	return target, target != title
+}
+
+// collectRedirects reads through the inputs once to find every redirect.
+// Only the pages that look like redirects are decoded.
+func (w *Worker) collectRedirects() RedirectMap {
+	redirects := make(RedirectMap)
+	add := func(p *Page) {
+		// Targets taken from the text are still escaped
+		if target := RedirectTarget(p); target != "" {
+			redirects[NormalizeTitle(p.Title)] = NormalizeTitle(html.UnescapeString(target))
+		}
+	}
+
+	for input := range w.inputs() {
+		log.Println("collecting redirects:", input)
+		if err := w.scanRedirects(input, add); err != nil {
+			panic(err)
+		}
+	}
+	log.Printf("%d redirects to follow", len(redirects))
+	return redirects
+}
+
+// scanRedirects calls fn with each page of the input that may be a redirect.
+func (w *Worker) scanRedirects(input string, fn func(p *Page)) error {
+	f, err := w.open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if isCache(r) {
+		return readCache(r, fn)
+	}
+
+	s := w.newScanner(f, r)
+	for s.Scan() {
+		page := s.Bytes()
+		if !bytes.Contains(page, []byte("<redirect")) && !hasRedirectWord(string(elementText(page, "text"))) {
+			continue
+		}
+		var p Page
+		if err := xml.Unmarshal(page, &p); err != nil {
+			return err
+		}
+		fn(&p)
+	}
+	return s.Err()
+}
+
+// linkEscaper escapes a resolved title for the page text, which is kept as
+// it appears in the XML.
+var linkEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// ResolveLinks rewrites the [[...]] links in text whose targets the resolver
+// knows better ones for. The displayed text stays the same.
+func ResolveLinks(text string, r LinkResolver) string {
+	return rewriteLinks(text, func(link string) string {
+		return "[[" + resolveLink(link, r) + "]]"
+	})
+}
+
+// rewriteLinks replaces each [[...]] link in text with what fn returns for
+// its contents. Links in the labels of links fn leaves alone are rewritten
+// too.
+func rewriteLinks(text string, fn func(link string) string) string {
+	return wikitext.Replace(text, func(n *wikitext.Node) (string, bool) {
+		if n.Kind != wikitext.Link {
+			return "", false
+		}
+		s := fn(n.Inner())
+		return s, s != n.Raw
+	})
+}
+
+// resolveLink returns the new contents of a single link.
+func resolveLink(link string, r LinkResolver) string {
+	title, _, ok := linkTarget(html.UnescapeString(link))
+	if !ok {
+		return link
+	}
+	resolved, ok := r.Resolve(title)
+	if !ok {
+		return link
+	}
+
+	target, display := link, link
+	if i := strings.Index(link, "|"); i >= 0 {
+		target = link[:i]
+		display = link[i+1:]
+	}
+	section := ""
+	if i := strings.Index(target, "#"); i >= 0 {
+		section = target[i:]
+	}
+	return linkEscaper.Replace(resolved) + section + "|" + display
+}
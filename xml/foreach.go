@@ -0,0 +1,114 @@
+package xml
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"html"
+	"strings"
+)
+
+// ErrStop can be returned by the function given to ForEachPage to stop
+// without an error.
+var ErrStop = errors.New("stop")
+
+// PagePredicate picks the pages ForEachPage calls its function with. It's
+// checked on the raw XML of each page, so the pages it doesn't match are
+// never decoded.
+type PagePredicate struct {
+	// Namespaces, if set, are the only namespaces matched
+	Namespaces []string
+	// TitlePrefix, if set, is what the titles have to start with
+	TitlePrefix string
+	// Limit, if set, stops after this many pages have matched
+	Limit int
+}
+
+// matchRaw reports whether the raw XML of a page matches.
+func (pred PagePredicate) matchRaw(page []byte) bool {
+	if len(pred.Namespaces) > 0 && !pred.matchNs(string(elementText(page, "ns"))) {
+		return false
+	}
+	// The decoder unescapes the title
+	return pred.TitlePrefix == "" || strings.HasPrefix(html.UnescapeString(string(elementText(page, "title"))), pred.TitlePrefix)
+}
+
+// match reports whether a decoded page matches.
+func (pred PagePredicate) match(p *Page) bool {
+	if len(pred.Namespaces) > 0 && !pred.matchNs(p.Ns) {
+		return false
+	}
+	return strings.HasPrefix(p.Title, pred.TitlePrefix)
+}
+
+func (pred PagePredicate) matchNs(ns string) bool {
+	for _, n := range pred.Namespaces {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEachPage calls fn with the pages of a dump, processed output or page
+// cache that match pred, in order. It stops at the first error from fn,
+// which is returned unless it's ErrStop, once pred.Limit pages have
+// matched, or when ctx is done, returning its error.
+func ForEachPage(ctx context.Context, path string, pred PagePredicate, fn func(p *Page) error) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	matched := 0
+	visit := func(p *Page) error {
+		if err := fn(p); err != nil {
+			return err
+		}
+		matched++
+		if pred.Limit > 0 && matched >= pred.Limit {
+			return ErrStop
+		}
+		return nil
+	}
+
+	r := bufio.NewReader(f)
+	if isCache(r) {
+		err = readCacheUntil(r, func(p *Page) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !pred.match(p) {
+				return nil
+			}
+			return visit(p)
+		})
+	} else {
+		s := NewPageScanner(r)
+		for s.Scan() {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if !pred.matchRaw(s.Bytes()) {
+				continue
+			}
+			var p Page
+			if err = xml.Unmarshal(s.Bytes(), &p); err != nil {
+				err = &DecodeError{Input: path, Offset: s.Offset(), Err: err}
+				break
+			}
+			if err = visit(&p); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = s.Err()
+		}
+	}
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package xml
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// Policies for the <gallery> and <imagemap> blocks in the text of pages
+// that are cleaned.
+const (
+	// GalleryKeep leaves the blocks for the parse script
+	GalleryKeep = "keep"
+	// GalleryDrop takes the blocks out of the text
+	GalleryDrop = "drop"
+	// GalleryCaptions replaces each block with a list of its captions
+	GalleryCaptions = "captions"
+)
+
+// ValidGalleryPolicy returns an error if the policy isn't one we know.
+func ValidGalleryPolicy(policy string) error {
+	switch policy {
+	case GalleryKeep, GalleryDrop, GalleryCaptions:
+		return nil
+	}
+	return fmt.Errorf("unknown gallery policy: %s", policy)
+}
+
+// Media is a file shown in a gallery or image map.
+type Media struct {
+	// File is the name of the file, without the File: prefix
+	File string
+	// Caption is the caption under it as plain text, if it has one
+	Caption string
+}
+
+var (
+	// galleryBlock matches a gallery or image map as it's escaped in the
+	// text, with its attributes and content
+	galleryBlock = regexp.MustCompile(`(?is)&lt;(gallery|imagemap)\b(.*?)&gt;(.*?)&lt;/(?:gallery|imagemap)\s*&gt;`)
+	// galleryCaption is the caption attribute of a gallery
+	galleryCaption = regexp.MustCompile(`(?i)\bcaption\s*=\s*(?:"([^"]*)"|'([^']*)'|(\S+))`)
+	// fileNamespace is the prefix of a file name
+	fileNamespace = regexp.MustCompile(`(?i)^\s*(file|image)\s*:`)
+	// mediaOption is a parameter of a gallery or image map line that isn't
+	// its caption
+	mediaOption = regexp.MustCompile(`(?i)^\s*((alt|link|page|class|lang|thumbtime|start|end)\s*=|(thumb|thumbnail|frame|frameless|border|left|right|center|centre|none|upright|\d*x?\d+px)\s*$)`)
+	// htmlComment is a comment, unescaped
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// Galleries returns the files in the galleries and image maps of the text,
+// which is escaped the way it's kept in the page, and the text with the
+// blocks handled as the policy says.
+func Galleries(text, policy string) (string, []Media) {
+	var media []Media
+	out := galleryBlock.ReplaceAllStringFunc(text, func(block string) string {
+		m := galleryBlock.FindStringSubmatch(block)
+		var files []Media
+		if strings.EqualFold(m[1], "imagemap") {
+			files = imagemapMedia(html.UnescapeString(m[3]))
+		} else {
+			files = galleryMedia(html.UnescapeString(m[3]))
+		}
+		media = append(media, files...)
+
+		switch policy {
+		case GalleryDrop:
+			return ""
+		case GalleryCaptions:
+			var lines []string
+			if c := galleryCaption.FindStringSubmatch(html.UnescapeString(m[2])); c != nil {
+				caption := wikitext.Plain(wikitext.Parse(c[1] + c[2] + c[3]))
+				lines = append(lines, escapeText(strings.TrimSpace(caption)))
+			}
+			for _, f := range files {
+				if f.Caption != "" {
+					lines = append(lines, "* "+escapeText(f.Caption))
+				}
+			}
+			return strings.Join(lines, "\n")
+		}
+		return block
+	})
+	return out, media
+}
+
+// galleryMedia returns the files listed in a gallery, one to a line.
+func galleryMedia(content string) []Media {
+	var media []Media
+	for _, line := range strings.Split(htmlComment.ReplaceAllString(content, ""), "\n") {
+		if m, ok := mediaLine(line); ok {
+			media = append(media, m)
+		}
+	}
+	return media
+}
+
+// imagemapMedia returns the file an image map is drawn on, which is its
+// first line. The rest are the areas of the map.
+func imagemapMedia(content string) []Media {
+	for _, line := range strings.Split(htmlComment.ReplaceAllString(content, ""), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if m, ok := mediaLine(line); ok {
+			return []Media{m}
+		}
+		return nil
+	}
+	return nil
+}
+
+// mediaLine parses a line like File:Name.jpg|alt=...|Caption.
+func mediaLine(line string) (Media, bool) {
+	parts := pipeParts(strings.TrimSpace(line))
+	file := strings.TrimSpace(fileNamespace.ReplaceAllString(parts[0], ""))
+	if file == "" {
+		return Media{}, false
+	}
+	m := Media{File: file}
+	for i := len(parts) - 1; i > 0; i-- {
+		if !mediaOption.MatchString(parts[i]) {
+			m.Caption = strings.TrimSpace(wikitext.Plain(wikitext.Parse(parts[i])))
+			break
+		}
+	}
+	return m, true
+}
+
+// pipeParts splits a line at the pipes that aren't inside a link or
+// template in it.
+func pipeParts(line string) []string {
+	parts := []string{""}
+	for _, n := range wikitext.Parse(line) {
+		if n.Kind != wikitext.Text {
+			parts[len(parts)-1] += n.Raw
+			continue
+		}
+		split := strings.Split(n.Raw, "|")
+		parts[len(parts)-1] += split[0]
+		parts = append(parts, split[1:]...)
+	}
+	return parts
+}
@@ -0,0 +1,38 @@
+package xml
+
+import (
+	"html"
+)
+
+// writeCategoryEdges writes one row per category the page belongs to. For
+// pages in the category namespace these are its parent categories.
+func writeCategoryEdges(t *tsvFile, p *Page) error {
+	for _, cat := range Categories(p.Revision.Text.Text) {
+		if err := t.Write(p.ID, p.Title, html.UnescapeString(cat)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLinkEdges writes one row per internal link on the page, with the
+// anchor text as an extra column if requested.
+func writeLinkEdges(t *tsvFile, p *Page, anchors bool) error {
+	for _, link := range links(p.Revision.Text.Text) {
+		target, anchor, ok := linkTarget(html.UnescapeString(link))
+		if !ok {
+			continue
+		}
+
+		var err error
+		if anchors {
+			err = t.Write(p.ID, p.Title, target, anchor)
+		} else {
+			err = t.Write(p.ID, p.Title, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// idMap gives pages compact sequential IDs in place of their MediaWiki IDs.
+// The mapping is kept in a TSV file of MediaWiki ID and internal ID, which
+// each run reads and appends to, so a page keeps its ID across runs and new
+// pages are numbered after the last one. It's only used by the reader, one
+// page at a time, so the IDs follow the order of the input.
+type idMap struct {
+	ids  map[string]string
+	next int
+	f    *os.File
+	w    *bufio.Writer
+}
+
+// openIDMap reads the mapping at path, if there is one, ready for more IDs
+// to be added.
+func openIDMap(path string) (*idMap, error) {
+	m := &idMap{ids: make(map[string]string), next: 1}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// A line cut short by an interrupted run is dropped
+	keep := bytes.LastIndexByte(data, '\n') + 1
+	for n, line := range strings.Split(string(data[:keep]), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		id, err := strconv.Atoi(fields[len(fields)-1])
+		if len(fields) != 2 || err != nil || id < 1 {
+			return nil, fmt.Errorf("id map %s: bad line %d: %q", path, n+1, line)
+		}
+		m.ids[fields[0]] = fields[1]
+		if id >= m.next {
+			m.next = id + 1
+		}
+	}
+
+	m.f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.f.Truncate(int64(keep)); err != nil {
+		m.f.Close()
+		return nil, err
+	}
+	if _, err := m.f.Seek(int64(keep), 0); err != nil {
+		m.f.Close()
+		return nil, err
+	}
+	m.w = bufio.NewWriter(m.f)
+	return m, nil
+}
+
+// lookup returns the internal ID of a page, if it has one.
+func (m *idMap) lookup(id string) (string, bool) {
+	internal, ok := m.ids[id]
+	return internal, ok
+}
+
+// assign returns the internal ID of a page, giving it the next one if it's
+// new. New IDs are saved before they're used, so an interrupted run can't
+// write a page with an ID the mapping doesn't have.
+func (m *idMap) assign(id string) (string, error) {
+	if internal, ok := m.ids[id]; ok {
+		return internal, nil
+	}
+
+	internal := strconv.Itoa(m.next)
+	if _, err := fmt.Fprintf(m.w, "%s\t%s\n", id, internal); err != nil {
+		return "", err
+	}
+	if err := m.w.Flush(); err != nil {
+		return "", err
+	}
+	m.ids[id] = internal
+	m.next++
+	return internal, nil
+}
+
+// Close flushes and closes the mapping file.
+func (m *idMap) Close() error {
+	if err := m.w.Flush(); err != nil {
+		m.f.Close()
+		return err
+	}
+	return m.f.Close()
+}
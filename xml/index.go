@@ -0,0 +1,155 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// IndexEntry is a row of an offset index: where a page is in a processed
+// output. Indexes are written by -index and the merge command.
+type IndexEntry struct {
+	ID     string
+	Title  string
+	Offset int64
+	Length int64
+	// Key is the search key of a sorted index made with a Transliterator
+	Key string
+}
+
+// writeIndexEntry adds a page of the output to the index. page is what was
+// written for it, starting at offset.
+func writeIndexEntry(index *tsvFile, page []byte, offset int64) error {
+	start := bytes.Index(page, pageStart)
+	end := bytes.LastIndex(page, pageEnd)
+	if start < 0 || end < start {
+		return nil
+	}
+	end += len(pageEnd)
+
+	title := string(elementText(page, "title"))
+	return index.Write(pageID(page), html.UnescapeString(title),
+		strconv.FormatInt(offset+int64(start), 10), strconv.FormatInt(int64(end-start), 10))
+}
+
+// ReadIndex calls fn for each entry of the offset index at path.
+func ReadIndex(path string, fn func(e IndexEntry) error) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) != 4 && len(fields) != 5 {
+			return fmt.Errorf("%s:%d: expected 4 or 5 fields, got %d", path, line, len(fields))
+		}
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		length, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		e := IndexEntry{ID: fields[0], Title: fields[1], Offset: offset, Length: length}
+		if len(fields) == 5 {
+			e.Key = fields[4]
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// LookupPages finds pages in a processed output with its offset index,
+// reading only those pages. Titles are matched after NormalizeTitle. It
+// returns the raw XML of each page found, in index order, and the titles and
+// IDs that weren't.
+func LookupPages(output, index string, titles, ids []string) (pages [][]byte, missing []string, err error) {
+	if IsRemote(output) || strings.HasSuffix(output, ".gz") || strings.HasSuffix(output, ".bz2") {
+		return nil, nil, fmt.Errorf("%s: pages can only be looked up in an uncompressed local file", output)
+	}
+
+	wantTitle := make(map[string]bool)
+	for _, t := range titles {
+		wantTitle[NormalizeTitle(t)] = true
+	}
+	wantID := make(map[string]bool)
+	for _, id := range ids {
+		wantID[id] = true
+	}
+
+	var found []IndexEntry
+	err = ReadIndex(index, func(e IndexEntry) error {
+		t := NormalizeTitle(e.Title)
+		if wantTitle[t] || wantID[e.ID] {
+			found = append(found, e)
+			delete(wantTitle, t)
+			delete(wantID, e.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	for _, e := range found {
+		page := make([]byte, e.Length)
+		if _, err := f.ReadAt(page, e.Offset); err != nil {
+			return nil, nil, fmt.Errorf("page %s at %d: %v", e.ID, e.Offset, err)
+		}
+		if !bytes.HasPrefix(page, pageStart) || !bytes.HasSuffix(page, pageEnd) {
+			return nil, nil, fmt.Errorf("page %s at %d: the index doesn't match %s", e.ID, e.Offset, output)
+		}
+		pages = append(pages, page)
+	}
+
+	for t := range wantTitle {
+		missing = append(missing, t)
+	}
+	for id := range wantID {
+		missing = append(missing, id)
+	}
+	return pages, missing, nil
+}
+
+// WritePages writes raw pages as a complete document, like the output they
+// came from.
+func WritePages(path string, pages [][]byte) error {
+	f, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	doc := newDocWriter(f, "  ")
+	err = doc.head()
+	for _, page := range pages {
+		if err != nil {
+			break
+		}
+		_, err = doc.rawPage(page)
+	}
+	if err == nil {
+		err = doc.end()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
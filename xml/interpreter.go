@@ -0,0 +1,118 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// scriptInterpreters are the commands scripts are run with by their
+// extension, when they can't be run themselves.
+var scriptInterpreters = map[string][]string{
+	".py":  {"python3"},
+	".sh":  {"sh"},
+	".pl":  {"perl"},
+	".rb":  {"ruby"},
+	".js":  {"node"},
+	".ps1": {"powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-File"},
+}
+
+// ScriptInterpreter returns the command a script has to be run with, or
+// nil if it can be run itself. Windows only runs .exe, .bat and .cmd files
+// itself, and elsewhere a script has to be executable. The others are run
+// with the interpreter for their extension or, failing that, the one on
+// their #! line. On Windows that's looked up by its name on the PATH, and
+// python with the py launcher, since python3 usually isn't on the PATH
+// there.
+func ScriptInterpreter(script string) ([]string, error) {
+	return scriptInterpreterOn(runtime.GOOS, script)
+}
+
+// scriptInterpreterOn is ScriptInterpreter as it is on goos.
+func scriptInterpreterOn(goos, script string) ([]string, error) {
+	windows := goos == "windows"
+	ext := strings.ToLower(filepath.Ext(script))
+	if windows {
+		switch ext {
+		case ".exe", ".bat", ".cmd", ".com":
+			return nil, nil
+		}
+	} else {
+		info, err := os.Stat(script)
+		if err != nil || info.Mode()&0111 != 0 {
+			// Whatever's wrong is reported when it's run
+			return nil, nil
+		}
+	}
+
+	interpreter := scriptInterpreters[ext]
+	if interpreter == nil {
+		var err error
+		interpreter, err = shebang(script)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if interpreter == nil {
+		if windows {
+			return nil, fmt.Errorf("%s: can't tell what to run it with, give it an extension, a #! line or -script-prefix", script)
+		}
+		return nil, fmt.Errorf("%s isn't executable and has no #! line", script)
+	}
+
+	if windows {
+		name := path.Base(interpreter[0])
+		if name == "python3" || name == "python" {
+			return append([]string{"py", "-3"}, interpreter[1:]...), nil
+		}
+		interpreter = append([]string{name}, interpreter[1:]...)
+	}
+	return interpreter, nil
+}
+
+// shebang returns the interpreter on the script's #! line, if it has one.
+// An env in front of it is dropped, since the interpreter is looked up on
+// the PATH anyway.
+func shebang(script string) ([]string, error) {
+	f, err := os.Open(script)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// A script without a line break is all one line
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return nil, nil
+	}
+	fields := strings.Fields(strings.TrimSpace(line[2:]))
+	if len(fields) > 0 && path.Base(fields[0]) == "env" {
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// scriptInterpreter is ScriptInterpreter, looked up once per script. If it
+// can't be found the script is run itself, for the error.
+func (w *Worker) scriptInterpreter(script string) []string {
+	if interpreter, ok := w.interpreters.Load(script); ok {
+		return interpreter.([]string)
+	}
+	interpreter, err := ScriptInterpreter(script)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	w.interpreters.Store(script, interpreter)
+	return interpreter
+}
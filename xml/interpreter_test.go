@@ -0,0 +1,59 @@
+package xml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScriptInterpreter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "interpreter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := func(name, content string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+		// WriteFile leaves the mode of a file that's there, and the umask
+		// applies to a new one
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, tt := range []struct {
+		name, goos, script string
+		want               []string
+		err                bool
+	}{
+		{"executable", "linux", script("run", "#!/bin/sh\n", 0755), nil, false},
+		{"extension", "linux", script("clean.py", "print()\n", 0644), []string{"python3"}, false},
+		{"shebang", "linux", script("clean", "#!/usr/bin/perl -w\n", 0644), []string{"/usr/bin/perl", "-w"}, false},
+		{"env with flags", "linux", script("envflags", "#!/usr/bin/env -i -S python3 -u\nprint()\n", 0644), []string{"python3", "-u"}, false},
+		{"env only", "darwin", script("envonly", "#!/usr/bin/env\n", 0644), nil, true},
+		{"no shebang", "linux", script("plain", "echo hi\n", 0644), nil, true},
+		{"one line", "linux", script("oneline", "#!/bin/bash", 0644), []string{"/bin/bash"}, false},
+		{"windows exe", "windows", script("clean.exe", "MZ", 0644), nil, false},
+		{"windows py", "windows", script("win.py", "print()\n", 0644), []string{"py", "-3"}, false},
+		{"windows python shebang", "windows", script("winpy", "#!/usr/bin/env python3 -u\n", 0644), []string{"py", "-3", "-u"}, false},
+		{"windows shebang path", "windows", script("winsh", "#!/bin/bash -e\n", 0644), []string{"bash", "-e"}, false},
+		{"windows powershell", "windows", script("clean.ps1", "Write-Output 1\n", 0644), []string{"powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-File"}, false},
+		{"windows no shebang", "windows", script("winplain", "echo hi\n", 0755), nil, true},
+	} {
+		got, err := scriptInterpreterOn(tt.goos, tt.script)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
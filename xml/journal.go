@@ -0,0 +1,274 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Journal commits are grouped, syncing at most every journalPages pages or
+// journalInterval, whichever comes first.
+const (
+	journalPages    = 1000
+	journalInterval = time.Second
+)
+
+// journal is a write-ahead log for the output file. A page is only recorded
+// once the output has been synced to disk with it, so after a crash the
+// journal lists exactly the pages that made it, and anything in the output
+// past the last of them is a torn write.
+//
+// Each line is a tab separated record: "head <end>" after the header,
+// "page <id> <end> <crc32>" for a page and "end <end>" once the document is
+// complete. end is the size of the output up to and including the record,
+// and the CRC covers the bytes of the page.
+type journal struct {
+	f       *os.File
+	pending bytes.Buffer
+	pages   int
+	last    time.Time
+
+	// offset is where the output continues, done the pages already in it
+	offset   int64
+	done     map[string]bool
+	complete bool
+}
+
+// openJournal creates the journal at path for output, or with resume picks
+// up an existing one. The output is cut back to the last page the journal
+// has a good record of.
+func openJournal(path, output string, resume bool) (*journal, error) {
+	j := &journal{done: make(map[string]bool), last: time.Now()}
+	if !resume {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		j.f = f
+		return j, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+
+	out, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	defer out.Close()
+
+	keep, err := j.recover(out)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("journal %s: %v", path, err)
+	}
+
+	// Drop whatever couldn't be trusted from both files
+	if err := f.Truncate(keep); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(keep, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := out.Truncate(j.offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	log.Printf("journal %s: resuming %s at byte %d after %d pages", path, output, j.offset, len(j.done))
+	return j, nil
+}
+
+// journalRecord is a parsed journal line.
+type journalRecord struct {
+	kind  string
+	id    string
+	end   int64
+	crc   uint32
+	start int64 // of the page in the output
+	line  int64 // end of the line in the journal
+}
+
+// recover reads the journal and checks it against the output, setting the
+// state to the last good record. It returns the length of the journal to
+// keep.
+func (j *journal) recover(out *os.File) (int64, error) {
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	var records []journalRecord
+	var pos, prev int64
+	r := bufio.NewReader(j.f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// A partial last line was never committed
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		pos += int64(len(line))
+
+		rec, ok := parseJournalRecord(strings.TrimSuffix(line, "\n"))
+		if !ok || rec.end > size {
+			break
+		}
+		rec.start = prev
+		rec.line = pos
+		prev = rec.end
+		records = append(records, rec)
+	}
+
+	// The last pages are the most likely to be torn
+	for len(records) > 0 {
+		last := records[len(records)-1]
+		if last.kind != "page" || pageCRC(out, last.start, last.end) == last.crc {
+			break
+		}
+		records = records[:len(records)-1]
+	}
+
+	for _, rec := range records {
+		switch rec.kind {
+		case "page":
+			j.done[rec.id] = true
+		case "end":
+			j.complete = true
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	last := records[len(records)-1]
+	j.offset = last.end
+	return last.line, nil
+}
+
+// parseJournalRecord parses a journal line.
+func parseJournalRecord(line string) (journalRecord, bool) {
+	var rec journalRecord
+	fields := strings.Split(line, "\t")
+	rec.kind = fields[0]
+
+	var err error
+	switch {
+	case (rec.kind == "head" || rec.kind == "end") && len(fields) == 2:
+		rec.end, err = strconv.ParseInt(fields[1], 10, 64)
+	case rec.kind == "page" && len(fields) == 4:
+		rec.id = fields[1]
+		rec.end, err = strconv.ParseInt(fields[2], 10, 64)
+		if err == nil {
+			var crc uint64
+			crc, err = strconv.ParseUint(fields[3], 16, 32)
+			rec.crc = uint32(crc)
+		}
+	default:
+		return rec, false
+	}
+	return rec, err == nil
+}
+
+// pageCRC is the CRC of a range of the output.
+func pageCRC(f *os.File, start, end int64) uint32 {
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, io.NewSectionReader(f, start, end-start)); err != nil {
+		return 0
+	}
+	return h.Sum32()
+}
+
+// head records the header, which ends at end.
+func (j *journal) head(out *os.File, end int64) error {
+	j.offset = end
+	fmt.Fprintf(&j.pending, "head\t%d\n", end)
+	return j.commit(out)
+}
+
+// page records a page just written to the output on a new line,
+// committing the journal if it's been a while.
+func (j *journal) page(out *os.File, id string, page []byte) error {
+	j.offset += int64(1 + len(page))
+	crc := crc32.Update(crc32.ChecksumIEEE([]byte{'\n'}), crc32.IEEETable, page)
+	fmt.Fprintf(&j.pending, "page\t%s\t%d\t%08x\n", id, j.offset, crc)
+	j.pages++
+	if j.pages >= journalPages || time.Since(j.last) >= journalInterval {
+		return j.commit(out)
+	}
+	return nil
+}
+
+// end records the end of the document and closes the journal.
+func (j *journal) end(out *os.File, end int64) error {
+	j.offset = end
+	fmt.Fprintf(&j.pending, "end\t%d\n", end)
+	if err := j.commit(out); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+// commit syncs the output, then adds the pending records to the journal.
+func (j *journal) commit(out *os.File) error {
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if _, err := j.f.Write(j.pending.Bytes()); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.pending.Reset()
+	j.pages = 0
+	j.last = time.Now()
+	return nil
+}
+
+// pageID returns the ID of a marshaled page, the first <id> in it.
+func pageID(page []byte) string {
+	start := bytes.Index(page, []byte("<id>"))
+	if start < 0 {
+		return ""
+	}
+	start += len("<id>")
+	end := bytes.Index(page[start:], []byte("</id>"))
+	if end < 0 {
+		return ""
+	}
+	return string(page[start : start+end])
+}
+
+// openJournaled opens the journaled output, positioned where the journal
+// left off.
+func (w *Worker) openJournaled(path string) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE
+	if !w.Resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(w.journal.offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,93 @@
+package xml
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Problems found by Lint.
+const (
+	LintTemplate = "unbalanced-template"
+	LintLink     = "unbalanced-link"
+	LintRef      = "unclosed-ref"
+	LintTable    = "malformed-table"
+)
+
+var (
+	// lintIgnored is markup whose contents aren't wikitext
+	lintIgnored = regexp.MustCompile(`(?is)<!--.*?-->|<(nowiki|pre|math|syntaxhighlight|source|code)\b[^>]*>.*?</(nowiki|pre|math|syntaxhighlight|source|code)>`)
+	refOpen     = regexp.MustCompile(`(?i)<ref\b[^>]*?(/?)>`)
+	refClose    = regexp.MustCompile(`(?i)</ref\s*>`)
+)
+
+// Lint returns the syntax problems in the wikitext of a page, which is
+// escaped the way it's kept in the page. These pages are the main source of
+// garbled output from the parse script.
+func Lint(text string) []string {
+	text = html.UnescapeString(text)
+	text = lintIgnored.ReplaceAllString(text, "")
+
+	var problems []string
+	if !balanced(text, "{{", "}}") {
+		problems = append(problems, LintTemplate)
+	}
+	if !balanced(text, "[[", "]]") {
+		problems = append(problems, LintLink)
+	}
+
+	opens := 0
+	for _, m := range refOpen.FindAllStringSubmatch(text, -1) {
+		if m[1] == "" {
+			opens++
+		}
+	}
+	if opens != len(refClose.FindAllStringIndex(text, -1)) {
+		problems = append(problems, LintRef)
+	}
+
+	if !tablesClosed(text) {
+		problems = append(problems, LintTable)
+	}
+	return problems
+}
+
+// balanced reports whether every open has a close after it and the other
+// way around.
+func balanced(text, open, close string) bool {
+	depth := 0
+	for i := 0; i < len(text)-1; {
+		switch {
+		case strings.HasPrefix(text[i:], open):
+			depth++
+			i += len(open)
+		case strings.HasPrefix(text[i:], close):
+			depth--
+			if depth < 0 {
+				return false
+			}
+			i += len(close)
+		default:
+			i++
+		}
+	}
+	return depth == 0
+}
+
+// tablesClosed checks that the {| and |} lines of tables pair up.
+func tablesClosed(text string) bool {
+	depth := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "{|"):
+			depth++
+		case strings.HasPrefix(line, "|}"):
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
@@ -0,0 +1,154 @@
+package xml
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The LZ4 block format, see
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md. Only the
+// block format is written, without the frame around it, since the blob file
+// already records the sizes.
+const (
+	lz4MinMatch  = 4
+	lz4HashLog   = 14
+	lz4MaxOffset = 65535
+	// The last match has to start 12 bytes before the end and the last 5
+	// bytes are always literals
+	lz4MatchLimit   = 12
+	lz4LastLiterals = 5
+)
+
+var errLZ4Corrupt = errors.New("lz4: corrupt block")
+
+// lz4Compress compresses src as a single LZ4 block, finding matches with a
+// hash table of the last position of each 4 byte sequence.
+func lz4Compress(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/255+16)
+	table := make([]int32, 1<<lz4HashLog)
+
+	anchor := 0
+	for i := 0; i+lz4MatchLimit < len(src); {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		// Positions are stored plus one, so zero is empty
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			i++
+			continue
+		}
+
+		n := lz4MinMatch
+		for i+n < len(src)-lz4LastLiterals && src[ref+n] == src[i+n] {
+			n++
+		}
+		dst = lz4Sequence(dst, src[anchor:i], i-ref, n)
+		i += n
+		anchor = i
+	}
+	return lz4Sequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4Sequence appends literals followed by a match of length n at offset.
+// The last sequence of a block has only literals.
+func lz4Sequence(dst, literals []byte, offset, n int) []byte {
+	token := byte(15 << 4)
+	if len(literals) < 15 {
+		token = byte(len(literals)) << 4
+	}
+	match := n - lz4MinMatch
+	if n > 0 {
+		if match < 15 {
+			token |= byte(match)
+		} else {
+			token |= 15
+		}
+	}
+
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lz4Length(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if n == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if match >= 15 {
+		dst = lz4Length(dst, match-15)
+	}
+	return dst
+}
+
+// lz4Length appends the rest of a length that didn't fit in the token.
+func lz4Length(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decompress decompresses a block that was size bytes uncompressed.
+func lz4Decompress(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+	i := 0
+	length := func(n int) (int, error) {
+		for {
+			if i >= len(src) {
+				return 0, errLZ4Corrupt
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		n := int(token >> 4)
+		if n == 15 {
+			var err error
+			if n, err = length(n); err != nil {
+				return nil, err
+			}
+		}
+		if i+n > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+n]...)
+		i += n
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4Corrupt
+		}
+		n = int(token & 15)
+		if n == 15 {
+			var err error
+			if n, err = length(n); err != nil {
+				return nil, err
+			}
+		}
+		// The match can overlap what it copies, so go a byte at a time
+		for k := 0; k < n+lz4MinMatch; k++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if len(dst) != size {
+		return nil, errLZ4Corrupt
+	}
+	return dst, nil
+}
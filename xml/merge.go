@@ -0,0 +1,123 @@
+package xml
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// Formats MergeShards can write.
+const (
+	MergeXML   = "xml"
+	MergeJSONL = "jsonl"
+)
+
+// MergeStats counts what MergeShards did.
+type MergeStats struct {
+	Pages      int
+	Duplicates int
+}
+
+// MergeShards combines processed outputs into a single document at out, in
+// the given format, keeping only the first page with each title. The pages
+// are copied as they are, not marshaled again.
+//
+// If index is set it receives the offset table of the merged output as TSV:
+// id, title, byte offset and length of each page.
+func MergeShards(inputs []string, out, format, index string) (MergeStats, error) {
+	var stats MergeStats
+	if format != MergeXML && format != MergeJSONL {
+		return stats, fmt.Errorf("unknown merge format: %s", format)
+	}
+
+	f, err := createOutput(out)
+	if err != nil {
+		return stats, err
+	}
+	// The xml output goes through a docWriter, the jsonl output straight to
+	// the buffer
+	doc := newDocWriter(f, "  ")
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	var offsets *tsvFile
+	if index != "" {
+		offsets, err = createTSV(index)
+		if err != nil {
+			f.Close()
+			return stats, err
+		}
+	}
+
+	var offset int64
+	if format == MergeXML {
+		if err := doc.head(); err != nil {
+			f.Close()
+			return stats, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		log.Println("merging:", input)
+		err := scanPages(input, func(raw []byte) error {
+			var p Page
+			if err := xml.Unmarshal(raw, &p); err != nil {
+				return err
+			}
+			if seen[p.Title] {
+				stats.Duplicates++
+				return nil
+			}
+			seen[p.Title] = true
+			stats.Pages++
+
+			start := offset
+			switch format {
+			case MergeXML:
+				var err error
+				if start, err = doc.rawPage(raw); err != nil {
+					return err
+				}
+				offset = doc.offset
+			case MergeJSONL:
+				before := w.Buffered()
+				if err := enc.Encode(NewRecord(&p)); err != nil {
+					return err
+				}
+				offset += int64(w.Buffered() - before)
+			}
+
+			if offsets != nil {
+				return offsets.Write(p.ID, p.Title, strconv.FormatInt(start, 10), strconv.FormatInt(offset-start, 10))
+			}
+			return nil
+		})
+		if err != nil {
+			f.Close()
+			return stats, fmt.Errorf("%s: %v", input, err)
+		}
+	}
+
+	if format == MergeXML {
+		err = doc.end()
+	} else {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return stats, err
+	}
+	if err := f.Close(); err != nil {
+		return stats, err
+	}
+	if offsets != nil {
+		if err := offsets.Close(); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,35 @@
+package xml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MetadataSink writes a row of metadata for each page as TSV: id, title,
+// namespace, revision id, timestamp, redirect target, the size of the
+// processed text in bytes, categories and short description. It's for the
+// tools that need the list of articles without reading the output.
+type MetadataSink struct {
+	t *tsvFile
+}
+
+// NewMetadataSink creates the TSV file at path.
+func NewMetadataSink(path string) (*MetadataSink, error) {
+	t, err := createTSV(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MetadataSink{t: t}, nil
+}
+
+// WritePage implements Sink.
+func (s *MetadataSink) WritePage(p *Page) error {
+	r := NewRecord(p)
+	return s.t.Write(r.ID, r.Title, r.Ns, r.RevisionID, r.Timestamp, r.Redirect,
+		strconv.Itoa(len(r.Text)), strings.Join(r.Categories, "|"), r.ShortDescription)
+}
+
+// Close implements Sink.
+func (s *MetadataSink) Close() error {
+	return s.t.Close()
+}
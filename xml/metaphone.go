@@ -0,0 +1,567 @@
+package xml
+
+import (
+	"strings"
+	"unicode"
+)
+
+// metaphoneLength is how long the Double Metaphone keys of titles are. The
+// usual 4 is meant for single names.
+const metaphoneLength = 8
+
+// DoubleMetaphone returns the primary and alternate Double Metaphone keys
+// of s, after Lawrence Philips' algorithm. The alternate is the same as the
+// primary for most words.
+func DoubleMetaphone(s string) (primary, alternate string) {
+	m := &metaphone{max: metaphoneLength}
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if r != 'Ç' && r != 'Ñ' {
+			if folded, ok := letterFolds[unicode.ToLower(r)]; ok {
+				r = unicode.ToUpper(folded)
+			}
+		}
+		switch {
+		case r >= 'A' && r <= 'Z', r == 'Ç', r == 'Ñ':
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			b.WriteByte(' ')
+		}
+	}
+	m.v = []rune(strings.TrimSpace(b.String()))
+	m.encode()
+	return m.primary.String(), m.alternate.String()
+}
+
+type metaphone struct {
+	v                  []rune
+	max                int
+	primary, alternate strings.Builder
+	slavoGermanic      bool
+}
+
+func (m *metaphone) at(i int) rune {
+	if i < 0 || i >= len(m.v) {
+		return 0
+	}
+	return m.v[i]
+}
+
+// is reports whether the text at i is any of the strings, which all have
+// the same length.
+func (m *metaphone) is(i int, options ...string) bool {
+	for _, o := range options {
+		n := len([]rune(o))
+		if i >= 0 && i+n <= len(m.v) && string(m.v[i:i+n]) == o {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *metaphone) vowel(i int) bool {
+	return strings.ContainsRune("AEIOUY", m.at(i))
+}
+
+func (m *metaphone) add(primary, alternate string) {
+	m.addPrimary(primary)
+	m.addAlternate(alternate)
+}
+
+func (m *metaphone) addPrimary(s string) {
+	if room := m.max - m.primary.Len(); room > 0 {
+		if len(s) > room {
+			s = s[:room]
+		}
+		m.primary.WriteString(s)
+	}
+}
+
+func (m *metaphone) addAlternate(s string) {
+	if room := m.max - m.alternate.Len(); room > 0 {
+		if len(s) > room {
+			s = s[:room]
+		}
+		m.alternate.WriteString(s)
+	}
+}
+
+func (m *metaphone) both(s string) {
+	m.add(s, s)
+}
+
+func (m *metaphone) done() bool {
+	return m.primary.Len() >= m.max && m.alternate.Len() >= m.max
+}
+
+// next returns where to carry on after the letter at i, skipping it if it's
+// doubled.
+func (m *metaphone) next(i int, double rune) int {
+	if m.at(i+1) == double {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) encode() {
+	v := string(m.v)
+	m.slavoGermanic = strings.Contains(v, "W") || strings.Contains(v, "K") || strings.Contains(v, "CZ") || strings.Contains(v, "WITZ")
+
+	i := 0
+	if m.is(0, "GN", "KN", "PN", "WR", "PS") {
+		// The first letter is silent
+		i = 1
+	}
+	for !m.done() && i < len(m.v) {
+		switch m.at(i) {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			if i == 0 {
+				m.both("A")
+			}
+			i++
+		case 'B':
+			m.both("P")
+			i = m.next(i, 'B')
+		case 'Ç':
+			m.both("S")
+			i++
+		case 'C':
+			i = m.c(i)
+		case 'D':
+			i = m.d(i)
+		case 'F':
+			m.both("F")
+			i = m.next(i, 'F')
+		case 'G':
+			i = m.g(i)
+		case 'H':
+			// Only kept first or between vowels
+			if (i == 0 || m.vowel(i-1)) && m.vowel(i+1) {
+				m.both("H")
+				i += 2
+			} else {
+				i++
+			}
+		case 'J':
+			i = m.j(i)
+		case 'K':
+			m.both("K")
+			i = m.next(i, 'K')
+		case 'L':
+			i = m.l(i)
+		case 'M':
+			m.both("M")
+			if m.at(i+1) == 'M' || m.is(i-1, "UMB") && (i+1 == len(m.v)-1 || m.is(i+2, "ER")) {
+				i += 2
+			} else {
+				i++
+			}
+		case 'N':
+			m.both("N")
+			i = m.next(i, 'N')
+		case 'Ñ':
+			m.both("N")
+			i++
+		case 'P':
+			if m.at(i+1) == 'H' {
+				m.both("F")
+				i += 2
+			} else {
+				m.both("P")
+				if m.is(i+1, "P", "B") {
+					i += 2
+				} else {
+					i++
+				}
+			}
+		case 'Q':
+			m.both("K")
+			i = m.next(i, 'Q')
+		case 'R':
+			if i == len(m.v)-1 && !m.slavoGermanic && m.is(i-2, "IE") && !m.is(i-4, "ME", "MA") {
+				// French, as in "Rogier"
+				m.addAlternate("R")
+			} else {
+				m.both("R")
+			}
+			i = m.next(i, 'R')
+		case 'S':
+			i = m.s(i)
+		case 'T':
+			i = m.t(i)
+		case 'V':
+			m.both("F")
+			i = m.next(i, 'V')
+		case 'W':
+			i = m.w(i)
+		case 'X':
+			if i == 0 {
+				m.both("S")
+				i++
+				break
+			}
+			// French endings like "breaux" are silent
+			if !(i == len(m.v)-1 && (m.is(i-3, "IAU", "EAU") || m.is(i-2, "AU", "OU"))) {
+				m.both("KS")
+			}
+			if m.is(i+1, "C", "X") {
+				i += 2
+			} else {
+				i++
+			}
+		case 'Z':
+			i = m.z(i)
+		default:
+			i++
+		}
+	}
+}
+
+func (m *metaphone) c(i int) int {
+	switch {
+	case m.germanicC(i):
+		// Like "bacher" and "macher"
+		m.both("K")
+		return i + 2
+	case i == 0 && m.is(i, "CAESAR"):
+		m.both("S")
+		return i + 2
+	case m.is(i, "CH"):
+		return m.ch(i)
+	case m.is(i, "CZ") && !m.is(i-2, "WICZ"):
+		// "Czerny"
+		m.add("S", "X")
+		return i + 2
+	case m.is(i+1, "CIA"):
+		// "Focaccia"
+		m.both("X")
+		return i + 3
+	case m.is(i, "CC") && !(i == 1 && m.at(0) == 'M'):
+		// Double C, but not "McClellan"
+		if m.is(i+2, "I", "E", "H") && !m.is(i+2, "HU") {
+			if i == 1 && m.at(0) == 'A' || m.is(i-1, "UCCEE", "UCCES") {
+				// "Accident", "succeed"
+				m.both("KS")
+			} else {
+				// "Bacci", "bertucci"
+				m.both("X")
+			}
+			return i + 3
+		}
+		// "Pierce's rule"
+		m.both("K")
+		return i + 2
+	case m.is(i, "CK", "CG", "CQ"):
+		m.both("K")
+		return i + 2
+	case m.is(i, "CI", "CE", "CY"):
+		// Italian and English
+		if m.is(i, "CIO", "CIE", "CIA") {
+			m.add("S", "X")
+		} else {
+			m.both("S")
+		}
+		return i + 2
+	}
+
+	m.both("K")
+	switch {
+	case m.is(i+1, " C", " Q", " G"):
+		// "Mac Caffrey", "Mac Gregor"
+		return i + 3
+	case m.is(i+1, "C", "K", "Q") && !m.is(i+1, "CE", "CI"):
+		return i + 2
+	}
+	return i + 1
+}
+
+// germanicC reports whether the C at i is hard, as in "bacher".
+func (m *metaphone) germanicC(i int) bool {
+	if m.is(i, "CHIA") {
+		return true
+	}
+	if i <= 1 || m.vowel(i-2) || !m.is(i-1, "ACH") {
+		return false
+	}
+	c := m.at(i + 2)
+	return c != 'I' && c != 'E' || m.is(i-2, "BACHER", "MACHER")
+}
+
+func (m *metaphone) ch(i int) int {
+	switch {
+	case i > 0 && m.is(i, "CHAE"):
+		// "Michael"
+		m.add("K", "X")
+	case i == 0 && (m.is(i+1, "HARAC", "HARIS") || m.is(i+1, "HOR", "HYM", "HIA", "HEM")) && !m.is(0, "CHORE"):
+		// Greek roots like "chemistry", "chorus"
+		m.both("K")
+	case m.is(0, "VAN ", "VON ") || m.is(0, "SCH") ||
+		m.is(i-2, "ORCHES", "ARCHIT", "ORCHID") || m.is(i+2, "T", "S") ||
+		(m.is(i-1, "A", "O", "U", "E") || i == 0) && (m.is(i+2, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ") || i+1 == len(m.v)-1):
+		// Germanic, Greek or otherwise "ch" as in "loch"
+		m.both("K")
+	case i > 0:
+		if m.is(0, "MC") {
+			// "McHugh"
+			m.both("K")
+		} else {
+			m.add("X", "K")
+		}
+	default:
+		m.both("X")
+	}
+	return i + 2
+}
+
+func (m *metaphone) d(i int) int {
+	switch {
+	case m.is(i, "DG"):
+		if m.is(i+2, "I", "E", "Y") {
+			// "Edge"
+			m.both("J")
+			return i + 3
+		}
+		// "Edgar"
+		m.both("TK")
+		return i + 2
+	case m.is(i, "DT", "DD"):
+		m.both("T")
+		return i + 2
+	}
+	m.both("T")
+	return i + 1
+}
+
+func (m *metaphone) g(i int) int {
+	switch {
+	case m.at(i+1) == 'H':
+		return m.gh(i)
+	case m.at(i+1) == 'N':
+		switch {
+		case i == 1 && m.vowel(0) && !m.slavoGermanic:
+			m.add("KN", "N")
+		case !m.is(i+2, "EY") && m.at(i+1) != 'Y' && !m.slavoGermanic:
+			// Not like "Cagney"
+			m.add("N", "KN")
+		default:
+			m.both("KN")
+		}
+		return i + 2
+	case m.is(i+1, "LI") && !m.slavoGermanic:
+		// "Tagliaro"
+		m.add("KL", "L")
+		return i + 2
+	case i == 0 && (m.at(i+1) == 'Y' || m.is(i+1, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")):
+		m.add("K", "J")
+		return i + 2
+	case (m.is(i+1, "ER") || m.at(i+1) == 'Y') && !m.is(0, "DANGER", "RANGER", "MANGER") &&
+		!m.is(i-1, "E", "I") && !m.is(i-1, "RGY", "OGY"):
+		m.add("K", "J")
+		return i + 2
+	case m.is(i+1, "E", "I", "Y") || m.is(i-1, "AGGI", "OGGI"):
+		// Italian "biaggi"
+		switch {
+		case m.is(0, "VAN ", "VON ") || m.is(0, "SCH") || m.is(i+1, "ET"):
+			// Germanic
+			m.both("K")
+		case m.is(i+1, "IER"):
+			m.both("J")
+		default:
+			m.add("J", "K")
+		}
+		return i + 2
+	case m.at(i+1) == 'G':
+		m.both("K")
+		return i + 2
+	}
+	m.both("K")
+	return i + 1
+}
+
+func (m *metaphone) gh(i int) int {
+	switch {
+	case i > 0 && !m.vowel(i-1):
+		m.both("K")
+	case i == 0:
+		// "Ghislane", "ghiradelli"
+		if m.at(i+2) == 'I' {
+			m.both("J")
+		} else {
+			m.both("K")
+		}
+	case i > 1 && m.is(i-2, "B", "H", "D") || i > 2 && m.is(i-3, "B", "H", "D") || i > 3 && m.is(i-4, "B", "H"):
+		// Parker's rule, as in "hugh"
+	case i > 2 && m.at(i-1) == 'U' && m.is(i-3, "C", "G", "L", "R", "T"):
+		// "Laugh", "McLaughlin", "cough", "rough"
+		m.both("F")
+	case i > 0 && m.at(i-1) != 'I':
+		m.both("K")
+	}
+	return i + 2
+}
+
+func (m *metaphone) j(i int) int {
+	if m.is(i, "JOSE") || m.is(0, "SAN ") {
+		// Spanish, as in "Jose" or "San Jacinto"
+		if i == 0 && m.at(i+4) == ' ' || len(m.v) == 4 || m.is(0, "SAN ") {
+			m.both("H")
+		} else {
+			m.add("J", "H")
+		}
+		return i + 1
+	}
+
+	switch {
+	case i == 0:
+		// "Yankelovich", "Jankelowicz"
+		m.add("J", "A")
+	case m.vowel(i-1) && !m.slavoGermanic && (m.at(i+1) == 'A' || m.at(i+1) == 'O'):
+		// Spanish pronunciation of "bajador"
+		m.add("J", "H")
+	case i == len(m.v)-1:
+		m.add("J", "")
+	case !m.is(i+1, "L", "T", "K", "S", "N", "M", "B", "Z") && !m.is(i-1, "S", "K", "L"):
+		m.both("J")
+	}
+	return m.next(i, 'J')
+}
+
+func (m *metaphone) l(i int) int {
+	if m.at(i+1) != 'L' {
+		m.both("L")
+		return i + 1
+	}
+	last := len(m.v) - 1
+	if i == last-2 && m.is(i-1, "ILLO", "ILLA", "ALLE") ||
+		(m.is(last-1, "AS", "OS") || m.is(last, "A", "O")) && m.is(i-1, "ALLE") {
+		// Spanish, as in "cabrillo" and "gallegos"
+		m.addPrimary("L")
+	} else {
+		m.both("L")
+	}
+	return i + 2
+}
+
+func (m *metaphone) s(i int) int {
+	switch {
+	case m.is(i-1, "ISL", "YSL"):
+		// Silent, as in "island" and "carlisle"
+		return i + 1
+	case i == 0 && m.is(i, "SUGAR"):
+		m.add("X", "S")
+		return i + 1
+	case m.is(i, "SH"):
+		if m.is(i+1, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			// Germanic
+			m.both("S")
+		} else {
+			m.both("X")
+		}
+		return i + 2
+	case m.is(i, "SIO", "SIA") || m.is(i, "SIAN"):
+		// Italian and Armenian
+		if m.slavoGermanic {
+			m.both("S")
+		} else {
+			m.add("S", "X")
+		}
+		return i + 3
+	case i == 0 && m.is(i+1, "M", "N", "L", "W") || m.is(i+1, "Z"):
+		// German and anglicizations, as in "Smith" matching "Schmidt"
+		m.add("S", "X")
+		return m.next(i, 'Z')
+	case m.is(i, "SC"):
+		return m.sc(i)
+	}
+
+	if i == len(m.v)-1 && m.is(i-2, "AI", "OI") {
+		// French, as in "resnais" and "artois"
+		m.addAlternate("S")
+	} else {
+		m.both("S")
+	}
+	if m.is(i+1, "S", "Z") {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) sc(i int) int {
+	switch {
+	case m.at(i+2) == 'H':
+		switch {
+		case m.is(i+3, "ER", "EN"):
+			// "Schenker"
+			m.add("X", "SK")
+		case m.is(i+3, "OO", "UY", "ED", "EM"):
+			// Dutch, as in "school" and "schooner"
+			m.both("SK")
+		case i == 0 && !m.vowel(3) && m.at(3) != 'W':
+			m.add("X", "S")
+		default:
+			m.both("X")
+		}
+	case m.is(i+2, "I", "E", "Y"):
+		m.both("S")
+	default:
+		m.both("SK")
+	}
+	return i + 3
+}
+
+func (m *metaphone) t(i int) int {
+	switch {
+	case m.is(i, "TION") || m.is(i, "TIA", "TCH"):
+		m.both("X")
+		return i + 3
+	case m.is(i, "TH") || m.is(i, "TTH"):
+		if m.is(i+2, "OM", "AM") || m.is(0, "VAN ", "VON ") || m.is(0, "SCH") {
+			// "Thomas", "Thames"
+			m.both("T")
+		} else {
+			m.add("0", "T")
+		}
+		return i + 2
+	}
+	m.both("T")
+	if m.is(i+1, "T", "D") {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) w(i int) int {
+	switch {
+	case m.is(i, "WR"):
+		m.both("R")
+		return i + 2
+	case i == 0 && (m.vowel(i+1) || m.is(i, "WH")):
+		// "Wasserman" should match "Vasserman"
+		if m.vowel(i + 1) {
+			m.add("A", "F")
+		} else {
+			m.both("A")
+		}
+	case i == len(m.v)-1 && m.vowel(i-1) || m.is(i-1, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || m.is(0, "SCH"):
+		// Polish, as in "Filipowicz"
+		m.addAlternate("F")
+	case m.is(i, "WICZ", "WITZ"):
+		m.add("TS", "FX")
+		return i + 4
+	}
+	return i + 1
+}
+
+func (m *metaphone) z(i int) int {
+	if m.at(i+1) == 'H' {
+		// Chinese, as in "Zhao"
+		m.both("J")
+		return i + 2
+	}
+	if m.is(i+1, "ZO", "ZI", "ZA") || m.slavoGermanic && i > 0 && m.at(i-1) != 'T' {
+		m.add("S", "TS")
+	} else {
+		m.both("S")
+	}
+	return m.next(i, 'Z')
+}
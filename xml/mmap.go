@@ -0,0 +1,97 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// mappedInput reads an input from its mapping. Closing it leaves the mapping
+// in place for the next pass over the input.
+type mappedInput struct {
+	io.Reader
+	data []byte
+}
+
+func (m *mappedInput) Close() error {
+	return nil
+}
+
+// open opens an input for reading. With Mmap set a local uncompressed file
+// is mapped into memory the first time it's opened and read from the
+// mapping after that, so the passes over it share the page cache rather
+// than each reading it through its own buffers. Anything else is opened
+// with openCounted.
+func (w *Worker) open(input string) (io.ReadCloser, error) {
+	if !w.Mmap || IsRemote(input) || strings.HasSuffix(input, ".bz2") || strings.HasSuffix(input, ".gz") {
+		return openCounted(input, w.Progress, w.ReadAhead)
+	}
+
+	w.mappedMu.Lock()
+	defer w.mappedMu.Unlock()
+	data, ok := w.mapped[input]
+	if !ok {
+		var err error
+		data, err = mapInput(input)
+		if err != nil {
+			log.Printf("mmap %s: %v. Reading it instead", input, err)
+			return openCounted(input, w.Progress, w.ReadAhead)
+		}
+		if w.mapped == nil {
+			w.mapped = make(map[string][]byte)
+		}
+		w.mapped[input] = data
+	}
+	m := &mappedInput{Reader: bytes.NewReader(data), data: data}
+	if w.Progress != nil {
+		m.Reader = &progressReader{Reader: m.Reader, p: w.Progress}
+	}
+	return m, nil
+}
+
+// mapInput maps the file at path into memory.
+func mapInput(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		// There's nothing to map
+		return []byte{}, nil
+	}
+	return mmapFile(f, fi.Size())
+}
+
+// unmapInputs releases the mappings once the run is over.
+func (w *Worker) unmapInputs() {
+	w.mappedMu.Lock()
+	defer w.mappedMu.Unlock()
+	for input, data := range w.mapped {
+		if len(data) > 0 {
+			if err := munmap(data); err != nil {
+				log.Printf("munmap %s: %v", input, err)
+			}
+		}
+		delete(w.mapped, input)
+	}
+}
+
+// newScanner returns a page scanner for the input f, which r buffers. With
+// f mapped and the encoding left alone it scans the mapping in place
+// instead of copying it through its buffer.
+func (w *Worker) newScanner(f io.Reader, r *bufio.Reader) *PageScanner {
+	if m, ok := f.(*mappedInput); ok && w.Encoding == EncodingOff {
+		w.Progress.add(progressBytes, int64(len(m.data)))
+		return NewPageScannerBytes(m.data)
+	}
+	return NewPageScanner(newEncodingReader(r, w.Encoding))
+}
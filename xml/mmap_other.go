@@ -0,0 +1,18 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package xml
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile isn't available here, so inputs are always read.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap isn't supported on this platform")
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package xml
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole of f into memory, read only.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases a mapping made by mmapFile.
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,38 @@
+package xml
+
+import "fmt"
+
+// Policies for the pages whose content model isn't wikitext, like Lua
+// modules (Scribunto), JSON, CSS and JavaScript, which the parse script
+// would mangle.
+const (
+	// ModelPassthrough keeps their text as it is, without cleaning it
+	ModelPassthrough = "passthrough"
+	// ModelSkip drops them before they're decoded
+	ModelSkip = "skip"
+)
+
+// ValidModelPolicy returns an error if the policy isn't one we know.
+func ValidModelPolicy(policy string) error {
+	switch policy {
+	case ModelPassthrough, ModelSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown content model policy: %s", policy)
+}
+
+// IsWikitext reports whether the page's text is wikitext, going by its
+// content model.
+func IsWikitext(p *Page) bool {
+	return isWikitextModel(p.Revision.Model, p.Ns)
+}
+
+// isWikitextModel is IsWikitext for a model and namespace. Dumps from
+// before content models don't give one, and then only the Module namespace
+// isn't wikitext.
+func isWikitextModel(model, ns string) bool {
+	if model == "" {
+		return ns != "828"
+	}
+	return model == "wikitext"
+}
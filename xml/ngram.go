@@ -0,0 +1,150 @@
+package xml
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ngramWord matches the words n-grams are made of.
+var ngramWord = regexp.MustCompile(`\pL+(?:'\pL+)*|\pN+`)
+
+// NGram is an n-gram with its (estimated) frequency.
+type NGram struct {
+	N     int
+	Text  string
+	Count uint32
+}
+
+// NGramCounter finds the most frequent n-grams in bounded memory. Counts are
+// kept in a count-min sketch, which can only overestimate, and only the
+// current top K of each order are kept exactly.
+type NGramCounter struct {
+	MaxN int
+	K    int
+
+	width  uint64
+	sketch [][]uint32
+	top    []*ngramHeap
+}
+
+// NewNGramCounter counts 1 to maxN-grams keeping the top k of each, using a
+// sketch of depth rows of width counters.
+func NewNGramCounter(maxN, k, width, depth int) *NGramCounter {
+	c := &NGramCounter{MaxN: maxN, K: k, width: uint64(width)}
+	for i := 0; i < depth; i++ {
+		c.sketch = append(c.sketch, make([]uint32, width))
+	}
+	for n := 1; n <= maxN; n++ {
+		c.top = append(c.top, &ngramHeap{index: make(map[string]int)})
+	}
+	return c
+}
+
+// Add counts all of the n-grams in the text. N-grams don't cross lines.
+func (c *NGramCounter) Add(text string) {
+	for _, line := range strings.Split(text, "\n") {
+		words := ngramWord.FindAllString(strings.ToLower(line), -1)
+		for i := range words {
+			for n := 1; n <= c.MaxN && i+n <= len(words); n++ {
+				c.add(n, strings.Join(words[i:i+n], " "))
+			}
+		}
+	}
+}
+
+func (c *NGramCounter) add(n int, gram string) {
+	// Double hashing gives depth independent-enough hash functions
+	h := fnv.New64a()
+	h.Write([]byte(gram))
+	h1 := mix64(h.Sum64())
+	h2 := mix64(h1) | 1
+
+	estimate := ^uint32(0)
+	for i, row := range c.sketch {
+		j := (h1 + uint64(i)*h2) % c.width
+		if row[j] < ^uint32(0) {
+			row[j]++
+		}
+		if row[j] < estimate {
+			estimate = row[j]
+		}
+	}
+
+	top := c.top[n-1]
+	if i, ok := top.index[gram]; ok {
+		top.items[i].Count = estimate
+		heap.Fix(top, i)
+		return
+	}
+	if top.Len() < c.K {
+		heap.Push(top, &NGram{N: n, Text: gram, Count: estimate})
+		return
+	}
+	if estimate > top.items[0].Count {
+		delete(top.index, top.items[0].Text)
+		top.items[0] = &NGram{N: n, Text: gram, Count: estimate}
+		top.index[gram] = 0
+		heap.Fix(top, 0)
+	}
+}
+
+// Top returns the top K n-grams of each order, most frequent first.
+func (c *NGramCounter) Top() []NGram {
+	var all []NGram
+	for _, top := range c.top {
+		grams := make([]NGram, 0, top.Len())
+		for _, g := range top.items {
+			grams = append(grams, *g)
+		}
+		sort.Slice(grams, func(i, j int) bool {
+			if grams[i].Count != grams[j].Count {
+				return grams[i].Count > grams[j].Count
+			}
+			return grams[i].Text < grams[j].Text
+		})
+		all = append(all, grams...)
+	}
+	return all
+}
+
+// mix64 is the splitmix64 finalizer, to spread FNV's poorly mixed bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ngramHeap is a min-heap on count, so the least frequent of the top K is
+// the one replaced.
+type ngramHeap struct {
+	items []*NGram
+	index map[string]int
+}
+
+func (h *ngramHeap) Len() int           { return len(h.items) }
+func (h *ngramHeap) Less(i, j int) bool { return h.items[i].Count < h.items[j].Count }
+
+func (h *ngramHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].Text] = i
+	h.index[h.items[j].Text] = j
+}
+
+func (h *ngramHeap) Push(x interface{}) {
+	g := x.(*NGram)
+	h.index[g.Text] = len(h.items)
+	h.items = append(h.items, g)
+}
+
+func (h *ngramHeap) Pop() interface{} {
+	g := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, g.Text)
+	return g
+}
@@ -0,0 +1,79 @@
+package xml
+
+import (
+	"strings"
+	"sync"
+)
+
+// sequencer makes the workers finish pages in the order they were read, for
+// Deterministic. Each page is numbered as it's sent to the workers, and
+// whatever happens to it after cleaning waits for the pages before it:
+// every page takes its turn with wait and gives it up with done, whether
+// it's written or dropped. A nil sequencer lets pages finish in any order.
+type sequencer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	next int64
+	last int64
+}
+
+func newSequencer() *sequencer {
+	s := &sequencer{}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// number gives the page its place in the order. It's only called by the
+// reader.
+func (s *sequencer) number(p *Page) {
+	if s == nil {
+		return
+	}
+	p.seq = s.last
+	s.last++
+}
+
+// wait blocks until the pages before p are done.
+func (s *sequencer) wait(p *Page) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	for s.next != p.seq {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+}
+
+// done gives up p's turn to the page after it.
+func (s *sequencer) done(p *Page) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.next++
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// takeTurn waits for the pages read before p, once it's been cleaned, and
+// writes what was noted about it on the way, so the reports are in order
+// too.
+func (w *Worker) takeTurn(p *Page) {
+	w.order.wait(p)
+	if w.lintReport != nil && len(p.lint) > 0 {
+		if err := w.lintReport.Write(p.ID, p.Title, strings.Join(p.lint, ",")); err != nil {
+			panic(err)
+		}
+	}
+	if p.stderr != "" {
+		w.diagnose(p, "warning", p.stderr)
+	}
+	if w.imageManifest != nil {
+		for _, m := range p.media {
+			if err := w.imageManifest.Write(p.ID, p.Title, m.File, m.Caption); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
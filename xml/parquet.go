@@ -0,0 +1,453 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parquet compression codecs we can write.
+const (
+	ParquetUncompressed = "none"
+	ParquetGzip         = "gzip"
+)
+
+// Parquet enum values, see parquet.thrift
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	parquetUTF8            = 0
+	parquetList            = 3
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetCodecNone = 0
+	parquetCodecGzip = 2
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn buffers one column of the current row group.
+type parquetColumn struct {
+	path   []string
+	typ    int32
+	maxDef int
+	maxRep int
+
+	values    bytes.Buffer
+	defs      []byte
+	reps      []byte
+	numValues int
+}
+
+// chunk is a column chunk that has been written out.
+type parquetChunk struct {
+	column           *parquetColumn
+	offset           int64
+	numValues        int
+	compressedSize   int64
+	uncompressedSize int64
+}
+
+// ParquetSink writes pages as a parquet file with the columns id, title, ns,
+// timestamp, text, categories, short_description, lat, lon, birth_date,
+// death_date, occupation, transforms, millis, fallbacks and original_text,
+// transforms, millis and fallbacks from the page's Processing with the
+// lists comma separated. Values are PLAIN encoded with one data page per
+// column chunk.
+type ParquetSink struct {
+	RowGroupSize int
+
+	f      io.WriteCloser
+	w      *bufio.Writer
+	offset int64
+	codec  int32
+
+	columns   []*parquetColumn
+	rows      int
+	totalRows int64
+	groups    [][]parquetChunk
+	groupRows []int
+}
+
+// NewParquetSink creates the parquet file at path. compression is
+// ParquetUncompressed or ParquetGzip.
+func NewParquetSink(path, compression string, rowGroupSize int) (*ParquetSink, error) {
+	var codec int32
+	switch compression {
+	case ParquetUncompressed:
+		codec = parquetCodecNone
+	case ParquetGzip:
+		codec = parquetCodecGzip
+	default:
+		return nil, fmt.Errorf("unknown parquet compression: %s", compression)
+	}
+
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ParquetSink{
+		RowGroupSize: rowGroupSize,
+		f:            f,
+		w:            bufio.NewWriter(f),
+		codec:        codec,
+		columns: []*parquetColumn{
+			{path: []string{"id"}, typ: parquetInt64},
+			{path: []string{"title"}, typ: parquetByteArray},
+			{path: []string{"ns"}, typ: parquetInt32},
+			{path: []string{"timestamp"}, typ: parquetInt64, maxDef: 1},
+			{path: []string{"text"}, typ: parquetByteArray},
+			{path: []string{"categories", "list", "element"}, typ: parquetByteArray, maxDef: 1, maxRep: 1},
+			{path: []string{"short_description"}, typ: parquetByteArray, maxDef: 1},
+			{path: []string{"lat"}, typ: parquetDouble, maxDef: 1},
+			{path: []string{"lon"}, typ: parquetDouble, maxDef: 1},
+			{path: []string{"birth_date"}, typ: parquetByteArray, maxDef: 1},
+			{path: []string{"death_date"}, typ: parquetByteArray, maxDef: 1},
+			{path: []string{"occupation"}, typ: parquetByteArray, maxDef: 1},
+			{path: []string{"transforms"}, typ: parquetByteArray, maxDef: 1},
+			{path: []string{"millis"}, typ: parquetInt64, maxDef: 1},
+			{path: []string{"fallbacks"}, typ: parquetByteArray, maxDef: 1},
+			{path: []string{"original_text"}, typ: parquetByteArray, maxDef: 1},
+		},
+	}
+	if err := s.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WritePage implements Sink.
+func (s *ParquetSink) WritePage(p *Page) error {
+	r := NewRecord(p)
+	id, _ := strconv.ParseInt(r.ID, 10, 64)
+	ns, _ := strconv.ParseInt(r.Ns, 10, 32)
+
+	s.columns[0].int64(id)
+	s.columns[1].byteArray(r.Title)
+	s.columns[2].int32(int32(ns))
+	if ts, err := time.Parse(time.RFC3339, r.Timestamp); err == nil {
+		s.columns[3].defs = append(s.columns[3].defs, 1)
+		s.columns[3].int64(ts.UnixNano() / int64(time.Millisecond))
+	} else {
+		s.columns[3].null()
+	}
+	s.columns[4].byteArray(r.Text)
+
+	cats := s.columns[5]
+	if len(r.Categories) == 0 {
+		cats.null()
+		cats.reps = append(cats.reps, 0)
+	}
+	for i, cat := range r.Categories {
+		rep := byte(1)
+		if i == 0 {
+			rep = 0
+		}
+		cats.reps = append(cats.reps, rep)
+		cats.defs = append(cats.defs, 1)
+		cats.byteArray(cat)
+	}
+	s.columns[6].optionalByteArray(r.ShortDescription)
+	if r.Coordinates != nil {
+		s.columns[7].defs = append(s.columns[7].defs, 1)
+		s.columns[7].double(r.Coordinates.Lat)
+		s.columns[8].defs = append(s.columns[8].defs, 1)
+		s.columns[8].double(r.Coordinates.Lon)
+	} else {
+		s.columns[7].null()
+		s.columns[8].null()
+	}
+	var bio Biography
+	if r.Biography != nil {
+		bio = *r.Biography
+	}
+	s.columns[9].optionalByteArray(bio.BirthDate)
+	s.columns[10].optionalByteArray(bio.DeathDate)
+	s.columns[11].optionalByteArray(bio.Occupation)
+	var processing Processing
+	if r.Processing != nil {
+		processing = *r.Processing
+	}
+	s.columns[12].optionalByteArray(strings.Join(processing.Transforms, ","))
+	if processing.Millis > 0 {
+		s.columns[13].defs = append(s.columns[13].defs, 1)
+		s.columns[13].int64(processing.Millis)
+	} else {
+		s.columns[13].null()
+	}
+	s.columns[14].optionalByteArray(strings.Join(processing.Fallbacks, ","))
+	s.columns[15].optionalByteArray(r.OriginalText)
+
+	s.rows++
+	if s.rows >= s.RowGroupSize {
+		return s.flushRowGroup()
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *ParquetSink) Close() error {
+	if s.rows > 0 {
+		if err := s.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	footer := s.footer()
+	if err := s.write(footer); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	if err := s.write(size[:]); err != nil {
+		return err
+	}
+	if err := s.write(parquetMagic); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
+
+func (s *ParquetSink) write(b []byte) error {
+	n, err := s.w.Write(b)
+	s.offset += int64(n)
+	return err
+}
+
+// flushRowGroup writes each buffered column as a single data page.
+func (s *ParquetSink) flushRowGroup() error {
+	var chunks []parquetChunk
+	for _, c := range s.columns {
+		var page bytes.Buffer
+		if c.maxRep > 0 {
+			writeLevels(&page, c.reps)
+		}
+		if c.maxDef > 0 {
+			writeLevels(&page, c.defs)
+		}
+		page.Write(c.values.Bytes())
+
+		data := page.Bytes()
+		if s.codec == parquetCodecGzip {
+			var z bytes.Buffer
+			gz := gzip.NewWriter(&z)
+			gz.Write(data)
+			if err := gz.Close(); err != nil {
+				return err
+			}
+			data = z.Bytes()
+		}
+
+		var h thriftWriter
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(page.Len()))
+		h.i32(3, int32(len(data)))
+		h.structBegin(5)
+		h.i32(1, int32(c.numValues))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.structEnd()
+		h.buf.WriteByte(0)
+
+		chunk := parquetChunk{
+			column:           c,
+			offset:           s.offset,
+			numValues:        c.numValues,
+			compressedSize:   int64(h.buf.Len() + len(data)),
+			uncompressedSize: int64(h.buf.Len() + page.Len()),
+		}
+		if err := s.write(h.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := s.write(data); err != nil {
+			return err
+		}
+		chunks = append(chunks, chunk)
+
+		c.values.Reset()
+		c.defs = c.defs[:0]
+		c.reps = c.reps[:0]
+		c.numValues = 0
+	}
+
+	s.groups = append(s.groups, chunks)
+	s.groupRows = append(s.groupRows, s.rows)
+	s.totalRows += int64(s.rows)
+	s.rows = 0
+	return nil
+}
+
+// footer returns the thrift encoded FileMetaData.
+func (s *ParquetSink) footer() []byte {
+	var t thriftWriter
+	t.i32(1, 1)
+
+	// The schema, flattened depth first
+	t.list(2, thriftStruct, 19)
+	schemaElement(&t, "schema", -1, -1, 16, -1)
+	schemaElement(&t, "id", parquetInt64, parquetRequired, 0, -1)
+	schemaElement(&t, "title", parquetByteArray, parquetRequired, 0, parquetUTF8)
+	schemaElement(&t, "ns", parquetInt32, parquetRequired, 0, -1)
+	schemaElement(&t, "timestamp", parquetInt64, parquetOptional, 0, parquetTimestampMillis)
+	schemaElement(&t, "text", parquetByteArray, parquetRequired, 0, parquetUTF8)
+	schemaElement(&t, "categories", -1, parquetRequired, 1, parquetList)
+	schemaElement(&t, "list", -1, parquetRepeated, 1, -1)
+	schemaElement(&t, "element", parquetByteArray, parquetRequired, 0, parquetUTF8)
+	schemaElement(&t, "short_description", parquetByteArray, parquetOptional, 0, parquetUTF8)
+	schemaElement(&t, "lat", parquetDouble, parquetOptional, 0, -1)
+	schemaElement(&t, "lon", parquetDouble, parquetOptional, 0, -1)
+	schemaElement(&t, "birth_date", parquetByteArray, parquetOptional, 0, parquetUTF8)
+	schemaElement(&t, "death_date", parquetByteArray, parquetOptional, 0, parquetUTF8)
+	schemaElement(&t, "occupation", parquetByteArray, parquetOptional, 0, parquetUTF8)
+	schemaElement(&t, "transforms", parquetByteArray, parquetOptional, 0, parquetUTF8)
+	schemaElement(&t, "millis", parquetInt64, parquetOptional, 0, -1)
+	schemaElement(&t, "fallbacks", parquetByteArray, parquetOptional, 0, parquetUTF8)
+	schemaElement(&t, "original_text", parquetByteArray, parquetOptional, 0, parquetUTF8)
+
+	t.i64(3, s.totalRows)
+
+	t.list(4, thriftStruct, len(s.groups))
+	for i, chunks := range s.groups {
+		t.structBegin(0)
+		t.list(1, thriftStruct, len(chunks))
+		var total int64
+		for _, c := range chunks {
+			total += c.uncompressedSize
+
+			t.structBegin(0)
+			t.i64(2, c.offset)
+			t.structBegin(3)
+			t.i32(1, c.column.typ)
+			t.list(2, thriftI32, 2)
+			t.zigzag(parquetPlain)
+			t.zigzag(parquetRLE)
+			t.list(3, thriftBinary, len(c.column.path))
+			for _, p := range c.column.path {
+				t.str(p)
+			}
+			t.i32(4, s.codec)
+			t.i64(5, int64(c.numValues))
+			t.i64(6, c.uncompressedSize)
+			t.i64(7, c.compressedSize)
+			t.i64(9, c.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, total)
+		t.i64(3, int64(s.groupRows[i]))
+		t.structEnd()
+	}
+
+	t.binary(6, "wikireader_fastparser")
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
+
+// schemaElement writes a SchemaElement, leaving out fields passed as -1 or 0
+// children.
+func schemaElement(t *thriftWriter, name string, typ, repetition int32, children int32, converted int32) {
+	t.structBegin(0)
+	if typ >= 0 {
+		t.i32(1, typ)
+	}
+	if repetition >= 0 {
+		t.i32(3, repetition)
+	}
+	t.binary(4, name)
+	if children > 0 {
+		t.i32(5, children)
+	}
+	if converted >= 0 {
+		t.i32(6, converted)
+	}
+	t.structEnd()
+}
+
+// writeLevels writes repetition or definition levels (which are 0 or 1 here)
+// with the RLE hybrid encoding and its length prefix.
+func writeLevels(w *bytes.Buffer, levels []byte) {
+	var enc bytes.Buffer
+	var b [binary.MaxVarintLen64]byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		n := binary.PutUvarint(b[:], uint64(j-i)<<1)
+		enc.Write(b[:n])
+		enc.WriteByte(levels[i])
+		i = j
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(enc.Len()))
+	w.Write(size[:])
+	w.Write(enc.Bytes())
+}
+
+func (c *parquetColumn) int32(v int32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(v))
+	c.values.Write(b[:])
+	c.numValues++
+}
+
+func (c *parquetColumn) int64(v int64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	c.values.Write(b[:])
+	c.numValues++
+}
+
+func (c *parquetColumn) double(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	c.values.Write(b[:])
+	c.numValues++
+}
+
+func (c *parquetColumn) byteArray(v string) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(v)))
+	c.values.Write(b[:])
+	c.values.WriteString(v)
+	c.numValues++
+}
+
+// optionalByteArray records v, or a missing value if it's empty.
+func (c *parquetColumn) optionalByteArray(v string) {
+	if v == "" {
+		c.null()
+		return
+	}
+	c.defs = append(c.defs, 1)
+	c.byteArray(v)
+}
+
+// null records a missing value, which only has a definition level.
+func (c *parquetColumn) null() {
+	c.defs = append(c.defs, 0)
+	c.numValues++
+}
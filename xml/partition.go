@@ -0,0 +1,92 @@
+package xml
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Partition groups pages into shards by title, the layout the reader
+// firmware expects. By default there's a shard for each letter A to Z, each
+// digit and one for everything else. With Buckets set the shards are
+// instead the FNV-1a hash of the normalized title modulo Buckets, so a
+// title can be found without knowing its first letter.
+type Partition struct {
+	Buckets int
+}
+
+// partitionLetters are the shards by first character, in order.
+var partitionLetters = strings.Split("a b c d e f g h i j k l m n o p q r s t u v w x y z 0 1 2 3 4 5 6 7 8 9 other", " ")
+
+// letterFolds maps accented Latin letters to the letter they're filed
+// under.
+var letterFolds = map[rune]rune{}
+
+func init() {
+	for base, accented := range map[rune]string{
+		'a': "àáâãäåāăąǎ", 'c': "çćĉċč", 'd': "ďđ", 'e': "èéêëēĕėęě", 'g': "ĝğġģ",
+		'h': "ĥħ", 'i': "ìíîïĩīĭįı", 'j': "ĵ", 'k': "ķ", 'l': "ĺļľŀł", 'n': "ñńņňŉ",
+		'o': "òóôõöøōŏőǒ", 'r': "ŕŗř", 's': "śŝşšș", 't': "ţťŧț", 'u': "ùúûüũūŭůűųǔ",
+		'w': "ŵ", 'y': "ýÿŷ", 'z': "źżž",
+	} {
+		for _, r := range accented {
+			letterFolds[r] = base
+		}
+	}
+}
+
+// ParsePartition parses a partition mode: "letter", or "hash:N" for N hash
+// buckets.
+func ParsePartition(s string) (*Partition, error) {
+	if s == "letter" {
+		return &Partition{}, nil
+	}
+	if strings.HasPrefix(s, "hash:") {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "hash:"))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid partition bucket count: %s", s)
+		}
+		return &Partition{Buckets: n}, nil
+	}
+	return nil, fmt.Errorf("unknown partition mode: %s (expected letter or hash:N)", s)
+}
+
+// Names returns the names of the shards, in order. Each is written next to
+// the output like the sets of a Split.
+func (p *Partition) Names() []string {
+	if p.Buckets == 0 {
+		return partitionLetters
+	}
+	width := len(strconv.Itoa(p.Buckets - 1))
+	names := make([]string, p.Buckets)
+	for i := range names {
+		names[i] = fmt.Sprintf("%0*d", width, i)
+	}
+	return names
+}
+
+// index returns the shard of a page title.
+func (p *Partition) index(title string) int {
+	title = NormalizeTitle(title)
+	if p.Buckets > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(title))
+		return int(h.Sum32() % uint32(p.Buckets))
+	}
+
+	r, _ := utf8.DecodeRuneInString(title)
+	r = unicode.ToLower(r)
+	if folded, ok := letterFolds[r]; ok {
+		r = folded
+	}
+	switch {
+	case r >= 'a' && r <= 'z':
+		return int(r - 'a')
+	case r >= '0' && r <= '9':
+		return 26 + int(r-'0')
+	}
+	return len(partitionLetters) - 1
+}
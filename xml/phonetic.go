@@ -0,0 +1,115 @@
+package xml
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// soundexCodes are the Soundex digits of the letters A to Z. Vowels are 0
+// and H and W are -1, since they don't separate letters with the same code.
+var soundexCodes = [26]int8{0, 1, 2, 3, 0, 1, 2, -1, 0, 2, 2, 4, 5, 5, 0, 1, 2, 6, 2, 3, 0, 1, -1, 2, 0, 2}
+
+// Soundex returns the American Soundex code of s, a letter and three
+// digits, or "" if s has no letters. Accented letters count as the letter
+// they're based on and everything else is ignored.
+func Soundex(s string) string {
+	code := make([]byte, 0, 4)
+	last := int8(0)
+	for _, r := range s {
+		r = unicode.ToLower(r)
+		if folded, ok := letterFolds[r]; ok {
+			r = folded
+		}
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		c := soundexCodes[r-'a']
+		if len(code) == 0 {
+			code = append(code, byte(unicode.ToUpper(r)))
+			last = c
+			continue
+		}
+		if c > 0 && c != last {
+			code = append(code, byte('0'+c))
+			if len(code) == 4 {
+				break
+			}
+		}
+		if c >= 0 {
+			last = c
+		}
+	}
+	if len(code) == 0 {
+		return ""
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+// phoneticIndex collects the phonetic keys of the titles written, so a
+// misspelled search can be matched to the titles that sound like it.
+type phoneticIndex struct {
+	mu      sync.Mutex
+	entries []phoneticEntry
+}
+
+type phoneticEntry struct {
+	scheme, key string
+	id, title   string
+}
+
+// add adds the keys of a page's title to the index: its Soundex code and
+// both Double Metaphone keys.
+func (x *phoneticIndex) add(p *Page) {
+	keys := []phoneticEntry{{scheme: "soundex", key: Soundex(p.Title)}}
+	primary, alternate := DoubleMetaphone(p.Title)
+	keys = append(keys, phoneticEntry{scheme: "metaphone", key: primary})
+	if alternate != primary {
+		keys = append(keys, phoneticEntry{scheme: "metaphone", key: alternate})
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, k := range keys {
+		if k.key == "" {
+			continue
+		}
+		k.id, k.title = p.ID, p.Title
+		x.entries = append(x.entries, k)
+	}
+}
+
+// write saves the index as TSV rows of scheme (soundex or metaphone), key,
+// page id and title, sorted by scheme and key so a reader can find the
+// titles sounding like a search with a binary search on its key.
+func (x *phoneticIndex) write(path string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	sort.Slice(x.entries, func(i, j int) bool {
+		a, b := x.entries[i], x.entries[j]
+		if a.scheme != b.scheme {
+			return a.scheme < b.scheme
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return strings.ToLower(a.title) < strings.ToLower(b.title)
+	})
+
+	t, err := createTSV(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range x.entries {
+		if err := t.Write(e.scheme, e.key, e.id, e.title); err != nil {
+			t.Close()
+			return err
+		}
+	}
+	return t.Close()
+}
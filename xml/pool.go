@@ -0,0 +1,27 @@
+package xml
+
+// Pool limits how many parse scripts run at once, shared between several
+// Workers so builds running side by side split the machine between them
+// rather than each starting its own full set. A nil Pool has no limit.
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool returns a pool running at most size scripts at once.
+func NewPool(size int) *Pool {
+	return &Pool{slots: make(chan struct{}, size)}
+}
+
+// acquire waits for a free slot.
+func (p *Pool) acquire() {
+	if p != nil {
+		p.slots <- struct{}{}
+	}
+}
+
+// release frees a slot taken with acquire.
+func (p *Pool) release() {
+	if p != nil {
+		<-p.slots
+	}
+}
@@ -0,0 +1,198 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// postgresTable is a table name, optionally with its schema.
+var postgresTable = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_$]*\.)?[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// postgresColumns are the columns of a page, in the order they're copied.
+const postgresColumns = `id, title, ns, revision_id, "timestamp", redirect, text, short_description`
+
+// PostgresSink streams pages into a PostgreSQL table with COPY. It feeds a
+// single psql session, so the only requirement is a psql client on the path.
+// Each batch is copied into a temporary table first and then upserted by
+// id, so a page that's already in the table, from an earlier run, is
+// replaced instead of failing the COPY.
+type PostgresSink struct {
+	Table string
+	// BatchSize is the number of rows per COPY statement
+	BatchSize int
+	// TxBatches is the number of COPY statements per transaction
+	TxBatches int
+
+	quoted  string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	w       *bufio.Writer
+	rows    int
+	batches int
+	inCopy  bool
+	inTx    bool
+}
+
+// NewPostgresSink starts psql against the connection string and creates the
+// table if needed. tsConfig, if set, adds a generated tsvector column using
+// that text search configuration (e.g. "english").
+func NewPostgresSink(conn, table, tsConfig string, batchSize, txBatches int) (*PostgresSink, error) {
+	if !postgresTable.MatchString(table) {
+		return nil, fmt.Errorf("invalid postgres table name: %q", table)
+	}
+	if batchSize < 1 || txBatches < 1 {
+		return nil, fmt.Errorf("postgres batches need at least one row and transactions one batch, not %d and %d", batchSize, txBatches)
+	}
+	quoted := quoteIdent(table)
+
+	cmd := exec.Command("psql", "-X", "-q", "-v", "ON_ERROR_STOP=1", conn)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting psql: %v", err)
+	}
+
+	s := &PostgresSink{
+		Table:     table,
+		BatchSize: batchSize,
+		TxBatches: txBatches,
+		quoted:    quoted,
+		cmd:       cmd,
+		stdin:     stdin,
+		w:         bufio.NewWriter(stdin),
+	}
+
+	tsv := ""
+	if tsConfig != "" {
+		tsv = fmt.Sprintf(",\n  tsv tsvector GENERATED ALWAYS AS (to_tsvector('%s', title || ' ' || coalesce(text, ''))) STORED", strings.Replace(tsConfig, "'", "''", -1))
+	}
+	fmt.Fprintf(s.w, `CREATE TABLE IF NOT EXISTS %s (
+  id bigint PRIMARY KEY,
+  title text NOT NULL,
+  ns integer,
+  revision_id bigint,
+  "timestamp" timestamptz,
+  redirect text,
+  text text,
+  short_description text%s
+);
+ALTER TABLE %s ADD COLUMN IF NOT EXISTS short_description text;
+CREATE TEMP TABLE wikireader_staging (
+  id bigint,
+  title text,
+  ns integer,
+  revision_id bigint,
+  "timestamp" timestamptz,
+  redirect text,
+  text text,
+  short_description text
+);
+`, quoted, tsv, quoted)
+	return s, nil
+}
+
+// quoteIdent quotes a table name, and its schema, as identifiers. They're
+// folded to lower case first, as postgres does with unquoted names.
+func quoteIdent(name string) string {
+	parts := strings.Split(strings.ToLower(name), ".")
+	for i, part := range parts {
+		parts[i] = `"` + part + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// WritePage implements Sink.
+func (s *PostgresSink) WritePage(p *Page) error {
+	if !s.inTx {
+		s.w.WriteString("BEGIN;\n")
+		s.inTx = true
+	}
+	if !s.inCopy {
+		fmt.Fprintf(s.w, "COPY wikireader_staging (%s) FROM STDIN;\n", postgresColumns)
+		s.inCopy = true
+	}
+
+	r := NewRecord(p)
+	fields := []string{r.ID, r.Title, r.Ns, r.RevisionID, r.Timestamp, r.Redirect, r.Text, r.ShortDescription}
+	for i, field := range fields {
+		if i > 0 {
+			s.w.WriteByte('\t')
+		}
+		s.w.WriteString(copyEscape(field))
+	}
+	if err := s.w.WriteByte('\n'); err != nil {
+		return err
+	}
+
+	s.rows++
+	if s.rows >= s.BatchSize {
+		s.endCopy()
+		s.batches++
+		if s.batches >= s.TxBatches {
+			s.commit()
+		}
+	}
+	return nil
+}
+
+// endCopy finishes the current COPY statement and moves its rows into the
+// table.
+func (s *PostgresSink) endCopy() {
+	if s.inCopy {
+		s.w.WriteString("\\.\n")
+		fmt.Fprintf(s.w, `INSERT INTO %s (%s) SELECT %s FROM wikireader_staging
+ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title, ns = EXCLUDED.ns, revision_id = EXCLUDED.revision_id,
+  "timestamp" = EXCLUDED."timestamp", redirect = EXCLUDED.redirect, text = EXCLUDED.text,
+  short_description = EXCLUDED.short_description;
+TRUNCATE wikireader_staging;
+`, s.quoted, postgresColumns, postgresColumns)
+		s.inCopy = false
+		s.rows = 0
+	}
+}
+
+// commit finishes the current transaction.
+func (s *PostgresSink) commit() {
+	if s.inTx {
+		s.w.WriteString("COMMIT;\n")
+		s.inTx = false
+		s.batches = 0
+	}
+}
+
+// Close implements Sink. It waits for psql to finish, so any error in the
+// last transaction is reported.
+func (s *PostgresSink) Close() error {
+	s.endCopy()
+	s.commit()
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.stdin.Close(); err != nil {
+		return err
+	}
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("psql: %v", err)
+	}
+	return nil
+}
+
+// copyEscape escapes a value for the COPY text format. Empty values are
+// written as NULL.
+func copyEscape(v string) string {
+	if v == "" {
+		return `\N`
+	}
+	return copyReplacer.Replace(v)
+}
+
+var copyReplacer = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
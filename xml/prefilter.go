@@ -0,0 +1,148 @@
+package xml
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Why the filters drop a page, for the skip log. The namespaces skipped by
+// Config are logged as namespace N.
+const (
+	skipTitle     = "title filter"
+	skipRedirect  = "redirect"
+	skipModel     = "not wikitext"
+	skipDuplicate = "duplicate title"
+	skipDisambig  = "disambiguation"
+	skipNearDup   = "near-duplicate"
+	skipFiltered  = "content filter"
+	skipIDRange   = "id range"
+	skipKnownBad  = "failed before"
+)
+
+// IDRange selects the pages with IDs from Min to Max, inclusive, so a run
+// can take a share of a dump by ID. Either end can be left open as 0.
+type IDRange struct {
+	Min, Max int64
+}
+
+// ParseIDRange parses a range given as min-max, where either can be left
+// out, e.g. 1000000-2000000 or 2000001-.
+func ParseIDRange(s string) (*IDRange, error) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid id range: %s (expected min-max)", s)
+	}
+	var r IDRange
+	var err error
+	if min := s[:i]; min != "" {
+		if r.Min, err = strconv.ParseInt(min, 10, 64); err != nil || r.Min < 0 {
+			return nil, fmt.Errorf("invalid id range: %s", s)
+		}
+	}
+	if max := s[i+1:]; max != "" {
+		if r.Max, err = strconv.ParseInt(max, 10, 64); err != nil || r.Max < r.Min {
+			return nil, fmt.Errorf("invalid id range: %s", s)
+		}
+	}
+	return &r, nil
+}
+
+// contains reports whether the page ID is in the range. IDs that aren't
+// numbers never are.
+func (r *IDRange) contains(id string) bool {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return false
+	}
+	return n >= r.Min && (r.Max == 0 || n <= r.Max)
+}
+
+// filtering reports whether any of the filters that can be told from the
+// raw XML are set: namespaces skipped by Config, IDRange, SkipListFile,
+// TitleFilter, SkipRedirects and ModelSkip. When they are, dumps are read
+// with the scanner so the pages they drop are never decoded.
+func (w *Worker) filtering() bool {
+	if w.IDRange != nil || w.SkipListFile != "" || w.TitleFilter != nil || w.SkipRedirects || w.ModelPolicy == ModelSkip {
+		return true
+	}
+	if w.Config != nil {
+		for _, nc := range w.Config.Namespaces {
+			if nc.Transform == TransformSkip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rawSkip applies the filters to the raw XML of a page, before it's
+// decoded, returning why the page is dropped or "" if it's kept. Only the
+// elements needed are looked at.
+func (w *Worker) rawSkip(page []byte) string {
+	// The ID is the first element to check, and the cheapest
+	id := pageID(page)
+	if w.IDRange != nil && !w.IDRange.contains(id) {
+		return skipIDRange
+	}
+	if w.skipList != nil && w.skipList.skip(id, func() string { return string(elementText(page, "sha1")) }) {
+		return skipKnownBad
+	}
+	ns := string(elementText(page, "ns"))
+	if w.Config.Transform(ns) == TransformSkip {
+		return "namespace " + ns
+	}
+	if w.ModelPolicy == ModelSkip && !isWikitextModel(string(elementText(page, "model")), ns) {
+		return skipModel
+	}
+	// The decoder unescapes the title
+	if w.TitleFilter != nil && !w.TitleFilter.MatchString(rawTitle(page)) {
+		return skipTitle
+	}
+	if w.SkipRedirects && (bytes.Contains(page, []byte("<redirect")) || hasRedirectWord(string(elementText(page, "text")))) {
+		return skipRedirect
+	}
+	return ""
+}
+
+// keepRaw reports whether the filters keep a page. See rawSkip.
+func (w *Worker) keepRaw(page []byte) bool {
+	return w.rawSkip(page) == ""
+}
+
+// decodedSkip applies the same filters as rawSkip to a decoded page, for
+// the inputs that aren't read as XML.
+func (w *Worker) decodedSkip(p *Page) string {
+	if w.IDRange != nil && !w.IDRange.contains(p.ID) {
+		return skipIDRange
+	}
+	if w.skipList != nil && w.skipList.skip(p.ID, func() string { return p.Revision.Sha1 }) {
+		return skipKnownBad
+	}
+	if w.Config.Transform(p.Ns) == TransformSkip {
+		return "namespace " + p.Ns
+	}
+	if w.ModelPolicy == ModelSkip && !IsWikitext(p) {
+		return skipModel
+	}
+	if w.TitleFilter != nil && !w.TitleFilter.MatchString(p.Title) {
+		return skipTitle
+	}
+	if w.SkipRedirects && IsRedirect(p) {
+		return skipRedirect
+	}
+	return ""
+}
+
+// keepDecoded reports whether the filters keep a decoded page. See
+// decodedSkip.
+func (w *Worker) keepDecoded(p *Page) bool {
+	return w.decodedSkip(p) == ""
+}
+
+// rawTitle returns the unescaped title of a page's raw XML.
+func rawTitle(page []byte) string {
+	return html.UnescapeString(string(elementText(page, "title")))
+}
@@ -0,0 +1,33 @@
+package xml
+
+// Processing is how a page was processed, kept with it in the outputs
+// when Worker.PageProvenance is set, so the pages that went a particular
+// way can be found without running again.
+//
+// The transforms are clean (the parse script), clean-url, clean-cache (the
+// script output was cached), categories, resolve-links and summarize. The
+// fallbacks are lint-script (it was cleaned with LintScript instead),
+// script-retry and slow-lane.
+type Processing struct {
+	Transforms []string `xml:"transform" json:"transforms,omitempty"`
+	// Millis is how long cleaning and finishing the page took. It's left
+	// out of deterministic runs.
+	Millis    int64    `xml:"millis,omitempty" json:"millis,omitempty"`
+	Fallbacks []string `xml:"fallback" json:"fallbacks,omitempty"`
+}
+
+// applied notes a transform applied to the page, if its processing is
+// kept.
+func (p *Page) applied(transform string) {
+	if p.Processing != nil {
+		p.Processing.Transforms = append(p.Processing.Transforms, transform)
+	}
+}
+
+// fellBack notes a fallback the page went through, if its processing is
+// kept.
+func (p *Page) fellBack(fallback string) {
+	if p.Processing != nil {
+		p.Processing.Fallbacks = append(p.Processing.Fallbacks, fallback)
+	}
+}
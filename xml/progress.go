@@ -0,0 +1,111 @@
+package xml
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Progress counts what has made it through each stage of a run, so it can
+// be shown as it goes. It's safe to take a Snapshot while the Worker runs.
+type Progress struct {
+	counts     [progressCounts]int64
+	inputBytes int64
+}
+
+// The counts kept by a Progress.
+const (
+	progressBytes = iota
+	progressSent
+	progressCleaned
+	progressWritten
+	progressDropped
+	progressFailed
+	progressBytesWritten
+	progressScripts
+	progressCounts
+)
+
+// ProgressSnapshot is the state of a run at one moment.
+type ProgressSnapshot struct {
+	// InputBytes is the size of the inputs, 0 if it isn't known, e.g. for
+	// remote or watched inputs. BytesRead counts the bytes read from the
+	// files, before any decompression, and BytesWritten those written to
+	// the xml outputs.
+	InputBytes   int64
+	BytesRead    int64
+	BytesWritten int64
+	// Sent counts the pages handed to the workers, after duplicates and
+	// skipped pages were left out. Each ends up Cleaned or Failed, and the
+	// cleaned ones Written or Dropped by a filter.
+	Sent    int64
+	Cleaned int64
+	Written int64
+	Dropped int64
+	Failed  int64
+	// Scripts counts the script runs, including retries
+	Scripts int64
+}
+
+// Snapshot returns the counts so far.
+func (p *Progress) Snapshot() ProgressSnapshot {
+	return ProgressSnapshot{
+		InputBytes:   atomic.LoadInt64(&p.inputBytes),
+		BytesRead:    atomic.LoadInt64(&p.counts[progressBytes]),
+		BytesWritten: atomic.LoadInt64(&p.counts[progressBytesWritten]),
+		Sent:         atomic.LoadInt64(&p.counts[progressSent]),
+		Cleaned:      atomic.LoadInt64(&p.counts[progressCleaned]),
+		Written:      atomic.LoadInt64(&p.counts[progressWritten]),
+		Dropped:      atomic.LoadInt64(&p.counts[progressDropped]),
+		Failed:       atomic.LoadInt64(&p.counts[progressFailed]),
+		Scripts:      atomic.LoadInt64(&p.counts[progressScripts]),
+	}
+}
+
+// add adds n to one of the counts of a Progress that may be nil.
+func (p *Progress) add(count int, n int64) {
+	if p != nil {
+		atomic.AddInt64(&p.counts[count], n)
+	}
+}
+
+// setInputs totals the size of the inputs. Any that isn't a local file
+// leaves the size unknown.
+func (p *Progress) setInputs(inputs []string) {
+	if p == nil {
+		return
+	}
+	var total int64
+	for _, input := range inputs {
+		fi, err := os.Stat(input)
+		if IsRemote(input) || err != nil {
+			return
+		}
+		total += fi.Size()
+	}
+	atomic.StoreInt64(&p.inputBytes, total)
+}
+
+// progressReader counts the bytes read through it.
+type progressReader struct {
+	io.Reader
+	p *Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.p.add(progressBytes, int64(n))
+	return n, err
+}
+
+// progressWriter counts the bytes written through it.
+type progressWriter struct {
+	io.Writer
+	p *Progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.p.add(progressBytesWritten, int64(n))
+	return n, err
+}
@@ -0,0 +1,215 @@
+package xml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// Project is a profile for the dumps of one of the Wikimedia projects. They
+// share the export format but not their namespaces or conventions, so each
+// keeps different namespaces and needs different markup taken out before
+// cleaning.
+type Project struct {
+	Name string
+
+	// Namespaces are the transforms of the project's namespaces. Those set
+	// in the config file take precedence.
+	Namespaces map[string]NamespaceConfig
+
+	// Section, if set, keeps only the level 2 section of each article with
+	// this heading, e.g. a language on Wiktionary. Articles without one are
+	// skipped.
+	Section string
+
+	// Templates are removed from the text, e.g. Wikisource's {{header}}.
+	// Elements are tags removed with their content, e.g. the <pages/>
+	// transclusions of Wikisource.
+	Templates []string
+	Elements  []string
+
+	// Dictionary is set for dictionaries, whose articles hold entries for
+	// DictionarySink
+	Dictionary bool
+}
+
+// projects are the profiles by name.
+var projects = map[string]Project{
+	"wikipedia": {Name: "wikipedia"},
+	"wiktionary": {
+		Name: "wiktionary",
+		Namespaces: map[string]NamespaceConfig{
+			"0":       {Transform: TransformClean},
+			"100":     {Transform: TransformClean}, // Appendix
+			"110":     {Transform: TransformClean}, // Thesaurus
+			"118":     {Transform: TransformClean}, // Reconstruction
+			"default": {Transform: TransformSkip},
+		},
+		Section:    "English",
+		Templates:  []string{"also", "wikipedia", "was wotd"},
+		Dictionary: true,
+	},
+	"wikiquote": {
+		Name: "wikiquote",
+		Namespaces: map[string]NamespaceConfig{
+			"0":       {Transform: TransformClean},
+			"default": {Transform: TransformSkip},
+		},
+		Templates: []string{"wikipedia", "commons", "sisterlinks"},
+	},
+	"wikisource": {
+		Name: "wikisource",
+		Namespaces: map[string]NamespaceConfig{
+			"0":       {Transform: TransformClean},
+			"102":     {Transform: TransformClean}, // Author
+			"104":     {Transform: TransformClean}, // Page
+			"default": {Transform: TransformSkip},
+		},
+		Templates: []string{"header", "author", "process header"},
+		Elements:  []string{"pages", "noinclude"},
+	},
+}
+
+// ProjectNames returns the names of the profiles in order.
+func ProjectNames() []string {
+	var names []string
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProjectProfile returns the profile with the given name.
+func ProjectProfile(name string) (*Project, error) {
+	p, ok := projects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown project %s, use one of: %s", name, strings.Join(ProjectNames(), ", "))
+	}
+	return &p, nil
+}
+
+// DetectProject returns the profile for the wiki an input was dumped from,
+// going by the database name in its siteinfo, e.g. enwiktionary.
+func DetectProject(input string) (*Project, error) {
+	var prov Provenance
+	prov.readSiteinfo(input)
+	if prov.Site == "" {
+		return nil, fmt.Errorf("%s: can't tell which project it's from without a siteinfo", input)
+	}
+	for _, name := range ProjectNames() {
+		if name != "wikipedia" && strings.HasSuffix(prov.Site, name) {
+			return ProjectProfile(name)
+		}
+	}
+	if strings.HasSuffix(prov.Site, "wiki") {
+		return ProjectProfile("wikipedia")
+	}
+	return nil, fmt.Errorf("%s: %s isn't a project with a profile", input, prov.Site)
+}
+
+// Config returns the config with the project's namespace settings under
+// those of c, which may be nil, and the rest of c as it is.
+func (p *Project) Config(c *Config) *Config {
+	pc := &Config{Namespaces: make(map[string]NamespaceConfig)}
+	for ns, nc := range p.Namespaces {
+		pc.Namespaces[ns] = nc
+	}
+	if c != nil {
+		for ns, nc := range c.Namespaces {
+			pc.Namespaces[ns] = nc
+		}
+		pc.Languages = c.Languages
+		pc.Redactions = c.Redactions
+		pc.ExtensionTags = c.ExtensionTags
+	}
+	return pc
+}
+
+// prepare takes the project's markup out of a page before it's cleaned. It
+// returns false if the page doesn't have the section being kept.
+func (p *Project) prepare(page *Page) bool {
+	if IsRedirect(page) {
+		return true
+	}
+	text := page.Revision.Text.Text
+
+	if p.Section != "" && page.Ns == "0" {
+		var ok bool
+		text, ok = section(text, p.Section)
+		if !ok {
+			return false
+		}
+	}
+	for _, name := range p.Elements {
+		text = elementPattern(name).ReplaceAllString(text, "")
+	}
+	if len(p.Templates) > 0 {
+		remove := make(map[string]bool)
+		for _, name := range p.Templates {
+			remove[templateTitle(name)] = true
+		}
+		text = wikitext.Replace(text, func(n *wikitext.Node) (string, bool) {
+			return "", n.Kind == wikitext.Template && remove[templateTitle(n.Name)]
+		})
+	}
+
+	page.Revision.Text.Text = text
+	return true
+}
+
+// elementPatterns are the compiled elementPattern of each name.
+var elementPatterns sync.Map
+
+// elementPattern matches an element in the escaped page text, either self
+// closing or with its content.
+func elementPattern(name string) *regexp.Regexp {
+	if re, ok := elementPatterns.Load(name); ok {
+		return re.(*regexp.Regexp)
+	}
+	quoted := regexp.QuoteMeta(name)
+	re := regexp.MustCompile(`(?is)&lt;` + quoted + `\b.*?(?:/&gt;|&gt;.*?&lt;/` + quoted + `\s*&gt;)`)
+	elementPatterns.Store(name, re)
+	return re
+}
+
+// section returns the level 2 section of text with the heading, including
+// its subsections, or false if there's none.
+func section(text, heading string) (string, bool) {
+	lines := strings.SplitAfter(text, "\n")
+	start := -1
+	for i, line := range lines {
+		level, title := headingLine(line)
+		if start < 0 {
+			if level == 2 && strings.EqualFold(title, heading) {
+				start = i
+			}
+			continue
+		}
+		if level == 1 || level == 2 {
+			return strings.Join(lines[start:i], ""), true
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.Join(lines[start:], ""), true
+}
+
+// headingLine returns the level and title of a heading line, or 0 if the
+// line isn't one.
+func headingLine(line string) (int, string) {
+	line = strings.TrimSpace(line)
+	level := 0
+	for level < len(line)/2 && level < 6 && line[level] == '=' && line[len(line)-1-level] == '=' {
+		level++
+	}
+	if level == 0 {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(line[level : len(line)-level])
+}
@@ -0,0 +1,131 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Provenance records how an output was built, so it can be traced back to
+// its dump and run. It goes in a comment at the top of the xml output and
+// in the stats report. Deterministic runs leave Processed at the zero time
+// and Args out, since the arguments name the output files.
+type Provenance struct {
+	Inputs []string `json:"inputs"`
+	// DumpDate is the date of the dump as YYYY-MM-DD, if it's known
+	DumpDate string `json:"dump_date,omitempty"`
+	// Site is the database name from the dump's siteinfo, e.g. enwiki
+	Site      string    `json:"site,omitempty"`
+	Generator string    `json:"generator,omitempty"`
+	Tool      string    `json:"tool"`
+	Args      []string  `json:"args,omitempty"`
+	Processed time.Time `json:"processed"`
+}
+
+// dumpDate matches the date in a dump's filename or siteinfo, as in
+// enwiki-20200501-pages-articles.xml.bz2
+var dumpDate = regexp.MustCompile(`(?:^|[^0-9])(20[0-9]{2})(0[1-9]|1[0-2])(0[1-9]|[12][0-9]|3[01])(?:[^0-9]|$)`)
+
+// secretFlags are the flags whose values are left out of the provenance.
+var secretFlags = map[string]bool{"contributor-key": true}
+
+// urlPassword and connPassword match the passwords in URLs and connection
+// strings.
+var (
+	urlPassword  = regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`)
+	connPassword = regexp.MustCompile(`(password=)[^\s&]+`)
+)
+
+// redactArgs returns the command line arguments without secrets.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	secret := false
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		switch {
+		case secret:
+			arg = "REDACTED"
+			secret = false
+		case strings.HasPrefix(arg, "-") && secretFlags[name]:
+			secret = true
+		case strings.HasPrefix(arg, "-") && strings.Contains(name, "=") && secretFlags[name[:strings.Index(name, "=")]]:
+			arg = arg[:strings.Index(arg, "=")+1] + "REDACTED"
+		default:
+			arg = urlPassword.ReplaceAllString(arg, "${1}REDACTED@")
+			arg = connPassword.ReplaceAllString(arg, "${1}REDACTED")
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// NewProvenance describes a run of tool over the inputs with the given
+// command line arguments, leaving out secrets like keys and passwords. The
+// dump date is taken from the first filename
+// that has one, or else from the siteinfo of the first input.
+func NewProvenance(inputs, args []string, tool string) *Provenance {
+	p := &Provenance{
+		Inputs:    inputs,
+		Tool:      tool,
+		Args:      redactArgs(args),
+		Processed: time.Now().UTC().Truncate(time.Second),
+	}
+	for _, input := range inputs {
+		if m := dumpDate.FindStringSubmatch(path.Base(input)); m != nil {
+			p.DumpDate = m[1] + "-" + m[2] + "-" + m[3]
+			break
+		}
+	}
+	if len(inputs) > 0 {
+		p.readSiteinfo(inputs[0])
+	}
+	return p
+}
+
+// readSiteinfo fills in what the input's siteinfo says about the dump. It's
+// only best effort: inputs without one, like page caches, are skipped.
+func (p *Provenance) readSiteinfo(input string) {
+	f, err := openInput(input)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if isCache(r) {
+		return
+	}
+	head := make([]byte, 64<<10)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	if end := bytes.Index(head, []byte("</siteinfo>")); end >= 0 {
+		head = head[:end]
+	} else {
+		return
+	}
+
+	p.Site = string(elementText(head, "dbname"))
+	p.Generator = string(elementText(head, "generator"))
+	if p.DumpDate == "" {
+		if m := dumpDate.FindSubmatch(head); m != nil {
+			p.DumpDate = string(m[1]) + "-" + string(m[2]) + "-" + string(m[3])
+		}
+	}
+}
+
+// comment returns the provenance as an XML comment.
+func (p *Provenance) comment() []byte {
+	b, err := json.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+	// "--" isn't allowed within a comment, and the JSON escape keeps it
+	// readable
+	b = bytes.ReplaceAll(b, []byte("--"), []byte(`-\u002d`))
+	return append([]byte(" provenance "), append(b, ' ')...)
+}
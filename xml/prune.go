@@ -0,0 +1,116 @@
+package xml
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+)
+
+// What PruneLinks does with links to pages that aren't in the output.
+const (
+	// PruneDelink keeps the displayed text of the link
+	PruneDelink = "delink"
+	// PruneRemove drops the link along with its text
+	PruneRemove = "remove"
+)
+
+// PruneStats counts what PruneLinks did.
+type PruneStats struct {
+	Pages  int
+	Links  int
+	Pruned int
+}
+
+// PruneLinks copies processed outputs into a single document at out,
+// pruning the internal links to titles that aren't in any of them, e.g.
+// because they were filtered out or summarized away. Links to other
+// namespaces and other wikis are left alone.
+func PruneLinks(inputs []string, out, mode string) (PruneStats, error) {
+	var stats PruneStats
+	if mode != PruneDelink && mode != PruneRemove {
+		return stats, fmt.Errorf("unknown prune mode: %s", mode)
+	}
+
+	// The first pass finds the titles that made it into the output
+	titles := make(map[string]bool)
+	for _, input := range inputs {
+		log.Println("collecting titles:", input)
+		err := scanPages(input, func(raw []byte) error {
+			titles[NormalizeTitle(html.UnescapeString(string(elementText(raw, "title"))))] = true
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("%s: %v", input, err)
+		}
+	}
+
+	f, err := createOutput(out)
+	if err != nil {
+		return stats, err
+	}
+	doc := newDocWriter(f, "  ")
+	if err := doc.head(); err != nil {
+		f.Close()
+		return stats, err
+	}
+
+	prune := func(link string) string {
+		target, _, ok := linkTarget(html.UnescapeString(link))
+		if !ok {
+			return "[[" + link + "]]"
+		}
+		stats.Links++
+		if titles[target] {
+			return "[[" + link + "]]"
+		}
+		stats.Pruned++
+		if mode == PruneRemove {
+			return ""
+		}
+		return linkDisplay(link)
+	}
+
+	for _, input := range inputs {
+		log.Println("pruning links:", input)
+		err := scanPages(input, func(raw []byte) error {
+			stats.Pages++
+
+			text := elementText(raw, "text")
+			if text == nil {
+				_, err := doc.rawPage(raw)
+				return err
+			}
+			// text is part of raw, so its capacity tells where it starts
+			start := cap(raw) - cap(text)
+			page := append([]byte{}, raw[:start]...)
+			page = append(page, rewriteLinks(string(text), prune)...)
+			page = append(page, raw[start+len(text):]...)
+			_, err := doc.rawPage(page)
+			return err
+		})
+		if err != nil {
+			f.Close()
+			return stats, fmt.Errorf("%s: %v", input, err)
+		}
+	}
+
+	if err := doc.end(); err != nil {
+		f.Close()
+		return stats, err
+	}
+	return stats, f.Close()
+}
+
+// linkDisplay returns the text a link shows: its label if it has one,
+// otherwise the target.
+func linkDisplay(link string) string {
+	target := link
+	if i := strings.Index(link, "|"); i >= 0 {
+		if label := link[i+1:]; label != "" {
+			return label
+		}
+		target = link[:i]
+	}
+	return strings.TrimPrefix(target, ":")
+}
@@ -0,0 +1,134 @@
+package xml
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LinkGraph is a link graph read back from a -links file. Pages only get
+// an ID from the links they have, or from AddPages. The others are link
+// targets that aren't pages, or pages without links, which are ranked but
+// left out of the scores.
+type LinkGraph struct {
+	Titles []string
+	IDs    []string
+	Out    [][]int32
+	index  map[string]int32
+}
+
+// Score is the importance of a single page.
+type Score struct {
+	ID    string
+	Title string
+	Score float64
+}
+
+// ReadLinkGraph loads a link graph TSV as written with -links.
+func ReadLinkGraph(path string) (*LinkGraph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g := &LinkGraph{index: make(map[string]int32)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		from := g.node(fields[1])
+		g.IDs[from] = fields[0]
+		to := g.node(fields[2])
+		g.Out[from] = append(g.Out[from], to)
+	}
+	return g, scanner.Err()
+}
+
+// AddPages adds every page of the offset index at path with its ID, so the
+// pages without links of their own are scored too. See Worker.IndexFile.
+func (g *LinkGraph) AddPages(index string) error {
+	return ReadIndex(index, func(e IndexEntry) error {
+		g.IDs[g.node(e.Title)] = e.ID
+		return nil
+	})
+}
+
+// node returns the index of the title, adding it if needed.
+func (g *LinkGraph) node(title string) int32 {
+	if i, ok := g.index[title]; ok {
+		return i
+	}
+	i := int32(len(g.Titles))
+	g.index[title] = i
+	g.Titles = append(g.Titles, title)
+	g.IDs = append(g.IDs, "")
+	g.Out = append(g.Out, nil)
+	return i
+}
+
+// InDegree scores each page by how many links point to it.
+func InDegree(g *LinkGraph) []Score {
+	counts := make([]float64, len(g.Titles))
+	for _, out := range g.Out {
+		for _, to := range out {
+			counts[to]++
+		}
+	}
+	return g.scores(counts)
+}
+
+// PageRank scores each page with the PageRank algorithm. Rank from pages
+// without outgoing links is spread evenly over all pages.
+func PageRank(g *LinkGraph, iterations int, damping float64) []Score {
+	n := float64(len(g.Titles))
+	rank := make([]float64, len(g.Titles))
+	next := make([]float64, len(g.Titles))
+	for i := range rank {
+		rank[i] = 1 / n
+	}
+
+	for iter := 0; iter < iterations; iter++ {
+		dangling := 0.0
+		for i := range next {
+			next[i] = 0
+		}
+		for from, out := range g.Out {
+			if len(out) == 0 {
+				dangling += rank[from]
+				continue
+			}
+			share := rank[from] / float64(len(out))
+			for _, to := range out {
+				next[to] += share
+			}
+		}
+
+		base := (1-damping)/n + damping*dangling/n
+		for i := range next {
+			next[i] = base + damping*next[i]
+		}
+		rank, next = next, rank
+	}
+	return g.scores(rank)
+}
+
+// scores pairs the values with their pages, highest first. Nodes without
+// an ID aren't pages.
+func (g *LinkGraph) scores(values []float64) []Score {
+	scores := make([]Score, 0, len(values))
+	for i, v := range values {
+		if g.IDs[i] == "" {
+			continue
+		}
+		scores = append(scores, Score{ID: g.IDs[i], Title: g.Titles[i], Score: v})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return scores
+}
@@ -0,0 +1,70 @@
+package xml
+
+import "html"
+
+// copyRaw sends the pages of a dump straight to their outputs as they were
+// read, for Raw. They go through the same filters, deduplication and
+// sharding as decoded pages, working from the few elements those need.
+func (w *Worker) copyRaw(s *PageScanner, seen map[string]int, stats *readStats, collisions *tsvFile) {
+	for !w.stopped() && s.Scan() {
+		raw := s.Bytes()
+		stats.pages++
+		if reason := w.rawSkip(raw); reason != "" {
+			stats.skipped++
+			title := ""
+			if w.skips.detailed() {
+				title = rawTitle(raw)
+			}
+			w.skips.skip(title, reason)
+			continue
+		}
+
+		p := rawFields(raw, w.DisambigPolicy != DisambigInclude || collisions != nil)
+		n := seen[p.Title]
+		seen[p.Title]++
+		if n == 0 && w.dedup != nil {
+			w.dedup.add(p.Title)
+		}
+		if !w.keepTitle(p, n, collisions) {
+			w.skips.skip(p.Title, skipDuplicate)
+			stats.duplicates++
+			continue
+		}
+		if w.DisambigPolicy == DisambigExclude && IsDisambiguation(p) {
+			w.skips.skip(p.Title, skipDisambig)
+			stats.skipped++
+			continue
+		}
+
+		out := w.output(p)
+		if out == nil {
+			continue
+		}
+		// Indented like a marshaled page. The scanner reuses its buffer.
+		w.Progress.add(progressSent, 1)
+		out <- append([]byte(w.indent()), raw...)
+		w.Progress.add(progressWritten, 1)
+	}
+	if err := s.Err(); err != nil {
+		panic(err)
+	}
+}
+
+// rawFields returns a page with just the fields needed to route the raw
+// XML of a page, and its text if withText is set.
+func rawFields(raw []byte, withText bool) *Page {
+	p := &Page{
+		Title: html.UnescapeString(string(elementText(raw, "title"))),
+		Ns:    string(elementText(raw, "ns")),
+		ID:    string(elementText(raw, "id")),
+	}
+	if rev := elementText(raw, "revision"); rev != nil {
+		p.Revision.ID = string(elementText(rev, "id"))
+		p.Revision.Timestamp = string(elementText(rev, "timestamp"))
+		if withText {
+			// Kept escaped, as the decoder keeps it
+			p.Revision.Text.Text = string(elementText(rev, "text"))
+		}
+	}
+	return p
+}
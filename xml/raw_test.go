@@ -0,0 +1,37 @@
+package xml
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestRawFieldsMatchDecoded(t *testing.T) {
+	raw := []byte(`<page>
+    <title>Fish &amp; Chips</title>
+    <ns>0</ns>
+    <id>7</id>
+    <revision>
+      <id>70</id>
+      <timestamp>2020-01-01T00:00:00Z</timestamp>
+      <text xml:space="preserve">{{disambiguation}} &lt;b&gt;Fish&lt;/b&gt; &amp; chips &quot;here&quot;</text>
+    </revision>
+  </page>`)
+
+	var want Page
+	if err := xml.Unmarshal(raw, &want); err != nil {
+		t.Fatal(err)
+	}
+	got := rawFields(raw, true)
+	if got.Title != want.Title || got.Ns != want.Ns || got.ID != want.ID {
+		t.Errorf("rawFields = %q %q %q, want %q %q %q", got.Title, got.Ns, got.ID, want.Title, want.Ns, want.ID)
+	}
+	if got.Revision.ID != want.Revision.ID || got.Revision.Timestamp != want.Revision.Timestamp {
+		t.Errorf("revision = %q %q, want %q %q", got.Revision.ID, got.Revision.Timestamp, want.Revision.ID, want.Revision.Timestamp)
+	}
+	if got.Revision.Text.Text != want.Revision.Text.Text {
+		t.Errorf("text = %q, want %q", got.Revision.Text.Text, want.Revision.Text.Text)
+	}
+	if versionOf(got) != versionOf(&want) {
+		t.Errorf("version = %+v, want %+v", versionOf(got), versionOf(&want))
+	}
+}
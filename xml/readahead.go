@@ -0,0 +1,102 @@
+package xml
+
+import (
+	"io"
+	"sync"
+)
+
+// readAheadBlock is how much is decompressed into each block ahead of the
+// reader.
+const readAheadBlock = 1 << 20
+
+// readAhead decompresses an input on its own goroutine into a ring of
+// blocks, so decompression overlaps with parsing instead of taking turns
+// with it. Once every block is full the goroutine waits for the reader.
+type readAhead struct {
+	src    io.Reader
+	closer io.Closer
+
+	full chan readAheadBlockData
+	free chan []byte
+	done chan struct{}
+	once sync.Once
+
+	block []byte
+	rest  []byte
+	err   error
+}
+
+// readAheadBlockData is a filled block and the error that ended it, if any.
+type readAheadBlockData struct {
+	b   []byte
+	err error
+}
+
+// newReadAhead reads src through blocks blocks, closing closer when it's
+// closed.
+func newReadAhead(src io.Reader, closer io.Closer, blocks int) *readAhead {
+	r := &readAhead{
+		src:    src,
+		closer: closer,
+		full:   make(chan readAheadBlockData, blocks),
+		free:   make(chan []byte, blocks),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < blocks; i++ {
+		r.free <- make([]byte, readAheadBlock)
+	}
+	go r.fill()
+	return r
+}
+
+// fill reads blocks from src until it ends or the reader is closed.
+func (r *readAhead) fill() {
+	for {
+		var b []byte
+		select {
+		case b = <-r.free:
+		case <-r.done:
+			return
+		}
+
+		n, err := io.ReadFull(r.src, b)
+		if err == io.ErrUnexpectedEOF {
+			// The last block is only partly filled
+			err = io.EOF
+		}
+		select {
+		case r.full <- readAheadBlockData{b: b[:n], err: err}:
+		case <-r.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *readAhead) Read(p []byte) (int, error) {
+	for len(r.rest) == 0 {
+		if r.block != nil {
+			// There's always room, as there are only as many blocks
+			r.free <- r.block[:cap(r.block)]
+			r.block = nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		next := <-r.full
+		r.block, r.rest, r.err = next.b, next.b, next.err
+	}
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
+
+// Close stops reading ahead and closes the input.
+func (r *readAhead) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	return r.closer.Close()
+}
@@ -0,0 +1,81 @@
+package xml
+
+import (
+	"encoding/json"
+	"html"
+)
+
+// Record is the flat form of a page used by the non-XML sinks.
+type Record struct {
+	ID               string       `json:"id"`
+	Title            string       `json:"title"`
+	Ns               string       `json:"ns"`
+	RevisionID       string       `json:"revision_id"`
+	Timestamp        string       `json:"timestamp"`
+	Redirect         string       `json:"redirect,omitempty"`
+	Text             string       `json:"text"`
+	Categories       []string     `json:"categories,omitempty"`
+	ShortDescription string       `json:"short_description,omitempty"`
+	Coordinates      *Coordinates `json:"coordinates,omitempty"`
+	Biography        *Biography   `json:"biography,omitempty"`
+	Processing       *Processing  `json:"processing,omitempty"`
+	OriginalText     string       `json:"original_text,omitempty"`
+
+	fields Fields
+}
+
+// MarshalJSON implements json.Marshaler, leaving out the fields that
+// weren't selected.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	type record Record
+	b, err := json.Marshal((*record)(r))
+	if err != nil || r.fields == nil {
+		return b, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	for key := range all {
+		if !r.fields[key] {
+			delete(all, key)
+		}
+	}
+	return json.Marshal(all)
+}
+
+// NewRecord flattens a page. The text is unescaped, since it's kept as raw
+// XML in the page.
+func NewRecord(p *Page) *Record {
+	var cats []string
+	for _, cat := range p.Categories {
+		cats = append(cats, html.UnescapeString(cat))
+	}
+
+	return &Record{
+		ID:               p.ID,
+		Title:            p.Title,
+		Ns:               p.Ns,
+		RevisionID:       p.Revision.ID,
+		Timestamp:        p.Revision.Timestamp,
+		Redirect:         RedirectTarget(p),
+		Text:             html.UnescapeString(p.Revision.Text.Text),
+		Categories:       cats,
+		ShortDescription: p.ShortDescription,
+		Coordinates:      p.Coordinates,
+		Biography:        p.Biography,
+		Processing:       p.Processing,
+		OriginalText:     originalText(p),
+		fields:           p.fields,
+	}
+}
+
+// originalText is the unescaped text the page was read with, if it was
+// kept.
+func originalText(p *Page) string {
+	if p.OriginalText == nil {
+		return ""
+	}
+	return html.UnescapeString(p.OriginalText.Text)
+}
@@ -0,0 +1,102 @@
+package xml
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// redirectWords are the localized redirect magic words used by the larger
+// wikis. Matching is case-insensitive, so only one spelling is listed.
+var redirectWords = []string{
+	"#REDIRECT",
+	"#WEITERLEITUNG",
+	"#REDIRECTION",
+	"#REDIRECCIÓN",
+	"#REDIRECIONAMENTO",
+	"#RINVIA",
+	"#DOORVERWIJZING",
+	"#PATRZ",
+	"#PRZEKIERUJ",
+	"#OMDIRIGERING",
+	"#YÖNLENDİRME",
+	"#ПЕРЕНАПРАВЛЕНИЕ",
+	"#ПЕРЕНАПР",
+	"#転送",
+	"#リダイレクト",
+	"#重定向",
+	"#넘겨주기",
+}
+
+// IsRedirect reports whether the page is a redirect. The <redirect> element
+// is authoritative when present, otherwise the text is checked for a
+// redirect magic word.
+func IsRedirect(p *Page) bool {
+	if p.Redirect.Title != "" {
+		return true
+	}
+	return hasRedirectWord(p.Revision.Text.Text)
+}
+
+// RedirectTarget returns the title a redirect page points to, or an empty
+// string if the page isn't a redirect.
+func RedirectTarget(p *Page) string {
+	if p.Redirect.Title != "" {
+		return p.Redirect.Title
+	}
+	if !hasRedirectWord(p.Revision.Text.Text) {
+		return ""
+	}
+
+	for _, n := range wikitext.Parse(p.Revision.Text.Text) {
+		if n.Kind != wikitext.Link {
+			continue
+		}
+		target := n.Target
+		// Drop any section anchor
+		if i := strings.Index(target, "#"); i >= 0 {
+			target = target[:i]
+		}
+		return strings.TrimSpace(target)
+	}
+	return ""
+}
+
+// hasRedirectWord checks for a redirect magic word at the start of the text,
+// ignoring case and leading whitespace.
+func hasRedirectWord(text string) bool {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "#") {
+		return false
+	}
+
+	for _, word := range redirectWords {
+		if hasFoldedPrefix(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFoldedPrefix reports whether text starts with prefix, ignoring case.
+// It goes rune by rune, since a letter and its other case can take a
+// different number of bytes, like the Turkish İ and i.
+func hasFoldedPrefix(text, prefix string) bool {
+	for _, want := range prefix {
+		r, size := utf8.DecodeRuneInString(text)
+		if size == 0 || !equalFoldRune(r, want) {
+			return false
+		}
+		text = text[size:]
+	}
+	return true
+}
+
+// equalFoldRune reports whether two runes are the same letter in either
+// case.
+func equalFoldRune(a, b rune) bool {
+	return a == b || unicode.ToLower(a) == unicode.ToLower(b) || unicode.ToUpper(a) == unicode.ToUpper(b) ||
+		strings.EqualFold(string(a), string(b))
+}
@@ -0,0 +1,29 @@
+package xml
+
+import "testing"
+
+func TestHasRedirectWord(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want bool
+	}{
+		{"#REDIRECT [[Target]]", true},
+		{"  #redirect [[Target]]", true},
+		{"#Weiterleitung [[Ziel]]", true},
+		{"#redirección [[Destino]]", true},
+		{"#YÖNLENDİRME [[Hedef]]", true},
+		{"#yönlendirme [[Hedef]]", true},
+		{"#Yönlendİrme [[Hedef]]", true},
+		{"#перенаправление [[Цель]]", true},
+		{"#転送 [[先]]", true},
+		{"#REDIREC", false},
+		{"#Ré", false},
+		{"#yönlendİ", false},
+		{"REDIRECT [[Target]]", false},
+		{"", false},
+	} {
+		if got := hasRedirectWord(tt.text); got != tt.want {
+			t.Errorf("hasRedirectWord(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package xml
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Remote paths are streamed through the cloud CLIs, which already handle
+// credentials, retries and multipart uploads.
+const (
+	s3Prefix  = "s3://"
+	gcsPrefix = "gs://"
+)
+
+// IsRemote reports whether the path is an S3 or GCS URL.
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, s3Prefix) || strings.HasPrefix(path, gcsPrefix)
+}
+
+// remoteCommand returns the CLI command copying between src and dst, where
+// "-" is stdin or stdout.
+func remoteCommand(src, dst string) *exec.Cmd {
+	if strings.HasPrefix(src, gcsPrefix) || strings.HasPrefix(dst, gcsPrefix) {
+		return exec.Command("gsutil", "-q", "cp", src, dst)
+	}
+	return exec.Command("aws", "s3", "cp", "--only-show-errors", src, dst)
+}
+
+// openInput opens a local file or remote object for reading, decompressing
+// .bz2 and .gz inputs on the fly.
+func openInput(path string) (io.ReadCloser, error) {
+	return openCounted(path, nil, 0)
+}
+
+// openCounted is openInput, also counting the bytes read from the file or
+// object in p if it's set. Compressed inputs are decompressed readAhead
+// blocks ahead of the reader, if it's set. See readAhead.
+func openCounted(path string, p *Progress, readAhead int) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if IsRemote(path) {
+		r, err := openRemote(path)
+		if err != nil {
+			return nil, err
+		}
+		rc = r
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+	}
+	if p != nil {
+		rc = &readCloser{Reader: &progressReader{Reader: rc, p: p}, closer: rc}
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".bz2"):
+		return decompressed(bzip2.NewReader(rc), rc, readAhead), nil
+	case strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return decompressed(gz, rc, readAhead), nil
+	}
+	return rc, nil
+}
+
+// decompressed reads from the decompressor r of the input closer, reading
+// ahead if readAhead is set.
+func decompressed(r io.Reader, closer io.Closer, readAhead int) io.ReadCloser {
+	if readAhead > 0 {
+		return newReadAhead(r, closer, readAhead)
+	}
+	return &readCloser{Reader: r, closer: closer}
+}
+
+// createOutput creates a local file or remote object for writing. Remote
+// objects are uploaded as they're written and complete on Close.
+func createOutput(path string) (io.WriteCloser, error) {
+	if IsRemote(path) {
+		return createRemote(outputPath(path))
+	}
+	return os.Create(path)
+}
+
+// outputPath returns the object an output is written to: a remote prefix,
+// ending in a slash, gets a default object name.
+func outputPath(path string) string {
+	if IsRemote(path) && strings.HasSuffix(path, "/") {
+		return path + "pages.xml"
+	}
+	return path
+}
+
+// readCloser closes the underlying reader of a decompressor.
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *readCloser) Close() error {
+	return r.closer.Close()
+}
+
+// remoteReader streams an object from the CLI's stdout. A CLI that fails
+// fails the read at the end of its output, so a download that was cut off
+// isn't taken for a short object.
+type remoteReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+	url string
+	// done is set once the output has been read to the end and the CLI has
+	// exited, with err if it failed
+	done bool
+	err  error
+}
+
+func openRemote(url string) (*remoteReader, error) {
+	cmd := remoteCommand(url, "-")
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", url, err)
+	}
+	return &remoteReader{ReadCloser: stdout, cmd: cmd, url: url}, nil
+}
+
+func (r *remoteReader) Read(p []byte) (int, error) {
+	if r.done {
+		if r.err != nil {
+			return 0, r.err
+		}
+		return 0, io.EOF
+	}
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.done = true
+		if werr := r.cmd.Wait(); werr != nil {
+			r.err = &remoteReadError{url: r.url, err: werr}
+			return n, r.err
+		}
+	}
+	return n, err
+}
+
+// remoteReadError is a CLI that failed while an object was being read, so
+// what was read of it may be cut short anywhere.
+type remoteReadError struct {
+	url string
+	err error
+}
+
+func (e *remoteReadError) Error() string {
+	return fmt.Sprintf("reading %s: %v", e.url, e.err)
+}
+
+func (e *remoteReadError) Unwrap() error { return e.err }
+
+// Close returns the CLI's error if the object was read to the end. If we
+// stopped reading early the CLI gets a broken pipe, which isn't an error.
+func (r *remoteReader) Close() error {
+	if r.done {
+		return r.err
+	}
+	r.ReadCloser.Close()
+	r.cmd.Wait()
+	return nil
+}
+
+// remoteWriter streams an object to the CLI's stdin.
+type remoteWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+	url string
+}
+
+func createRemote(url string) (*remoteWriter, error) {
+	cmd := remoteCommand("-", url)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("writing %s: %v", url, err)
+	}
+	return &remoteWriter{WriteCloser: stdin, cmd: cmd, url: url}, nil
+}
+
+// Close finishes the upload and reports whether it succeeded.
+func (w *remoteWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("uploading %s: %v", w.url, err)
+	}
+	return nil
+}
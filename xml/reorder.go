@@ -0,0 +1,225 @@
+package xml
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultReorderMemory is the memory of the reorder buffer if none is
+// given.
+const DefaultReorderMemory = 256 << 20
+
+// reorderPageOverhead is roughly what a buffered page costs besides its
+// title and text.
+const reorderPageOverhead = 512
+
+// reorderBuffer holds the pages decoded ahead of the one decodeParallel is
+// waiting for. One slow page lets the other decoders run on, so past its
+// memory it spills what it holds to a run in the spill directory, sorted
+// and compressed, and reads the runs back as their turn comes.
+type reorderBuffer struct {
+	limit int64
+	dir   string
+
+	mem  map[int]*rawPage
+	size int64
+
+	// temp holds the runs, once there are any
+	temp string
+	runs []*reorderRun
+}
+
+// spilledPage is a rawPage as it's written to a run. Pages that failed to
+// decode aren't spilled, their errors stay in memory.
+type spilledPage struct {
+	Seq     int
+	Offset  int64
+	Skipped string
+	Title   string
+	Page    *Page
+	// Decoded is when the page's decode started and ended, if it's traced
+	Decoded [2]time.Time
+}
+
+// reorderRun is a spilled run being read back, with its next page.
+type reorderRun struct {
+	path string
+	f    *os.File
+	z    io.ReadCloser
+	dec  *gob.Decoder
+	head *spilledPage
+}
+
+func newReorderBuffer(limit int64, dir string) *reorderBuffer {
+	if limit <= 0 {
+		limit = DefaultReorderMemory
+	}
+	return &reorderBuffer{limit: limit, dir: dir, mem: make(map[int]*rawPage)}
+}
+
+// pageSize is about how much memory a buffered page takes.
+func pageSize(r *rawPage) int64 {
+	size := int64(reorderPageOverhead + len(r.title))
+	if r.p != nil {
+		size += int64(len(r.p.Title) + len(r.p.Revision.Text.Text))
+	}
+	return size
+}
+
+// add buffers a page, spilling the buffer if it's full.
+func (b *reorderBuffer) add(r *rawPage) error {
+	b.mem[r.seq] = r
+	b.size += pageSize(r)
+	if b.size < b.limit {
+		return nil
+	}
+	return b.spill()
+}
+
+// take returns the page numbered seq and forgets it, or nil if it hasn't
+// been decoded yet.
+func (b *reorderBuffer) take(seq int) (*rawPage, error) {
+	if r, ok := b.mem[seq]; ok {
+		delete(b.mem, seq)
+		b.size -= pageSize(r)
+		return r, nil
+	}
+	// Every page in a run came after the one being waited for when it was
+	// spilled, so the page is at the head of its run if it's in one
+	for i, run := range b.runs {
+		if run.head == nil || run.head.Seq != seq {
+			continue
+		}
+		r := run.head.rawPage()
+		if err := run.next(); err != nil {
+			return nil, err
+		}
+		if run.head == nil {
+			run.close()
+			b.runs = append(b.runs[:i], b.runs[i+1:]...)
+		}
+		return r, nil
+	}
+	return nil, nil
+}
+
+// spill writes the pages in memory to a new run.
+func (b *reorderBuffer) spill() error {
+	if b.temp == "" {
+		temp, err := ioutil.TempDir(b.dir, "wikireader-reorder")
+		if err != nil {
+			return err
+		}
+		b.temp = temp
+	}
+
+	var seqs []int
+	for seq, r := range b.mem {
+		if r.err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	if len(seqs) == 0 {
+		return nil
+	}
+	sort.Ints(seqs)
+
+	path := filepath.Join(b.temp, "run"+strconv.Itoa(len(b.runs))+"-"+strconv.Itoa(seqs[0]))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	z, _ := flate.NewWriter(w, flate.BestSpeed)
+	enc := gob.NewEncoder(z)
+	for _, seq := range seqs {
+		if err := enc.Encode(spilledOf(b.mem[seq])); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := z.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	run := &reorderRun{path: path, f: f, z: flate.NewReader(bufio.NewReader(f))}
+	run.dec = gob.NewDecoder(run.z)
+	if err := run.next(); err != nil {
+		run.close()
+		return err
+	}
+	b.runs = append(b.runs, run)
+
+	for _, seq := range seqs {
+		b.size -= pageSize(b.mem[seq])
+		delete(b.mem, seq)
+	}
+	return nil
+}
+
+// close removes the runs.
+func (b *reorderBuffer) close() {
+	for _, run := range b.runs {
+		run.close()
+	}
+	b.runs = nil
+	if b.temp != "" {
+		os.RemoveAll(b.temp)
+	}
+}
+
+// spilledOf returns the page as it's written to a run.
+func spilledOf(r *rawPage) *spilledPage {
+	s := &spilledPage{Seq: r.seq, Offset: r.offset, Skipped: r.skipped, Title: r.title, Page: r.p}
+	if r.p != nil && r.p.trace != nil {
+		s.Decoded = [2]time.Time{r.p.trace.start, r.p.trace.spans[0].end}
+	}
+	return s
+}
+
+// rawPage returns the page as it was buffered.
+func (s *spilledPage) rawPage() *rawPage {
+	r := &rawPage{seq: s.Seq, offset: s.Offset, skipped: s.Skipped, title: s.Title, p: s.Page}
+	if s.Page != nil && !s.Decoded[0].IsZero() {
+		start, end := s.Decoded[0], s.Decoded[1]
+		s.Page.trace = &pageTrace{start: start, spans: []traceSpan{{name: SpanDecode, start: start, end: end}}}
+	}
+	return r
+}
+
+// next reads the run's next page into head, which is nil at its end.
+func (r *reorderRun) next() error {
+	var s spilledPage
+	if err := r.dec.Decode(&s); err == io.EOF {
+		r.head = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.head = &s
+	return nil
+}
+
+// close closes and removes the run.
+func (r *reorderRun) close() {
+	r.z.Close()
+	r.f.Close()
+	os.Remove(r.path)
+}
@@ -0,0 +1,94 @@
+package xml
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestReorderBufferSpills(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Room for about two pages, so most of them are spilled
+	b := newReorderBuffer(2*reorderPageOverhead, dir)
+	page := func(seq int) *rawPage {
+		r := &rawPage{seq: seq, offset: int64(seq) * 10}
+		switch {
+		case seq%7 == 3:
+			r.err = errors.New("bad page " + strconv.Itoa(seq))
+		case seq%5 == 4:
+			r.skipped, r.title = skipRedirect, "Skipped "+strconv.Itoa(seq)
+		default:
+			r.p = &Page{Title: "Page " + strconv.Itoa(seq), ID: strconv.Itoa(seq)}
+			r.p.Revision.Text.Text = "text of " + strconv.Itoa(seq)
+		}
+		return r
+	}
+
+	// Page 0 is slow, the rest arrive in a muddle
+	const n = 60
+	next := 0
+	var got []int
+	for _, seq := range append([]int{5, 2, 9, 1, 12, 3, 4, 8, 7, 6, 11, 10}, seqRange(13, n)...) {
+		if err := b.add(page(seq)); err != nil {
+			t.Fatal(err)
+		}
+		if seq == 12 {
+			if len(b.runs) == 0 {
+				t.Fatal("nothing was spilled")
+			}
+			if err := b.add(page(0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for {
+			r, err := b.take(next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r == nil {
+				break
+			}
+			want := page(next)
+			switch {
+			case r.seq != next || r.offset != want.offset:
+				t.Errorf("took page %d at %d, want %d at %d", r.seq, r.offset, next, want.offset)
+			case want.err != nil && (r.err == nil || r.err.Error() != want.err.Error()):
+				t.Errorf("page %d: error %v, want %v", next, r.err, want.err)
+			case want.skipped != "" && (r.skipped != want.skipped || r.title != want.title):
+				t.Errorf("page %d: skipped %q %q, want %q %q", next, r.skipped, r.title, want.skipped, want.title)
+			case want.p != nil && (r.p == nil || r.p.Title != want.p.Title || r.p.Revision.Text.Text != want.p.Revision.Text.Text):
+				t.Errorf("page %d: got %+v, want %+v", next, r.p, want.p)
+			}
+			got = append(got, r.seq)
+			next++
+		}
+	}
+	if len(got) != n {
+		t.Errorf("took %d pages, want %d", len(got), n)
+	}
+
+	b.close()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("%d files left in the spill directory", len(files))
+	}
+}
+
+// seqRange returns the numbers from start up to end.
+func seqRange(start, end int) []int {
+	var seqs []int
+	for i := start; i < end; i++ {
+		seqs = append(seqs, i)
+	}
+	return seqs
+}
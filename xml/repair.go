@@ -0,0 +1,265 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// How the text of a page in an output can have been damaged by earlier
+// versions of the tool.
+const (
+	// DamageDoubleEscaped text was escaped again after it was written, so
+	// it shows entities like &lt;ref&gt; instead of the markup
+	DamageDoubleEscaped = "double-escaped"
+	// DamageTruncated text was cut off, leaving a link or template open
+	// or stopping at a buffer size
+	DamageTruncated = "truncated"
+)
+
+// What RepairOutput did about a damaged page.
+const (
+	// RepairPatched pages were cleaned again from the dump
+	RepairPatched = "patched"
+	// RepairUnconfirmed pages look the same way in the dump, so they're
+	// kept
+	RepairUnconfirmed = "unconfirmed"
+	// RepairNotFound pages aren't in the dump index, so they're kept
+	RepairNotFound = "not in dump"
+	// RepairFailed pages couldn't be cleaned again, so they're kept
+	RepairFailed = "clean failed"
+)
+
+// doubleEscaped matches an entity escaped twice in the raw XML.
+var doubleEscaped = regexp.MustCompile(`&amp;(?:amp|lt|gt|quot|apos|#[0-9]+|#x[0-9a-fA-F]+);`)
+
+// textDamage returns how the raw text of a page looks damaged, or "" if
+// it doesn't.
+func textDamage(text []byte) string {
+	if doubleEscaped.Match(text) {
+		return DamageDoubleEscaped
+	}
+	if truncatedText(text) {
+		return DamageTruncated
+	}
+	return ""
+}
+
+// truncatedText reports whether text ends with a link or template left
+// open, or is exactly a power of two long.
+func truncatedText(text []byte) bool {
+	if n := len(text); n >= 4096 && n&(n-1) == 0 {
+		return true
+	}
+	for _, pair := range [][2]string{{"[[", "]]"}, {"{{", "}}"}} {
+		if bytes.LastIndex(text, []byte(pair[0])) > bytes.LastIndex(text, []byte(pair[1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmDamage reports whether the raw text of the page in the dump bears
+// out the damage, as pages can legitimately show entities or end oddly.
+func confirmDamage(damage string, text, original []byte) bool {
+	switch damage {
+	case DamageDoubleEscaped:
+		return len(doubleEscaped.FindAll(text, -1)) > len(doubleEscaped.FindAll(original, -1))
+	case DamageTruncated:
+		return !truncatedText(original) && len(original) > len(text)
+	}
+	return false
+}
+
+// RepairOptions says where RepairOutput finds the original pages and how
+// it cleans them.
+type RepairOptions struct {
+	// Dump is the local, uncompressed dump the output was made from, and
+	// DumpIndex its offset index. See IndexDump.
+	Dump      string
+	DumpIndex string
+	// Clean cleans the text of a page from the dump. Without it the text
+	// is kept as it was, as for extracted outputs. Redirects and text that
+	// isn't wikitext are never cleaned.
+	Clean func(p *Page) (string, error)
+}
+
+// Repair is a damaged page found by RepairOutput, and what was done about
+// it.
+type Repair struct {
+	ID     string
+	Title  string
+	Damage string
+	Action string
+}
+
+// RepairOutput finds the pages of a processed output damaged by earlier
+// versions of the tool and, if they're confirmed by the dump, writes the
+// output to out with their text taken from the dump again. fn is called
+// for each page that looks damaged. Without out the pages are only found.
+func RepairOutput(in, out string, opts RepairOptions, fn func(r Repair) error) error {
+	if IsRemote(opts.Dump) || strings.HasSuffix(opts.Dump, ".gz") || strings.HasSuffix(opts.Dump, ".bz2") {
+		return fmt.Errorf("%s: pages can only be read again from an uncompressed local dump", opts.Dump)
+	}
+
+	// Find the damaged pages, then read them from the dump
+	var found []*Repair
+	damaged := make(map[string]*Repair)
+	texts := make(map[string][]byte)
+	err := scanPages(in, func(raw []byte) error {
+		text := elementText(raw, "text")
+		if damage := textDamage(text); damage != "" {
+			id := pageID(raw)
+			r := &Repair{ID: id, Title: html.UnescapeString(string(elementText(raw, "title"))), Damage: damage, Action: RepairNotFound}
+			found = append(found, r)
+			damaged[id] = r
+			texts[id] = append([]byte(nil), text...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	originals, err := readOriginals(opts.Dump, opts.DumpIndex, damaged)
+	if err != nil {
+		return err
+	}
+
+	repaired := make(map[string]string)
+	for id, r := range damaged {
+		raw, ok := originals[id]
+		if !ok {
+			continue
+		}
+		if !confirmDamage(r.Damage, texts[id], elementText(raw, "text")) {
+			r.Action = RepairUnconfirmed
+			continue
+		}
+		var p Page
+		if err := xml.Unmarshal(raw, &p); err != nil {
+			return fmt.Errorf("page %s in %s: %v", id, opts.Dump, err)
+		}
+		text := p.Revision.Text.Text
+		if opts.Clean != nil && IsWikitext(&p) && !IsRedirect(&p) {
+			text, err = opts.Clean(&p)
+			if err != nil {
+				r.Action = RepairFailed
+				continue
+			}
+		}
+		repaired[id] = text
+		r.Action = RepairPatched
+	}
+	for _, r := range found {
+		if err := fn(*r); err != nil {
+			return err
+		}
+	}
+	if out == "" {
+		return nil
+	}
+	return patchOutput(in, out, repaired)
+}
+
+// readOriginals reads the raw XML of the damaged pages from the dump.
+func readOriginals(dump, index string, damaged map[string]*Repair) (map[string][]byte, error) {
+	var found []IndexEntry
+	err := ReadIndex(index, func(e IndexEntry) error {
+		if damaged[e.ID] != nil {
+			found = append(found, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(dump)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	originals := make(map[string][]byte)
+	for _, e := range found {
+		page := make([]byte, e.Length)
+		if _, err := f.ReadAt(page, e.Offset); err != nil {
+			return nil, fmt.Errorf("page %s at %d: %v", e.ID, e.Offset, err)
+		}
+		if !bytes.HasPrefix(page, pageStart) || !bytes.HasSuffix(page, pageEnd) {
+			return nil, fmt.Errorf("page %s at %d: the index doesn't match %s", e.ID, e.Offset, dump)
+		}
+		originals[e.ID] = page
+	}
+	return originals, nil
+}
+
+// patchOutput copies the output in to out, replacing the text of the
+// repaired pages.
+func patchOutput(in, out string, repaired map[string]string) error {
+	f, err := createOutput(out)
+	if err != nil {
+		return err
+	}
+	doc := newDocWriter(f, "  ")
+	err = doc.head()
+	if err == nil {
+		err = scanPages(in, func(raw []byte) error {
+			text, ok := repaired[pageID(raw)]
+			if !ok {
+				_, err := doc.rawPage(raw)
+				return err
+			}
+			var p Page
+			if err := xml.Unmarshal(raw, &p); err != nil {
+				return err
+			}
+			p.Revision.Text.Text = text
+			b, err := xml.MarshalIndent(&p, doc.indent, doc.indent)
+			if err != nil {
+				return err
+			}
+			_, err = doc.page(b)
+			return err
+		})
+	}
+	if err == nil {
+		err = doc.end()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// IndexDump writes an offset index of a local, uncompressed dump, for
+// reading its pages again with RepairOutput.
+func IndexDump(dump, index string) error {
+	f, err := os.Open(dump)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	t, err := createTSV(index)
+	if err != nil {
+		return err
+	}
+
+	s := NewPageScanner(f)
+	for s.Scan() {
+		if err := writeIndexEntry(t, s.Bytes(), s.Offset()); err != nil {
+			t.Close()
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Close()
+		return err
+	}
+	return t.Close()
+}
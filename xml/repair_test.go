@@ -0,0 +1,125 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+// roundTripTexts are page texts as they're escaped in a dump, heavy on the
+// entities and sections an earlier version of the tool mangled.
+var roundTripTexts = []string{
+	`Fish &amp; chips &lt;ref name=&quot;a&quot;&gt;cite&lt;/ref&gt;`,
+	`Literal &amp;amp; and &amp;lt;b&amp;gt; in a guide to HTML`,
+	`Dashes &#8212; &#x2014; and quotes &apos;single&apos; &quot;double&quot;`,
+	`Before <![CDATA[<b>raw</b> & unescaped ]] text]]> after`,
+	`<![CDATA[]]>&lt;math&gt;a &lt; b &amp;&amp; b &gt; c&lt;/math&gt;`,
+	"Lines\n  indented\n\ttabbed\n",
+}
+
+// decodedText is the text of a page as an XML reader would see it.
+func decodedText(t *testing.T, raw []byte) string {
+	var p struct {
+		Text string `xml:"revision>text"`
+	}
+	if err := xml.Unmarshal(raw, &p); err != nil {
+		t.Fatalf("decoding %s: %v", raw, err)
+	}
+	return p.Text
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	for _, text := range roundTripTexts {
+		raw := []byte("<page><title>T</title><ns>0</ns><id>1</id><revision><id>2</id><text xml:space=\"preserve\">" + text + "</text></revision></page>")
+		want := decodedText(t, raw)
+
+		var p Page
+		if err := xml.Unmarshal(raw, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Revision.Text.Text != text {
+			t.Errorf("unmarshal changed the text:\n got %q\nwant %q", p.Revision.Text.Text, text)
+		}
+
+		// Through the writer and back
+		b, err := xml.MarshalIndent(&p, "  ", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		doc := newDocWriter(&out, "  ")
+		if err := doc.head(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := doc.page(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := doc.end(); err != nil {
+			t.Fatal(err)
+		}
+		s := NewPageScanner(&out)
+		if !s.Scan() {
+			t.Fatalf("no page in %s: %v", out.Bytes(), s.Err())
+		}
+		if got := string(elementText(s.Bytes(), "text")); got != text {
+			t.Errorf("written text changed:\n got %q\nwant %q", got, text)
+		}
+		if got := decodedText(t, s.Bytes()); got != want {
+			t.Errorf("decoded text changed:\n got %q\nwant %q", got, want)
+		}
+	}
+}
+
+func TestEscapeTextRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		`a < b && c > d`,
+		`"quoted" 'single' &amp; already escaped`,
+		`]]> ends a CDATA section`,
+		"tab\tand newline\n",
+		`non-ASCII — ü 漢字`,
+	} {
+		raw := []byte("<page><revision><text>" + escapeText(s) + "</text></revision></page>")
+		if got := decodedText(t, raw); got != s {
+			t.Errorf("escapeText(%q) decodes as %q", s, got)
+		}
+	}
+}
+
+func TestTextDamage(t *testing.T) {
+	long := bytes.Repeat([]byte("a"), 4096)
+	for _, tt := range []struct {
+		name, text, want string
+	}{
+		{"clean", `Plain &lt;ref&gt;text&lt;/ref&gt; [[link]] {{tpl}}`, ""},
+		{"double escaped", `Text &amp;lt;ref&amp;gt;`, DamageDoubleEscaped},
+		{"double escaped number", `Dash &amp;#8212;`, DamageDoubleEscaped},
+		{"open link", `Ends in [[Link`, DamageTruncated},
+		{"open template", `Ends in {{Infobox`, DamageTruncated},
+		{"closed after open", `[[a]] {{b}} [[c]]`, ""},
+		{"power of two", string(long), DamageTruncated},
+		{"short power of two", "abcd", ""},
+	} {
+		if got := textDamage([]byte(tt.text)); got != tt.want {
+			t.Errorf("%s: textDamage = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmDamage(t *testing.T) {
+	for _, tt := range []struct {
+		name, damage, text, original string
+		want                         bool
+	}{
+		{"escaped again", DamageDoubleEscaped, `a &amp;lt;b&amp;gt;`, `a &lt;b&gt;`, true},
+		{"escaped in the dump too", DamageDoubleEscaped, `&amp;amp; is written so`, `&amp;amp; is written so`, false},
+		{"more than the dump", DamageDoubleEscaped, `&amp;amp; and &amp;lt;`, `&amp;amp; and &lt;`, true},
+		{"cut off", DamageTruncated, `Text [[Li`, `Text [[Link]] and more`, true},
+		{"open in the dump too", DamageTruncated, `Text [[Li`, `Text [[Li`, false},
+		{"dump is shorter", DamageTruncated, `Text {{a`, `Text`, false},
+		{"unknown damage", "other", `a`, `b`, false},
+	} {
+		if got := confirmDamage(tt.damage, []byte(tt.text), []byte(tt.original)); got != tt.want {
+			t.Errorf("%s: confirmDamage = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
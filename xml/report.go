@@ -0,0 +1,80 @@
+package xml
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"time"
+)
+
+// RunReport is what a run used, for planning the machines bigger dumps
+// need. The CPU time and memory are the whole process's, so with several
+// Workers running at once they're shared.
+type RunReport struct {
+	Elapsed float64 `json:"elapsed_seconds"`
+	// CPU is the user and system time of the process, ScriptCPU of the
+	// scripts it ran
+	CPU       float64 `json:"cpu_seconds"`
+	ScriptCPU float64 `json:"script_cpu_seconds"`
+	// PeakRSS is the largest the process got, ScriptPeakRSS the largest
+	// any script got, in bytes. They're 0 where that isn't known.
+	PeakRSS       int64 `json:"peak_rss_bytes"`
+	ScriptPeakRSS int64 `json:"script_peak_rss_bytes"`
+	// BytesRead counts the bytes read from the inputs, before
+	// decompression, and BytesWritten those written to the xml outputs
+	BytesRead    int64 `json:"bytes_read"`
+	BytesWritten int64 `json:"bytes_written"`
+	// Scripts counts the script runs, one per page cleaned by a script
+	// and one per retry
+	Scripts int64    `json:"scripts"`
+	GC      gcReport `json:"gc"`
+}
+
+// gcReport is what the garbage collector did during the run.
+type gcReport struct {
+	Cycles     uint32  `json:"cycles"`
+	Pause      float64 `json:"pause_seconds"`
+	TotalAlloc uint64  `json:"total_alloc_bytes"`
+	HeapSys    uint64  `json:"heap_sys_bytes"`
+}
+
+// report logs what the run that started at start, with the memory stats
+// at the time, used and writes it to ReportFile if it's set.
+func (w *Worker) report(start time.Time, startMem *runtime.MemStats) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	progress := w.Progress.Snapshot()
+	r := RunReport{
+		Elapsed:      time.Since(start).Seconds(),
+		BytesRead:    progress.BytesRead,
+		BytesWritten: progress.BytesWritten,
+		Scripts:      progress.Scripts,
+		GC: gcReport{
+			Cycles:     mem.NumGC - startMem.NumGC,
+			Pause:      time.Duration(mem.PauseTotalNs - startMem.PauseTotalNs).Seconds(),
+			TotalAlloc: mem.TotalAlloc - startMem.TotalAlloc,
+			HeapSys:    mem.HeapSys,
+		},
+	}
+	if u, ok := resourceUsage(); ok {
+		r.CPU = u.cpu.Seconds()
+		r.ScriptCPU = u.childCPU.Seconds()
+		r.PeakRSS = u.maxRSS
+		r.ScriptPeakRSS = u.childMaxRSS
+	}
+
+	log.Printf("used %.1fs of CPU (%.1fs in %d scripts) in %.1fs, peak RSS %.1f MiB, read %.1f MiB, wrote %.1f MiB, %d GCs pausing %.3fs",
+		r.CPU, r.ScriptCPU, r.Scripts, r.Elapsed, float64(r.PeakRSS)/(1<<20),
+		float64(r.BytesRead)/(1<<20), float64(r.BytesWritten)/(1<<20), r.GC.Cycles, r.GC.Pause)
+	if w.ReportFile == "" {
+		return
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(w.ReportFile, append(b, '\n'), 0644); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,111 @@
+package xml
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultHTMLAllowlist is the tags an HTMLSanitizer keeps when it isn't
+// told otherwise: the inline formatting that means something in plain text.
+var DefaultHTMLAllowlist = []string{"b", "i", "sub", "sup"}
+
+// htmlDropContent are the elements whose content goes with their tags,
+// since it's only of use to a browser or the wiki's extensions.
+var htmlDropContent = []string{"style", "script", "gallery", "timeline", "imagemap", "templatestyles"}
+
+// htmlElementNames are the HTML elements and wiki extension tags that are
+// taken for tags. Anything else after a < is text, like the comparisons in
+// a formula.
+var htmlElementNames = []string{
+	"a", "abbr", "b", "bdi", "bdo", "big", "blockquote", "br", "caption", "center", "cite", "code",
+	"data", "dd", "del", "dfn", "div", "dl", "dt", "em", "font", "h1", "h2", "h3", "h4", "h5", "h6",
+	"hr", "i", "ins", "kbd", "li", "mark", "ol", "p", "pre", "q", "rb", "rp", "rt", "rtc", "ruby",
+	"s", "samp", "small", "span", "strike", "strong", "sub", "sup", "table", "td", "th", "time",
+	"tr", "tt", "u", "ul", "var", "wbr",
+	"categorytree", "ce", "charinsert", "chem", "gallery", "graph", "hiero", "imagemap",
+	"includeonly", "indicator", "inputbox", "mapframe", "maplink", "math", "noinclude", "nowiki",
+	"onlyinclude", "poem", "ref", "references", "score", "script", "section", "source", "style",
+	"syntaxhighlight", "templatestyles", "timeline",
+}
+
+// htmlBareAttrs are the attributes the wiki's tags take without a value.
+// Any other attribute needs one, so a comparison like a<b and c>d isn't
+// taken for a <b> tag with the attributes "and" and "c".
+var htmlBareAttrs = []string{"compact", "hidden", "inline", "line", "responsive"}
+
+// htmlAttrValue is an attribute value as it's escaped in the text: quoted,
+// where it can hold entities but never another < or >, or a single word.
+const htmlAttrValue = `(?:&quot;(?:[^&\n]|&(?:amp|apos|#[0-9]+|#x[0-9a-fA-F]+);)*?&quot;` +
+	`|(?:'|&apos;|&#39;)(?:[^&'\n]|&(?:quot|amp|#[0-9]+|#x[0-9a-fA-F]+);)*?(?:'|&apos;|&#39;)` +
+	`|(?:[^\s&'=]|&amp;)+)`
+
+// htmlAttrs is the attributes of an escaped tag after its name, on the
+// same line: each after a space, as name=value or one of htmlBareAttrs.
+var htmlAttrs = `(?:[ \t]+(?:[a-zA-Z_:][-a-zA-Z0-9_:.]*[ \t]*=[ \t]*` + htmlAttrValue +
+	`|(?:` + strings.Join(htmlBareAttrs, "|") + `)\b))*[ \t]*`
+
+// htmlTag matches an opening, closing or self-closing tag as it's escaped
+// in the text.
+var htmlTag = regexp.MustCompile(`(?i)&lt;(/?)(` + strings.Join(htmlElementNames, "|") + `)` + htmlAttrs + `/?&gt;`)
+
+// htmlTagName is what a tag in an allowlist looks like.
+var htmlTagName = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// htmlElements match each element of htmlDropContent with its content, or
+// on its own if it closes itself.
+var htmlElements []*regexp.Regexp
+
+func init() {
+	for _, name := range htmlDropContent {
+		htmlElements = append(htmlElements, regexp.MustCompile(`(?is)&lt;`+name+htmlAttrs+`/&gt;|&lt;`+name+htmlAttrs+`&gt;.*?&lt;/`+name+`\s*&gt;`))
+	}
+}
+
+// HTMLSanitizer strips the raw HTML in wikitext, like the div and span
+// wrappers, down to what's inside it, keeping only the allowed tags.
+// Elements like style and script go with their content.
+type HTMLSanitizer struct {
+	allowed map[string]bool
+}
+
+// ParseHTMLAllowlist parses the tags to keep separated by commas, or none
+// to keep none of them.
+func ParseHTMLAllowlist(s string) (*HTMLSanitizer, error) {
+	h := &HTMLSanitizer{allowed: make(map[string]bool)}
+	if s == "none" {
+		return h, nil
+	}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !htmlTagName.MatchString(tag) {
+			return nil, fmt.Errorf("invalid html tag: %q", tag)
+		}
+		h.allowed[tag] = true
+	}
+	return h, nil
+}
+
+// Sanitize returns the text, escaped as it's kept in the XML, with the tags
+// that aren't allowed taken out.
+func (h *HTMLSanitizer) Sanitize(text string) string {
+	if !strings.Contains(text, "&lt;") {
+		return text
+	}
+	for i, re := range htmlElements {
+		if !h.allowed[htmlDropContent[i]] {
+			text = re.ReplaceAllString(text, "")
+		}
+	}
+	return htmlTag.ReplaceAllStringFunc(text, func(tag string) string {
+		name := strings.ToLower(htmlTag.FindStringSubmatch(tag)[2])
+		switch {
+		case h.allowed[name]:
+			return tag
+		case name == "br":
+			// It still breaks the line
+			return "\n"
+		}
+		return ""
+	})
+}
@@ -0,0 +1,29 @@
+package xml
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	h, err := ParseHTMLAllowlist("b,i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ in, want string }{
+		{"the set {x : 0 &lt;x and x &lt; 1} where y&gt;2", "the set {x : 0 &lt;x and x &lt; 1} where y&gt;2"},
+		{"&lt;div class=&quot;a&quot;&gt;Hi &lt;b&gt;there&lt;/b&gt;&lt;br/&gt;x&lt;/div&gt;", "Hi &lt;b&gt;there&lt;/b&gt;\nx"},
+		{"a &lt;span&gt;&lt;b&lt;/span&gt;", "a &lt;b"},
+		{"&lt;style&gt;x{}&lt;/style&gt;keep &lt;DIV&gt;y&lt;/DIV&gt;", "keep y"},
+		// Comparisons aren't tags
+		{"if a&lt;b and c&gt;d then", "if a&lt;b and c&gt;d then"},
+		{"when p &lt;q then r&gt;s", "when p &lt;q then r&gt;s"},
+		{"x &lt;b\nand y&gt; z", "x &lt;b\nand y&gt; z"},
+		// Attributes quoted, unquoted and bare
+		{"&lt;span style=&quot;color:red&quot; title=&#39;a &amp; b&#39;&gt;red&lt;/span&gt;", "red"},
+		{"&lt;div class=plain id = x&gt;y&lt;/div &gt;", "y"},
+		{"a&lt;ref name=&quot;n&quot; /&gt;b&lt;references responsive /&gt;", "ab"},
+		{"&lt;script type=&quot;text/javascript&quot;&gt;x&lt;y&lt;/script&gt;z", "z"},
+	} {
+		if got := h.Sanitize(tt.in); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
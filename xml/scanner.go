@@ -0,0 +1,152 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+var (
+	pageStart = []byte("<page")
+	pageEnd   = []byte("</page>")
+)
+
+// scanChunk is how much is read from the input at a time.
+const scanChunk = 1 << 20
+
+// PageScanner splits a dump or processed output into the raw XML of each
+// page, without decoding it. Unlike encoding/xml it doesn't care whether the
+// document around the pages is well-formed.
+type PageScanner struct {
+	r      io.Reader
+	buf    []byte
+	start  int
+	page   []byte
+	offset int64
+	base   int64
+	err    error
+	eof    bool
+}
+
+// NewPageScanner returns a scanner reading from r.
+func NewPageScanner(r io.Reader) *PageScanner {
+	return &PageScanner{r: r}
+}
+
+// NewPageScannerBytes returns a scanner over the whole input in b, e.g. a
+// mapped file. The pages it returns point into b.
+func NewPageScannerBytes(b []byte) *PageScanner {
+	return &PageScanner{buf: b, eof: true}
+}
+
+// Scan advances to the next page, returning false at the end of the input
+// or on an error.
+func (s *PageScanner) Scan() bool {
+	for {
+		if i := s.findStart(); i >= 0 {
+			if j := bytes.Index(s.buf[i:], pageEnd); j >= 0 {
+				end := i + j + len(pageEnd)
+				s.page = s.buf[i:end]
+				s.offset = s.base + int64(i)
+				s.start = end
+				return true
+			}
+			s.start = i
+		} else if keep := len(s.buf) - len(pageStart); keep > s.start {
+			// Keep enough to find a start tag split between reads
+			s.start = keep
+		}
+
+		if s.eof {
+			return false
+		}
+		s.fill()
+	}
+}
+
+// findStart returns the index of the next <page> or <page ...> tag.
+func (s *PageScanner) findStart() int {
+	from := s.start
+	for {
+		i := bytes.Index(s.buf[from:], pageStart)
+		if i < 0 {
+			return -1
+		}
+		i += from
+		if next := i + len(pageStart); next < len(s.buf) && (s.buf[next] == '>' || s.buf[next] == ' ') {
+			return i
+		} else if next >= len(s.buf) {
+			// Can't tell yet, e.g. <pages>
+			return -1
+		}
+		from = i + 1
+	}
+}
+
+// fill drops the consumed part of the buffer and reads more.
+func (s *PageScanner) fill() {
+	s.base += int64(s.start)
+	s.buf = append(s.buf[:0], s.buf[s.start:]...)
+	s.start = 0
+
+	n := len(s.buf)
+	if cap(s.buf)-n < scanChunk {
+		grown := make([]byte, n, 2*cap(s.buf)+scanChunk)
+		copy(grown, s.buf)
+		s.buf = grown
+	}
+	read, err := io.ReadFull(s.r, s.buf[n:n+scanChunk])
+	s.buf = s.buf[:n+read]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		s.eof = true
+	} else if err != nil {
+		s.err = err
+		s.eof = true
+	}
+}
+
+// Bytes returns the raw XML of the current page. It's only valid until the
+// next call to Scan.
+func (s *PageScanner) Bytes() []byte {
+	return s.page
+}
+
+// Offset returns the byte offset of the current page in the input.
+func (s *PageScanner) Offset() int64 {
+	return s.offset
+}
+
+// Err returns the first read error.
+func (s *PageScanner) Err() error {
+	return s.err
+}
+
+// ReadPages calls fn for each page in a dump or processed output, stopping at
+// the first error.
+func ReadPages(path string, fn func(p *Page) error) error {
+	return scanPages(path, func(raw []byte) error {
+		var p Page
+		if err := xml.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+		return fn(&p)
+	})
+}
+
+// scanPages calls fn with the raw XML of each page in a dump or processed
+// output. The bytes are only valid during the call.
+func scanPages(path string, fn func(raw []byte) error) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := NewPageScanner(f)
+	for s.Scan() {
+		if err := fn(s.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,127 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// scriptFields replaces the placeholders of ScriptArgs and ScriptEnv with
+// the page's values.
+func scriptFields(p *Page) *strings.Replacer {
+	return strings.NewReplacer(
+		"{title}", p.Title,
+		"{ns}", p.Ns,
+		"{id}", p.ID,
+		"{revision}", p.Revision.ID,
+	)
+}
+
+// scriptCommand returns the command running script over p, after
+// ScriptPrefix, or the interpreter it needs without one, and with
+// ScriptArgs and ScriptEnv filled in. The page text still goes to its
+// stdin.
+func (w *Worker) scriptCommand(script string, p *Page) *exec.Cmd {
+	fields := scriptFields(p)
+
+	prefix := w.ScriptPrefix
+	if len(prefix) == 0 {
+		prefix = w.scriptInterpreter(script)
+	}
+	args := append(append([]string(nil), prefix...), script)
+	for _, arg := range w.ScriptArgs {
+		args = append(args, fields.Replace(arg))
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+
+	if len(w.ScriptEnv) > 0 {
+		cmd.Env = os.Environ()
+		for _, env := range w.ScriptEnv {
+			cmd.Env = append(cmd.Env, fields.Replace(env))
+		}
+	}
+	return cmd
+}
+
+// runScript runs script over text for p, returning what it printed to
+// stdout. If it fails the error is a *ProcessError. What it printed to
+// stderr while succeeding is a warning, which is logged and kept for
+// DiagnosticsFile.
+func (w *Worker) runScript(script string, p *Page, text string) ([]byte, error) {
+	cmd := w.scriptCommand(script, p)
+	cmd.Stdin = strings.NewReader(text)
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	w.Pool.acquire()
+	defer w.Pool.release()
+	if err := cmd.Start(); err != nil {
+		return nil, &ProcessError{Title: p.Title, Script: script, Err: err}
+	}
+	w.Progress.add(progressScripts, 1)
+	w.watchdog.started(cmd, p)
+	err := cmd.Wait()
+	w.watchdog.finished(cmd)
+	if err != nil {
+		return nil, &ProcessError{Title: p.Title, Script: script, Stderr: stderr.String(), Err: err}
+	}
+	p.stderr = stderr.String()
+	if p.stderr != "" {
+		log.Printf("warning from %s on title %s: %s", script, p.Title, firstLine(p.stderr))
+	}
+	return out.Bytes(), nil
+}
+
+// firstLine returns the first line of s that isn't blank.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// diagnose lists p in DiagnosticsFile, if there is one, with what the
+// script wrote to stderr. The page has to have taken its turn.
+func (w *Worker) diagnose(p *Page, status, stderr string) {
+	if w.diagnostics == nil {
+		return
+	}
+	if err := w.diagnostics.Write(p.ID, p.Title, status, strings.TrimSpace(stderr)); err != nil {
+		panic(err)
+	}
+}
+
+// deadLetterFailed writes a page that couldn't be cleaned to the dead
+// letter file, if there is one, so it can be cleaned again later.
+func (w *Worker) deadLetterFailed(p *Page, reason error) {
+	if w.deadLetter == nil {
+		return
+	}
+	var pe *ProcessError
+	if errors.As(reason, &pe) && strings.TrimSpace(pe.Stderr) != "" {
+		reason = fmt.Errorf("%v\nstderr:\n%s", reason, strings.TrimSpace(pe.Stderr))
+	}
+	output, err := xml.MarshalIndent(p, w.indent(), w.indent())
+	if err != nil {
+		panic(err)
+	}
+	w.deadLetter <- deadLetterPage(output, "cleaning failed", reason)
+}
+
+// scriptInvocation is everything besides the script itself that changes
+// what it outputs, for keying the clean cache.
+func (w *Worker) scriptInvocation() []string {
+	var invocation []string
+	invocation = append(invocation, w.ScriptPrefix...)
+	invocation = append(invocation, w.ScriptArgs...)
+	return append(invocation, w.ScriptEnv...)
+}
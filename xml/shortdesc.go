@@ -0,0 +1,34 @@
+package xml
+
+import (
+	"html"
+	"strings"
+
+	"github.com/stephen-mw/wikireader_fastparser/wikitext"
+)
+
+// shortDescription is the template holding a page's short description.
+const shortDescription = "Template:Short description"
+
+// ShortDescription returns the text of the page's {{Short description}},
+// which readers show as a subtitle in search results. It's empty if the page
+// has none, or explicitly none.
+func ShortDescription(text string) string {
+	for _, n := range wikitext.Parse(html.UnescapeString(text)) {
+		if n.Kind != wikitext.Template || !strings.EqualFold(templateTitle(n.Name), shortDescription) {
+			continue
+		}
+		for _, param := range n.Params {
+			if param.Name != "" {
+				continue
+			}
+			desc := strings.Join(strings.Fields(wikitext.Plain(param.Value)), " ")
+			if strings.EqualFold(desc, "none") {
+				return ""
+			}
+			return desc
+		}
+		return ""
+	}
+	return ""
+}
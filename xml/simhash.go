@@ -0,0 +1,121 @@
+package xml
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SimHash returns the 64 bit SimHash of the text's word 3-shingles. Texts
+// that differ in a few words have hashes a small Hamming distance apart.
+func SimHash(text string) uint64 {
+	words := strings.Fields(strings.ToLower(text))
+	var weights [64]int
+
+	add := func(shingle string) {
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		v := mix64(h.Sum64())
+		for i := 0; i < 64; i++ {
+			if v&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	if len(words) < 3 {
+		add(strings.Join(words, " "))
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		add(strings.Join(words[i:i+3], " "))
+	}
+
+	var hash uint64
+	for i, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// nearDup is a page kept in the near-duplicate index.
+type nearDup struct {
+	hash  uint64
+	id    string
+	title string
+}
+
+// nearDupIndex finds earlier pages within maxDist bits of a SimHash. The hash
+// is split into maxDist+1 bands: two hashes that close must agree exactly
+// on at least one band, so only pages sharing a band are compared.
+type nearDupIndex struct {
+	mu      sync.Mutex
+	maxDist int
+	masks   []uint64
+	bands   []map[uint64][]*nearDup
+}
+
+func newNearDupIndex(maxDist int) *nearDupIndex {
+	x := &nearDupIndex{maxDist: maxDist}
+	n := maxDist + 1
+	width := 64 / n
+	for i := 0; i < n; i++ {
+		bitsInBand := width
+		if i == n-1 {
+			bitsInBand = 64 - width*(n-1)
+		}
+		mask := (^uint64(0) >> uint(64-bitsInBand)) << uint(i*width)
+		x.masks = append(x.masks, mask)
+		x.bands = append(x.bands, make(map[uint64][]*nearDup))
+	}
+	return x
+}
+
+// check returns the closest earlier page within maxDist of the hash, if any.
+// Pages without a match are added to the index, so each cluster is
+// represented by the first page seen.
+func (x *nearDupIndex) check(hash uint64, id, title string) (*nearDup, int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var best *nearDup
+	bestDist := x.maxDist + 1
+	for i, mask := range x.masks {
+		for _, d := range x.bands[i][hash&mask] {
+			if dist := bits.OnesCount64(d.hash ^ hash); dist < bestDist {
+				best = d
+				bestDist = dist
+			}
+		}
+	}
+	if best != nil {
+		return best, bestDist
+	}
+
+	d := &nearDup{hash: hash, id: id, title: title}
+	for i, mask := range x.masks {
+		x.bands[i][hash&mask] = append(x.bands[i][hash&mask], d)
+	}
+	return nil, 0
+}
+
+// checkNearDup looks for an earlier near-duplicate of the page. It returns
+// false if the page should be dropped.
+func (w *Worker) checkNearDup(p *Page) bool {
+	dup, dist := w.nearDups.check(SimHash(p.Revision.Text.Text), p.ID, p.Title)
+	if dup == nil {
+		return true
+	}
+
+	if w.nearDupReport != nil {
+		if err := w.nearDupReport.Write(p.ID, p.Title, dup.id, dup.title, strconv.Itoa(dist)); err != nil {
+			panic(err)
+		}
+	}
+	return !w.DropNearDups
+}
@@ -0,0 +1,35 @@
+package xml
+
+import (
+	"log"
+)
+
+// Sink receives processed pages in addition to, or instead of, the XML
+// output file. Each sink is fed from a single goroutine, so it doesn't need
+// to be safe for concurrent use.
+type Sink interface {
+	WritePage(p *Page) error
+	Close() error
+}
+
+// startSink feeds the pages arriving on the channel to the sink
+func (w *Worker) startSink(s Sink, in chan *Page) {
+	defer w.writers.Done()
+
+	failed := false
+	for p := range in {
+		if failed {
+			continue
+		}
+		if err := s.WritePage(p); err != nil {
+			w.fatal(&WriteError{Title: p.Title, Err: err})
+			failed = true
+		}
+	}
+
+	if err := s.Close(); err != nil && !failed {
+		w.fatal(&WriteError{Err: err})
+		return
+	}
+	log.Println("Sink done")
+}
@@ -0,0 +1,139 @@
+package xml
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SinkFilter picks and changes the pages for a single sink, after they've
+// been processed for the main output, so one run can feed sinks that want
+// different cuts of the same pages.
+type SinkFilter struct {
+	// Namespaces, if set, are the only namespaces passed on
+	Namespaces map[string]bool
+	// TitleFilter, if set, only passes on pages whose titles match it
+	TitleFilter *regexp.Regexp
+	// SkipRedirects drops redirects
+	SkipRedirects bool
+	// Lead cuts the text down to the lead section
+	Lead bool
+	// MaxBytes, if set, summarizes longer text. See Summarize.
+	MaxBytes int
+	// HTML, if set, strips the HTML tags it doesn't allow from the text
+	HTML *HTMLSanitizer
+}
+
+// ParseSinkFilter parses a filter given as options separated by
+// semicolons: ns=0,14, title=regexp, no-redirects, lead, max-bytes=N and
+// html=b,i,... for the HTML tags to keep, or html alone for
+// DefaultHTMLAllowlist.
+func ParseSinkFilter(s string) (*SinkFilter, error) {
+	f := &SinkFilter{}
+	for _, opt := range strings.Split(s, ";") {
+		name, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			name, value = opt[:i], opt[i+1:]
+		}
+		switch name {
+		case "ns":
+			f.Namespaces = make(map[string]bool)
+			for _, ns := range strings.Split(value, ",") {
+				if _, err := strconv.Atoi(ns); err != nil {
+					return nil, fmt.Errorf("invalid namespace: %s", ns)
+				}
+				f.Namespaces[ns] = true
+			}
+		case "title":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+			f.TitleFilter = re
+		case "no-redirects":
+			f.SkipRedirects = true
+		case "lead":
+			f.Lead = true
+		case "max-bytes":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid max-bytes: %s", value)
+			}
+			f.MaxBytes = n
+		case "html":
+			if value == "" {
+				value = strings.Join(DefaultHTMLAllowlist, ",")
+			}
+			h, err := ParseHTMLAllowlist(value)
+			if err != nil {
+				return nil, err
+			}
+			f.HTML = h
+		default:
+			return nil, fmt.Errorf("unknown sink option: %s", opt)
+		}
+	}
+	return f, nil
+}
+
+// apply returns the page as the sink should get it, or nil if it's
+// filtered out. The page is shared with the other sinks, so a changed page
+// is a copy.
+func (f *SinkFilter) apply(p *Page) *Page {
+	if f.Namespaces != nil && !f.Namespaces[p.Ns] {
+		return nil
+	}
+	if f.TitleFilter != nil && !f.TitleFilter.MatchString(p.Title) {
+		return nil
+	}
+	if f.SkipRedirects && IsRedirect(p) {
+		return nil
+	}
+	if !f.Lead && f.MaxBytes == 0 && f.HTML == nil {
+		return p
+	}
+
+	q := *p
+	if f.HTML != nil {
+		q.Revision.Text.Text = f.HTML.Sanitize(q.Revision.Text.Text)
+	}
+	if f.Lead {
+		q.Revision.Text.Text = leadSection(q.Revision.Text.Text)
+	}
+	if f.MaxBytes > 0 {
+		q.Revision.Text.Text = Summarize(q.Revision.Text.Text, f.MaxBytes, 1)
+	}
+	return &q
+}
+
+// leadSection returns the text before the first heading.
+func leadSection(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if level, _ := headingLine(line); level > 0 {
+			return strings.Join(lines[:i], "")
+		}
+	}
+	return text
+}
+
+// FilteredSink is a sink that only gets the pages its filter passes on, as
+// the filter changes them.
+type FilteredSink struct {
+	Sink   Sink
+	Filter *SinkFilter
+}
+
+// WritePage implements Sink.
+func (s *FilteredSink) WritePage(p *Page) error {
+	if p = s.Filter.apply(p); p == nil {
+		return nil
+	}
+	return s.Sink.WritePage(p)
+}
+
+// Close implements Sink.
+func (s *FilteredSink) Close() error {
+	return s.Sink.Close()
+}
@@ -0,0 +1,137 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// skipList keeps the pages that failed to clean in a TSV file of page ID,
+// revision sha1 and the error, so later runs skip them as they're read
+// instead of running the script on them until it gives up again. A page is
+// only skipped while it's at the revision that failed. Failures are
+// appended as they happen, and the file is rewritten at the end without
+// the pages that have moved on to another revision, or were retried.
+type skipList struct {
+	path  string
+	retry bool
+
+	mu    sync.Mutex
+	f     *os.File
+	bad   map[string]skipListEntry
+	moved map[string]bool
+}
+
+// skipListEntry is a page on the skip list.
+type skipListEntry struct {
+	sha1, reason string
+}
+
+// openSkipList loads the skip list at path, if there is one. With retry
+// the pages on it aren't skipped, and they stay on it only if they fail
+// again.
+func openSkipList(path string, retry bool) (*skipList, error) {
+	l := &skipList{path: path, retry: retry, bad: make(map[string]skipListEntry), moved: make(map[string]bool)}
+	if f, err := os.Open(path); err == nil {
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			fields := strings.SplitN(s.Text(), "\t", 3)
+			if len(fields) < 2 {
+				// A line cut short by an interrupted run
+				continue
+			}
+			e := skipListEntry{sha1: fields[1]}
+			if len(fields) == 3 {
+				e.reason = fields[2]
+			}
+			// Later lines are later failures of the same page
+			l.bad[fields[0]] = e
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			return nil, fmt.Errorf("skip list %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var err error
+	l.f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// skip reports whether a page read with the ID should be skipped. sha1
+// returns its revision's sha1, and is only called for the pages on the
+// list.
+func (l *skipList) skip(id string, sha1 func() string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.bad[id]
+	if !ok {
+		return false
+	}
+	if l.retry || e.sha1 != sha1() {
+		l.moved[id] = true
+		return false
+	}
+	return true
+}
+
+// add puts a page that failed to clean on the list.
+func (l *skipList) add(p *Page, reason error) {
+	if l == nil {
+		return
+	}
+	msg := strings.Join(strings.Fields(reason.Error()), " ")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := p.sourceID()
+	l.bad[id] = skipListEntry{sha1: p.Revision.Sha1, reason: msg}
+	delete(l.moved, id)
+	if _, err := fmt.Fprintf(l.f, "%s\t%s\t%s\n", id, p.Revision.Sha1, msg); err != nil {
+		panic(err)
+	}
+}
+
+// Close rewrites the list without the pages that have moved on.
+func (l *skipList) Close() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), ".skiplist-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	ids := make([]string, 0, len(l.bad))
+	for id := range l.bad {
+		if !l.moved[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	w := bufio.NewWriter(tmp)
+	for _, id := range ids {
+		e := l.bad[id]
+		fmt.Fprintf(w, "%s\t%s\t%s\n", id, e.sha1, e.reason)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
@@ -0,0 +1,112 @@
+package xml
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// skipLogInterval is how often the pages skipped are summed up in the log.
+const skipLogInterval = time.Minute
+
+// skipLog counts the pages skipped for each reason, like duplicate title or
+// namespace 1, and logs the counts every skipLogInterval instead of a line
+// per page, which would bury the rest of the log once most of a dump is
+// filtered out. With Worker.LogSkips, or before the run starts, each page
+// is logged instead.
+type skipLog struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	since   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startSkipLog starts logging the counts until close is called.
+func startSkipLog() *skipLog {
+	l := &skipLog{
+		counts:  make(map[string]int),
+		since:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// detailed reports whether each page is logged, so the caller needs its
+// title.
+func (l *skipLog) detailed() bool {
+	return l == nil
+}
+
+// skip notes a page skipped for the reason.
+func (l *skipLog) skip(title, reason string) {
+	if l == nil {
+		log.Printf("Skipping %s: %s", title, reason)
+		return
+	}
+	l.mu.Lock()
+	l.counts[reason]++
+	l.mu.Unlock()
+}
+
+func (l *skipLog) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(skipLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			l.flush()
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+// flush logs the counts since the last time, most first, and starts
+// counting again.
+func (l *skipLog) flush() {
+	l.mu.Lock()
+	counts := l.counts
+	since := l.since
+	l.counts = make(map[string]int)
+	l.since = time.Now()
+	l.mu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+	reasons := make([]string, 0, len(counts))
+	total := 0
+	for reason, n := range counts {
+		reasons = append(reasons, reason)
+		total += n
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%d %s", counts[reason], reason)
+	}
+	log.Printf("skipped %d pages in the last %s: %s", total, time.Since(since).Round(time.Second), strings.Join(parts, ", "))
+}
+
+// close logs what's left to log and stops.
+func (l *skipLog) close() {
+	if l == nil {
+		return
+	}
+	close(l.stop)
+	<-l.stopped
+}
@@ -0,0 +1,105 @@
+package xml
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// slowPage is a page whose cleaning ran past SlowThreshold, handed to the
+// slow lane to wait for.
+type slowPage struct {
+	out   chan []byte
+	p     *Page
+	done  chan error
+	start time.Time
+}
+
+// startSlowLane starts the SlowLaneSlots goroutines finishing slow pages.
+// The channel to them isn't buffered, so with every slot taken the next
+// slow page holds up its worker as it would without a slow lane.
+func (w *Worker) startSlowLane() error {
+	if w.SlowFile != "" {
+		var err error
+		w.slowReport, err = createTSV(w.SlowFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	slots := w.SlowLaneSlots
+	if slots < 1 {
+		slots = 1
+	}
+	w.slow = make(chan *slowPage)
+	for i := 0; i < slots; i++ {
+		w.slowLane.Add(1)
+		go w.runSlowLane()
+	}
+	return nil
+}
+
+// cleanOrDivert cleans p with script, like clean. If that takes longer
+// than SlowThreshold the page goes on to the slow lane to finish and
+// diverted is set, so the worker can get on with the next page.
+func (w *Worker) cleanOrDivert(out chan []byte, p *Page, script string, start time.Time) (diverted bool, err error) {
+	if w.slow == nil {
+		return false, w.clean(p, script)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.clean(p, script)
+	}()
+
+	timer := time.NewTimer(w.SlowThreshold)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return false, err
+	case <-timer.C:
+	}
+
+	log.Printf("Slow page: %s. Moving to the slow lane", p.Title)
+	w.slow <- &slowPage{out: out, p: p, done: done, start: start}
+	return true, nil
+}
+
+// runSlowLane waits for the slow pages to be cleaned and finishes them.
+func (w *Worker) runSlowLane() {
+	defer w.slowLane.Done()
+
+	for s := range w.slow {
+		err := <-s.done
+		took := time.Since(s.start)
+		s.p.fellBack("slow-lane")
+
+		w.slowMu.Lock()
+		w.slowIDs = append(w.slowIDs, s.p.ID)
+		w.slowMu.Unlock()
+		if w.slowReport != nil {
+			if err := w.slowReport.Write(s.p.ID, s.p.Title, fmt.Sprintf("%.1f", took.Seconds())); err != nil {
+				panic(err)
+			}
+		}
+
+		w.takeTurn(s.p)
+		if w.cleaned(s.p, err) {
+			w.finishPage(s.out, s.p, s.start)
+		}
+	}
+}
+
+// reportSlow logs the pages that went through the slow lane and closes
+// SlowFile.
+func (w *Worker) reportSlow() {
+	if len(w.slowIDs) > 0 {
+		log.Printf("slow lane: %d pages: %s", len(w.slowIDs), strings.Join(w.slowIDs, ","))
+	}
+	if w.slowReport != nil {
+		if err := w.slowReport.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package xml
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unsortedPath is where the xml output is written before it's sorted, with
+// SortByTitle.
+func unsortedPath(path string) string {
+	return path + ".unsorted"
+}
+
+// sortOutput writes the unsorted xml output to OutputFile sorted by title,
+// the same way as SortIndex, with IndexFile giving the offsets of the
+// sorted pages. The pages are sorted by their offsets with an external
+// sort bounded by SortOptions, then copied across one by one. The unsorted
+// output is only removed once every page it has was written.
+func (w *Worker) sortOutput() error {
+	unsorted := unsortedPath(w.OutputFile)
+	f, err := os.Open(unsorted)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := newExternalSort(w.SortOptions)
+	scanner := NewPageScanner(f)
+	scanned, written := 0, 0
+	for scanner.Scan() {
+		scanned++
+		page := scanner.Bytes()
+		// Pages with the same title stay in the order they were written
+		line := fmt.Sprintf("%020d\t%d", scanner.Offset(), len(page))
+		if err := s.add(w.SearchKeys.Key(rawTitle(page)), line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	out, err := createOutput(w.OutputFile)
+	if err != nil {
+		return err
+	}
+	var index *tsvFile
+	if w.IndexFile != "" {
+		if index, err = createTSV(w.IndexFile); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	doc := newDocWriter(out, w.indent())
+	doc.provenance = w.Provenance
+	err = doc.head()
+	if err == nil {
+		err = s.each(func(line string) error {
+			fields := strings.Split(line, "\t")
+			offset, _ := strconv.ParseInt(fields[0], 10, 64)
+			length, _ := strconv.Atoi(fields[1])
+			page := make([]byte, length)
+			if _, err := f.ReadAt(page, offset); err != nil {
+				return err
+			}
+			start, err := doc.rawPage(page)
+			if err == nil {
+				written++
+			}
+			if err != nil || index == nil {
+				return err
+			}
+			return writeIndexEntry(index, page, start)
+		})
+	}
+	if err == nil {
+		err = doc.end()
+	}
+	if index != nil {
+		if cerr := index.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if written != scanned {
+		return fmt.Errorf("sorting %s: wrote %d of its %d pages, keeping it", unsorted, written, scanned)
+	}
+	return os.Remove(unsorted)
+}
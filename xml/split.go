@@ -0,0 +1,87 @@
+package xml
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Split is a named output set receiving a share of the pages.
+type Split struct {
+	Name   string
+	Weight float64
+}
+
+// ParseSplit parses a list of sets like "train=0.95,val=0.05". The weights
+// don't need to add up to one. Each set needs a name of its own, which goes
+// into the name of its output file.
+func ParseSplit(s string) ([]Split, error) {
+	var splits []Split
+	names := make(map[string]bool)
+	total := 0.0
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid split %q, expected name=weight", part)
+		}
+		name := strings.TrimSpace(kv[0])
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("invalid split %q, the set needs a name", part)
+		case strings.ContainsAny(name, `/\`) || name == "." || name == "..":
+			return nil, fmt.Errorf("invalid split name %q, it can't be a path", name)
+		case names[name]:
+			return nil, fmt.Errorf("split %s is listed twice", name)
+		}
+		names[name] = true
+		weight, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("invalid weight for split %s: %s", name, kv[1])
+		}
+		splits = append(splits, Split{Name: name, Weight: weight})
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("split weights add up to zero")
+	}
+	if math.IsInf(total, 0) {
+		return nil, fmt.Errorf("split weights add up to more than a float can hold")
+	}
+	return splits, nil
+}
+
+// splitIndex picks the set for a page ID. The same ID always lands in the
+// same set.
+func splitIndex(splits []Split, id string) int {
+	// FNV doesn't mix short numeric IDs well enough, so use SHA-256 and take
+	// the top 53 bits for a uniform float in [0, 1)
+	sum := sha256.Sum256([]byte(id))
+	point := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+
+	total := 0.0
+	for _, s := range splits {
+		total += s.Weight
+	}
+
+	cumulative := 0.0
+	for i, s := range splits {
+		cumulative += s.Weight / total
+		if point < cumulative {
+			return i
+		}
+	}
+	return len(splits) - 1
+}
+
+// splitPath inserts the set name before the file extension, so out.xml
+// becomes out.train.xml, and a remote prefix gs://bucket/out/ becomes
+// gs://bucket/out/pages.train.xml.
+func splitPath(path, name string) string {
+	path = outputPath(path)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
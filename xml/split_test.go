@@ -0,0 +1,40 @@
+package xml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSplit(t *testing.T) {
+	splits, err := ParseSplit("train=0.95, val = 0.05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Split{{"train", 0.95}, {"val", 0.05}}; !reflect.DeepEqual(splits, want) {
+		t.Errorf("ParseSplit = %v, want %v", splits, want)
+	}
+
+	for _, s := range []string{
+		"train", "=1", "a=1,a=2", "a/b=1", "..=1",
+		"a=-1", "a=x", "a=0,b=0",
+		"a=NaN", "a=nan,b=1", "a=Inf", "a=+Inf,b=1", "a=-inf",
+		"a=1e308,b=1e308",
+	} {
+		if _, err := ParseSplit(s); err == nil {
+			t.Errorf("ParseSplit(%q) didn't fail", s)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	for _, tt := range []struct{ path, want string }{
+		{"out.xml", "out.train.xml"},
+		{"dir/out", "dir/out.train"},
+		{"s3://bucket/out.xml", "s3://bucket/out.train.xml"},
+		{"gs://bucket/prefix/", "gs://bucket/prefix/pages.train.xml"},
+	} {
+		if got := splitPath(tt.path, "train"); got != tt.want {
+			t.Errorf("splitPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package xml
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLSink writes the pages as MySQL statements that load them straight into
+// the tables of a MediaWiki 1.41 or later wiki. Run maintenance/rebuildall.php
+// afterwards to fill in the link tables and search index. Older wikis can
+// import the -format xml output with maintenance/importDump.php instead.
+//
+// Pages keep their IDs, so the wiki should be empty apart from the pages
+// created by the installer.
+type SQLSink struct {
+	// Prefix is the wiki's $wgDBprefix
+	Prefix string
+
+	f   io.WriteCloser
+	w   *bufio.Writer
+	now string
+}
+
+// SetTime sets the time given to pages without a timestamp, instead of
+// when the file was created.
+func (s *SQLSink) SetTime(t time.Time) {
+	s.now = t.UTC().Format("20060102150405")
+}
+
+// NewSQLSink creates the SQL file at path.
+func NewSQLSink(path, prefix string) (*SQLSink, error) {
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLSink{
+		Prefix: prefix,
+		f:      f,
+		w:      bufio.NewWriter(f),
+		now:    time.Now().UTC().Format("20060102150405"),
+	}
+	s.w.WriteString("SET NAMES binary;\nBEGIN;\n")
+	return s, nil
+}
+
+// WritePage implements Sink. Each page gets a single revision holding the
+// processed text.
+func (s *SQLSink) WritePage(p *Page) error {
+	r := NewRecord(p)
+	size := len(r.Text)
+	sha := Sha1Base36(r.Text)
+	ts := mediawikiTimestamp(r.Timestamp, s.now)
+	model := p.Revision.Model
+	if model == "" {
+		model = "wikitext"
+	}
+	actor := p.Revision.Contributor.Username
+	if actor == "" {
+		actor = p.Revision.Contributor.IP
+	}
+	if actor == "" {
+		actor = "Maintenance script"
+	}
+	redirect := 0
+	if IsRedirect(p) {
+		redirect = 1
+	}
+
+	fmt.Fprintf(s.w, "INSERT INTO %stext (old_text, old_flags) VALUES (%s, 'utf-8');\n",
+		s.Prefix, sqlString(r.Text))
+	fmt.Fprintf(s.w, "INSERT INTO %scontent (content_size, content_sha1, content_model, content_address) "+
+		"VALUES (%d, '%s', (SELECT model_id FROM %scontent_models WHERE model_name = %s), CONCAT('tt:', LAST_INSERT_ID()));\n",
+		s.Prefix, size, sha, s.Prefix, sqlString(model))
+	s.w.WriteString("SET @content = LAST_INSERT_ID();\n")
+	fmt.Fprintf(s.w, "INSERT INTO %scomment (comment_hash, comment_text) VALUES (%d, %s);\n",
+		s.Prefix, commentHash(p.Revision.Comment), sqlString(p.Revision.Comment))
+	s.w.WriteString("SET @comment = LAST_INSERT_ID();\n")
+	fmt.Fprintf(s.w, "INSERT IGNORE INTO %sactor (actor_name) VALUES (%s);\n", s.Prefix, sqlString(actor))
+	fmt.Fprintf(s.w, "INSERT INTO %srevision (rev_id, rev_page, rev_comment_id, rev_actor, rev_timestamp, rev_minor_edit, rev_deleted, rev_len, rev_parent_id, rev_sha1) "+
+		"VALUES (%s, %s, @comment, (SELECT actor_id FROM %sactor WHERE actor_name = %s), '%s', 0, 0, %d, 0, '%s');\n",
+		s.Prefix, sqlInt(r.RevisionID), sqlInt(r.ID), s.Prefix, sqlString(actor), ts, size, sha)
+	fmt.Fprintf(s.w, "INSERT INTO %sslots (slot_revision_id, slot_role_id, slot_content_id, slot_origin) "+
+		"VALUES (%s, (SELECT role_id FROM %sslot_roles WHERE role_name = 'main'), @content, %s);\n",
+		s.Prefix, sqlInt(r.RevisionID), s.Prefix, sqlInt(r.RevisionID))
+	_, err := fmt.Fprintf(s.w, "INSERT INTO %spage (page_id, page_namespace, page_title, page_is_redirect, page_is_new, page_random, page_touched, page_latest, page_len, page_content_model) "+
+		"VALUES (%s, %s, %s, %d, 1, %s, '%s', %s, %d, %s);\n",
+		s.Prefix, sqlInt(r.ID), sqlInt(r.Ns), sqlString(dbKey(r.Title, r.Ns)), redirect, pageRandom(r.ID), ts, sqlInt(r.RevisionID), size, sqlString(model))
+	if err != nil || r.ShortDescription == "" {
+		return err
+	}
+	// The same property the ShortDescription extension sets
+	_, err = fmt.Fprintf(s.w, "INSERT INTO %spage_props (pp_page, pp_propname, pp_value) VALUES (%s, 'wikibase-shortdesc', %s);\n",
+		s.Prefix, sqlInt(r.ID), sqlString(r.ShortDescription))
+	return err
+}
+
+// Close implements Sink.
+func (s *SQLSink) Close() error {
+	s.w.WriteString("COMMIT;\n")
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// dbKey is the form of a title stored in page_title: underscores for spaces,
+// without the namespace prefix.
+func dbKey(title, ns string) string {
+	if ns != "0" {
+		if i := strings.Index(title, ":"); i >= 0 {
+			title = title[i+1:]
+		}
+	}
+	return strings.ReplaceAll(title, " ", "_")
+}
+
+// mediawikiTimestamp converts a dump timestamp to the 14 digit form used in
+// the database, falling back to def.
+func mediawikiTimestamp(ts, def string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return def
+	}
+	return t.UTC().Format("20060102150405")
+}
+
+// Sha1Base36 is the SHA-1 of the text as MediaWiki stores it, the <sha1>
+// of a revision.
+func Sha1Base36(text string) string {
+	sum := sha1.Sum([]byte(text))
+	s := new(big.Int).SetBytes(sum[:]).Text(36)
+	return strings.Repeat("0", 31-len(s)) + s
+}
+
+// commentHash is CommentStore::hash for a comment without data.
+func commentHash(comment string) int32 {
+	return int32(crc32.ChecksumIEEE([]byte(comment)))
+}
+
+// pageRandom is a stable page_random for the page ID.
+func pageRandom(id string) string {
+	n, _ := strconv.ParseUint(id, 10, 64)
+	return strconv.FormatFloat(float64(mix64(n)>>11)/(1<<53), 'f', 12, 64)
+}
+
+// sqlInt guards against anything but digits ending up unquoted in the SQL.
+func sqlInt(v string) string {
+	if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+		return "0"
+	}
+	return v
+}
+
+// sqlString quotes a MySQL string literal.
+func sqlString(v string) string {
+	return "'" + sqlReplacer.Replace(v) + "'"
+}
+
+var sqlReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
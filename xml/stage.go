@@ -0,0 +1,146 @@
+package xml
+
+import (
+	"encoding/xml"
+	"log"
+	"sync"
+	"time"
+)
+
+// rawPage is a page found by the scanner, numbered so the decoded pages can
+// be put back in input order.
+type rawPage struct {
+	seq    int
+	offset int64
+	raw    []byte
+	p      *Page
+	err    error
+	// skipped is why rawSkip dropped the page, which isn't decoded
+	skipped string
+	title   string
+}
+
+// decodeParallel takes the pages of input from the scanner and decodes
+// them with DecodeWorkers goroutines. fn is called for each page in input
+// order, so deduplication keeps the same page as the single decoder. Pages
+// dropped by rawSkip aren't decoded at all, skip is called for them instead
+// with the title, if the skip log needs it, and the reason. The pages decoded
+// ahead of a slow one wait in a reorderBuffer.
+func (w *Worker) decodeParallel(input string, s *PageScanner, fn func(p *Page), skip func(title, reason string)) error {
+	decoders := w.DecodeWorkers
+	if decoders < 1 {
+		decoders = 1
+	}
+	filtering := w.filtering()
+	jobs := make(chan *rawPage, 2*decoders)
+	results := make(chan *rawPage, 2*decoders)
+
+	var decoding sync.WaitGroup
+	for i := 0; i < decoders; i++ {
+		decoding.Add(1)
+		go func() {
+			defer decoding.Done()
+			for job := range jobs {
+				var p Page
+				start := time.Now()
+				if err := xml.Unmarshal(job.raw, &p); err != nil {
+					job.err = &DecodeError{Input: input, Offset: job.offset, Err: err}
+				}
+				w.Tracer.startPage(&p, start)
+				job.p = &p
+				job.raw = nil
+				results <- job
+			}
+		}()
+	}
+
+	go func() {
+		seq := 0
+		for !w.stopped() && s.Scan() {
+			if filtering {
+				if reason := w.rawSkip(s.Bytes()); reason != "" {
+					// Still in order, so skip is called from fn's goroutine
+					skipped := &rawPage{seq: seq, offset: s.Offset(), skipped: reason}
+					if w.skips.detailed() {
+						skipped.title = rawTitle(s.Bytes())
+					}
+					results <- skipped
+					seq++
+					continue
+				}
+			}
+			// The scanner reuses its buffer
+			raw := append([]byte(nil), s.Bytes()...)
+			jobs <- &rawPage{seq: seq, offset: s.Offset(), raw: raw}
+			seq++
+		}
+		close(jobs)
+		decoding.Wait()
+		close(results)
+	}()
+
+	pending := newReorderBuffer(w.ReorderMemory, w.SortOptions.TempDir)
+	defer pending.close()
+	next := 0
+	for job := range results {
+		if err := pending.add(job); err != nil {
+			w.fatal(&WriteError{Output: "reorder buffer", Err: err})
+			break
+		}
+		for {
+			done, err := pending.take(next)
+			if err != nil {
+				w.fatal(&WriteError{Output: "reorder buffer", Err: err})
+				break
+			}
+			if done == nil {
+				break
+			}
+			next++
+
+			if done.skipped != "" {
+				skip(done.title, done.skipped)
+				continue
+			}
+			if done.err != nil {
+				log.Printf("%v. Skipping", done.err)
+				w.failed(done.err)
+				continue
+			}
+			fn(done.p)
+		}
+		if w.stopped() {
+			break
+		}
+	}
+	// Let the scanner and decoders wind down
+	for range results {
+	}
+	return s.Err()
+}
+
+// queuedPage is a processed page waiting for a write worker.
+type queuedPage struct {
+	out    chan []byte
+	p      *Page
+	indent bool
+}
+
+// startWriteWorker marshals the processed pages queued by the workers. With
+// WriteWorkers set this happens in its own pool instead of the workers.
+func (w *Worker) startWriteWorker() {
+	defer w.writeWorkers.Done()
+
+	for q := range w.toWrite {
+		w.emit(q.out, q.p, q.indent)
+	}
+}
+
+// write hands a processed page to the write stage.
+func (w *Worker) write(out chan []byte, p *Page, indent bool) {
+	if w.toWrite == nil {
+		w.emit(out, p, indent)
+		return
+	}
+	w.toWrite <- &queuedPage{out: out, p: p, indent: indent}
+}
@@ -0,0 +1,148 @@
+package xml
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// StatsSink counts tokens per page and for the whole corpus. Whitespace
+// tokens are always counted, BPE tokens only when a tokenizer is set.
+type StatsSink struct {
+	Path string
+	BPE  *BPE
+
+	// Version is the build that wrote the stats file
+	Version string
+	// Provenance, if set, is included in the stats file
+	Provenance *Provenance
+
+	pages   *tsvFile
+	vocab   map[string]struct{}
+	stats   corpusStats
+	buckets map[int]int
+}
+
+// corpusStats is what ends up in the stats file.
+type corpusStats struct {
+	Pages       int               `json:"pages"`
+	Tokens      int64             `json:"tokens"`
+	BPETokens   int64             `json:"bpe_tokens,omitempty"`
+	Vocabulary  int               `json:"vocabulary"`
+	MinTokens   int               `json:"min_tokens"`
+	MaxTokens   int               `json:"max_tokens"`
+	MeanTokens  float64           `json:"mean_tokens"`
+	LengthHisto []histogramBucket `json:"length_histogram"`
+	Version     string            `json:"version,omitempty"`
+	Provenance  *Provenance       `json:"provenance,omitempty"`
+}
+
+// histogramBucket counts the pages with between Min and Max tokens.
+type histogramBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Pages int `json:"pages"`
+}
+
+// NewStatsSink writes the corpus stats as JSON to path and, if pagesPath is
+// set, the per page counts as TSV.
+func NewStatsSink(path, pagesPath string, bpe *BPE) (*StatsSink, error) {
+	s := &StatsSink{
+		Path:    path,
+		BPE:     bpe,
+		vocab:   make(map[string]struct{}),
+		buckets: make(map[int]int),
+	}
+	if pagesPath != "" {
+		var err error
+		s.pages, err = createTSV(pagesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// WritePage implements Sink. Redirects aren't counted.
+func (s *StatsSink) WritePage(p *Page) error {
+	if IsRedirect(p) {
+		return nil
+	}
+
+	text := NewRecord(p).Text
+	words := strings.Fields(text)
+	for _, word := range words {
+		s.vocab[word] = struct{}{}
+	}
+
+	bpe := 0
+	if s.BPE != nil {
+		bpe = s.BPE.Count(text)
+	}
+
+	n := len(words)
+	if s.stats.Pages == 0 || n < s.stats.MinTokens {
+		s.stats.MinTokens = n
+	}
+	if n > s.stats.MaxTokens {
+		s.stats.MaxTokens = n
+	}
+	s.stats.Pages++
+	s.stats.Tokens += int64(n)
+	s.stats.BPETokens += int64(bpe)
+	s.buckets[bucket(n)]++
+
+	if s.pages != nil {
+		return s.pages.Write(p.ID, p.Title, strconv.Itoa(n), strconv.Itoa(bpe))
+	}
+	return nil
+}
+
+// bucket returns the power of two bucket for a count: 0, 1, 2-3, 4-7, ...
+func bucket(n int) int {
+	b := 0
+	for n > 0 {
+		n >>= 1
+		b++
+	}
+	return b
+}
+
+// Close implements Sink.
+func (s *StatsSink) Close() error {
+	if s.pages != nil {
+		if err := s.pages.Close(); err != nil {
+			return err
+		}
+	}
+
+	s.stats.Vocabulary = len(s.vocab)
+	s.stats.Version = s.Version
+	s.stats.Provenance = s.Provenance
+	if s.stats.Pages > 0 {
+		s.stats.MeanTokens = float64(s.stats.Tokens) / float64(s.stats.Pages)
+	}
+	for b := 0; b <= bucket(s.stats.MaxTokens); b++ {
+		if s.buckets[b] == 0 {
+			continue
+		}
+		lo, hi := 0, 0
+		if b > 0 {
+			lo = 1 << uint(b-1)
+			hi = 1<<uint(b) - 1
+		}
+		s.stats.LengthHisto = append(s.stats.LengthHisto, histogramBucket{Min: lo, Max: hi, Pages: s.buckets[b]})
+	}
+
+	f, err := createOutput(s.Path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.stats); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
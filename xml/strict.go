@@ -0,0 +1,334 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// exportNamespace is the namespace of the export-0.10 schema the output
+// claims to follow.
+const exportNamespace = "http://www.mediawiki.org/xml/export-0.10/"
+
+// xmlNamespace is the namespace of the predefined xml: prefix.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// xsdElement is an element declaration from export-0.10.xsd. Elements
+// with content are a sequence of other elements, the rest have simple
+// content of the given type.
+type xsdElement struct {
+	name     string
+	min, max int // max 0 is unbounded
+	typ      string
+	attrs    map[string]string
+	content  []xsdElement
+}
+
+// pageSchema is PageType from export-0.10.xsd, copied by hand. It's the
+// part of the schema each output page has to conform to, and it has to be
+// updated along with the page fields the xml output writes. The XSD isn't
+// bundled or read: Strict checks this subset of it and nothing more.
+//
+// Checked for each page:
+//   - the elements of PageType and RevisionType, in their order, with their
+//     minOccurs and maxOccurs, and no others. Uploads and discussion
+//     threading are never written, so they aren't allowed.
+//   - the username, id and ip of a contributor, each at most once
+//   - that title, redirect, restrictions, comment, model, format, text and
+//     sha1 have no child elements. Their strings aren't checked further.
+//   - that ns and the ids are integers, positive where PageType says so,
+//     and that timestamp is a dateTime
+//   - the attributes of redirect, contributor, comment and text, and no
+//     others. deleted and xml:space must have their fixed values.
+//
+// Checked for the whole document, by ValidateDocument:
+//   - a single mediawiki root element in the export-0.10 namespace
+//   - nothing in it but an optional siteinfo, before the pages, and pages
+//
+// Not checked: the contributor's choice between username and id or ip,
+// the attributes of the root element, the content of siteinfo, namespaced
+// attributes other than xml:space, and the lengths and patterns of
+// strings, like the sha1's base 36.
+var pageSchema = xsdElement{name: "page", min: 1, max: 1, content: []xsdElement{
+	{name: "title", min: 1, max: 1, typ: "string"},
+	{name: "ns", min: 1, max: 1, typ: "nonNegativeInteger"},
+	{name: "id", min: 1, max: 1, typ: "positiveInteger"},
+	{name: "redirect", min: 0, max: 1, typ: "string", attrs: map[string]string{"title": "string"}},
+	{name: "restrictions", min: 0, max: 1, typ: "string"},
+	{name: "revision", min: 1, max: 0, content: []xsdElement{
+		{name: "id", min: 1, max: 1, typ: "positiveInteger"},
+		{name: "parentid", min: 0, max: 1, typ: "positiveInteger"},
+		{name: "timestamp", min: 1, max: 1, typ: "dateTime"},
+		{name: "contributor", min: 1, max: 1, attrs: map[string]string{"deleted": "deleted"}, content: []xsdElement{
+			{name: "username", min: 0, max: 1, typ: "string"},
+			{name: "id", min: 0, max: 1, typ: "nonNegativeInteger"},
+			{name: "ip", min: 0, max: 1, typ: "string"},
+		}},
+		{name: "minor", min: 0, max: 1, typ: "empty"},
+		{name: "comment", min: 0, max: 1, typ: "string", attrs: map[string]string{"deleted": "deleted"}},
+		{name: "model", min: 1, max: 1, typ: "string"},
+		{name: "format", min: 1, max: 1, typ: "string"},
+		{name: "text", min: 1, max: 1, typ: "string", attrs: map[string]string{
+			"xml:space": "preserve",
+			"deleted":   "deleted",
+			"id":        "nonNegativeInteger",
+			"bytes":     "nonNegativeInteger",
+		}},
+		{name: "sha1", min: 1, max: 1, typ: "string"},
+	}},
+}}
+
+// exportOnly returns a copy of the page without the fields that aren't
+// part of the export format, for writing it under Strict.
+func exportOnly(p *Page) *Page {
+	q := *p
+	q.ShortDescription = ""
+	q.Coordinates = nil
+	q.Biography = nil
+	q.Processing = nil
+	q.OriginalText = nil
+	return &q
+}
+
+// dateTimePattern is the lexical space of xs:dateTime.
+var dateTimePattern = regexp.MustCompile(`^-?\d{4,}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+
+// element is a parsed element, just enough to check it against the schema.
+type element struct {
+	name     string
+	attrs    []xml.Attr
+	children []*element
+	text     string
+}
+
+// ValidatePage checks a single marshaled page against PageType of the
+// export-0.10 schema, as far as pageSchema goes. The error lists every
+// problem found.
+func ValidatePage(page []byte) error {
+	root, err := parseElement(page)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	checkElement(root, pageSchema, "page", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ValidateDocument checks that an output file is a well-formed export
+// document: a single mediawiki root in the export namespace holding an
+// optional siteinfo followed by pages. The pages themselves are checked as
+// they're written.
+func ValidateDocument(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+
+	depth := 0
+	roots := 0
+	pages := 0
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch se := t.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			case 1:
+				roots++
+				if roots > 1 {
+					return fmt.Errorf("more than one root element")
+				}
+				if se.Name.Local != "mediawiki" || se.Name.Space != exportNamespace {
+					return fmt.Errorf("root element is %s, not mediawiki", se.Name.Local)
+				}
+			case 2:
+				switch se.Name.Local {
+				case "siteinfo":
+					if pages > 0 {
+						return fmt.Errorf("siteinfo after the first page")
+					}
+				case "page":
+					pages++
+				default:
+					return fmt.Errorf("unexpected <%s> in mediawiki", se.Name.Local)
+				}
+			}
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(se)) > 0 {
+				return fmt.Errorf("text outside of the root element")
+			}
+		}
+	}
+
+	if roots == 0 {
+		return fmt.Errorf("no root element")
+	}
+	return nil
+}
+
+// parseElement parses a single element and everything inside it.
+func parseElement(b []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(b))
+
+	var stack []*element
+	var root *element
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch se := t.(type) {
+		case xml.StartElement:
+			e := &element{name: se.Name.Local, attrs: se.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, fmt.Errorf("more than one element")
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(se)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no element")
+	}
+	return root, nil
+}
+
+// checkElement adds the ways e doesn't match its declaration to problems.
+// path names the element in the messages.
+func checkElement(e *element, decl xsdElement, path string, problems *[]string) {
+	add := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	for _, attr := range e.attrs {
+		name := attr.Name.Local
+		if attr.Name.Space == xmlNamespace {
+			name = "xml:" + name
+		} else if attr.Name.Space != "" {
+			// Namespace declarations and the like
+			continue
+		}
+		typ, ok := decl.attrs[name]
+		if !ok {
+			add("unexpected attribute %s", name)
+			continue
+		}
+		if err := checkValue(attr.Value, typ); err != nil {
+			add("attribute %s: %v", name, err)
+		}
+	}
+
+	if decl.content == nil {
+		if len(e.children) > 0 {
+			add("unexpected <%s>", e.children[0].name)
+		}
+		if err := checkValue(e.text, decl.typ); err != nil {
+			add("%v", err)
+		}
+		return
+	}
+
+	if strings.TrimSpace(e.text) != "" {
+		add("unexpected text")
+	}
+
+	// Match the children against the sequence in order
+	i := 0
+	for _, child := range decl.content {
+		n := 0
+		for i < len(e.children) && e.children[i].name == child.name && (child.max == 0 || n < child.max) {
+			checkElement(e.children[i], child, path+"/"+child.name, problems)
+			i++
+			n++
+		}
+		if n < child.min {
+			add("missing <%s>", child.name)
+		}
+	}
+	if i < len(e.children) {
+		add("unexpected <%s>", e.children[i].name)
+	}
+}
+
+// checkValue checks simple content against one of the schema types.
+func checkValue(value, typ string) error {
+	switch typ {
+	case "nonNegativeInteger", "positiveInteger":
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a %s", value, typ)
+		}
+		if typ == "positiveInteger" && n == 0 {
+			return fmt.Errorf("%q is not a %s", value, typ)
+		}
+	case "dateTime":
+		if !dateTimePattern.MatchString(strings.TrimSpace(value)) {
+			return fmt.Errorf("%q is not a dateTime", value)
+		}
+	case "empty":
+		if value != "" {
+			return fmt.Errorf("unexpected text")
+		}
+	case "deleted", "preserve":
+		if value != typ {
+			return fmt.Errorf("%q is not %s", value, typ)
+		}
+	}
+	return nil
+}
+
+// checkDocument runs ValidateDocument on a finished output file. Remote
+// outputs would have to be downloaded again, so they aren't checked.
+func checkDocument(path string) error {
+	if IsRemote(path) {
+		log.Printf("strict: not checking remote output %s", path)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ValidateDocument(f)
+}
+
+// deadLetterPage prefixes a page that didn't make it to the output with a
+// comment giving the stage that refused it and the reason, so the dead
+// letter file can be read like any other output.
+func deadLetterPage(page []byte, stage string, reason error) []byte {
+	// "--" isn't allowed within a comment
+	msg := strings.ReplaceAll(reason.Error(), "--", "- -")
+	return append([]byte("<!-- "+stage+": "+msg+" -->\n  "), page...)
+}
@@ -0,0 +1,85 @@
+package xml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingSink keeps the short descriptions of the pages it's given.
+type recordingSink struct {
+	mu           sync.Mutex
+	descriptions []string
+}
+
+func (s *recordingSink) WritePage(p *Page) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.descriptions = append(s.descriptions, p.ShortDescription)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestStrictLeavesOutMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := filepath.Join(dir, "dump.xml")
+	if err := ioutil.WriteFile(dump, []byte(`<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="en">
+  <page>
+    <title>Page 1</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision>
+      <id>10</id>
+      <timestamp>2020-01-01T00:00:00Z</timestamp>
+      <contributor>
+        <username>Someone</username>
+        <id>5</id>
+      </contributor>
+      <model>wikitext</model>
+      <format>text/x-wiki</format>
+      <text xml:space="preserve">{{Short description|A page to test with}}
+Some text.</text>
+      <sha1>abc</sha1>
+    </revision>
+  </page>
+</mediawiki>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "clean.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out.xml")
+	sink := &recordingSink{}
+	w := NewWorker(dump, out, script, 1)
+	w.Strict = true
+	w.Sinks = []Sink{sink}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "shortdescription") {
+		t.Errorf("strict output has the short description:\n%s", b)
+	}
+	if !strings.Contains(string(b), "<title>Page 1</title>") {
+		t.Errorf("strict output lost the page:\n%s", b)
+	}
+	if len(sink.descriptions) != 1 || sink.descriptions[0] != "A page to test with" {
+		t.Errorf("sink got short descriptions %q, want the page's", sink.descriptions)
+	}
+}
@@ -0,0 +1,73 @@
+package xml
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Summarize shortens text longer than maxBytes. The lead section is kept
+// whole and every other section is cut down to its heading and first
+// paragraphs. If that's still too long the text is truncated at a line
+// boundary.
+func Summarize(text string, maxBytes, paragraphs int) string {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text
+	}
+
+	var b strings.Builder
+	kept := 0
+	inLead := true
+	for _, para := range strings.SplitAfter(text, "\n\n") {
+		if isHeading(para) {
+			inLead = false
+			kept = 0
+			b.WriteString(para)
+			// The first paragraph may follow the heading without a blank line
+			if !isHeadingOnly(para) {
+				kept++
+			}
+			continue
+		}
+		if inLead || kept < paragraphs {
+			b.WriteString(para)
+			kept++
+		}
+	}
+
+	return truncate(b.String(), maxBytes)
+}
+
+// isHeading reports whether the paragraph starts with a section heading.
+func isHeading(para string) bool {
+	return strings.HasPrefix(strings.TrimLeft(para, "\n"), "==")
+}
+
+// isHeadingOnly reports whether the paragraph is nothing but a heading.
+func isHeadingOnly(para string) bool {
+	para = strings.TrimSpace(para)
+	return strings.HasPrefix(para, "==") && !strings.Contains(para, "\n")
+}
+
+// truncate cuts the text to at most maxBytes, at the last line break if
+// there is one, otherwise the last space. It won't cut through an XML
+// entity.
+func truncate(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+
+	cut := text[:maxBytes]
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		return cut[:i+1]
+	}
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	if i := strings.LastIndex(cut, "&"); i >= 0 && !strings.Contains(cut[i:], ";") {
+		cut = cut[:i]
+	}
+	return cut
+}
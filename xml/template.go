@@ -0,0 +1,87 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// The namespaces whose pages define what templates expand to.
+const (
+	nsTemplate = "10"
+	nsModule   = "828"
+)
+
+// isTemplateSource reports whether the page is a template or a Lua module.
+func isTemplateSource(p *Page) bool {
+	return p.Ns == nsTemplate || p.Ns == nsModule
+}
+
+// Templates are the template and module definitions harvested from a dump,
+// keyed by their full title (e.g. "Template:Infobox" or "Module:Citation"),
+// with the unescaped wikitext or Lua source.
+type Templates map[string]string
+
+// Lookup returns the definition of a template or module. Names without a
+// namespace are templates, as in {{infobox person}}, and the name is
+// normalized the way MediaWiki does, so "infobox_person" finds
+// "Template:Infobox person".
+func (t Templates) Lookup(name string) (string, bool) {
+	text, ok := t[templateTitle(name)]
+	return text, ok
+}
+
+// templateTitle returns the full title of a template or module name.
+func templateTitle(name string) string {
+	ns := "Template:"
+	if i := strings.Index(name, ":"); i >= 0 {
+		switch strings.ToLower(strings.TrimSpace(name[:i])) {
+		case "template":
+			name = name[i+1:]
+		case "module":
+			ns = "Module:"
+			name = name[i+1:]
+		}
+	}
+	return ns + NormalizeTitle(name)
+}
+
+// ReadTemplates loads the template store written with TemplateFile. Redirects
+// between templates are followed, so every name a template is known by can
+// be looked up.
+func ReadTemplates(path string) (Templates, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if !isCache(r) {
+		return nil, fmt.Errorf("%s: not a template store", path)
+	}
+
+	templates := make(Templates)
+	redirects := make(RedirectMap)
+	err = readCache(r, func(p *Page) {
+		title := NormalizeTitle(p.Title)
+		if target := RedirectTarget(p); target != "" {
+			redirects[title] = NormalizeTitle(html.UnescapeString(target))
+			return
+		}
+		templates[title] = html.UnescapeString(p.Revision.Text.Text)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for title := range redirects {
+		if target, ok := redirects.Resolve(title); ok {
+			if text, ok := templates[target]; ok {
+				templates[title] = text
+			}
+		}
+	}
+	return templates, nil
+}
@@ -0,0 +1,92 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol types, see
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the thrift compact protocol, just enough of it for
+// parquet metadata.
+type thriftWriter struct {
+	buf    bytes.Buffer
+	last   int16
+	nested []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.buf.Write(b[:n])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+// list writes a list header, the elements follow without field headers.
+func (t *thriftWriter) list(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(size))
+	}
+}
+
+// structBegin starts a struct, either as a field (id > 0) or a list element.
+func (t *thriftWriter) structBegin(id int16) {
+	if id > 0 {
+		t.field(id, thriftStruct)
+	}
+	t.nested = append(t.nested, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.nested[len(t.nested)-1]
+	t.nested = t.nested[:len(t.nested)-1]
+}
+
+// str writes a bare string, used for list elements.
+func (t *thriftWriter) str(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
@@ -0,0 +1,96 @@
+package xml
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// skipLinkPrefixes are the (lowercase) namespaces whose links don't point to
+// another article, e.g. files and categories.
+var skipLinkPrefixes = map[string]bool{
+	"file":       true,
+	"image":      true,
+	"media":      true,
+	"category":   true,
+	"template":   true,
+	"wikipedia":  true,
+	"wp":         true,
+	"help":       true,
+	"special":    true,
+	"user":       true,
+	"talk":       true,
+	"portal":     true,
+	"draft":      true,
+	"module":     true,
+	"wikt":       true,
+	"wiktionary": true,
+	"commons":    true,
+}
+
+// NormalizeTitle puts a title in the form used by the dump: spaces instead of
+// underscores, no surrounding or repeated whitespace and an uppercase first
+// letter.
+func NormalizeTitle(title string) string {
+	title = strings.Join(strings.Fields(strings.ReplaceAll(title, "_", " ")), " ")
+	r, size := utf8.DecodeRuneInString(title)
+	if r == utf8.RuneError {
+		return title
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+// linkTarget splits the contents of a [[...]] link into its normalized target
+// title and anchor text. ok is false for links that don't point to another
+// article.
+func linkTarget(link string) (target, anchor string, ok bool) {
+	target = link
+	anchor = link
+	if i := strings.Index(link, "|"); i >= 0 {
+		target = link[:i]
+		anchor = link[i+1:]
+	}
+
+	// Drop the section
+	if i := strings.Index(target, "#"); i >= 0 {
+		target = target[:i]
+	}
+	target = strings.TrimPrefix(strings.TrimSpace(target), ":")
+
+	if i := strings.Index(target, ":"); i >= 0 {
+		prefix := strings.ToLower(strings.TrimSpace(target[:i]))
+		// Namespaces we don't link to and interlanguage links (en:, de:, ...).
+		// Titles like "Alien: Resurrection" have a space after the colon.
+		interlanguage := isLanguageCode(prefix) && !strings.HasPrefix(target[i+1:], " ")
+		if skipLinkPrefixes[prefix] || strings.HasSuffix(prefix, " talk") || interlanguage {
+			return "", "", false
+		}
+	}
+
+	target = NormalizeTitle(target)
+	if target == "" {
+		return "", "", false
+	}
+	return target, strings.TrimSpace(anchor), true
+}
+
+// isLanguageCode is a rough check for interlanguage prefixes like "de" or
+// "zh-yue".
+func isLanguageCode(prefix string) bool {
+	if len(prefix) < 2 || len(prefix) > 12 {
+		return false
+	}
+	base := prefix
+	if i := strings.Index(prefix, "-"); i >= 0 {
+		base = prefix[:i]
+	}
+	if len(base) < 2 || len(base) > 3 {
+		return false
+	}
+	for _, r := range prefix {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,278 @@
+package xml
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Per page spans.
+const (
+	SpanDecode  = "decode"
+	SpanClean   = "clean"
+	SpanMarshal = "marshal"
+	SpanWrite   = "write"
+)
+
+// traceBatch is how many pages are sent to the collector at once.
+const traceBatch = 256
+
+// Tracer exports a trace for each page, with a span for every stage it went
+// through, to an OpenTelemetry collector (or Jaeger) over OTLP/HTTP with
+// JSON encoding, e.g. http://localhost:4318/v1/traces.
+//
+// Only pages taking at least MinDuration from decode to write are exported,
+// so a long run can be traced just for its slow pages. Export errors are
+// logged, never fatal.
+type Tracer struct {
+	URL         string
+	Service     string
+	MinDuration time.Duration
+
+	client *http.Client
+	in     chan *pageTrace
+	done   chan struct{}
+}
+
+// pageTrace collects the spans of one page. It travels with the page, so
+// only one stage touches it at a time.
+type pageTrace struct {
+	title string
+	id    string
+	start time.Time
+	end   time.Time
+	err   string
+	spans []traceSpan
+}
+
+// traceSpan is a single stage of a page.
+type traceSpan struct {
+	name       string
+	start, end time.Time
+}
+
+// NewTracer returns a tracer exporting to url.
+func NewTracer(url, service string, minDuration time.Duration) *Tracer {
+	t := &Tracer{
+		URL:         url,
+		Service:     service,
+		MinDuration: minDuration,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		in:          make(chan *pageTrace, traceBatch),
+		done:        make(chan struct{}),
+	}
+	go t.export()
+	return t
+}
+
+// startPage begins the trace of a page whose decode started at start.
+func (t *Tracer) startPage(p *Page, start time.Time) {
+	if t == nil {
+		return
+	}
+	p.trace = &pageTrace{start: start}
+	p.trace.span(SpanDecode, start)
+}
+
+// span records a stage of the page that started at start and just ended.
+func (pt *pageTrace) span(name string, start time.Time) {
+	if pt == nil {
+		return
+	}
+	pt.spans = append(pt.spans, traceSpan{name: name, start: start, end: time.Now()})
+}
+
+// finish ends the trace of the page and queues it for export. err, if set,
+// marks the page as failed.
+func (t *Tracer) finish(p *Page, err error) {
+	if t == nil || p.trace == nil {
+		return
+	}
+	pt := p.trace
+	pt.end = time.Now()
+	if pt.end.Sub(pt.start) < t.MinDuration {
+		return
+	}
+	pt.title = p.Title
+	pt.id = p.ID
+	if err != nil {
+		pt.err = err.Error()
+	}
+	t.in <- pt
+}
+
+// Close sends the remaining traces.
+func (t *Tracer) Close() error {
+	close(t.in)
+	<-t.done
+	return nil
+}
+
+// export sends the finished traces in batches, at least every few seconds.
+func (t *Tracer) export() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var batch []*pageTrace
+	for {
+		select {
+		case pt, ok := <-t.in:
+			if !ok {
+				t.send(batch)
+				return
+			}
+			batch = append(batch, pt)
+			if len(batch) >= traceBatch {
+				t.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.send(batch)
+			batch = nil
+		}
+	}
+}
+
+// The OTLP/JSON request, just the parts we fill in.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpStatusError is STATUS_CODE_ERROR, otlpKindInternal SPAN_KIND_INTERNAL.
+const (
+	otlpStatusError  = 2
+	otlpKindInternal = 1
+)
+
+// send posts a batch of traces to the collector.
+func (t *Tracer) send(batch []*pageTrace) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var scope otlpScopeSpans
+	scope.Scope.Name = "wikireader_fastparser"
+	for _, pt := range batch {
+		traceID := randomID(16)
+		root := otlpSpan{
+			TraceID: traceID,
+			SpanID:  randomID(8),
+			Name:    "page",
+			Kind:    otlpKindInternal,
+			Start:   unixNano(pt.start),
+			End:     unixNano(pt.end),
+			Attributes: []otlpAttribute{
+				attribute("page.id", pt.id),
+				attribute("page.title", pt.title),
+			},
+		}
+		if pt.err != "" {
+			root.Status = &otlpStatus{Code: otlpStatusError, Message: pt.err}
+		}
+		scope.Spans = append(scope.Spans, root)
+
+		for _, s := range pt.spans {
+			scope.Spans = append(scope.Spans, otlpSpan{
+				TraceID:      traceID,
+				SpanID:       randomID(8),
+				ParentSpanID: root.SpanID,
+				Name:         s.name,
+				Kind:         otlpKindInternal,
+				Start:        unixNano(s.start),
+				End:          unixNano(s.end),
+			})
+		}
+	}
+
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttribute{attribute("service.name", t.Service)}
+	rs.ScopeSpans = []otlpScopeSpans{scope}
+
+	if err := t.post(&otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}); err != nil {
+		log.Printf("error exporting %d traces: %v", len(batch), err)
+	}
+}
+
+// post sends one OTLP request.
+func (t *Tracer) post(req *otlpRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func attribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// randomID returns a random trace or span ID of n bytes, hex encoded.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package xml
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// transliterations are the built in schemes of a Transliterator, each
+// mapping lowercase letters to what's typed for them on a Latin keyboard.
+var transliterations = map[string]map[rune]string{
+	"latin": {
+		'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th", 'ð': "d", 'ĳ': "ij", 'ŋ': "n",
+	},
+	"greek": {
+		'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+		'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+		'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+		'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+		'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+		'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+	},
+	"cyrillic": {
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+		'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+		'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+		'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+		'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+		'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u", 'ђ': "dj",
+		'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+	},
+}
+
+// Transliterator turns titles into search keys: what's typed for them on
+// the device keyboard, so "Łódź" is found by typing "lodz". Keys are
+// lowercase, and combining marks are dropped.
+type Transliterator struct {
+	letters map[rune]string
+}
+
+// ParseTransliteration parses a comma separated list of schemes: latin
+// (accents and ligatures), greek, cyrillic, or file:path for a file of
+// letters and what to type for them, separated by a tab, one per line.
+// Later schemes win where they map the same letter.
+func ParseTransliteration(list string) (*Transliterator, error) {
+	t := &Transliterator{letters: make(map[rune]string)}
+	for _, scheme := range strings.Split(list, ",") {
+		scheme = strings.TrimSpace(scheme)
+		if strings.HasPrefix(scheme, "file:") {
+			if err := t.load(strings.TrimPrefix(scheme, "file:")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		letters, ok := transliterations[scheme]
+		if !ok {
+			return nil, fmt.Errorf("unknown transliteration: %s (expected latin, greek, cyrillic or file:path)", scheme)
+		}
+		if scheme == "latin" {
+			// Accented letters are typed as the letter they're filed under
+			for r, base := range letterFolds {
+				t.letters[r] = string(base)
+			}
+		}
+		for r, s := range letters {
+			t.letters[r] = s
+		}
+	}
+	return t, nil
+}
+
+// load adds the letters in a transliteration file.
+func (t *Transliterator) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	line := 0
+	for s.Scan() {
+		line++
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		fields := strings.SplitN(s.Text(), "\t", 2)
+		letter := strings.ToLower(fields[0])
+		r, size := utf8.DecodeRuneInString(letter)
+		if len(fields) != 2 || size == 0 || size != len(letter) {
+			return fmt.Errorf("%s:%d: expected a letter, a tab and what to type for it", path, line)
+		}
+		t.letters[r] = strings.ToLower(fields[1])
+	}
+	return s.Err()
+}
+
+// Key returns the search key of a title. A nil Transliterator only
+// normalizes the title and lowercases it.
+func (t *Transliterator) Key(title string) string {
+	title = strings.ToLower(NormalizeTitle(title))
+	if t == nil {
+		return title
+	}
+
+	var b strings.Builder
+	for _, r := range title {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if s, ok := t.letters[r]; ok {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package xml
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+)
+
+// tsvFile is a buffered tab separated output file. It's safe for concurrent
+// use.
+type tsvFile struct {
+	mu sync.Mutex
+	f  io.WriteCloser
+	w  *bufio.Writer
+}
+
+// createTSV creates (or truncates) the tsv file at path.
+func createTSV(path string) (*tsvFile, error) {
+	f, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tsvFile{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Write writes a single row. Tabs and newlines within fields are replaced by
+// spaces.
+func (t *tsvFile) Write(fields ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, field := range fields {
+		if i > 0 {
+			if err := t.w.WriteByte('\t'); err != nil {
+				return err
+			}
+		}
+		if strings.ContainsAny(field, "\t\n") {
+			field = strings.NewReplacer("\t", " ", "\n", " ").Replace(field)
+		}
+		if _, err := t.w.WriteString(field); err != nil {
+			return err
+		}
+	}
+	return t.w.WriteByte('\n')
+}
+
+// Close flushes and closes the file.
+func (t *tsvFile) Close() error {
+	if err := t.w.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
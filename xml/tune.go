@@ -0,0 +1,152 @@
+package xml
+
+import (
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tuneInterval is how often the worker count is reconsidered.
+var tuneInterval = 2 * time.Second
+
+// tuner adjusts the number of workers while the reader is running. Workers
+// are added while the reader is held up by them and the CPUs aren't busy,
+// which is the usual state when the parse script does the work, and
+// retired while they're mostly waiting for pages.
+type tuner struct {
+	max    int
+	retire chan struct{}
+
+	// sendWait and recvWait are the nanoseconds the reader spent waiting
+	// for a worker, and the workers spent waiting for a page
+	sendWait int64
+	recvWait int64
+	running  int64
+
+	mu       sync.Mutex
+	readDone bool
+}
+
+// newTuner returns a tuner that won't go above max workers.
+func newTuner(max int) *tuner {
+	return &tuner{max: max, retire: make(chan struct{})}
+}
+
+// tune adjusts the workers every tuneInterval until the reader is done.
+func (w *Worker) tune() {
+	t := w.tuner
+	ticker := time.NewTicker(tuneInterval)
+	defer ticker.Stop()
+
+	lastCPU, haveCPU := cpuTime()
+	last := time.Now()
+	for range ticker.C {
+		now := time.Now()
+		elapsed := now.Sub(last)
+		last = now
+
+		cpu, ok := cpuTime()
+		busy := 0.0
+		if ok && haveCPU {
+			busy = float64(cpu-lastCPU) / float64(elapsed) / float64(runtime.NumCPU())
+		}
+		lastCPU, haveCPU = cpu, ok
+
+		n := atomic.LoadInt64(&t.running)
+		send := float64(atomic.SwapInt64(&t.sendWait, 0)) / float64(elapsed)
+		recv := float64(atomic.SwapInt64(&t.recvWait, 0)) / float64(elapsed) / float64(n)
+
+		switch {
+		case send > 0.5 && busy < 0.9 && int(n) < t.max:
+			// Grow by half again, so a slow script gets enough workers
+			// quickly
+			add := int(n) / 2
+			if add < 1 {
+				add = 1
+			}
+			if int(n)+add > t.max {
+				add = t.max - int(n)
+			}
+			for i := 0; i < add; i++ {
+				if !w.addWorker() {
+					return
+				}
+			}
+			log.Printf("workers: %d (reader waiting %.0f%%, cpu %.0f%%)", int(n)+add, send*100, busy*100)
+		case recv > 0.5 && n > 1:
+			select {
+			case t.retire <- struct{}{}:
+				log.Printf("workers: %d (workers waiting %.0f%%, cpu %.0f%%)", n-1, recv*100, busy*100)
+			default:
+			}
+		}
+
+		t.mu.Lock()
+		done := t.readDone
+		t.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// addWorker starts another worker, unless the reader is already done and
+// the existing workers may have exited.
+func (w *Worker) addWorker() bool {
+	if w.tuner != nil {
+		w.tuner.mu.Lock()
+		defer w.tuner.mu.Unlock()
+		if w.tuner.readDone {
+			return false
+		}
+		atomic.AddInt64(&w.tuner.running, 1)
+	}
+	w.wg.Add(1)
+	go w.startWorker()
+	return true
+}
+
+// sendPage hands a page to the workers, timing the wait for the tuner.
+func (w *Worker) sendPage(p *Page) {
+	if w.tuner == nil {
+		w.InPage <- p
+		return
+	}
+	start := time.Now()
+	w.InPage <- p
+	atomic.AddInt64(&w.tuner.sendWait, int64(time.Since(start)))
+}
+
+// nextPage waits for the next page for a worker. It returns false once the
+// input is done or the tuner retires the worker.
+func (w *Worker) nextPage() (*Page, bool) {
+	if w.tuner == nil {
+		p, ok := <-w.InPage
+		return p, ok
+	}
+
+	start := time.Now()
+	select {
+	case p, ok := <-w.InPage:
+		atomic.AddInt64(&w.tuner.recvWait, int64(time.Since(start)))
+		if !ok {
+			atomic.AddInt64(&w.tuner.running, -1)
+		}
+		return p, ok
+	case <-w.tuner.retire:
+		atomic.AddInt64(&w.tuner.running, -1)
+		return nil, false
+	}
+}
+
+// closeInput tells the workers there are no more pages.
+func (w *Worker) closeInput() {
+	if w.tuner != nil {
+		w.tuner.mu.Lock()
+		w.tuner.readDone = true
+		w.tuner.mu.Unlock()
+	}
+	close(w.InPage)
+}
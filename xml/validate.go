@@ -0,0 +1,278 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultValidateChunk is how much of the file each validation worker
+// takes at a time.
+const DefaultValidateChunk = 16 << 20
+
+// ValidateOptions controls ValidateFile.
+type ValidateOptions struct {
+	// Workers is how many chunks are checked at once
+	Workers int
+	// Chunk is the size of each chunk in bytes
+	Chunk int64
+	// Schema also checks each page against export-0.10, not only that it's
+	// well-formed
+	Schema bool
+}
+
+// ValidateProblem is something wrong at an offset in the file.
+type ValidateProblem struct {
+	Offset  int64
+	Message string
+}
+
+func (p ValidateProblem) String() string {
+	return fmt.Sprintf("offset %d: %s", p.Offset, p.Message)
+}
+
+// ValidateResult is what ValidateFile found, with the problems in file
+// order.
+type ValidateResult struct {
+	Pages    int
+	Problems []ValidateProblem
+}
+
+// ValidateFile checks an xml output for well-formedness and, with
+// opts.Schema, the pages against the export schema. The file is split
+// into chunks checked in parallel: each checks the pages starting in it and
+// what's between them, reading past its end to finish the last. The part
+// before the first page is checked with ValidateDocument.
+func ValidateFile(path string, opts ValidateOptions) (ValidateResult, error) {
+	var result ValidateResult
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return result, err
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Chunk <= 0 {
+		opts.Chunk = DefaultValidateChunk
+	}
+
+	chunks := make(chan int64)
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range chunks {
+				c := &validateChunk{f: f, size: info.Size(), start: start, end: start + opts.Chunk, schema: opts.Schema}
+				err := c.check()
+
+				mu.Lock()
+				result.Pages += c.pages
+				result.Problems = append(result.Problems, c.problems...)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for start := int64(0); start == 0 || start < info.Size(); start += opts.Chunk {
+		chunks <- start
+	}
+	close(chunks)
+	wg.Wait()
+
+	sort.Slice(result.Problems, func(i, j int) bool {
+		return result.Problems[i].Offset < result.Problems[j].Offset
+	})
+	return result, firstErr
+}
+
+// validateChunk checks the pages starting between start and end.
+type validateChunk struct {
+	f          *os.File
+	size       int64
+	start, end int64
+	schema     bool
+	buf        []byte
+	pages      int
+	problems   []ValidateProblem
+}
+
+// more reads another block after what's been read, returning false at the
+// end of the file.
+func (c *validateChunk) more() (bool, error) {
+	from := c.start + int64(len(c.buf))
+	if from >= c.size {
+		return false, nil
+	}
+	n := c.end - from
+	if n <= 0 {
+		n = scanChunk
+	}
+	if from+n > c.size {
+		n = c.size - from
+	}
+	c.buf = append(c.buf, make([]byte, n)...)
+	read, err := c.f.ReadAt(c.buf[len(c.buf)-int(n):], from)
+	c.buf = c.buf[:len(c.buf)-int(n)+read]
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return read > 0, nil
+}
+
+func (c *validateChunk) problem(offset int, format string, args ...interface{}) {
+	c.problems = append(c.problems, ValidateProblem{Offset: c.start + int64(offset), Message: fmt.Sprintf(format, args...)})
+}
+
+// find returns the index found by find in the buffer at or after from, reading
+// more of the file as needed, or -1 if it's not in the rest of the file.
+func (c *validateChunk) find(from int, find func(b []byte) int) (int, error) {
+	for {
+		if i := find(c.buf[from:]); i >= 0 {
+			return from + i, nil
+		}
+		ok, err := c.more()
+		if err != nil || !ok {
+			return -1, err
+		}
+	}
+}
+
+// findPage finds the next <page> or <page ...> tag.
+func findPage(b []byte) int {
+	s := PageScanner{buf: b}
+	return s.findStart()
+}
+
+func (c *validateChunk) check() error {
+	if _, err := c.more(); err != nil {
+		return err
+	}
+
+	pos, err := c.find(0, findPage)
+	if err != nil {
+		return err
+	}
+	if c.start == 0 {
+		if pos < 0 {
+			// No pages at all
+			if err := ValidateDocument(bytes.NewReader(c.buf)); err != nil {
+				c.problem(0, "%v", err)
+			}
+			return nil
+		}
+		head := append(append([]byte(nil), c.buf[:pos]...), "</mediawiki>"...)
+		if err := ValidateDocument(bytes.NewReader(head)); err != nil {
+			c.problem(0, "before the first page: %v", err)
+		}
+	}
+	// Only the pages starting in this chunk are checked here
+	if pos < 0 || c.start+int64(pos) >= c.end {
+		return nil
+	}
+
+	for {
+		end, err := c.find(pos, func(b []byte) int {
+			if i := bytes.Index(b, pageEnd); i >= 0 {
+				return i + len(pageEnd)
+			}
+			return -1
+		})
+		if err != nil {
+			return err
+		}
+		if end < 0 {
+			c.problem(pos, "page isn't closed before the end of the file")
+			return nil
+		}
+		c.checkPage(pos, c.buf[pos:end])
+
+		next, err := c.find(end, findPage)
+		if err != nil {
+			return err
+		}
+		if next < 0 {
+			// The last page, what's left has to close the document
+			if rest := strings.TrimSpace(string(stripComments(c.buf[end:]))); rest != "</mediawiki>" {
+				c.problem(end, "expected </mediawiki> after the last page, found %q", abbreviate(rest))
+			}
+			return nil
+		}
+		if gap := stripComments(c.buf[end:next]); len(bytes.TrimSpace(gap)) > 0 {
+			c.problem(end, "unexpected %q between pages", abbreviate(string(bytes.TrimSpace(gap))))
+		}
+		if c.start+int64(next) >= c.end {
+			return nil
+		}
+		pos = next
+	}
+}
+
+// checkPage checks the page found at offset in the buffer.
+func (c *validateChunk) checkPage(offset int, page []byte) {
+	c.pages++
+	title := string(elementText(page, "title"))
+
+	var err error
+	if c.schema {
+		err = ValidatePage(page)
+	} else {
+		_, err = parseElement(page)
+	}
+	if err == nil {
+		return
+	}
+	if se, ok := err.(*xml.SyntaxError); ok && se.Line > 1 {
+		// Point at the line, not only the page
+		line := offset
+		for n := 1; n < se.Line; n++ {
+			line += bytes.IndexByte(page[line-offset:], '\n') + 1
+		}
+		c.problem(line, "page %q: %v", title, err)
+		return
+	}
+	c.problem(offset, "page %q: %v", title, err)
+}
+
+// stripComments removes the XML comments from b, like the provenance
+// comment at the top of an output.
+func stripComments(b []byte) []byte {
+	if !bytes.Contains(b, []byte("<!--")) {
+		return b
+	}
+	var out []byte
+	for {
+		i := bytes.Index(b, []byte("<!--"))
+		if i < 0 {
+			return append(out, b...)
+		}
+		j := bytes.Index(b[i+4:], []byte("-->"))
+		if j < 0 {
+			return append(out, b...)
+		}
+		out = append(out, b[:i]...)
+		b = b[i+4+j+3:]
+	}
+}
+
+// abbreviate shortens unexpected content for a message.
+func abbreviate(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "..."
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"os"
+	"unicode/utf8"
+)
+
+// VerifyResult is what VerifyArtifact found. Problems describe the entries
+// that failed, each starting with the index line.
+type VerifyResult struct {
+	Entries  int
+	Sampled  int
+	Problems []string
+}
+
+// VerifyArtifact checks an output meant for the device against its offset
+// index: an xml output or shard, or a blob file. Every entry has to point at
+// a whole article inside the file and every title has to resolve to a
+// single entry. samples random entries, chosen with rng, are also read end
+// to end, decoding the page or decompressing the article and comparing it
+// with the index.
+func VerifyArtifact(path, index string, samples int, rng *rand.Rand) (VerifyResult, error) {
+	var result VerifyResult
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return result, err
+	}
+	magic := make([]byte, len(blobMagic))
+	f.ReadAt(magic, 0)
+	blob := bytes.Equal(magic, blobMagic)
+
+	problem := func(line int, e IndexEntry, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		result.Problems = append(result.Problems, fmt.Sprintf("%s:%d: page %s (%s): %s", index, line, e.ID, e.Title, msg))
+	}
+
+	var entries []IndexEntry
+	titles := make(map[string]int)
+	ids := make(map[string]int)
+	err = ReadIndex(index, func(e IndexEntry) error {
+		entries = append(entries, e)
+		line := len(entries)
+
+		t := NormalizeTitle(e.Title)
+		if first, ok := titles[t]; ok {
+			problem(line, e, "title already indexed on line %d", first)
+		} else {
+			titles[t] = line
+		}
+		if first, ok := ids[e.ID]; ok {
+			problem(line, e, "id already indexed on line %d", first)
+		} else {
+			ids[e.ID] = line
+		}
+
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > info.Size() {
+			problem(line, e, "offset %d and length %d are outside the file", e.Offset, e.Length)
+			return nil
+		}
+		if err := checkEntry(f, e, blob); err != nil {
+			problem(line, e, "%v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Entries = len(entries)
+
+	// The start of a random permutation, so no entry is sampled twice
+	order := rng.Perm(len(entries))
+	if samples > len(order) {
+		samples = len(order)
+	}
+	for _, i := range order[:samples] {
+		e := entries[i]
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > info.Size() {
+			continue
+		}
+		result.Sampled++
+		if err := readEntry(f, e, blob); err != nil {
+			problem(i+1, e, "%v", err)
+		}
+	}
+	return result, nil
+}
+
+// checkEntry checks the ends of the article an index entry points at.
+func checkEntry(f *os.File, e IndexEntry, blob bool) error {
+	if blob {
+		var sizes [8]byte
+		if _, err := f.ReadAt(sizes[:], e.Offset); err != nil {
+			return err
+		}
+		if n := int64(binary.LittleEndian.Uint32(sizes[:4])) + int64(len(sizes)); n != e.Length {
+			return fmt.Errorf("the article is %d bytes, not %d", n, e.Length)
+		}
+		return nil
+	}
+
+	head := make([]byte, len(pageStart)+1)
+	tail := make([]byte, len(pageEnd))
+	if _, err := f.ReadAt(head, e.Offset); err != nil {
+		return err
+	}
+	if _, err := f.ReadAt(tail, e.Offset+e.Length-int64(len(tail))); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(head, pageStart) || !bytes.Equal(tail, pageEnd) {
+		return fmt.Errorf("the index doesn't point at a page")
+	}
+	return nil
+}
+
+// readEntry reads and decodes the article an index entry points at.
+func readEntry(f *os.File, e IndexEntry, blob bool) error {
+	if blob {
+		text, err := ReadBlobArticle(f, e.Offset)
+		if err != nil {
+			return err
+		}
+		if !utf8.ValidString(text) {
+			return fmt.Errorf("the article isn't valid UTF-8")
+		}
+		return nil
+	}
+
+	raw := make([]byte, e.Length)
+	if _, err := f.ReadAt(raw, e.Offset); err != nil {
+		return err
+	}
+	var p Page
+	if err := xml.Unmarshal(raw, &p); err != nil {
+		return err
+	}
+	if p.ID != e.ID || p.Title != e.Title {
+		return fmt.Errorf("the page is %s (%s)", p.ID, p.Title)
+	}
+	return nil
+}
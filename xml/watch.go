@@ -0,0 +1,89 @@
+package xml
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// inputs returns the files to read, in order. In watch mode they arrive as
+// they appear in WatchDir.
+func (w *Worker) inputs() <-chan string {
+	out := make(chan string)
+	if w.WatchDir != "" {
+		go w.watch(out)
+		return out
+	}
+
+	inputs := w.InputFiles
+	if len(inputs) == 0 {
+		inputs = []string{w.InputFile}
+	}
+	go func() {
+		for _, input := range inputs {
+			out <- input
+		}
+		close(out)
+	}()
+	return out
+}
+
+// watch polls WatchDir for files matching WatchPattern. A file is only
+// handed on once its size stops changing between polls, so partially
+// downloaded chunks are left alone. Watching ends when the WatchDone marker
+// file appears or nothing new has arrived for WatchIdle.
+func (w *Worker) watch(out chan<- string) {
+	defer close(out)
+
+	sent := make(map[string]bool)
+	sizes := make(map[string]int64)
+	lastNew := time.Now()
+
+	for {
+		// Check for the marker before listing, so a chunk that finished just
+		// before it was created is still picked up
+		finished := false
+		if w.WatchDone != "" {
+			if _, err := os.Stat(filepath.Join(w.WatchDir, w.WatchDone)); err == nil {
+				finished = true
+			}
+		}
+
+		matches, err := filepath.Glob(filepath.Join(w.WatchDir, w.WatchPattern))
+		if err != nil {
+			panic(err)
+		}
+
+		pending := 0
+		for _, m := range matches {
+			if sent[m] {
+				continue
+			}
+			info, err := os.Stat(m)
+			if err != nil {
+				continue
+			}
+
+			if size, ok := sizes[m]; ok && size == info.Size() {
+				sent[m] = true
+				lastNew = time.Now()
+				out <- m
+				continue
+			}
+			sizes[m] = info.Size()
+			pending++
+		}
+
+		if finished && pending == 0 {
+			log.Println("watch: done marker found")
+			return
+		}
+		if w.WatchIdle > 0 && pending == 0 && time.Since(lastNew) > w.WatchIdle {
+			log.Printf("watch: nothing new for %s", w.WatchIdle)
+			return
+		}
+
+		time.Sleep(w.WatchInterval)
+	}
+}
@@ -0,0 +1,171 @@
+package xml
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policies for when the run stalls.
+const (
+	// StallAbort logs what's running and every goroutine's stack, then
+	// gives up
+	StallAbort = "abort"
+	// StallKill kills the scripts that have been running for longer than
+	// StallTimeout, failing their pages so the workers can carry on. If
+	// there are none it aborts.
+	StallKill = "kill"
+)
+
+// ValidStallPolicy returns an error if the policy isn't one we know.
+func ValidStallPolicy(policy string) error {
+	switch policy {
+	case StallAbort, StallKill:
+		return nil
+	}
+	return fmt.Errorf("unknown stall policy: %s", policy)
+}
+
+// watchdog notices when the run stops making progress: nothing read and no
+// page finished for StallTimeout, say because a script hung or a stage is
+// deadlocked.
+type watchdog struct {
+	w       *Worker
+	mu      sync.Mutex
+	running map[*exec.Cmd]runningScript
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// runningScript is a parse script cleaning a page.
+type runningScript struct {
+	p     *Page
+	start time.Time
+}
+
+// startWatchdog starts watching the run's progress until stop is called.
+func (w *Worker) startWatchdog() *watchdog {
+	d := &watchdog{
+		w:       w,
+		running: make(map[*exec.Cmd]runningScript),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go d.watch()
+	return d
+}
+
+// activity is what changes while the run is making progress.
+func (d *watchdog) activity() int64 {
+	s := d.w.Progress.Snapshot()
+	return s.BytesRead + s.Written + s.Dropped + s.Failed
+}
+
+func (d *watchdog) watch() {
+	defer close(d.stopped)
+
+	timeout := d.w.StallTimeout
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	last := d.activity()
+	lastChange := time.Now()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if now := d.activity(); now != last {
+			last = now
+			lastChange = time.Now()
+			continue
+		}
+		if time.Since(lastChange) < timeout {
+			continue
+		}
+
+		log.Printf("stalled: no progress for %s", time.Since(lastChange).Round(time.Second))
+		d.logRunning()
+		if d.w.StallPolicy == StallKill && d.kill() > 0 {
+			// Give the workers another StallTimeout to get going again
+			lastChange = time.Now()
+			continue
+		}
+		log.Println("stalled: goroutines:")
+		pprof.Lookup("goroutine").WriteTo(log.Writer(), 2)
+		panic(fmt.Errorf("stalled: no progress for %s", timeout))
+	}
+}
+
+// logRunning logs the scripts still running, longest first.
+func (d *watchdog) logRunning() {
+	d.mu.Lock()
+	scripts := make([]runningScript, 0, len(d.running))
+	for _, s := range d.running {
+		scripts = append(scripts, s)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].start.Before(scripts[j].start)
+	})
+	for _, s := range scripts {
+		log.Printf("stalled: cleaning page %s (%s) for %s", s.p.ID, s.p.Title, time.Since(s.start).Round(time.Second))
+	}
+}
+
+// kill kills the scripts running for longer than StallTimeout, returning
+// how many there were.
+func (d *watchdog) kill() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	killed := 0
+	for cmd, s := range d.running {
+		if time.Since(s.start) < d.w.StallTimeout {
+			continue
+		}
+		log.Printf("stalled: killing the script cleaning page %s (%s)", s.p.ID, s.p.Title)
+		if err := cmd.Process.Kill(); err != nil {
+			log.Printf("stalled: %v", err)
+			continue
+		}
+		killed++
+	}
+	return killed
+}
+
+// started notes a script that started cleaning p.
+func (d *watchdog) started(cmd *exec.Cmd, p *Page) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.running[cmd] = runningScript{p: p, start: time.Now()}
+	d.mu.Unlock()
+}
+
+// finished notes a script that's exited.
+func (d *watchdog) finished(cmd *exec.Cmd) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	delete(d.running, cmd)
+	d.mu.Unlock()
+}
+
+// close stops the watchdog, once the pipeline is done.
+func (d *watchdog) close() {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+}
@@ -0,0 +1,90 @@
+package xml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Whitespace says how the whitespace of the text is normalized once it's
+// cleaned. The line breaks within the text are kept, only the runs of them
+// are collapsed.
+type Whitespace struct {
+	// CRLF turns \r\n and lone \r line breaks into \n
+	CRLF bool
+	// TrimTrailing removes the spaces and tabs at the end of each line
+	TrimTrailing bool
+	// CollapseBlank collapses runs of blank lines into one, and drops them
+	// at the start and end of the text
+	CollapseBlank bool
+}
+
+// ParseWhitespace parses the normalizations separated by commas: crlf,
+// trim-trailing and collapse-blank, or all of them.
+func ParseWhitespace(s string) (*Whitespace, error) {
+	ws := &Whitespace{}
+	for _, opt := range strings.Split(s, ",") {
+		switch opt {
+		case "crlf":
+			ws.CRLF = true
+		case "trim-trailing":
+			ws.TrimTrailing = true
+		case "collapse-blank":
+			ws.CollapseBlank = true
+		case "all":
+			ws.CRLF, ws.TrimTrailing, ws.CollapseBlank = true, true, true
+		default:
+			return nil, fmt.Errorf("unknown whitespace normalization: %s (expected crlf, trim-trailing, collapse-blank or all)", opt)
+		}
+	}
+	return ws, nil
+}
+
+// Normalize returns the text with its whitespace normalized. A nil
+// Whitespace leaves it as it is.
+func (ws *Whitespace) Normalize(text string) string {
+	if ws == nil {
+		return text
+	}
+	if ws.CRLF && strings.Contains(text, "\r") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	if !ws.TrimTrailing && !ws.CollapseBlank {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	blank := 0
+	for _, line := range lines {
+		if ws.TrimTrailing {
+			// Before the \r of a CRLF that's kept
+			cr := strings.HasSuffix(line, "\r")
+			line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+			if cr {
+				line += "\r"
+			}
+		}
+		if ws.CollapseBlank && strings.TrimSpace(line) == "" {
+			blank++
+			continue
+		}
+		if blank > 0 && len(kept) > 0 {
+			kept = append(kept, "")
+		}
+		blank = 0
+		kept = append(kept, line)
+	}
+	if !ws.CollapseBlank {
+		return strings.Join(kept, "\n")
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	// The text still ends with a line break if it had one
+	out := strings.Join(kept, "\n")
+	if strings.HasSuffix(text, "\n") {
+		out += "\n"
+	}
+	return out
+}
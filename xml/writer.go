@@ -0,0 +1,199 @@
+package xml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+)
+
+// siteinfo is the <siteinfo> of every output. We don't preserve the one
+// from the dump, just a dummy one.
+type siteinfo struct {
+	XMLName    xml.Name    `xml:"siteinfo"`
+	Sitename   string      `xml:"sitename"`
+	DBName     string      `xml:"dbname"`
+	Base       string      `xml:"base"`
+	Generator  string      `xml:"generator"`
+	Case       string      `xml:"case"`
+	Namespaces []namespace `xml:"namespaces>namespace"`
+}
+
+type namespace struct {
+	Key  int    `xml:"key,attr"`
+	Case string `xml:"case,attr"`
+	Name string `xml:",chardata"`
+}
+
+var site = siteinfo{
+	Sitename:  "Wikipedia",
+	DBName:    "enwiki",
+	Base:      "https://en.wikipedia.org/wiki/Main_Page",
+	Generator: "MediaWiki 1.35.0-wmf.31",
+	Case:      "first-letter",
+	Namespaces: []namespace{
+		{-2, "first-letter", "Media"},
+		{-1, "first-letter", "Special"},
+		{0, "first-letter", ""},
+		{1, "first-letter", "Talk"},
+		{2, "first-letter", "User"},
+		{3, "first-letter", "User talk"},
+		{4, "first-letter", "Wikipedia"},
+		{5, "first-letter", "Wikipedia talk"},
+		{6, "first-letter", "File"},
+		{7, "first-letter", "File talk"},
+		{8, "first-letter", "MediaWiki"},
+		{9, "first-letter", "MediaWiki talk"},
+		{10, "first-letter", "Template"},
+		{11, "first-letter", "Template talk"},
+		{12, "first-letter", "Help"},
+		{13, "first-letter", "Help talk"},
+		{14, "first-letter", "Category"},
+		{15, "first-letter", "Category talk"},
+		{100, "first-letter", "Portal"},
+		{101, "first-letter", "Portal talk"},
+		{108, "first-letter", "Book"},
+		{109, "first-letter", "Book talk"},
+		{118, "first-letter", "Draft"},
+		{119, "first-letter", "Draft talk"},
+		{446, "first-letter", "Education Program"},
+		{447, "first-letter", "Education Program talk"},
+		{710, "first-letter", "TimedText"},
+		{711, "first-letter", "TimedText talk"},
+		{828, "first-letter", "Module"},
+		{829, "first-letter", "Module talk"},
+		{2300, "first-letter", "Gadget"},
+		{2301, "first-letter", "Gadget talk"},
+		{2302, "case-sensitive", "Gadget definition"},
+		{2303, "case-sensitive", "Gadget definition talk"},
+	},
+}
+
+// root is the document element of every output.
+var root = xml.StartElement{
+	Name: xml.Name{Local: "mediawiki"},
+	Attr: []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: "http://www.mediawiki.org/xml/export-0.10/"},
+		{Name: xml.Name{Local: "xmlns:xsi"}, Value: "http://www.w3.org/2001/XMLSchema-instance"},
+		{Name: xml.Name{Local: "xsi:schemaLocation"}, Value: "http://www.mediawiki.org/xml/export-0.10/ http://www.mediawiki.org/xml/export-0.10.xsd"},
+		{Name: xml.Name{Local: "version"}, Value: "0.10"},
+		{Name: xml.Name{Local: "xml:lang"}, Value: "en"},
+	},
+}
+
+// docBuffer is how much of the document is buffered between writes.
+const docBuffer = 256 << 10
+
+// docWriter writes an output document. The head and footer go through an
+// xml.Encoder, which escapes them and makes sure the root element is
+// closed. Pages are marshaled on their own, usually in parallel by the
+// workers, and copied in whole on a new line each.
+type docWriter struct {
+	w      *bufio.Writer
+	enc    *xml.Encoder
+	indent string
+
+	// provenance, if set, is stamped at the top of the document
+	provenance *Provenance
+
+	// offset is how much of the document has been written
+	offset int64
+
+	// discard drops what's written, to restore the encoder's state when
+	// resuming after the head
+	discard bool
+}
+
+// newDocWriter returns a writer indenting the head and raw pages with
+// indent, or not at all if it's empty.
+func newDocWriter(w io.Writer, indent string) *docWriter {
+	d := &docWriter{w: bufio.NewWriterSize(w, docBuffer), indent: indent}
+	d.enc = xml.NewEncoder(d)
+	d.enc.Indent("", indent)
+	return d
+}
+
+// Write implements io.Writer for the encoder.
+func (d *docWriter) Write(b []byte) (int, error) {
+	if d.discard {
+		return len(b), nil
+	}
+	n, err := d.w.Write(b)
+	d.offset += int64(n)
+	return n, err
+}
+
+// head writes the start of the root element and the siteinfo.
+func (d *docWriter) head() error {
+	if err := d.enc.EncodeToken(root); err != nil {
+		return err
+	}
+	if d.provenance != nil {
+		// The encoder doesn't indent comments
+		if d.indent != "" {
+			if err := d.enc.Flush(); err != nil {
+				return err
+			}
+			if _, err := d.Write([]byte("\n" + d.indent)); err != nil {
+				return err
+			}
+		}
+		if err := d.enc.EncodeToken(xml.Comment(d.provenance.comment())); err != nil {
+			return err
+		}
+	}
+	if err := d.enc.Encode(site); err != nil {
+		return err
+	}
+	return d.enc.Flush()
+}
+
+// resume carries on a document whose head, and everything up to offset, was
+// written by an earlier run.
+func (d *docWriter) resume(offset int64) error {
+	d.discard = true
+	err := d.head()
+	d.discard = false
+	d.offset = offset
+	return err
+}
+
+// page writes a marshaled page on a new line, returning where it starts.
+func (d *docWriter) page(b []byte) (int64, error) {
+	if err := d.w.WriteByte('\n'); err != nil {
+		return 0, err
+	}
+	d.offset++
+	start := d.offset
+	_, err := d.Write(b)
+	return start, err
+}
+
+// rawPage writes a page copied from another document, indented like a
+// marshaled one, returning where it starts.
+func (d *docWriter) rawPage(b []byte) (int64, error) {
+	if _, err := d.page([]byte(d.indent)); err != nil {
+		return 0, err
+	}
+	start := d.offset
+	_, err := d.Write(b)
+	return start, err
+}
+
+// flush writes out what's buffered.
+func (d *docWriter) flush() error {
+	return d.w.Flush()
+}
+
+// end closes the root element and flushes the document.
+func (d *docWriter) end() error {
+	if err := d.enc.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	if err := d.enc.Flush(); err != nil {
+		return err
+	}
+	if _, err := d.Write([]byte("\n")); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
@@ -0,0 +1,62 @@
+package xml
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterKeepsLineBreaks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	text := "First line.\nSecond line.\n\n== Section ==\n* item &amp; more\n"
+	dump := filepath.Join(dir, "dump.xml")
+	if err := ioutil.WriteFile(dump, []byte(`<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="en">
+  <page>
+    <title>Lines</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision>
+      <id>10</id>
+      <text xml:space="preserve">`+text+`</text>
+    </revision>
+  </page>
+</mediawiki>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out.xml")
+	w := NewWorker(dump, out, "", 1)
+	w.Extract = true
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "&#xA;") || !strings.Contains(string(b), text) {
+		t.Errorf("output doesn't have the text with its line breaks:\n%s", b)
+	}
+
+	var doc struct {
+		Pages []struct {
+			Text string `xml:"revision>text"`
+		} `xml:"page"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(text, "&amp;", "&", -1); len(doc.Pages) != 1 || doc.Pages[0].Text != want {
+		t.Errorf("decoded output = %+v, want the text %q", doc.Pages, want)
+	}
+}
@@ -1,13 +1,23 @@
+// Package xml reads MediaWiki XML dumps and processes their pages for the
+// WikiReader. Worker runs the whole pipeline from dumps to outputs; the
+// readers, cleaners and sinks it's built from can be used on their own.
 package xml
 
 import (
-	"bytes"
+	"bufio"
+	"crypto/sha256"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
 	"log"
 	"os"
-	"os/exec"
+	"regexp"
+	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 var parseXMLScript string
@@ -15,137 +25,998 @@ var parseXMLScript string
 // Page is a wikimedia xml page
 type Page struct {
 	XMLName  xml.Name `xml:"page"`
-	Text     string   `xml:",chardata"`
 	Title    string   `xml:"title"`
 	Ns       string   `xml:"ns"`
 	ID       string   `xml:"id"`
-	Redirect struct {
-		Text  string `xml:",chardata"`
-		Title string `xml:"title,attr"`
-	} `xml:"redirect"`
+	Redirect Redirect `xml:"redirect"`
 	Revision struct {
-		Chardata    string `xml:",chardata"`
-		ID          string `xml:"id"`
-		Parentid    string `xml:"parentid"`
-		Timestamp   string `xml:"timestamp"`
-		Contributor struct {
-			Text     string `xml:",chardata"`
-			Username string `xml:"username"`
-			ID       string `xml:"id"`
-		} `xml:"contributor"`
-		Comment string `xml:"comment"`
-		Model   string `xml:"model"`
-		Format  string `xml:"format"`
-		Text    struct {
-			Text  string `xml:",innerxml"`
-			Bytes string `xml:"bytes,attr"`
-			Space string `xml:"space,attr"`
-		} `xml:"text"`
-		Sha1 string `xml:"sha1"`
+		ID          string      `xml:"id"`
+		Parentid    string      `xml:"parentid,omitempty"`
+		Timestamp   string      `xml:"timestamp"`
+		Contributor Contributor `xml:"contributor"`
+		Comment     string      `xml:"comment,omitempty"`
+		Model       string      `xml:"model"`
+		Format      string      `xml:"format"`
+		Text        Text        `xml:"text"`
+		Sha1        string      `xml:"sha1"`
 	} `xml:"revision"`
+
+	// Categories are collected before cleaning, which may remove the links
+	Categories []string `xml:"-"`
+	// ShortDescription, Coordinates and Biography are collected before
+	// cleaning too. They aren't part of the export format, so they're
+	// written after the revision.
+	ShortDescription string       `xml:"shortdescription,omitempty"`
+	Coordinates      *Coordinates `xml:"coordinates,omitempty"`
+	Biography        *Biography   `xml:"biography,omitempty"`
+
+	// Processing is set with Worker.PageProvenance
+	Processing *Processing `xml:"processing,omitempty"`
+	// OriginalText is the text as it was read, before cleaning, set with
+	// Worker.KeepOriginalText
+	OriginalText *Text `xml:"originaltext,omitempty"`
+
+	// Dictionary is collected before cleaning from the pages of projects
+	// that are dictionaries. See DictionaryEntries.
+	Dictionary []DictionaryEntry `xml:"-"`
+
+	trace  *pageTrace
+	fields Fields
+	// seq and lint are kept until the page takes its turn. See takeTurn.
+	seq  int64
+	lint []string
+	// stderr is what the script wrote to stderr while cleaning the page
+	stderr string
+	// media are the files in the page's galleries, for the image manifest
+	media []Media
+	// dumpID is the page's ID in the dump, when IDMapFile replaces it
+	dumpID string
 }
 
-// seen is used for tracking a list of titles we've seen
-var seen = make([]string, 0)
-
-// We don't preserve the XML head from the file, just a dummy one.
-var head = []byte(`
-<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.mediawiki.org/xml/export-0.10/ http://www.mediawiki.org/xml/export-0.10.xsd" version="0.10" xml:lang="en">
-    <sitename>Wikipedia</sitename>
-    <dbname>enwiki</dbname>
-    <base>https://en.wikipedia.org/wiki/Main_Page</base>
-    <generator>MediaWiki 1.35.0-wmf.31</generator>
-    <case>first-letter</case>
-    <namespaces>
-      <namespace key="-2" case="first-letter">Media</namespace>
-      <namespace key="-1" case="first-letter">Special</namespace>
-      <namespace key="0" case="first-letter" />
-      <namespace key="1" case="first-letter">Talk</namespace>
-      <namespace key="2" case="first-letter">User</namespace>
-      <namespace key="3" case="first-letter">User talk</namespace>
-      <namespace key="4" case="first-letter">Wikipedia</namespace>
-      <namespace key="5" case="first-letter">Wikipedia talk</namespace>
-      <namespace key="6" case="first-letter">File</namespace>
-      <namespace key="7" case="first-letter">File talk</namespace>
-      <namespace key="8" case="first-letter">MediaWiki</namespace>
-      <namespace key="9" case="first-letter">MediaWiki talk</namespace>
-      <namespace key="10" case="first-letter">Template</namespace>
-      <namespace key="11" case="first-letter">Template talk</namespace>
-      <namespace key="12" case="first-letter">Help</namespace>
-      <namespace key="13" case="first-letter">Help talk</namespace>
-      <namespace key="14" case="first-letter">Category</namespace>
-      <namespace key="15" case="first-letter">Category talk</namespace>
-      <namespace key="100" case="first-letter">Portal</namespace>
-      <namespace key="101" case="first-letter">Portal talk</namespace>
-      <namespace key="108" case="first-letter">Book</namespace>
-      <namespace key="109" case="first-letter">Book talk</namespace>
-      <namespace key="118" case="first-letter">Draft</namespace>
-      <namespace key="119" case="first-letter">Draft talk</namespace>
-      <namespace key="446" case="first-letter">Education Program</namespace>
-      <namespace key="447" case="first-letter">Education Program talk</namespace>
-      <namespace key="710" case="first-letter">TimedText</namespace>
-      <namespace key="711" case="first-letter">TimedText talk</namespace>
-      <namespace key="828" case="first-letter">Module</namespace>
-      <namespace key="829" case="first-letter">Module talk</namespace>
-      <namespace key="2300" case="first-letter">Gadget</namespace>
-      <namespace key="2301" case="first-letter">Gadget talk</namespace>
-      <namespace key="2302" case="case-sensitive">Gadget definition</namespace>
-      <namespace key="2303" case="case-sensitive">Gadget definition talk</namespace>
-    </namespaces>
-  </siteinfo>
- `)
+// sourceID returns the page's ID in the dump.
+func (p *Page) sourceID() string {
+	if p.dumpID != "" {
+		return p.dumpID
+	}
+	return p.ID
+}
+
+// Contributor is who made a revision, a user or an IP address.
+type Contributor struct {
+	Username string `xml:"username,omitempty"`
+	ID       string `xml:"id,omitempty"`
+	IP       string `xml:"ip,omitempty"`
+}
+
+// Text is the wikitext of a revision, kept escaped as it was in the XML.
+type Text struct {
+	Text  string `xml:",innerxml"`
+	Bytes string `xml:"bytes,attr,omitempty"`
+	Space string `xml:"http://www.w3.org/XML/1998/namespace space,attr,omitempty"`
+}
+
+// Redirect is the target of a redirect page. It's left out of the output
+// for other pages.
+type Redirect struct {
+	Title string `xml:"title,attr"`
+}
+
+// MarshalXML implements xml.Marshaler.
+func (r Redirect) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if r.Title == "" {
+		return nil
+	}
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "title"}, Value: r.Title})
+	return e.EncodeElement(struct{}{}, start)
+}
 
 // Worker is a single XML parser worker.
 type Worker struct {
 	InPage      chan *Page
 	OutText     chan []byte
+	OutDisambig chan []byte
 	OutputFile  string
 	InputFile   string
 	ParseScript string
+
+	// Encoding decides how invalid UTF-8 and characters not allowed in XML
+	// are fixed in the input and the cleaned text.
+	Encoding string
+
+	// ScriptPrefix, if set, is the command the parse scripts are run with,
+	// e.g. a virtualenv's python. Without it the scripts that can't be run
+	// themselves are run with the interpreter ScriptInterpreter finds for
+	// them. ScriptArgs and ScriptEnv ("NAME=value")
+	// are passed to them, with {title}, {ns}, {id} and {revision} replaced
+	// by the page's.
+	ScriptPrefix []string
+	ScriptArgs   []string
+	ScriptEnv    []string
+
+	// CleanService, if set, cleans the pages in place of the parse script.
+	// LintScript is still run as a script.
+	CleanService *CleanService
+
+	// InputFiles, if set, are read in order instead of InputFile as a single
+	// run, e.g. the pieces of a split dump
+	InputFiles []string
+
+	// WatchDir, if set, is polled every WatchInterval for new inputs
+	// matching WatchPattern instead of reading InputFiles. See watch.
+	WatchDir      string
+	WatchPattern  string
+	WatchInterval time.Duration
+	WatchIdle     time.Duration
+	WatchDone     string
+
+	// CollisionPolicy decides which of the pages sharing a title is kept.
+	// Every page with a shared title is listed in CollisionFile, if set.
+	CollisionPolicy string
+	CollisionFile   string
+
+	// DisambigPolicy decides what happens to disambiguation pages. With
+	// DisambigSeparate they're written to DisambigFile instead.
+	DisambigPolicy string
+	DisambigFile   string
+
+	// Config is the optional config file, nil if none was given
+	Config *Config
+
+	// TitleFilter, if set, only keeps the pages whose titles match it, and
+	// SkipRedirects drops redirects. Like the namespaces skipped by Config
+	// they're applied before pages are decoded, and before deduplication.
+	TitleFilter   *regexp.Regexp
+	SkipRedirects bool
+
+	// IDRange, if set, only keeps the pages with IDs in the range. It's
+	// applied with the filters above.
+	IDRange *IDRange
+
+	// SkipListFile, if set, keeps the pages that failed to clean so later
+	// runs skip them with the filters above, unless RetrySkipList is set.
+	// See skipList.
+	SkipListFile  string
+	RetrySkipList bool
+
+	// LogSkips logs each page skipped by the filters or deduplication,
+	// instead of how many were skipped for each reason every minute
+	LogSkips bool
+
+	// ModelPolicy decides what happens to the pages whose content model
+	// isn't wikitext. See IsWikitext.
+	ModelPolicy string
+
+	// Project, if set, adapts the run to a project other than Wikipedia,
+	// taking its markup out of the pages before they're cleaned. Its
+	// namespaces are applied through Config. See Project.Config.
+	Project *Project
+
+	// CategoryFile, if set, receives the page to category edges as TSV
+	CategoryFile string
+
+	// LinkFile, if set, receives the page to page link edges as TSV, with
+	// the anchor text as a fourth column if LinkAnchors is set
+	LinkFile    string
+	LinkAnchors bool
+
+	// FollowRedirects points the links in the cleaned text past redirects,
+	// straight to the article. The redirects are collected from the inputs
+	// before they're read, unless LinkResolver is already set.
+	FollowRedirects bool
+	LinkResolver    LinkResolver
+
+	// TemplateFile, if set, receives the template and module pages as a
+	// page cache, whatever happens to them in the output, so template
+	// expansion can use the definitions from the same dump. See
+	// ReadTemplates.
+	TemplateFile string
+
+	// StripContributors, if set, removes who made each revision from the
+	// outputs or replaces them with a pseudonym keyed by ContributorKey.
+	StripContributors string
+	ContributorKey    []byte
+
+	// Fields, if set, are the only page fields written to the outputs
+	Fields Fields
+
+	// Indent is how many spaces each level of the xml output is indented
+	// by. Pages are written on a single line if it's 0.
+	Indent int
+
+	// IndexFile, if set, receives the offset table of OutputFile, so single
+	// pages can be looked up with LookupPages
+	IndexFile string
+
+	// SortedIndexFile, if set, receives IndexFile sorted by title with an
+	// external sort bounded by SortOptions, or by search key with
+	// SearchKeys. See SortIndex.
+	SortedIndexFile string
+	SortOptions     SortOptions
+	SearchKeys      *Transliterator
+
+	// SortByTitle writes the xml output sorted by title, in the order of
+	// SortedIndexFile, instead of the order the pages were read in. It's
+	// written next to OutputFile first and sorted at the end of the run.
+	// See sortOutput.
+	SortByTitle bool
+
+	// ChecksumFile, if set, receives the SHA-256 of each output file and of
+	// the overall content
+	ChecksumFile string
+
+	// GeoIndexFile, if set, lists the pages written with coordinates by
+	// geohash, for finding nearby pages. See PageCoordinates.
+	GeoIndexFile string
+
+	// PhoneticIndexFile, if set, lists the Soundex and Double Metaphone keys
+	// of the titles written, for "did you mean" suggestions. See Soundex.
+	PhoneticIndexFile string
+
+	// Split, if set, divides the pages between several output files by
+	// hashing their ID. Each set is written next to OutputFile.
+	Split []Split
+
+	// Partition, if set, divides the pages between shards by title instead.
+	// Each shard also gets its own index if IndexFile is set.
+	Partition *Partition
+
+	// ContentFilter, if set, flags unsuitable pages after cleaning and
+	// FilterAction decides what happens to them. Flagged pages that are kept
+	// are listed in FilterTagFile.
+	ContentFilter ContentFilter
+	FilterAction  string
+	FilterTagFile string
+
+	// Whitespace, if set, normalizes the whitespace of the cleaned text
+	Whitespace *Whitespace
+
+	// HTMLSanitizer, if set, strips the HTML tags it doesn't allow from the
+	// cleaned text for the xml output and the sinks. SinkFilter can set
+	// another one for a single sink.
+	HTMLSanitizer *HTMLSanitizer
+
+	// MaxArticleBytes, if set, summarizes longer articles down to the lead
+	// and the first SectionParagraphs paragraphs of each section
+	MaxArticleBytes   int
+	SectionParagraphs int
+
+	// NearDupDistance, if set, finds pages whose cleaned text has a SimHash
+	// within this many bits of an earlier page. They are listed in
+	// NearDupFile and dropped if DropNearDups is set.
+	NearDupDistance int
+	NearDupFile     string
+	DropNearDups    bool
+
+	// Strict checks every page written to the xml output against the
+	// export schema, and each output file once it's complete. Pages that
+	// don't conform go to DeadLetterFile, or stop the run if it isn't set.
+	// The metadata collected from the pages, which the schema has no place
+	// for, is left out of the xml output and only reaches the sinks.
+	// Pages the parse script still fails on after ScriptRetries reruns go
+	// there too, as they were read, with or without Strict.
+	Strict         bool
+	DeadLetterFile string
+	ScriptRetries  int
+
+	// LintFile, if set, lists the pages with wikitext syntax problems, and
+	// LintScript, if set, cleans them instead of the parse script. See Lint.
+	LintFile   string
+	LintScript string
+
+	// DiagnosticsFile, if set, lists the pages the script wrote to stderr
+	// for, whether it succeeded with warnings or failed, with what it
+	// wrote. Stderr is never part of the text.
+	DiagnosticsFile string
+
+	// GalleryPolicy is what's done with the galleries and image maps in the
+	// text of the pages that are cleaned, before the parse script sees
+	// them. ImageManifestFile, if set, lists the files in them. See
+	// Galleries.
+	GalleryPolicy     string
+	ImageManifestFile string
+
+	// ExtensionTags are the policies for extension tags like hiero, score
+	// and timeline in the text of the pages that are cleaned, applied
+	// before the parse script sees them, over those of Config. Tags that
+	// aren't listed are kept. See DefaultExtensionTags.
+	ExtensionTags map[string]string
+
+	// SlowThreshold, if set, moves pages still being cleaned after this
+	// long to a slow lane of SlowLaneSlots, so a few huge pages can't hold
+	// up all of the workers. They're listed in SlowFile, if set, and the
+	// log at the end of the run.
+	SlowThreshold time.Duration
+	SlowLaneSlots int
+	SlowFile      string
+
+	// StallTimeout, if set, is how long the run can go without reading
+	// anything or finishing a page before StallPolicy is applied, instead
+	// of hanging. See watchdog.
+	StallTimeout time.Duration
+	StallPolicy  string
+
+	// ReadAhead, if set, is how many blocks of a compressed input are
+	// decompressed ahead of the parser, on a goroutine of their own
+	ReadAhead int
+
+	// Mmap maps the local uncompressed inputs into memory rather than
+	// reading them, keeping them mapped for each pass over them. With
+	// Encoding off the page scanner works over the mapping in place.
+	Mmap bool
+
+	// CleanCacheDir, if set, keeps the parse script output for each
+	// revision, so later runs only clean revisions they haven't seen
+	CleanCacheDir string
+
+	// Deterministic makes runs over the same inputs with the same settings
+	// write the same bytes: the workers finish pages in input order, and
+	// the reports they write are in that order too. See sequencer. It can't
+	// be used with SlowThreshold, whose pages would hold up the rest.
+	Deterministic bool
+
+	// DecodeWorkers, if more than one, decode the input in parallel after
+	// splitting it into pages with a PageScanner. WriteWorkers, if set,
+	// marshal the processed pages in their own pool rather than in the
+	// workers that clean them.
+	DecodeWorkers int
+	WriteWorkers  int
+	// ReorderMemory is about how many bytes of pages DecodeWorkers may hold
+	// while they wait for a slower one, DefaultReorderMemory if it's 0.
+	// Past it they're spilled, compressed, to SortOptions.TempDir.
+	ReorderMemory int64
+
+	// AutoWorkers starts with GOMAXPROCS workers instead of the given count
+	// and adjusts it as the run goes, up to MaxWorkers. See tune.
+	AutoWorkers bool
+	MaxWorkers  int
+
+	// JournalFile, if set, is a write-ahead journal of the pages durably
+	// written to OutputFile. With Resume an interrupted run carries on
+	// where the journal says it stopped. See journal.
+	JournalFile string
+	Resume      bool
+
+	// DedupFile, if set, keeps the titles deduplicated against between
+	// runs, so a run over more pieces of a dump skips titles written by the
+	// earlier runs. ExpectedPages, if set, sizes the dedup set up front.
+	// See dedupFile.
+	DedupFile     string
+	ExpectedPages int
+
+	// IDMapFile, if set, gives the pages compact sequential IDs in place of
+	// their MediaWiki IDs, keeping the mapping in this file so pages keep
+	// their IDs in later runs. See idMap.
+	IDMapFile string
+
+	// Provenance, if set, is stamped at the top of each xml output
+	Provenance *Provenance
+
+	// ReportFile, if set, gets the resources the run used as JSON. They're
+	// logged at the end either way. See RunReport.
+	ReportFile string
+
+	// KeepOriginalText keeps the text of each page as it was read along
+	// with the cleaned text, so it can be cleaned again without the dump
+	KeepOriginalText bool
+
+	// PageProvenance keeps how each page was processed with it in the
+	// outputs. See Processing.
+	PageProvenance bool
+
+	// Tracer, if set, exports the time each page spent in each stage
+	Tracer *Tracer
+
+	// Progress, if set, counts the pages through each stage as the run goes
+	Progress *Progress
+
+	// OnPageDecoded, OnPageCleaned and OnPageWritten, if set, are called
+	// with each page as it's read, once it's cleaned and once it's written,
+	// so a program using the package can follow or steer the run. Returning
+	// false from the first two drops the page. A page dropped by
+	// OnPageDecoded still counts when a collision policy other than
+	// CollisionFirst picks which page of a title to keep. OnPageDecoded is called from the reader, the
+	// others from many workers at once.
+	OnPageDecoded func(p *Page) bool
+	OnPageCleaned func(p *Page) bool
+	OnPageWritten func(p *Page)
+
+	// OnPageFailed, if set, is called with the error for each page that's
+	// skipped because it failed: a *DecodeError for those that couldn't be
+	// decoded and a *ProcessError for those that couldn't be cleaned. It's
+	// called from many goroutines at once. The errors that stop the run are
+	// panics, with these types and *WriteError where they apply.
+	OnPageFailed func(err error)
+
+	// Pool, if set, is shared with other Workers and limits how many parse
+	// scripts run at once between them
+	Pool *Pool
+
+	// Extract skips all of the processing, so the pages reach the sinks as
+	// they were read. See CacheSink.
+	Extract bool
+
+	// Raw copies the pages of dumps to the xml outputs byte for byte, once
+	// they've been filtered, deduplicated and sharded, without decoding or
+	// cleaning them. The sinks and the reports made while reading don't
+	// get them. Pages from page caches are written as they were read.
+	Raw bool
+
+	// Sinks also receive every processed page. Without an OutputFile they
+	// are the only output.
+	Sinks []Sink
+
 	workerCount int
 	wg          *sync.WaitGroup
+	writers     *sync.WaitGroup
+	checksums   *checksums
+	geo         *geoIndex
+	phonetic    *phoneticIndex
+	splitOut    []chan []byte
+	filterTags  *tsvFile
+	sinkIn      []chan *Page
+	deadLetter  chan []byte
+	cleanCache  *cleanCache
+	tuner       *tuner
+	journal     *journal
+	winners     map[string]int
+	templates   *CacheSink
+	ids         *idMap
+	dedup       *dedupFile
+	order       *sequencer
+	watchdog    *watchdog
+	skips       *skipLog
+	skipList    *skipList
+	// interpreters caches scriptInterpreter
+	interpreters sync.Map
+	read         readStats
+
+	toWrite      chan *queuedPage
+	writeWorkers *sync.WaitGroup
+
+	slow       chan *slowPage
+	slowLane   *sync.WaitGroup
+	slowReport *tsvFile
+	slowMu     sync.Mutex
+	slowIDs    []string
+
+	// fatalErr is the first error that stopped the run, and stopping is set
+	// once there is one. See fatal.
+	fatalMu  sync.Mutex
+	fatalErr error
+	stopping int32
+
+	mapped   map[string][]byte
+	mappedMu sync.Mutex
+
+	lintReport    *tsvFile
+	diagnostics   *tsvFile
+	imageManifest *tsvFile
+	extensionTags *extensionTags
+	nearDups      *nearDupIndex
+	nearDupReport *tsvFile
 }
 
 // NewWorker returns a new worker
 func NewWorker(inputFile, outputFile, parseScript string, workerCount int) *Worker {
 	return &Worker{
-		InPage:      make(chan *Page, 0),
-		OutText:     make(chan []byte, 0),
-		OutputFile:  outputFile,
-		InputFile:   inputFile,
-		ParseScript: parseScript,
-		workerCount: workerCount,
-		wg:          &sync.WaitGroup{},
+		InPage:          make(chan *Page, 0),
+		OutText:         make(chan []byte, 0),
+		OutDisambig:     make(chan []byte, 0),
+		OutputFile:      outputFile,
+		InputFile:       inputFile,
+		ParseScript:     parseScript,
+		DisambigPolicy:  DisambigInclude,
+		ModelPolicy:     ModelPassthrough,
+		CollisionPolicy: CollisionFirst,
+		FilterAction:    FilterTag,
+		Encoding:        EncodingReplace,
+		Indent:          2,
+		ReadAhead:       4,
+		StallPolicy:     StallAbort,
+		GalleryPolicy:   GalleryKeep,
+		workerCount:     workerCount,
+		wg:              &sync.WaitGroup{},
+		writers:         &sync.WaitGroup{},
+		writeWorkers:    &sync.WaitGroup{},
+		slowLane:        &sync.WaitGroup{},
 	}
 }
 
-// Start the main processing.
-func (w *Worker) Start() {
+// Start the main processing. It returns the first error that stopped the
+// run, a DecodeError or WriteError, once the pages already read have been
+// through the pipeline.
+func (w *Worker) Start() error {
+	start := time.Now()
+	var startMem runtime.MemStats
+	runtime.ReadMemStats(&startMem)
+	if w.Progress == nil {
+		// The watchdog, the writers and the report at the end go by the
+		// progress counts
+		w.Progress = &Progress{}
+	}
+
+	if w.JournalFile != "" {
+		var err error
+		w.journal, err = openJournal(w.JournalFile, w.OutputFile, w.Resume)
+		if err != nil {
+			panic(err)
+		}
+		if w.journal.complete {
+			log.Printf("%s is already complete", w.OutputFile)
+			return nil
+		}
+	}
+
+	if w.CleanCacheDir != "" {
+		var err error
+		if w.CleanService != nil {
+			// The service's output is only known by its URL
+			w.cleanCache, err = newCleanCache(w.CleanCacheDir, "", []string{w.CleanService.URL})
+		} else {
+			w.cleanCache, err = newCleanCache(w.CleanCacheDir, w.ParseScript, w.scriptInvocation())
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if w.Deterministic {
+		w.order = newSequencer()
+	}
+
+	if w.NearDupDistance > 0 {
+		w.nearDups = newNearDupIndex(w.NearDupDistance)
+	}
+	if w.NearDupFile != "" {
+		var err error
+		w.nearDupReport, err = createTSV(w.NearDupFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if w.FilterTagFile != "" {
+		var err error
+		w.filterTags, err = createTSV(w.FilterTagFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if w.LintFile != "" {
+		var err error
+		w.lintReport, err = createTSV(w.LintFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if w.DiagnosticsFile != "" {
+		var err error
+		w.diagnostics, err = createTSV(w.DiagnosticsFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if w.ImageManifestFile != "" {
+		var err error
+		w.imageManifest, err = createTSV(w.ImageManifestFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	policies := make(map[string]string)
+	if w.Config != nil {
+		for tag, policy := range w.Config.ExtensionTags {
+			policies[tag] = policy
+		}
+	}
+	for tag, policy := range w.ExtensionTags {
+		policies[tag] = policy
+	}
+	if len(policies) > 0 {
+		var err error
+		w.extensionTags, err = compileExtensionTags(policies)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if w.AutoWorkers {
+		w.workerCount = runtime.GOMAXPROCS(0)
+		if w.MaxWorkers < w.workerCount {
+			w.MaxWorkers = w.workerCount
+		}
+		w.tuner = newTuner(w.MaxWorkers)
+	}
 	for i := 1; i <= w.workerCount; i++ {
 		log.Println("starting worker:", i)
-		go w.startWorker()
+		w.addWorker()
+	}
+	if w.tuner != nil {
+		go w.tune()
+	}
+	if w.WriteWorkers > 0 {
+		w.toWrite = make(chan *queuedPage, w.WriteWorkers)
+		for i := 0; i < w.WriteWorkers; i++ {
+			w.writeWorkers.Add(1)
+			go w.startWriteWorker()
+		}
 	}
 
-	go w.startWriter()
+	if w.ChecksumFile != "" {
+		w.checksums = newChecksums()
+	}
+	if w.GeoIndexFile != "" {
+		w.geo = &geoIndex{}
+	}
+	if w.PhoneticIndexFile != "" {
+		w.phonetic = &phoneticIndex{}
+	}
+
+	if len(w.Split) > 0 {
+		for _, split := range w.Split {
+			out := make(chan []byte, 0)
+			w.splitOut = append(w.splitOut, out)
+			w.writers.Add(1)
+			go w.startWriter(splitPath(w.OutputFile, split.Name), "", out)
+		}
+	} else if w.Partition != nil {
+		for _, name := range w.Partition.Names() {
+			out := make(chan []byte, 0)
+			w.splitOut = append(w.splitOut, out)
+			index := ""
+			if w.IndexFile != "" {
+				index = splitPath(w.IndexFile, name)
+			}
+			w.writers.Add(1)
+			go w.startWriter(splitPath(w.OutputFile, name), index, out)
+		}
+	} else if w.OutputFile != "" && w.SortByTitle {
+		// Sorted once it's all written, see sortOutput
+		w.writers.Add(1)
+		go w.startWriter(unsortedPath(w.OutputFile), "", w.OutText)
+	} else if w.OutputFile != "" {
+		w.writers.Add(1)
+		go w.startWriter(w.OutputFile, w.IndexFile, w.OutText)
+	}
+	for _, s := range w.Sinks {
+		in := make(chan *Page, 0)
+		w.sinkIn = append(w.sinkIn, in)
+		w.writers.Add(1)
+		go w.startSink(s, in)
+	}
+	if w.DisambigPolicy == DisambigSeparate {
+		w.writers.Add(1)
+		go w.startWriter(w.DisambigFile, "", w.OutDisambig)
+	}
+	if w.DeadLetterFile != "" {
+		w.deadLetter = make(chan []byte, 0)
+		w.writers.Add(1)
+		go w.startWriter(w.DeadLetterFile, "", w.deadLetter)
+	}
+	if w.WatchDir == "" {
+		inputs := w.InputFiles
+		if len(inputs) == 0 {
+			inputs = []string{w.InputFile}
+		}
+		w.Progress.setInputs(inputs)
+	}
+	if w.SlowThreshold > 0 {
+		if err := w.startSlowLane(); err != nil {
+			panic(err)
+		}
+	}
+	if w.StallTimeout > 0 {
+		w.watchdog = w.startWatchdog()
+	}
+	if !w.LogSkips {
+		w.skips = startSkipLog()
+	}
+	if w.SkipListFile != "" {
+		var err error
+		w.skipList, err = openSkipList(w.SkipListFile, w.RetrySkipList)
+		if err != nil {
+			panic(err)
+		}
+	}
 	w.startReader()
 
-	// Let the workers finish, then exit
+	// Let the workers finish, then the writers, then exit
 	w.wg.Wait()
+	if w.slow != nil {
+		close(w.slow)
+		w.slowLane.Wait()
+		w.reportSlow()
+	}
+	if w.toWrite != nil {
+		close(w.toWrite)
+		w.writeWorkers.Wait()
+	}
+	if w.filterTags != nil {
+		if err := w.filterTags.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.nearDupReport != nil {
+		if err := w.nearDupReport.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.lintReport != nil {
+		if err := w.lintReport.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.diagnostics != nil {
+		if err := w.diagnostics.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.imageManifest != nil {
+		if err := w.imageManifest.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.cleanCache != nil {
+		log.Printf("clean cache: %d hits, %d misses", w.cleanCache.hits, w.cleanCache.misses)
+	}
 	close(w.OutText)
+	close(w.OutDisambig)
+	for _, out := range w.splitOut {
+		close(out)
+	}
+	for _, in := range w.sinkIn {
+		close(in)
+	}
+	if w.deadLetter != nil {
+		close(w.deadLetter)
+	}
+	w.writers.Wait()
+	w.watchdog.close()
+	w.skips.close()
+	if w.skipList != nil {
+		if err := w.skipList.Close(); err != nil {
+			panic(err)
+		}
+	}
+	w.unmapInputs()
+	if w.Tracer != nil {
+		w.Tracer.Close()
+	}
+	// What was written is incomplete, so it isn't sorted or summed
+	if err := w.fatalError(); err != nil {
+		w.report(start, &startMem)
+		return err
+	}
+
+	if w.SortByTitle && w.OutputFile != "" {
+		if err := w.sortOutput(); err != nil {
+			panic(err)
+		}
+	}
+
+	if w.SortedIndexFile != "" {
+		if err := SortIndex(w.IndexFile, w.SortedIndexFile, w.SearchKeys, w.SortOptions); err != nil {
+			panic(err)
+		}
+	}
+	if w.checksums != nil {
+		if err := w.checksums.write(w.ChecksumFile); err != nil {
+			panic(err)
+		}
+	}
+	if w.geo != nil {
+		if err := w.geo.write(w.GeoIndexFile); err != nil {
+			panic(err)
+		}
+	}
+	if w.phonetic != nil {
+		if err := w.phonetic.write(w.PhoneticIndexFile); err != nil {
+			panic(err)
+		}
+	}
+	w.report(start, &startMem)
+	return nil
+}
+
+// readStats counts what happened to the pages of one input file
+type readStats struct {
+	pages      int
+	duplicates int
+	skipped    int
+}
+
+// Read returns how many pages were read from the inputs, and how many of
+// those were duplicates or skipped, once Start has returned.
+func (w *Worker) Read() (pages, duplicates, skipped int) {
+	return w.read.pages, w.read.duplicates, w.read.skipped
 }
 
-// read will iterate through the XML file
+// read will iterate through the XML files
 func (w *Worker) startReader() {
-	dump, err := os.Open(w.InputFile)
+	var err error
+	var categories *tsvFile
+	if w.CategoryFile != "" {
+		categories, err = createTSV(w.CategoryFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var links *tsvFile
+	if w.LinkFile != "" {
+		links, err = createTSV(w.LinkFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var collisions *tsvFile
+	if w.CollisionFile != "" {
+		collisions, err = createTSV(w.CollisionFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if w.CollisionPolicy != CollisionFirst || collisions != nil {
+		w.winners = w.collisionWinners()
+	}
+	if w.TemplateFile != "" {
+		w.templates, err = NewCacheSink(w.TemplateFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if w.FollowRedirects && w.LinkResolver == nil {
+		w.LinkResolver = w.collectRedirects()
+	}
+	if w.IDMapFile != "" {
+		w.ids, err = openIDMap(w.IDMapFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Titles are tracked across all of the inputs, so the pieces of a split
+	// dump are deduplicated together. Each counts the pages read with it.
+	seen := make(map[string]int, w.ExpectedPages)
+	if w.DedupFile != "" {
+		w.dedup, err = openDedupFile(w.DedupFile, w.InputFiles, seen)
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("dedup file %s: %d titles from earlier runs", w.DedupFile, w.dedup.loaded)
+	}
+
+	var total readStats
+	count := 0
+	for input := range w.inputs() {
+		count++
+		log.Println("reading input:", input)
+		stats := w.readInput(input, seen, categories, links, collisions)
+		log.Printf("input %s: %d pages, %d duplicates, %d skipped", input, stats.pages, stats.duplicates, stats.skipped)
+		if w.stopped() {
+			break
+		}
+		if w.dedup != nil {
+			if err := w.dedup.inputDone(input); err != nil {
+				panic(err)
+			}
+		}
+		log.Printf("dedup set: %d titles, about %.1f MiB", len(seen), float64(dedupFootprint(seen))/(1<<20))
+
+		total.pages += stats.pages
+		total.duplicates += stats.duplicates
+		total.skipped += stats.skipped
+	}
+	w.read = total
+	if w.dedup != nil {
+		if err := w.dedup.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if count > 1 {
+		log.Printf("all %d inputs: %d pages, %d duplicates, %d skipped", count, total.pages, total.duplicates, total.skipped)
+	}
+
+	if categories != nil {
+		if err := categories.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if links != nil {
+		if err := links.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if collisions != nil {
+		if err := collisions.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.templates != nil {
+		if err := w.templates.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if w.ids != nil {
+		if err := w.ids.Close(); err != nil {
+			panic(err)
+		}
+	}
+
+	// Close the channels associated with reading/writing
+	w.closeInput()
+	log.Println("Reader done")
+}
+
+// readInput sends all of the pages of a single input file to the workers.
+// The input is either a dump or a page cache written by CacheSink.
+func (w *Worker) readInput(input string, seen map[string]int, categories, links, collisions *tsvFile) readStats {
+	var stats readStats
+	dump, err := w.open(input)
 	if err != nil {
-		panic(err)
+		w.fatal(&DecodeError{Input: input, Err: err})
+		return stats
+	}
+	defer dump.Close()
+
+	r := bufio.NewReader(dump)
+	if isCache(r) {
+		err := readCache(r, func(p *Page) {
+			w.Tracer.startPage(p, time.Now())
+			w.readPage(p, seen, &stats, categories, links, collisions)
+		})
+		if err != nil {
+			w.fatal(&DecodeError{Input: input, Err: err})
+		}
+		return stats
+	}
+	if err := checkDump(input, r); err != nil {
+		w.fatal(&DecodeError{Input: input, Err: err})
+		return stats
 	}
 
-	decoder := xml.NewDecoder(dump)
+	if w.Raw {
+		w.copyRaw(w.newScanner(dump, r), seen, &stats, collisions)
+		return stats
+	}
 
-	for {
-		t, _ := decoder.Token()
-		if t == nil {
+	if w.DecodeWorkers > 1 || w.filtering() {
+		s := w.newScanner(dump, r)
+		err := w.decodeParallel(input, s, func(p *Page) {
+			w.readPage(p, seen, &stats, categories, links, collisions)
+		}, func(title, reason string) {
+			stats.pages++
+			stats.skipped++
+			w.skips.skip(title, reason)
+		})
+		if err != nil {
+			w.fatal(&DecodeError{Input: input, Offset: s.Offset(), Err: err})
+		}
+		return stats
+	}
+
+	decoder := xml.NewDecoder(newEncodingReader(r, w.Encoding))
+
+	for !w.stopped() {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A truncated dump still gives the pages before the error, but
+			// one that can't be read at all is an error, as is a download
+			// that failed
+			var re *remoteReadError
+			if stats.pages == 0 || errors.As(err, &re) {
+				w.fatal(&DecodeError{Input: input, Offset: decoder.InputOffset(), Err: err})
+				break
+			}
+			log.Printf("input %s: stopped reading after %d pages: %v", input, stats.pages, err)
 			break
 		}
 
@@ -154,121 +1025,626 @@ func (w *Worker) startReader() {
 		case xml.StartElement:
 			if se.Name.Local == "page" {
 				var p Page
+				start := time.Now()
 				decoder.DecodeElement(&p, &se)
+				w.Tracer.startPage(&p, start)
+				w.readPage(&p, seen, &stats, categories, links, collisions)
+			}
+		}
+	}
 
-				found := find(seen, p.Title)
-				if found {
-					log.Printf("Duplicate title: %s. Skipping...", p.Title)
-					continue
-				}
+	return stats
+}
 
-				w.InPage <- &p
-			}
+// readPage filters a page that was just read and sends it on to the workers
+func (w *Worker) readPage(p *Page, seen map[string]int, stats *readStats, categories, links, collisions *tsvFile) {
+	stats.pages++
+
+	if w.OnPageDecoded != nil && !w.OnPageDecoded(p) {
+		// The collision pre-scan doesn't call the hook, so the page still
+		// counts as an occurrence of a title the policy picks a page for
+		// by comparing them. The first page is whichever the hook kept.
+		if _, collided := w.winners[p.Title]; collided && w.CollisionPolicy != CollisionFirst && w.keepDecoded(p) {
+			seen[p.Title]++
 		}
+		stats.skipped++
+		return
 	}
 
-	// Close the channels associated with reading/writing
-	close(w.InPage)
-	log.Println("Reader done")
+	if reason := w.decodedSkip(p); reason != "" {
+		stats.skipped++
+		w.skips.skip(p.Title, reason)
+		return
+	}
+
+	n := seen[p.Title]
+	seen[p.Title]++
+	if n == 0 && w.dedup != nil {
+		w.dedup.add(p.Title)
+	}
+	if !w.keepTitle(p, n, collisions) {
+		w.skips.skip(p.Title, skipDuplicate)
+		stats.duplicates++
+		return
+	}
+
+	if w.templates != nil && isTemplateSource(p) {
+		if err := w.templates.WritePage(p); err != nil {
+			w.fatal(&WriteError{Output: w.TemplateFile, Title: p.Title, Err: err})
+			return
+		}
+	}
+
+	written := p.ID
+	if w.ids != nil {
+		written, _ = w.ids.lookup(p.ID)
+	}
+	if w.journal != nil && w.journal.done[written] {
+		// Written before the run was interrupted
+		stats.skipped++
+		return
+	}
+
+	if w.Project != nil && !w.Project.prepare(p) {
+		stats.skipped++
+		return
+	}
+
+	if w.DisambigPolicy == DisambigExclude && IsDisambiguation(p) {
+		w.skips.skip(p.Title, skipDisambig)
+		stats.skipped++
+		return
+	}
+
+	// Only the pages that get this far are numbered
+	if w.ids != nil {
+		id, err := w.ids.assign(p.ID)
+		if err != nil {
+			w.fatal(&WriteError{Output: w.IDMapFile, Title: p.Title, Err: err})
+			return
+		}
+		p.dumpID = p.ID
+		p.ID = id
+	}
+
+	if categories != nil && !IsRedirect(p) {
+		if err := writeCategoryEdges(categories, p); err != nil {
+			w.fatal(&WriteError{Output: w.CategoryFile, Title: p.Title, Err: err})
+			return
+		}
+	}
+
+	if links != nil && !IsRedirect(p) {
+		if err := writeLinkEdges(links, p, w.LinkAnchors); err != nil {
+			w.fatal(&WriteError{Output: w.LinkFile, Title: p.Title, Err: err})
+			return
+		}
+	}
+
+	w.Progress.add(progressSent, 1)
+	w.order.number(p)
+	w.sendPage(p)
 }
 
-// startWriter will start the new xml writer
-func (w *Worker) startWriter() {
-	f, err := os.Create(w.OutputFile)
+// startWriter will start a new xml writer for the given file, writing
+// everything that arrives on the channel. The offset of each page goes to
+// indexPath, if it's set.
+func (w *Worker) startWriter(path, indexPath string, in chan []byte) {
+	defer w.writers.Done()
+
+	var f io.WriteCloser
+	var index *tsvFile
+	// fail stops the run, draining the pages still coming so the workers
+	// sending them don't block
+	fail := func(output, title string, err error) {
+		w.fatal(&WriteError{Output: output, Title: title, Err: err})
+		for range in {
+		}
+		if f != nil {
+			f.Close()
+		}
+		if index != nil {
+			index.Close()
+		}
+	}
+
+	var journaled *os.File
+	var err error
+	if w.journal != nil && path == w.OutputFile {
+		journaled, err = w.openJournaled(path)
+		if journaled != nil {
+			f = journaled
+		}
+	} else {
+		f, err = createOutput(path)
+	}
 	if err != nil {
-		panic(err)
+		fail(path, "", err)
+		return
+	}
+
+	if indexPath != "" {
+		index, err = createTSV(indexPath)
+		if err != nil {
+			fail(indexPath, "", err)
+			return
+		}
 	}
-	defer f.Close()
 
-	// Write the header
-	_, err = f.Write(head)
+	var dst io.Writer = &progressWriter{Writer: f, p: w.Progress}
+	var h hash.Hash
+	if w.checksums != nil {
+		h = sha256.New()
+		dst = io.MultiWriter(dst, h)
+	}
+	doc := newDocWriter(dst, w.indent())
+	doc.provenance = w.Provenance
+
+	// Write the header, unless we're resuming after it
+	if journaled != nil && w.journal.offset > 0 {
+		err = doc.resume(w.journal.offset)
+	} else {
+		err = doc.head()
+	}
 	if err != nil {
-		panic(err)
+		fail(path, "", err)
+		return
+	}
+	if journaled != nil && w.journal.offset == 0 {
+		if err := doc.flush(); err != nil {
+			fail(path, "", err)
+			return
+		}
+		if err := w.journal.head(journaled, doc.offset); err != nil {
+			fail(w.JournalFile, "", err)
+			return
+		}
 	}
 
 	// Write all of the incoming pages, when the channel closes will exit
-	for text := range w.OutText {
-		// Remove HTML carriage return added as a product of xml marshing
-		text := strings.Replace(string(text), "&#xA;", "", -1)
-
-		// Write a newline
-		_, err := f.Write([]byte("\n"))
+	for page := range in {
+		offset, err := doc.page(page)
 		if err != nil {
-			panic(err)
+			fail(path, string(elementText(page, "title")), err)
+			return
+		}
+		if journaled != nil {
+			// The journal can only record what's in the file
+			if err := doc.flush(); err != nil {
+				fail(path, string(elementText(page, "title")), err)
+				return
+			}
+			if err := w.journal.page(journaled, pageID(page), page); err != nil {
+				fail(w.JournalFile, string(elementText(page, "title")), err)
+				return
+			}
+		}
+		if index != nil {
+			if err := writeIndexEntry(index, page, offset); err != nil {
+				fail(indexPath, string(elementText(page, "title")), err)
+				return
+			}
 		}
 
-		// Write the article body
-		_, err = f.Write([]byte(text))
-		if err != nil {
-			panic(err)
+		if w.checksums != nil {
+			w.checksums.addPage(page)
+		}
+	}
+
+	// Lastly, close up the document
+	if err := doc.end(); err != nil {
+		fail(path, "", err)
+		return
+	}
+	if journaled != nil {
+		if err := w.journal.end(journaled, doc.offset); err != nil {
+			fail(w.JournalFile, "", err)
+			return
 		}
 	}
 
-	// Lastly, close up the file with the final </page> tag
-	_, err = f.Write([]byte(`</page>`))
+	// Remote uploads only complete on close, so check it
+	err = f.Close()
+	f = nil
 	if err != nil {
-		panic(err)
+		fail(path, "", err)
+		return
+	}
+	if index != nil {
+		err = index.Close()
+		index = nil
+		if err != nil {
+			fail(indexPath, "", err)
+			return
+		}
+	}
+
+	if h != nil {
+		w.checksums.addFile(path, h.Sum(nil))
+	}
+
+	if w.Strict {
+		if err := checkDocument(path); err != nil {
+			w.fatal(&WriteError{Output: path, Err: fmt.Errorf("strict: %v", err)})
+			return
+		}
 	}
 
 	log.Println("Writer done")
 }
 
-// find is a helper function for searching a slice of strings
-func find(slice []string, val string) bool {
-	for _, p := range slice {
-		if p == val {
-			return true
-		}
+// output picks the channel a processed page is written to
+func (w *Worker) output(p *Page) chan []byte {
+	if w.DisambigPolicy == DisambigSeparate && IsDisambiguation(p) {
+		return w.OutDisambig
+	}
+	if w.Partition != nil {
+		return w.splitOut[w.Partition.index(p.Title)]
+	}
+	if len(w.splitOut) > 0 {
+		return w.splitOut[splitIndex(w.Split, p.ID)]
 	}
-	return false
+	if w.OutputFile == "" {
+		// Only writing to sinks
+		return nil
+	}
+	return w.OutText
 }
 
 // startWorker will start an individual XML worker
 func (w *Worker) startWorker() {
-	w.wg.Add(1)
 	defer w.wg.Done()
 
-	for p := range w.InPage {
+	for {
+		p, ok := w.nextPage()
+		if !ok {
+			break
+		}
 		log.Println("processing title: ", p.Title)
 
-		// Skip redirect titles, which have no text that needs parsing
-		if strings.HasPrefix(p.Revision.Text.Text, "#REDIRECT") {
-			output, err := xml.Marshal(p)
-			if err != nil {
-				panic(err)
+		out := w.output(p)
+		if w.PageProvenance {
+			p.Processing = &Processing{}
+		}
+		if w.KeepOriginalText {
+			original := p.Revision.Text
+			p.OriginalText = &original
+		}
+
+		// Extracted pages are kept as they are, redirects have no text that
+		// needs parsing, and text that isn't wikitext would be mangled
+		if w.Extract || w.Raw || IsRedirect(p) || !IsWikitext(p) {
+			w.Progress.add(progressCleaned, 1)
+			w.takeTurn(p)
+			if w.OnPageCleaned != nil && !w.OnPageCleaned(p) {
+				w.Progress.add(progressDropped, 1)
+				w.order.done(p)
+				continue
 			}
-			w.OutText <- output
+			w.write(out, p, false)
 			continue
 		}
 
-		// We will temporarily swap the URL link symbols so we don't parse that
-		p.Revision.Text.Text = strings.ReplaceAll(p.Revision.Text.Text, "[[", `<SPEC_START>`)
-		p.Revision.Text.Text = strings.ReplaceAll(p.Revision.Text.Text, `]]`, `<SPEC_END>`)
+		p.Categories = Categories(p.Revision.Text.Text)
+		p.ShortDescription = ShortDescription(p.Revision.Text.Text)
+		p.Coordinates = PageCoordinates(p.Revision.Text.Text)
+		p.Biography = PageBiography(p.Revision.Text.Text)
+		if w.Project != nil && w.Project.Dictionary && p.Ns == "0" {
+			p.Dictionary = DictionaryEntries(p.Title, p.Revision.Text.Text)
+		}
+		if w.imageManifest != nil || w.GalleryPolicy != GalleryKeep {
+			policy := w.GalleryPolicy
+			if w.Config.Transform(p.Ns) != TransformClean {
+				policy = GalleryKeep
+			}
+			text, media := Galleries(p.Revision.Text.Text, policy)
+			if text != p.Revision.Text.Text {
+				p.applied("gallery")
+			}
+			p.Revision.Text.Text, p.media = text, media
+		}
+		if w.extensionTags != nil && w.Config.Transform(p.Ns) == TransformClean {
+			text := w.extensionTags.apply(p.Revision.Text.Text)
+			if text != p.Revision.Text.Text {
+				p.applied("extension-tags")
+			}
+			p.Revision.Text.Text = text
+		}
+
+		script := w.ParseScript
+		if w.lintReport != nil || w.LintScript != "" {
+			if problems := Lint(p.Revision.Text.Text); len(problems) > 0 {
+				p.lint = problems
+				if w.LintScript != "" {
+					script = w.LintScript
+					p.fellBack("lint-script")
+				}
+			}
+		}
+
+		start := time.Now()
+		switch w.Config.Transform(p.Ns) {
+		case TransformRaw:
+			// Nothing to do, the text is kept as-is
+		case TransformCategories:
+			p.Revision.Text.Text = categoryText(p.Revision.Text.Text)
+			p.applied("categories")
+		default:
+			diverted, err := w.cleanOrDivert(out, p, script, start)
+			if diverted {
+				continue
+			}
+			w.takeTurn(p)
+			if !w.cleaned(p, err) {
+				continue
+			}
+			w.finishPage(out, p, start)
+			continue
+		}
+		w.takeTurn(p)
+		w.finishPage(out, p, start)
+	}
 
-		cmd := exec.Command(w.ParseScript)
+	log.Println("exiting xml worker")
+}
+
+// cleaned finishes off the text the parse script returned for p. It
+// returns false if the script failed and the page is skipped. The page has
+// to have taken its turn.
+func (w *Worker) cleaned(p *Page, err error) bool {
+	if err != nil {
+		log.Printf("error parsing title %s. Skipping", p.Title)
+		var pe *ProcessError
+		if errors.As(err, &pe) && pe.Stderr != "" {
+			w.diagnose(p, "failed", pe.Stderr)
+		}
+		w.failed(err)
+		w.Progress.add(progressFailed, 1)
+		w.deadLetterFailed(p, err)
+		w.skipList.add(p, err)
+		w.Tracer.finish(p, err)
+		w.order.done(p)
+		return false
+	}
+	// The script may hand back bytes that aren't valid XML text
+	p.Revision.Text.Text = FixEncoding(p.Revision.Text.Text, w.Encoding)
+	if w.Config != nil && len(w.Config.Redactions) > 0 {
+		text, title := w.Config.Redact(RedactText, p.Revision.Text.Text), w.Config.Redact(RedactTitle, p.Title)
+		if text != p.Revision.Text.Text || title != p.Title {
+			p.applied("redact")
+		}
+		p.Revision.Text.Text, p.Title = text, title
+	}
+	if w.Whitespace != nil {
+		normalized := w.Whitespace.Normalize(p.Revision.Text.Text)
+		if normalized != p.Revision.Text.Text {
+			p.applied("whitespace")
+		}
+		p.Revision.Text.Text = normalized
+	}
+	if w.FollowRedirects {
+		p.Revision.Text.Text = ResolveLinks(p.Revision.Text.Text, w.LinkResolver)
+		p.applied("resolve-links")
+	}
+	return true
+}
 
-		var b bytes.Buffer
-		b.Write([]byte(p.Revision.Text.Text))
+// finishPage runs the steps after cleaning that started at start, and
+// writes the page if it's kept. The page has to have taken its turn.
+func (w *Worker) finishPage(out chan []byte, p *Page, start time.Time) {
+	p.trace.span(SpanClean, start)
+	w.Progress.add(progressCleaned, 1)
 
-		cmd.Stdin = &b
+	if w.OnPageCleaned != nil && !w.OnPageCleaned(p) {
+		w.Progress.add(progressDropped, 1)
+		w.order.done(p)
+		return
+	}
 
-		clean, err := cmd.CombinedOutput()
+	if w.nearDups != nil && !w.checkNearDup(p) {
+		w.skips.skip(p.Title, skipNearDup)
+		w.Progress.add(progressDropped, 1)
+		w.order.done(p)
+		return
+	}
+
+	if w.ContentFilter != nil && !w.filterContent(p) {
+		w.Progress.add(progressDropped, 1)
+		w.order.done(p)
+		return
+	}
+
+	if w.HTMLSanitizer != nil {
+		sanitized := w.HTMLSanitizer.Sanitize(p.Revision.Text.Text)
+		if sanitized != p.Revision.Text.Text {
+			p.applied("sanitize-html")
+		}
+		p.Revision.Text.Text = sanitized
+	}
+	if w.MaxArticleBytes > 0 {
+		summary := Summarize(p.Revision.Text.Text, w.MaxArticleBytes, w.SectionParagraphs)
+		if len(summary) != len(p.Revision.Text.Text) {
+			p.applied("summarize")
+		}
+		p.Revision.Text.Text = summary
+	}
+	if p.Processing != nil && !w.Deterministic {
+		p.Processing.Millis = time.Since(start).Milliseconds()
+	}
+
+	if w.geo != nil && p.Coordinates != nil {
+		w.geo.add(p)
+	}
+	if w.phonetic != nil {
+		w.phonetic.add(p)
+	}
+	w.write(out, p, true)
+}
+
+// indent returns the indentation of each level of the xml output.
+func (w *Worker) indent() string {
+	return strings.Repeat(" ", w.Indent)
+}
+
+// drop counts a page that won't be written and lets the pages after it
+// take their turn.
+func (w *Worker) drop(p *Page, err error) {
+	w.Progress.add(progressDropped, 1)
+	w.Tracer.finish(p, err)
+	w.order.done(p)
+}
+
+// emit sends a processed page to its xml output, if there is one, and to
+// all of the sinks
+func (w *Worker) emit(out chan []byte, p *Page, indent bool) {
+	if w.StripContributors != "" {
+		w.stripContributor(p)
+	}
+
+	if w.Fields != nil {
+		p = w.Fields.apply(p)
+	}
+	written := p
+	if w.Strict {
+		written = exportOnly(p)
+	}
+	var v interface{} = written
+	if w.Fields != nil {
+		v = w.Fields.marshaled(written)
+	}
+
+	var output []byte
+	if out != nil {
+		var err error
+		start := time.Now()
+		if indent && w.Indent > 0 {
+			output, err = xml.MarshalIndent(v, w.indent(), w.indent())
+		} else {
+			output, err = xml.Marshal(v)
+		}
 		if err != nil {
-			log.Printf("error parsing title %s. Skipping", p.Title)
-			continue
+			w.fatal(&WriteError{Output: w.OutputFile, Title: p.Title, Err: err})
+			w.drop(p, err)
+			return
+		}
+		p.trace.span(SpanMarshal, start)
+
+		if w.Strict {
+			if err := ValidatePage(output); err != nil {
+				if w.deadLetter == nil {
+					w.fatal(&WriteError{Output: w.OutputFile, Title: p.Title, Err: fmt.Errorf("strict: page %s doesn't conform: %v", p.ID, err)})
+					w.drop(p, err)
+					return
+				}
+				log.Printf("Nonconforming page: %s. Dead-lettering: %v", p.Title, err)
+				w.deadLetter <- deadLetterPage(output, "strict", err)
+				w.drop(p, err)
+				return
+			}
+		}
+	}
+
+	start := time.Now()
+	if out != nil {
+		out <- output
+	}
+	for _, in := range w.sinkIn {
+		in <- p
+	}
+	w.order.done(p)
+	p.trace.span(SpanWrite, start)
+	w.Progress.add(progressWritten, 1)
+	if w.OnPageWritten != nil {
+		w.OnPageWritten(p)
+	}
+	w.Tracer.finish(p, nil)
+}
+
+// clean runs the page text through the parse script, or another script
+// such as LintScript. Only the parse script's output is cached.
+func (w *Worker) clean(p *Page, script string) error {
+	cache := w.cleanCache
+	if script != w.ParseScript {
+		cache = nil
+	}
+
+	var key string
+	if cache != nil {
+		key = cleanKey(p)
+		if text, ok := cache.get(key); ok {
+			p.Revision.Text.Text = text
+			p.applied("clean-cache")
+			return nil
 		}
+	}
 
-		// Reverse the url text changes
-		new := strings.ReplaceAll(string(clean), `<SPEC_START>`, `[[`)
-		new = strings.ReplaceAll(new, `<SPEC_END>`, `]]`)
-		p.Revision.Text.Text = new
+	// We will temporarily swap the URL link symbols so we don't parse that
+	text := strings.ReplaceAll(p.Revision.Text.Text, "[[", `<SPEC_START>`)
+	text = strings.ReplaceAll(text, `]]`, `<SPEC_END>`)
 
-		output, err := xml.MarshalIndent(p, "  ", "    ")
+	var clean []byte
+	if w.CleanService != nil && script == w.ParseScript {
+		s, err := w.CleanService.clean(p, text)
 		if err != nil {
-			panic(err)
+			return &ProcessError{Title: p.Title, Err: err}
+		}
+		clean = []byte(s)
+		p.applied("clean-url")
+	} else {
+		var err error
+		for attempt := 0; ; attempt++ {
+			clean, err = w.runScript(script, p, text)
+			if err == nil || attempt == w.ScriptRetries {
+				break
+			}
+			log.Printf("%v. Retrying", err)
+			p.fellBack("script-retry")
+		}
+		if err != nil {
+			return err
 		}
-		w.OutText <- output
+		p.applied("clean")
 	}
 
-	log.Println("exiting xml worker")
+	// Reverse the url text changes
+	new := strings.ReplaceAll(string(clean), `<SPEC_START>`, `[[`)
+	new = strings.ReplaceAll(new, `<SPEC_END>`, `]]`)
+	p.Revision.Text.Text = new
+
+	if cache != nil {
+		if err := cache.put(key, new); err != nil {
+			log.Printf("error caching title %s: %v", p.Title, err)
+		}
+	}
+	return nil
+}
+
+// CleanText cleans wikitext on its own, outside of a run, as it would be
+// for a page with the title and namespace: through the parse script or
+// CleanService, fixing its encoding and whitespace and summarizing it past
+// MaxArticleBytes. The worker doesn't need to be started. If it can't be
+// cleaned the error is a *ProcessError.
+func (w *Worker) CleanText(title, ns, text string) (string, error) {
+	p := &Page{Title: title, Ns: ns}
+	p.Revision.Text.Text = text
+	if err := w.clean(p, w.ParseScript); err != nil {
+		return "", err
+	}
+	text = FixEncoding(p.Revision.Text.Text, w.Encoding)
+	text = w.Whitespace.Normalize(text)
+	if w.MaxArticleBytes > 0 {
+		text = Summarize(text, w.MaxArticleBytes, w.SectionParagraphs)
+	}
+	return text, nil
+}
+
+// categoryText reduces the text to just its category links, one per line
+func categoryText(text string) string {
+	var b strings.Builder
+	for _, cat := range Categories(text) {
+		b.WriteString("[[Category:")
+		b.WriteString(cat)
+		b.WriteString("]]\n")
+	}
+	return b.String()
 }